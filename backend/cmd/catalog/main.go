@@ -0,0 +1,188 @@
+// Command catalog maintains the local card catalog used by the server.
+//
+// Usage:
+//
+//	catalog import-bulk <file.json[.gz]>
+//	catalog import-barcodes <file.csv>
+//	catalog hash-images [-limit N]
+//	catalog snapshot-values [-date YYYY-MM-DD]
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/config"
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/scanner"
+	"github.com/abzi/mtg_card_detector/internal/scryfall"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cfg := config.Load()
+	db, err := database.New(cfg.DatabasePath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations(cfg.MigrationsPath); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	scannerService, err := scanner.NewService(db)
+	if err != nil {
+		log.Fatalf("Failed to create scanner service: %v", err)
+	}
+	scannerService.UseScryfall(scryfall.NewClient(scryfall.Options{BaseURL: cfg.ScryfallBaseURL}))
+	if err := scannerService.UseResolvers(cfg.Resolvers); err != nil {
+		log.Fatalf("Invalid CARD_RESOLVERS: %v", err)
+	}
+
+	switch os.Args[1] {
+	case "import-bulk":
+		err = importBulk(scannerService, os.Args[2:])
+	case "import-barcodes":
+		err = importBarcodes(scannerService, os.Args[2:])
+	case "hash-images":
+		err = hashImages(db, scannerService, os.Args[2:])
+	case "snapshot-values":
+		err = snapshotValues(db, os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: catalog <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "commands:")
+	fmt.Fprintln(os.Stderr, "  import-bulk      import a Scryfall default_cards/all_cards bulk data file")
+	fmt.Fprintln(os.Stderr, "  import-barcodes  import barcode mappings from CSV")
+	fmt.Fprintln(os.Stderr, "  hash-images      download card images and build the artwork hash index")
+	fmt.Fprintln(os.Stderr, "  snapshot-values  record today's card prices and inventory values")
+	os.Exit(2)
+}
+
+// importBulk loads a Scryfall bulk data file into the cards table
+func importBulk(scannerService *scanner.Service, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: catalog import-bulk <file.json[.gz]>")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open bulk data file: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReaderSize(f, 1<<20)
+	if strings.HasSuffix(args[0], ".gz") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	start := time.Now()
+	result, err := scannerService.ImportBulkData(r)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Imported bulk data in %s: %d inserted, %d updated, %d unchanged, %d skipped",
+		time.Since(start).Round(time.Second), result.Inserted, result.Updated, result.Unchanged, result.Skipped)
+	return nil
+}
+
+// importBarcodes loads barcode mappings from a CSV file
+func importBarcodes(scannerService *scanner.Service, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: catalog import-barcodes <file.csv>")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open barcode file: %w", err)
+	}
+	defer f.Close()
+
+	result, err := scannerService.ImportBarcodes(f)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Imported barcodes: %d inserted, %d updated, %d skipped", result.Inserted, result.Updated, result.Skipped)
+	return nil
+}
+
+// hashImages indexes the artwork of every catalog card that has not been hashed yet
+func hashImages(db *database.DB, scannerService *scanner.Service, args []string) error {
+	fs := flag.NewFlagSet("hash-images", flag.ExitOnError)
+	limit := fs.Int("limit", 0, "maximum number of cards to hash (0 for all)")
+	fs.Parse(args)
+
+	hashed, failed := 0, 0
+	for *limit == 0 || hashed+failed < *limit {
+		// Cards that failed stay unhashed at the front of the queue, so skip past them
+		cards, err := db.GetCardsWithoutImageHash(100, failed)
+		if err != nil {
+			return err
+		}
+		if len(cards) == 0 {
+			break
+		}
+
+		for i := range cards {
+			if *limit > 0 && hashed+failed >= *limit {
+				break
+			}
+			if err := scannerService.IndexCardImage(&cards[i]); err != nil {
+				log.Printf("Failed to hash %s (%s %s): %v", cards[i].Name, cards[i].SetCode, cards[i].CollectorNumber, err)
+				failed++
+				continue
+			}
+			hashed++
+		}
+	}
+
+	log.Printf("Hashed %d card images (%d failed)", hashed, failed)
+	return nil
+}
+
+// snapshotValues records the day's card prices and inventory values for value
+// history. It is meant to run daily, after importing the day's bulk data.
+func snapshotValues(db *database.DB, args []string) error {
+	fs := flag.NewFlagSet("snapshot-values", flag.ExitOnError)
+	date := fs.String("date", time.Now().UTC().Format(time.DateOnly), "snapshot date (YYYY-MM-DD)")
+	fs.Parse(args)
+
+	if _, err := time.Parse(time.DateOnly, *date); err != nil {
+		return fmt.Errorf("invalid date %q: use YYYY-MM-DD", *date)
+	}
+
+	result, err := db.RecordValueSnapshot(*date)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Recorded value snapshot for %s: %d users, %d card prices", result.Date, result.Users, result.Prices)
+	return nil
+}
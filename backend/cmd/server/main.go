@@ -0,0 +1,103 @@
+// Command server runs the card scanning API and the background scan job
+// runner.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/config"
+	"github.com/abzi/mtg_card_detector/internal/api"
+	"github.com/abzi/mtg_card_detector/internal/auth"
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/inventory"
+	"github.com/abzi/mtg_card_detector/internal/scanner"
+	"github.com/abzi/mtg_card_detector/internal/scryfall"
+)
+
+// shutdownTimeout is how long requests in flight get to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+func main() {
+	cfg := config.Load()
+
+	db, err := database.New(cfg.DatabasePath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.RunMigrations(cfg.MigrationsPath); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	scannerService, err := scanner.NewService(db)
+	if err != nil {
+		log.Fatalf("Failed to create scanner service: %v", err)
+	}
+	scannerService.UseScryfall(scryfall.NewClient(scryfall.Options{BaseURL: cfg.ScryfallBaseURL}))
+	if err := scannerService.UseResolvers(cfg.Resolvers); err != nil {
+		log.Fatalf("Invalid CARD_RESOLVERS: %v", err)
+	}
+	inventoryService := inventory.NewService(db, scannerService)
+	inventoryService.SetIdempotencyTTL(cfg.IdempotencyTTL)
+	authService := auth.NewService(db, cfg.JWTSecret)
+
+	handler := api.NewHandler(authService, inventoryService, scannerService, db)
+	router := api.NewRouter(handler, authService)
+
+	// Jobs the last server left running resume from their first unprocessed scan
+	requeued, err := db.RequeueScanJobs()
+	if err != nil {
+		log.Fatalf("Failed to requeue scan jobs: %v", err)
+	}
+	if requeued > 0 {
+		log.Printf("Resuming %d interrupted scan jobs", requeued)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jobsDone := make(chan error, 1)
+	go func() { jobsDone <- inventoryService.RunJobs(ctx) }()
+
+	// Requests share ctx so open job event streams end on shutdown
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	serveDone := make(chan error, 1)
+	go func() {
+		log.Printf("Server listening on :%s", cfg.Port)
+		serveDone <- server.ListenAndServe()
+	}()
+
+	var failure error
+	select {
+	case <-ctx.Done():
+		log.Printf("Shutting down")
+	case err := <-jobsDone:
+		failure = fmt.Errorf("scan job runner stopped: %w", err)
+	case err := <-serveDone:
+		failure = err
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to shut down cleanly: %v", err)
+	}
+	if failure != nil {
+		log.Fatal(failure)
+	}
+}
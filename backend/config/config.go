@@ -2,21 +2,29 @@ package config
 
 import (
 	"os"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Port           string
-	DatabasePath   string
-	JWTSecret      string
-	MigrationsPath string
+	Port            string
+	DatabasePath    string
+	JWTSecret       string
+	MigrationsPath  string
+	Resolvers       []string
+	ScryfallBaseURL string
+	IdempotencyTTL  time.Duration
 }
 
 func Load() *Config {
 	return &Config{
-		Port:           getEnv("PORT", "8080"),
-		DatabasePath:   getEnv("DATABASE_PATH", "./data/mtg_cards.db"),
-		JWTSecret:      getEnv("JWT_SECRET", "change-this-in-production-to-a-secure-random-secret"),
-		MigrationsPath: getEnv("MIGRATIONS_PATH", "./migrations"),
+		Port:            getEnv("PORT", "8080"),
+		DatabasePath:    getEnv("DATABASE_PATH", "./data/mtg_cards.db"),
+		JWTSecret:       getEnv("JWT_SECRET", "change-this-in-production-to-a-secure-random-secret"),
+		MigrationsPath:  getEnv("MIGRATIONS_PATH", "./migrations"),
+		Resolvers:       strings.Split(getEnv("CARD_RESOLVERS", "barcode,local,fuzzy,image,scryfall"), ","),
+		ScryfallBaseURL: getEnv("SCRYFALL_BASE_URL", "https://api.scryfall.com"),
+		IdempotencyTTL:  getDuration("IDEMPOTENCY_TTL", 24*time.Hour),
 	}
 }
 
@@ -27,3 +35,11 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -1,26 +1,47 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/abzi/mtg_card_detector/internal/auth"
 	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/fuzzy"
 	"github.com/abzi/mtg_card_detector/internal/inventory"
 	"github.com/abzi/mtg_card_detector/internal/middleware"
 	"github.com/abzi/mtg_card_detector/internal/models"
+	"github.com/abzi/mtg_card_detector/internal/scanner"
+	"github.com/go-chi/chi/v5"
 )
 
+// maxImageSize limits uploaded card photos to 10 MB
+const maxImageSize = 10 << 20
+
+// maxImportSize limits uploaded inventory CSV files to 20 MB
+const maxImportSize = 20 << 20
+
 type Handler struct {
 	authService      *auth.Service
 	inventoryService *inventory.Service
+	scannerService   *scanner.Service
 	db               *database.DB
 }
 
-func NewHandler(authService *auth.Service, inventoryService *inventory.Service, db *database.DB) *Handler {
+func NewHandler(authService *auth.Service, inventoryService *inventory.Service, scannerService *scanner.Service, db *database.DB) *Handler {
 	return &Handler{
 		authService:      authService,
 		inventoryService: inventoryService,
+		scannerService:   scannerService,
 		db:               db,
 	}
 }
@@ -64,16 +85,27 @@ func (h *Handler) HandleSingleScan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// An Idempotency-Key header stands in for client_scan_id
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		if req.ClientScanID != "" && req.ClientScanID != key {
+			respondError(w, http.StatusBadRequest, "Idempotency-Key header and client_scan_id differ")
+			return
+		}
+		req.ClientScanID = key
+	}
+
 	result, err := h.inventoryService.ProcessSingleScan(userID, &req)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondScanError(w, err)
 		return
 	}
 
 	respondJSON(w, http.StatusOK, result)
 }
 
-// HandleBulkScan processes multiple card scans
+// HandleBulkScan processes multiple card scans, or with ?async=true queues
+// them as a background job. Atomic requests can't be queued, as jobs record
+// each scan as they go.
 func (h *Handler) HandleBulkScan(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r)
 	if userID == "" {
@@ -91,63 +123,1658 @@ func (h *Handler) HandleBulkScan(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "scans array cannot be empty")
 		return
 	}
+	req.IdempotencyKey = r.Header.Get("Idempotency-Key")
+
+	if r.URL.Query().Get("async") == "true" {
+		if req.Atomic {
+			respondError(w, http.StatusBadRequest, "atomic bulk scans can't be processed asynchronously")
+			return
+		}
+		job, err := h.inventoryService.SubmitBulkScan(userID, &req)
+		if err != nil {
+			respondScanError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusAccepted, job)
+		return
+	}
 
 	result, err := h.inventoryService.ProcessBulkScan(userID, &req)
 	if err != nil {
+		respondScanError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// jobKeepAlive is how often an idle job event stream sends a comment to keep
+// the connection open
+const jobKeepAlive = 15 * time.Second
+
+// jobStartTimeout is how long a job event stream waits for a queued job to
+// start before giving up, so a stream doesn't hang on a job no runner claims
+const jobStartTimeout = 2 * time.Minute
+
+// HandleGetJob reports a scan job's progress and its results, from ?from= on
+// if given
+func (h *Handler) HandleGetJob(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	jobID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid job id")
+		return
+	}
+
+	var from int
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = strconv.Atoi(v); err != nil || from < 0 {
+			respondError(w, http.StatusBadRequest, "invalid from")
+			return
+		}
+	}
+
+	job, err := h.inventoryService.GetJob(userID, jobID, from)
+	if err != nil {
+		respondJobError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, job)
+}
+
+// HandleJobEvents streams a scan job's results as server-sent "result"
+// events as they resolve, then a "done" event with the finished job. Each
+// result's event ID is its position, so a reconnecting client sending
+// Last-Event-ID picks up after the last result it saw.
+func (h *Handler) HandleJobEvents(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	jobID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid job id")
+		return
+	}
+
+	next := 0
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		last, err := strconv.Atoi(v)
+		if err != nil || last < 0 {
+			respondError(w, http.StatusBadRequest, "invalid Last-Event-ID")
+			return
+		}
+		next = last + 1
+	}
+
+	changed, stop, err := h.inventoryService.WatchJob(userID, jobID)
+	if err != nil {
+		respondJobError(w, err)
+		return
+	}
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+
+	keepAlive := time.NewTicker(jobKeepAlive)
+	defer keepAlive.Stop()
+	startBy := time.Now().Add(jobStartTimeout)
+	for {
+		job, err := h.inventoryService.GetJob(userID, jobID, next)
+		if err != nil {
+			writeEvent(w, "", "error", map[string]string{"error": "failed to retrieve job"})
+			rc.Flush()
+			return
+		}
+		if job.StartedAt == nil && time.Now().After(startBy) {
+			writeEvent(w, "", "error", map[string]string{"error": "job has not started"})
+			rc.Flush()
+			return
+		}
+		for _, result := range job.Results {
+			writeEvent(w, strconv.Itoa(result.Position), "result", result)
+			next = result.Position + 1
+		}
+		if job.CompletedAt != nil {
+			job.Results = nil
+			writeEvent(w, "", "done", job)
+			rc.Flush()
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes a server-sent event with a JSON payload, and an ID if
+// id isn't empty
+func writeEvent(w io.Writer, id, event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
+
+// respondJobError maps scan job errors to HTTP statuses
+func respondJobError(w http.ResponseWriter, err error) {
+	if errors.Is(err, inventory.ErrJobNotFound) {
+		respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	respondError(w, http.StatusInternalServerError, "failed to retrieve job")
+}
+
+// respondScanError maps errors from processing scans to HTTP statuses
+func respondScanError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrInvalidAttributes):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, inventory.ErrScanSessionNotFound):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, inventory.ErrSessionCompleted):
+		respondError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, inventory.ErrIdempotencyKeyReused), errors.Is(err, inventory.ErrBulkScanRolledBack):
+		respondError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
 		respondError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// HandleConfirmScan commits a pending scan with the printing the user picked
+func (h *Handler) HandleConfirmScan(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	scanID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid scan id")
+		return
+	}
+
+	var req models.ConfirmScanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.CardID == "" {
+		respondError(w, http.StatusBadRequest, "card_id is required")
+		return
+	}
+
+	result, err := h.inventoryService.ConfirmScan(userID, scanID, req.CardID)
+	if err != nil {
+		switch {
+		case errors.Is(err, inventory.ErrScanNotFound):
+			respondError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, inventory.ErrScanNotPending):
+			respondError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, inventory.ErrNotCandidate):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "failed to confirm scan")
+		}
 		return
 	}
 
 	respondJSON(w, http.StatusOK, result)
 }
 
-// HandleGetInventory retrieves user's inventory
-func (h *Handler) HandleGetInventory(w http.ResponseWriter, r *http.Request) {
+// HandleRecognizeScan identifies a card from a JPEG/PNG photo and adds it to inventory
+func (h *Handler) HandleRecognizeScan(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r)
 	if userID == "" {
 		respondError(w, http.StatusUnauthorized, "user not authenticated")
 		return
 	}
 
-	inventory, err := h.inventoryService.GetInventory(userID)
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageSize)
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("image")
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "image file is required")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	img, _, err := image.Decode(body)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to retrieve inventory")
+		respondError(w, http.StatusBadRequest, "invalid image: must be JPEG or PNG")
+		return
+	}
+
+	var sessionID int
+	if v := r.URL.Query().Get("session_id"); v != "" {
+		if sessionID, err = strconv.Atoi(v); err != nil || sessionID <= 0 {
+			respondError(w, http.StatusBadRequest, "invalid session_id")
+			return
+		}
+	}
+
+	artworkOnly := r.URL.Query().Get("region") == "artwork"
+	result, err := h.inventoryService.ProcessImageScan(userID, img, artworkOnly, copyAttributesFromQuery(r), sessionID)
+	if err != nil {
+		respondScanError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// HandleStartSession opens a scan session for scans to be recorded in
+func (h *Handler) HandleStartSession(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	session, err := h.inventoryService.StartSession(userID)
+	if err != nil {
+		respondSessionError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, session)
+}
+
+// HandleGetSessions lists the user's scan sessions, newest first, optionally
+// only those of ?type=
+func (h *Handler) HandleGetSessions(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	sessions, err := h.inventoryService.GetSessions(userID, r.URL.Query().Get("type"))
+	if err != nil {
+		respondSessionError(w, err)
 		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"inventory": inventory,
-		"count":     len(inventory),
+		"sessions": sessions,
+		"count":    len(sessions),
 	})
 }
 
-// HandleGetCard retrieves card details by ID
-func (h *Handler) HandleGetCard(w http.ResponseWriter, r *http.Request) {
-	cardID := r.URL.Query().Get("id")
-	if cardID == "" {
-		respondError(w, http.StatusBadRequest, "card id is required")
+// HandleGetSession retrieves one of the user's scan sessions
+func (h *Handler) HandleGetSession(w http.ResponseWriter, r *http.Request) {
+	h.handleSession(w, r, func(userID string, sessionID int) (interface{}, error) {
+		return h.inventoryService.GetSession(userID, sessionID)
+	})
+}
+
+// HandleCompleteSession closes one of the user's open scan sessions
+func (h *Handler) HandleCompleteSession(w http.ResponseWriter, r *http.Request) {
+	h.handleSession(w, r, func(userID string, sessionID int) (interface{}, error) {
+		return h.inventoryService.CompleteSession(userID, sessionID)
+	})
+}
+
+// HandleGetSessionCards lists the copies a scan session added to inventory
+func (h *Handler) HandleGetSessionCards(w http.ResponseWriter, r *http.Request) {
+	h.handleSession(w, r, func(userID string, sessionID int) (interface{}, error) {
+		cards, err := h.inventoryService.GetSessionCards(userID, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"cards": cards, "count": len(cards)}, nil
+	})
+}
+
+// HandleGetSessionScans lists the scans recorded in a scan session
+func (h *Handler) HandleGetSessionScans(w http.ResponseWriter, r *http.Request) {
+	h.handleSession(w, r, func(userID string, sessionID int) (interface{}, error) {
+		scans, err := h.inventoryService.GetSessionScans(userID, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"scans": scans, "count": len(scans)}, nil
+	})
+}
+
+// handleSession applies fn to the scan session named in the URL and responds
+// with the result
+func (h *Handler) handleSession(w http.ResponseWriter, r *http.Request, fn func(userID string, sessionID int) (interface{}, error)) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
 		return
 	}
 
-	card, err := h.db.GetCardByID(cardID)
+	sessionID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to retrieve card")
+		respondError(w, http.StatusBadRequest, "invalid session id")
 		return
 	}
 
-	if card == nil {
-		respondError(w, http.StatusNotFound, "card not found")
+	result, err := fn(userID, sessionID)
+	if err != nil {
+		respondSessionError(w, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, card)
+	respondJSON(w, http.StatusOK, result)
 }
 
-// HandleHealthCheck returns API health status
-func (h *Handler) HandleHealthCheck(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, map[string]string{
-		"status": "ok",
-	})
+// respondSessionError maps scan session errors to HTTP statuses
+func respondSessionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrInvalidQuery):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, inventory.ErrScanSessionNotFound):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, inventory.ErrSessionCompleted):
+		respondError(w, http.StatusConflict, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "failed to process scan session")
+	}
+}
+
+// HandleGetInventoryValue totals the market value of the user's inventory.
+// ?currency= is usd (default) or eur and ?top= the number of most valuable
+// entries listed.
+func (h *Handler) HandleGetInventoryValue(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	var top int
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(w, http.StatusBadRequest, "invalid top")
+			return
+		}
+		top = n
+	}
+
+	value, err := h.inventoryService.GetInventoryValue(userID, r.URL.Query().Get("currency"), top)
+	if err != nil {
+		if errors.Is(err, inventory.ErrInvalidCurrency) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "failed to value inventory")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, value)
+}
+
+// HandleGetValueHistory returns the user's daily inventory value between
+// ?from= and ?to= (YYYY-MM-DD, the last 30 days by default) in ?currency=,
+// with the ?movers= entries whose value changed most
+func (h *Handler) HandleGetValueHistory(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	params := r.URL.Query()
+	var from, to *time.Time
+	for name, dest := range map[string]**time.Time{"from": &from, "to": &to} {
+		if v := params.Get(name); v != "" {
+			t, err := parseDate(v)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid %s: use YYYY-MM-DD or RFC 3339", name))
+				return
+			}
+			*dest = &t
+		}
+	}
+
+	var movers int
+	if v := params.Get("movers"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(w, http.StatusBadRequest, "invalid movers")
+			return
+		}
+		movers = n
+	}
+
+	history, err := h.inventoryService.GetValueHistory(userID, params.Get("currency"), from, to, movers)
+	if err != nil {
+		if errors.Is(err, inventory.ErrInvalidCurrency) || errors.Is(err, inventory.ErrInvalidDateRange) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "failed to retrieve value history")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, history)
+}
+
+// HandleExportInventory downloads the user's inventory as CSV in the format
+// given by ?format= (native by default)
+func (h *Handler) HandleExportInventory(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "native"
+	}
+
+	var buf bytes.Buffer
+	if err := h.inventoryService.ExportCSV(userID, format, &buf); err != nil {
+		if errors.Is(err, inventory.ErrUnknownFormat) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "failed to export inventory")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="inventory-%s.csv"`, strings.ToLower(format)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// HandleImportInventory adds cards from an uploaded CSV file, sent as the
+// request body or a multipart "file" field. ?format= names the layout
+// (detected from the header by default) and ?dry_run=true only reports how
+// each line resolves.
+func (h *Handler) HandleImportInventory(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "CSV file is required")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	report, err := h.inventoryService.ImportCSV(userID, body, r.URL.Query().Get("format"), dryRun)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			respondError(w, http.StatusRequestEntityTooLarge, "CSV file is too large")
+		case errors.Is(err, inventory.ErrUnknownFormat), errors.Is(err, inventory.ErrInvalidCSV):
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "failed to import inventory")
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// HandleGetLedger lists a page of the user's inventory changes, newest
+// first, optionally filtered by source, session_id or card_id
+func (h *Handler) HandleGetLedger(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	params := r.URL.Query()
+	q := &models.LedgerQuery{
+		Source: params.Get("source"),
+		CardID: params.Get("card_id"),
+		Cursor: params.Get("cursor"),
+	}
+	for name, dest := range map[string]*int{"session_id": &q.SessionID, "limit": &q.Limit} {
+		if v := params.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				respondError(w, http.StatusBadRequest, "invalid "+name)
+				return
+			}
+			*dest = n
+		}
+	}
+
+	page, err := h.inventoryService.GetLedger(userID, q)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidQuery) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "failed to retrieve ledger")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, page)
+}
+
+// HandleUndo reverses a ledger entry or a whole scan session
+func (h *Handler) HandleUndo(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	var req models.UndoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	result, err := h.inventoryService.Undo(userID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, inventory.ErrCannotUndo):
+			respondError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, inventory.ErrLedgerEntryNotFound), errors.Is(err, inventory.ErrScanSessionNotFound):
+			respondError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, database.ErrNotInInventory), errors.Is(err, database.ErrNotEnoughCopies):
+			respondError(w, http.StatusConflict, "copies to undo are no longer in inventory")
+		default:
+			respondError(w, http.StatusInternalServerError, "failed to undo")
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// HandleCheckLedger compares the user's inventory with quantities rebuilt
+// from the ledger
+func (h *Handler) HandleCheckLedger(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	check, err := h.inventoryService.CheckLedger(userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to check ledger")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, check)
+}
+
+// HandleGetInventory lists a page of the user's inventory. See
+// parseInventoryQuery for the filter, sort and paging parameters.
+func (h *Handler) HandleGetInventory(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	q, err := parseInventoryQuery(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.inventoryService.ListInventory(userID, q)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidQuery) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "failed to retrieve inventory")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, page)
+}
+
+// parseInventoryQuery reads inventory listing parameters: name, set, rarity,
+// type and color filters, added_after/added_before dates (YYYY-MM-DD or
+// RFC 3339), location, sort, order (asc/desc), limit and cursor
+func parseInventoryQuery(r *http.Request) (*models.InventoryQuery, error) {
+	params := r.URL.Query()
+	q := &models.InventoryQuery{
+		Name:     params.Get("name"),
+		SetCode:  params.Get("set"),
+		Rarity:   params.Get("rarity"),
+		TypeLine: params.Get("type"),
+		Colors:   params.Get("color"),
+		Sort:     params.Get("sort"),
+		Currency: strings.ToLower(params.Get("currency")),
+		Cursor:   params.Get("cursor"),
+	}
+
+	// Newest and most valuable first by default, ascending for every other sort key
+	switch params.Get("order") {
+	case "":
+		q.Descending = q.Sort == "" || q.Sort == "added_at" || q.Sort == "value"
+	case "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return nil, errors.New("order must be asc or desc")
+	}
+
+	for name, dest := range map[string]**time.Time{"added_after": &q.AddedAfter, "added_before": &q.AddedBefore} {
+		if v := params.Get(name); v != "" {
+			t, err := parseDate(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: use YYYY-MM-DD or RFC 3339", name)
+			}
+			*dest = &t
+		}
+	}
+
+	if v := params.Get("location"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid location")
+		}
+		q.LocationID = id
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return nil, errors.New("invalid limit")
+		}
+		q.Limit = limit
+	}
+
+	return q, nil
+}
+
+// parseDate parses a YYYY-MM-DD date or an RFC 3339 timestamp
+func parseDate(v string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// HandleGetCard retrieves card details by ID
+func (h *Handler) HandleGetCard(w http.ResponseWriter, r *http.Request) {
+	cardID := r.URL.Query().Get("id")
+	if cardID == "" {
+		respondError(w, http.StatusBadRequest, "card id is required")
+		return
+	}
+
+	card, err := h.db.GetCardByID(cardID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to retrieve card")
+		return
+	}
+
+	if card == nil {
+		respondError(w, http.StatusNotFound, "card not found")
+		return
+	}
+
+	if card.Prices, err = h.db.GetCardPrices(card.ID); err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to retrieve card prices")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, card)
+}
+
+// HandleMatchCards ranks catalog cards by fuzzy similarity to a noisy OCR name
+func (h *Handler) HandleMatchCards(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name := query.Get("name")
+	if name == "" {
+		respondError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	limit := 10
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+
+	candidates, err := h.scannerService.MatchName(name, fuzzy.Hints{
+		TypeLine:        query.Get("type_line"),
+		SetCode:         query.Get("set_code"),
+		CollectorNumber: query.Get("collector_number"),
+	}, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to match cards")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"candidates": candidates,
+		"count":      len(candidates),
+	})
+}
+
+// HandleLearnBarcode teaches the server a new barcode-to-card or sealed product mapping
+func (h *Handler) HandleLearnBarcode(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	var req models.BarcodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	barcode, err := h.scannerService.LearnBarcode(userID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, scanner.ErrInvalidBarcode):
+			respondError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, scanner.ErrCardNotFound):
+			respondError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, scanner.ErrBarcodeExists):
+			respondError(w, http.StatusConflict, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "failed to save barcode")
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, barcode)
+}
+
+// HandleGetBarcode retrieves the mapping for a barcode
+func (h *Handler) HandleGetBarcode(w http.ResponseWriter, r *http.Request) {
+	barcode, err := h.db.GetBarcode(strings.ToUpper(chi.URLParam(r, "code")))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to retrieve barcode")
+		return
+	}
+
+	if barcode == nil {
+		respondError(w, http.StatusNotFound, "unknown barcode")
+		return
+	}
+
+	if barcode.CardID != "" {
+		barcode.Card, err = h.db.GetCardByID(barcode.CardID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "failed to retrieve card")
+			return
+		}
+	}
+
+	respondJSON(w, http.StatusOK, barcode)
+}
+
+// HandleGetInventoryStats retrieves inventory totals and breakdowns
+func (h *Handler) HandleGetInventoryStats(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	stats, err := h.inventoryService.GetInventoryStats(userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to retrieve inventory stats")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, stats)
+}
+
+// HandleAddCard adds copies of a card to inventory by card ID
+func (h *Handler) HandleAddCard(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	var req models.InventoryAddRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	item, err := h.inventoryService.AddCard(userID, chi.URLParam(r, "cardId"), &req)
+	if err != nil {
+		respondInventoryError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, item)
+}
+
+// HandleUpdateInventory sets or adjusts the quantity of an inventory entry.
+// The entry's copy attributes are given as query parameters.
+func (h *Handler) HandleUpdateInventory(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	var req models.InventoryUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	item, err := h.inventoryService.UpdateQuantity(userID, chi.URLParam(r, "cardId"), copyAttributesFromQuery(r), &req)
+	if err != nil {
+		respondInventoryError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, item)
+}
+
+// HandleRemoveCard removes copies of a card from inventory, all of them
+// unless a quantity is given. The entry's copy attributes are given as query
+// parameters.
+func (h *Handler) HandleRemoveCard(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	quantity := 0
+	if q := r.URL.Query().Get("quantity"); q != "" {
+		var err error
+		if quantity, err = strconv.Atoi(q); err != nil || quantity <= 0 {
+			respondError(w, http.StatusBadRequest, "invalid quantity")
+			return
+		}
+	}
+
+	item, err := h.inventoryService.RemoveCard(userID, chi.URLParam(r, "cardId"), copyAttributesFromQuery(r), quantity)
+	if err != nil {
+		respondInventoryError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, item)
+}
+
+// respondInventoryError maps inventory update errors to HTTP statuses
+func respondInventoryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrInvalidQuantity), errors.Is(err, inventory.ErrInvalidAttributes):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, scanner.ErrCardNotFound), errors.Is(err, database.ErrNotInInventory),
+		errors.Is(err, inventory.ErrLocationNotFound):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, database.ErrNotEnoughCopies):
+		respondError(w, http.StatusConflict, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "failed to update inventory")
+	}
+}
+
+// HandleGetLocations lists the user's locations
+func (h *Handler) HandleGetLocations(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	locations, current, err := h.inventoryService.GetLocations(userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "failed to retrieve locations")
+		return
+	}
+
+	resp := map[string]interface{}{
+		"locations": locations,
+	}
+	if current != 0 {
+		resp["current_location_id"] = current
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// HandleCreateLocation creates a binder, box or deck box
+func (h *Handler) HandleCreateLocation(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	var req models.LocationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	loc, err := h.inventoryService.CreateLocation(userID, &req)
+	if err != nil {
+		respondLocationError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, loc)
+}
+
+// HandleGetLocation lists a location's nested locations and cards
+func (h *Handler) HandleGetLocation(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	locationID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid location id")
+		return
+	}
+
+	recursive := r.URL.Query().Get("recursive") == "true"
+	contents, err := h.inventoryService.GetLocationContents(userID, locationID, recursive)
+	if err != nil {
+		respondLocationError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, contents)
+}
+
+// HandleDeleteLocation deletes a location; its cards stay in inventory unplaced
+func (h *Handler) HandleDeleteLocation(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	locationID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid location id")
+		return
+	}
+
+	if err := h.inventoryService.DeleteLocation(userID, locationID); err != nil {
+		respondLocationError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleSetCurrentLocation sets the location the user's scans land in
+func (h *Handler) HandleSetCurrentLocation(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	var req models.CurrentLocationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.inventoryService.SetCurrentLocation(userID, req.LocationID); err != nil {
+		respondLocationError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, req)
+}
+
+// HandleMoveCards moves copies of an inventory entry between locations
+func (h *Handler) HandleMoveCards(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	var req models.MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.inventoryService.MoveCards(userID, &req); err != nil {
+		respondLocationError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondLocationError maps location and move errors to HTTP statuses
+func respondLocationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrInvalidLocation), errors.Is(err, inventory.ErrInvalidMove):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, inventory.ErrLocationNotFound), errors.Is(err, database.ErrNotInInventory):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, database.ErrNotEnoughCopies):
+		respondError(w, http.StatusConflict, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "failed to update locations")
+	}
+}
+
+// maxDecklistSize limits plain-text decklists to 1 MB
+const maxDecklistSize = 1 << 20
+
+// HandleCreateDeck creates a deck from a JSON DeckRequest, or from a
+// plain-text decklist body named by ?name=
+func (h *Handler) HandleCreateDeck(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxDecklistSize)
+
+	var req models.DeckRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/plain") {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		req = models.DeckRequest{Name: r.URL.Query().Get("name"), Decklist: string(body)}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	result, err := h.inventoryService.CreateDeck(userID, &req)
+	if err != nil {
+		respondDeckError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, result)
+}
+
+// HandleGetDecks lists the user's decks
+func (h *Handler) HandleGetDecks(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	decks, err := h.inventoryService.GetDecks(userID)
+	if err != nil {
+		respondDeckError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"decks": decks,
+		"count": len(decks),
+	})
+}
+
+// HandleGetDeck retrieves a deck with its cards
+func (h *Handler) HandleGetDeck(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	deckID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid deck id")
+		return
+	}
+
+	deck, err := h.inventoryService.GetDeck(userID, deckID)
+	if err != nil {
+		respondDeckError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, deck)
+}
+
+// HandleDeleteDeck deletes a deck
+func (h *Handler) HandleDeleteDeck(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	deckID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid deck id")
+		return
+	}
+
+	if err := h.inventoryService.DeleteDeck(userID, deckID); err != nil {
+		respondDeckError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetDeckReport reports which of a deck's cards the user owns, owns in
+// a different printing, or is missing
+func (h *Handler) HandleGetDeckReport(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	deckID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid deck id")
+		return
+	}
+
+	report, err := h.inventoryService.GetDeckReport(userID, deckID)
+	if err != nil {
+		respondDeckError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// HandleValidateDeck checks a deck against the rules of ?format=, by default
+// the format it was created for
+func (h *Handler) HandleValidateDeck(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	deckID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid deck id")
+		return
+	}
+
+	validation, err := h.inventoryService.ValidateDeck(userID, deckID, r.URL.Query().Get("format"))
+	if err != nil {
+		respondDeckError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, validation)
+}
+
+// HandleGetShoppingList downloads the cards missing from a deck, as plain
+// text or ?format=csv
+func (h *Handler) HandleGetShoppingList(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	deckID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid deck id")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	var buf bytes.Buffer
+	if err := h.inventoryService.WriteShoppingList(userID, deckID, format, &buf); err != nil {
+		respondDeckError(w, err)
+		return
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="deck-%d-missing.csv"`, deckID))
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func respondDeckError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrInvalidDeck), errors.Is(err, inventory.ErrUnknownFormat):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, inventory.ErrDeckNotFound):
+		respondError(w, http.StatusNotFound, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "failed to process deck")
+	}
+}
+
+// HandleGetWishlist lists the user's wishlist
+func (h *Handler) HandleGetWishlist(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	items, err := h.inventoryService.GetWishlist(userID)
+	if err != nil {
+		respondWishlistError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"wishlist": items,
+		"count":    len(items),
+	})
+}
+
+// HandleAddToWishlist adds a wanted card to the user's wishlist
+func (h *Handler) HandleAddToWishlist(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	var req models.WishlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	item, err := h.inventoryService.AddToWishlist(userID, &req)
+	if err != nil {
+		respondWishlistError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, item)
+}
+
+// HandleUpdateWishlistItem changes a wishlist item's quantity, acquired
+// count, max price or minimum condition
+func (h *Handler) HandleUpdateWishlistItem(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid wishlist item id")
+		return
+	}
+
+	var req models.WishlistUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	item, err := h.inventoryService.UpdateWishlistItem(userID, id, &req)
+	if err != nil {
+		respondWishlistError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, item)
+}
+
+// HandleDeleteWishlistItem removes an item from the user's wishlist
+func (h *Handler) HandleDeleteWishlistItem(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid wishlist item id")
+		return
+	}
+
+	if err := h.inventoryService.DeleteWishlistItem(userID, id); err != nil {
+		respondWishlistError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetTradeList lists the inventory entries the user offers for trade
+func (h *Handler) HandleGetTradeList(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	items, err := h.inventoryService.GetTradeList(userID)
+	if err != nil {
+		respondWishlistError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"trade_list": items,
+		"count":      len(items),
+	})
+}
+
+// HandleSetTradeQuantity offers copies of an inventory entry for trade
+func (h *Handler) HandleSetTradeQuantity(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	inventoryID, err := strconv.Atoi(chi.URLParam(r, "inventoryId"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid inventory id")
+		return
+	}
+
+	var req models.TradeListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	item, err := h.inventoryService.SetTradeQuantity(userID, inventoryID, &req)
+	if err != nil {
+		respondWishlistError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, item)
+}
+
+// HandleRemoveFromTradeList withdraws an inventory entry from trade
+func (h *Handler) HandleRemoveFromTradeList(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	inventoryID, err := strconv.Atoi(chi.URLParam(r, "inventoryId"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid inventory id")
+		return
+	}
+
+	if err := h.inventoryService.RemoveFromTradeList(userID, inventoryID); err != nil {
+		respondWishlistError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondWishlistError maps wishlist and trade list errors to HTTP statuses
+func respondWishlistError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrInvalidWishlistItem), errors.Is(err, inventory.ErrInvalidQuantity),
+		errors.Is(err, inventory.ErrInvalidCurrency):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, inventory.ErrWishlistItemNotFound), errors.Is(err, inventory.ErrNotOnTradeList),
+		errors.Is(err, scanner.ErrCardNotFound), errors.Is(err, database.ErrNotInInventory):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, database.ErrNotEnoughCopies):
+		respondError(w, http.StatusConflict, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "failed to process wishlist")
+	}
+}
+
+// HandleGetTradePartners lists the users the user has agreed to trade with
+func (h *Handler) HandleGetTradePartners(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	partners, err := h.inventoryService.GetTradePartners(userID)
+	if err != nil {
+		respondTradeError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"partners": partners,
+		"count":    len(partners),
+	})
+}
+
+// HandleAddTradePartner records the user's agreement to trade with another user
+func (h *Handler) HandleAddTradePartner(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	if err := h.inventoryService.AddTradePartner(userID, chi.URLParam(r, "userId")); err != nil {
+		respondTradeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRemoveTradePartner withdraws the user's agreement to trade with another user
+func (h *Handler) HandleRemoveTradePartner(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	if err := h.inventoryService.RemoveTradePartner(userID, chi.URLParam(r, "userId")); err != nil {
+		respondTradeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetTradeMatches matches the user's wishlist and trade list against a
+// partner's and proposes a balanced trade
+func (h *Handler) HandleGetTradeMatches(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	match, err := h.inventoryService.FindTradeMatches(userID, chi.URLParam(r, "userId"), r.URL.Query().Get("currency"))
+	if err != nil {
+		respondTradeError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, match)
+}
+
+// HandleGetTrades lists the trades the user proposed or was offered
+func (h *Handler) HandleGetTrades(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	trades, err := h.inventoryService.GetTrades(userID)
+	if err != nil {
+		respondTradeError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"trades": trades,
+		"count":  len(trades),
+	})
+}
+
+// HandleProposeTrade proposes a trade to a partner
+func (h *Handler) HandleProposeTrade(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	var req models.TradeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	trade, err := h.inventoryService.ProposeTrade(userID, &req)
+	if err != nil {
+		respondTradeError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, trade)
+}
+
+// HandleGetTrade retrieves a trade the user is part of
+func (h *Handler) HandleGetTrade(w http.ResponseWriter, r *http.Request) {
+	h.handleTrade(w, r, h.inventoryService.GetTrade)
+}
+
+// HandleAcceptTrade accepts a trade offered to the user, exchanging the cards
+func (h *Handler) HandleAcceptTrade(w http.ResponseWriter, r *http.Request) {
+	h.handleTrade(w, r, h.inventoryService.AcceptTrade)
+}
+
+// HandleDeclineTrade declines a trade offered to the user, or cancels one
+// the user proposed
+func (h *Handler) HandleDeclineTrade(w http.ResponseWriter, r *http.Request) {
+	h.handleTrade(w, r, h.inventoryService.DeclineTrade)
+}
+
+// handleTrade applies fn to the trade named in the URL and responds with the result
+func (h *Handler) handleTrade(w http.ResponseWriter, r *http.Request, fn func(userID string, tradeID int64) (*models.Trade, error)) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		respondError(w, http.StatusUnauthorized, "user not authenticated")
+		return
+	}
+
+	tradeID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid trade id")
+		return
+	}
+
+	trade, err := fn(userID, tradeID)
+	if err != nil {
+		respondTradeError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, trade)
+}
+
+// respondTradeError maps trade errors to HTTP statuses
+func respondTradeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, inventory.ErrInvalidTrade), errors.Is(err, inventory.ErrInvalidQuantity),
+		errors.Is(err, inventory.ErrInvalidCurrency):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, inventory.ErrNotTradePartners):
+		respondError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, inventory.ErrTradeNotFound), errors.Is(err, inventory.ErrPartnerNotFound):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, inventory.ErrTradeNotProposed), errors.Is(err, database.ErrTradeUnavailable):
+		respondError(w, http.StatusConflict, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "failed to process trade")
+	}
+}
+
+// HandleHealthCheck returns API health status
+func (h *Handler) HandleHealthCheck(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]string{
+		"status": "ok",
+	})
+}
+
+// copyAttributesFromQuery reads copy attributes from query parameters, for
+// endpoints whose body is not JSON
+func copyAttributesFromQuery(r *http.Request) models.CopyAttributes {
+	q := r.URL.Query()
+	flag := func(name string) bool {
+		v, _ := strconv.ParseBool(q.Get(name))
+		return v
+	}
+	return models.CopyAttributes{
+		Finish:    q.Get("finish"),
+		Condition: q.Get("condition"),
+		Language:  q.Get("language"),
+		Signed:    flag("signed"),
+		Altered:   flag("altered"),
+		Misprint:  flag("misprint"),
+	}
 }
 
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -14,8 +14,8 @@ func NewRouter(handler *Handler, authService *auth.Service) *chi.Mux {
 	r.Use(middleware.LoggingMiddleware)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Idempotency-Key"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
@@ -31,8 +31,61 @@ func NewRouter(handler *Handler, authService *auth.Service) *chi.Mux {
 
 		r.Post("/api/v1/cards/scan", handler.HandleSingleScan)
 		r.Post("/api/v1/cards/scan/bulk", handler.HandleBulkScan)
+		r.Post("/api/v1/cards/scan/{id}/confirm", handler.HandleConfirmScan)
+		r.Post("/api/v1/cards/recognize", handler.HandleRecognizeScan)
+		r.Get("/api/v1/jobs/{id}", handler.HandleGetJob)
+		r.Get("/api/v1/jobs/{id}/events", handler.HandleJobEvents)
+		r.Get("/api/v1/sessions", handler.HandleGetSessions)
+		r.Post("/api/v1/sessions", handler.HandleStartSession)
+		r.Get("/api/v1/sessions/{id}", handler.HandleGetSession)
+		r.Post("/api/v1/sessions/{id}/complete", handler.HandleCompleteSession)
+		r.Get("/api/v1/sessions/{id}/cards", handler.HandleGetSessionCards)
+		r.Get("/api/v1/sessions/{id}/scans", handler.HandleGetSessionScans)
 		r.Get("/api/v1/inventory", handler.HandleGetInventory)
+		r.Get("/api/v1/inventory/stats", handler.HandleGetInventoryStats)
+		r.Get("/api/v1/inventory/value", handler.HandleGetInventoryValue)
+		r.Get("/api/v1/inventory/value/history", handler.HandleGetValueHistory)
+		r.Get("/api/v1/inventory/export", handler.HandleExportInventory)
+		r.Post("/api/v1/inventory/import", handler.HandleImportInventory)
+		r.Post("/api/v1/inventory/move", handler.HandleMoveCards)
+		r.Get("/api/v1/inventory/ledger", handler.HandleGetLedger)
+		r.Post("/api/v1/inventory/ledger/undo", handler.HandleUndo)
+		r.Get("/api/v1/inventory/ledger/check", handler.HandleCheckLedger)
+		r.Post("/api/v1/inventory/{cardId}", handler.HandleAddCard)
+		r.Patch("/api/v1/inventory/{cardId}", handler.HandleUpdateInventory)
+		r.Delete("/api/v1/inventory/{cardId}", handler.HandleRemoveCard)
+		r.Get("/api/v1/locations", handler.HandleGetLocations)
+		r.Post("/api/v1/locations", handler.HandleCreateLocation)
+		r.Put("/api/v1/locations/current", handler.HandleSetCurrentLocation)
+		r.Get("/api/v1/locations/{id}", handler.HandleGetLocation)
+		r.Delete("/api/v1/locations/{id}", handler.HandleDeleteLocation)
+		r.Get("/api/v1/decks", handler.HandleGetDecks)
+		r.Post("/api/v1/decks", handler.HandleCreateDeck)
+		r.Get("/api/v1/decks/{id}", handler.HandleGetDeck)
+		r.Delete("/api/v1/decks/{id}", handler.HandleDeleteDeck)
+		r.Get("/api/v1/decks/{id}/report", handler.HandleGetDeckReport)
+		r.Get("/api/v1/decks/{id}/validation", handler.HandleValidateDeck)
+		r.Get("/api/v1/decks/{id}/shopping-list", handler.HandleGetShoppingList)
+		r.Get("/api/v1/wishlist", handler.HandleGetWishlist)
+		r.Post("/api/v1/wishlist", handler.HandleAddToWishlist)
+		r.Patch("/api/v1/wishlist/{id}", handler.HandleUpdateWishlistItem)
+		r.Delete("/api/v1/wishlist/{id}", handler.HandleDeleteWishlistItem)
+		r.Get("/api/v1/tradelist", handler.HandleGetTradeList)
+		r.Put("/api/v1/tradelist/{inventoryId}", handler.HandleSetTradeQuantity)
+		r.Delete("/api/v1/tradelist/{inventoryId}", handler.HandleRemoveFromTradeList)
+		r.Get("/api/v1/trades", handler.HandleGetTrades)
+		r.Post("/api/v1/trades", handler.HandleProposeTrade)
+		r.Get("/api/v1/trades/partners", handler.HandleGetTradePartners)
+		r.Put("/api/v1/trades/partners/{userId}", handler.HandleAddTradePartner)
+		r.Delete("/api/v1/trades/partners/{userId}", handler.HandleRemoveTradePartner)
+		r.Get("/api/v1/trades/matches/{userId}", handler.HandleGetTradeMatches)
+		r.Get("/api/v1/trades/{id}", handler.HandleGetTrade)
+		r.Post("/api/v1/trades/{id}/accept", handler.HandleAcceptTrade)
+		r.Post("/api/v1/trades/{id}/decline", handler.HandleDeclineTrade)
 		r.Get("/api/v1/cards", handler.HandleGetCard)
+		r.Get("/api/v1/cards/match", handler.HandleMatchCards)
+		r.Post("/api/v1/barcodes", handler.HandleLearnBarcode)
+		r.Get("/api/v1/barcodes/{code}", handler.HandleGetBarcode)
 	})
 
 	return r
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// CreateBarcode inserts a new barcode mapping
+func (db *DB) CreateBarcode(barcode *models.Barcode) error {
+	query := `INSERT INTO barcodes (code, kind, card_id, product_name, added_by, created_at)
+	          VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := db.Exec(query, barcode.Code, barcode.Kind, nullString(barcode.CardID),
+		nullString(barcode.ProductName), nullString(barcode.AddedBy), barcode.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create barcode: %w", err)
+	}
+	return nil
+}
+
+// UpsertBarcode inserts a barcode mapping or replaces the target of an existing one.
+// It reports whether the mapping was newly inserted.
+func (db *DB) UpsertBarcode(barcode *models.Barcode) (bool, error) {
+	existing, err := db.GetBarcode(barcode.Code)
+	if err != nil {
+		return false, err
+	}
+
+	query := `INSERT INTO barcodes (code, kind, card_id, product_name, added_by, created_at)
+	          VALUES (?, ?, ?, ?, ?, ?)
+	          ON CONFLICT(code)
+	          DO UPDATE SET kind = excluded.kind, card_id = excluded.card_id, product_name = excluded.product_name`
+	_, err = db.Exec(query, barcode.Code, barcode.Kind, nullString(barcode.CardID),
+		nullString(barcode.ProductName), nullString(barcode.AddedBy), barcode.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to upsert barcode: %w", err)
+	}
+	return existing == nil, nil
+}
+
+// GetBarcode retrieves a barcode mapping by code
+func (db *DB) GetBarcode(code string) (*models.Barcode, error) {
+	query := `SELECT code, kind, card_id, product_name, added_by, created_at FROM barcodes WHERE code = ?`
+
+	barcode := &models.Barcode{}
+	var cardID, productName, addedBy sql.NullString
+	err := db.QueryRow(query, code).Scan(&barcode.Code, &barcode.Kind, &cardID, &productName, &addedBy, &barcode.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get barcode: %w", err)
+	}
+
+	barcode.CardID = cardID.String
+	barcode.ProductName = productName.String
+	barcode.AddedBy = addedBy.String
+	return barcode, nil
+}
+
+// nullString converts empty strings to SQL NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// UpsertCardImageHash stores the artwork hashes for a card, replacing any existing ones
+func (db *DB) UpsertCardImageHash(hash *models.CardImageHash) error {
+	query := `INSERT INTO card_image_hashes (card_id, phash, dhash, created_at)
+	          VALUES (?, ?, ?, ?)
+	          ON CONFLICT(card_id)
+	          DO UPDATE SET phash = excluded.phash, dhash = excluded.dhash, created_at = excluded.created_at`
+	_, err := db.Exec(query, hash.CardID, int64(hash.PHash), int64(hash.DHash), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to upsert card image hash: %w", err)
+	}
+	return nil
+}
+
+// GetAllCardImageHashes retrieves the complete artwork hash index
+func (db *DB) GetAllCardImageHashes() ([]models.CardImageHash, error) {
+	rows, err := db.Query(`SELECT card_id, phash, dhash, created_at FROM card_image_hashes`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get card image hashes: %w", err)
+	}
+	defer rows.Close()
+
+	var hashes []models.CardImageHash
+	for rows.Next() {
+		var hash models.CardImageHash
+		var phash, dhash int64
+		if err := rows.Scan(&hash.CardID, &phash, &dhash, &hash.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan card image hash: %w", err)
+		}
+		hash.PHash = uint64(phash)
+		hash.DHash = uint64(dhash)
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, nil
+}
+
+// GetCardsWithoutImageHash retrieves cards with an image that have not been hashed yet
+func (db *DB) GetCardsWithoutImageHash(limit, offset int) ([]models.Card, error) {
+	query := `SELECT ` + prefixedCardColumns + `
+	          FROM cards c
+	          LEFT JOIN card_image_hashes h ON h.card_id = c.id
+	          WHERE h.card_id IS NULL AND c.image_uri IS NOT NULL AND c.image_uri != ''
+	          ORDER BY c.created_at, c.id
+	          LIMIT ? OFFSET ?`
+	rows, err := db.Query(query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unhashed cards: %w", err)
+	}
+	return scanCards(rows)
+}
@@ -2,34 +2,169 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"maps"
 
 	"github.com/abzi/mtg_card_detector/internal/models"
 )
 
-// CreateCard inserts a new card into the database
-func (db *DB) CreateCard(card *models.Card) error {
-	query := `INSERT INTO cards (id, scryfall_id, name, set_code, collector_number, image_uri, oracle_text, type_line, mana_cost, rarity, created_at)
-	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	_, err := db.Exec(query, card.ID, card.ScryfallID, card.Name, card.SetCode, card.CollectorNumber,
-		card.ImageURI, card.OracleText, card.TypeLine, card.ManaCost, card.Rarity, card.CreatedAt)
-	if err != nil {
-		return fmt.Errorf("failed to create card: %w", err)
+// cardColumns is the column list scanned by cardFields. Nullable columns
+// added after the initial schema are coalesced so they scan into strings.
+const cardColumns = `id, scryfall_id, name, set_code, collector_number, image_uri, oracle_text, type_line, mana_cost, rarity, created_at,
+	COALESCE(released_at, ''), COALESCE(colors, ''), COALESCE(color_identity, ''), COALESCE(cmc, 0), COALESCE(legalities, '')`
+
+// prefixedCardColumns is cardColumns for queries that join cards as "c"
+const prefixedCardColumns = `c.id, c.scryfall_id, c.name, c.set_code, c.collector_number, c.image_uri, c.oracle_text, c.type_line, c.mana_cost, c.rarity, c.created_at,
+	COALESCE(c.released_at, ''), COALESCE(c.colors, ''), COALESCE(c.color_identity, ''), COALESCE(c.cmc, 0), COALESCE(c.legalities, '')`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// cardFields returns the scan destinations matching cardColumns
+func cardFields(card *models.Card) []interface{} {
+	return []interface{}{&card.ID, &card.ScryfallID, &card.Name, &card.SetCode, &card.CollectorNumber,
+		&card.ImageURI, &card.OracleText, &card.TypeLine, &card.ManaCost, &card.Rarity, &card.CreatedAt,
+		&card.ReleasedAt, &card.Colors, &card.ColorIdentity, &card.CMC, legalitiesField{&card.Legalities}}
+}
+
+// nullableCard scans prefixedCardColumns of a LEFT JOINed card, whose
+// columns are all NULL when there is no card
+type nullableCard struct {
+	card                                            models.Card
+	id, scryfallID, name, setCode, number, imageURI sql.NullString
+	oracleText, typeLine, manaCost, rarity          sql.NullString
+	createdAt                                       sql.NullTime
+	cmc                                             sql.NullFloat64
+}
+
+// fields returns the scan destinations matching prefixedCardColumns
+func (n *nullableCard) fields() []interface{} {
+	return []interface{}{&n.id, &n.scryfallID, &n.name, &n.setCode, &n.number,
+		&n.imageURI, &n.oracleText, &n.typeLine, &n.manaCost, &n.rarity, &n.createdAt,
+		&n.card.ReleasedAt, &n.card.Colors, &n.card.ColorIdentity, &n.cmc, legalitiesField{&n.card.Legalities}}
+}
+
+// get returns the scanned card, or nil if there was none
+func (n *nullableCard) get() *models.Card {
+	if !n.id.Valid {
+		return nil
 	}
-	return nil
+	card := n.card
+	card.ID, card.ScryfallID, card.Name, card.SetCode = n.id.String, n.scryfallID.String, n.name.String, n.setCode.String
+	card.CollectorNumber, card.ImageURI, card.OracleText = n.number.String, n.imageURI.String, n.oracleText.String
+	card.TypeLine, card.ManaCost, card.Rarity = n.typeLine.String, n.manaCost.String, n.rarity.String
+	card.CreatedAt, card.CMC = n.createdAt.Time, n.cmc.Float64
+	return &card
 }
 
-// GetCardByID retrieves a card by ID
-func (db *DB) GetCardByID(id string) (*models.Card, error) {
-	query := `SELECT id, scryfall_id, name, set_code, collector_number, image_uri, oracle_text, type_line, mana_cost, rarity, created_at
-	          FROM cards WHERE id = ?`
+// legalitiesField scans a JSON legalities column, empty when unknown
+type legalitiesField struct {
+	dest *models.Legalities
+}
+
+func (f legalitiesField) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	}
+	if len(data) == 0 {
+		*f.dest = nil
+		return nil
+	}
+	return json.Unmarshal(data, f.dest)
+}
+
+// legalitiesValue encodes legalities for storage, NULL when unknown
+func legalitiesValue(l models.Legalities) sql.NullString {
+	if len(l) == 0 {
+		return sql.NullString{}
+	}
+	data, _ := json.Marshal(l)
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// scanCard scans a row selected with cardColumns, returning nil if there is no row
+func scanCard(row rowScanner) (*models.Card, error) {
 	card := &models.Card{}
-	err := db.QueryRow(query, id).Scan(&card.ID, &card.ScryfallID, &card.Name, &card.SetCode, &card.CollectorNumber,
-		&card.ImageURI, &card.OracleText, &card.TypeLine, &card.ManaCost, &card.Rarity, &card.CreatedAt)
-	if err != nil {
+	if err := row.Scan(cardFields(card)...); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
+		return nil, err
+	}
+	return card, nil
+}
+
+// scanCards scans every row selected with cardColumns
+func scanCards(rows *sql.Rows) ([]models.Card, error) {
+	defer rows.Close()
+
+	var cards []models.Card
+	for rows.Next() {
+		var card models.Card
+		if err := rows.Scan(cardFields(&card)...); err != nil {
+			return nil, fmt.Errorf("failed to scan card: %w", err)
+		}
+		cards = append(cards, card)
+	}
+
+	return cards, rows.Err()
+}
+
+func insertCard(e execer, card *models.Card) error {
+	query := `INSERT INTO cards (id, scryfall_id, name, set_code, collector_number, image_uri, oracle_text, type_line, mana_cost, rarity, created_at,
+	                             released_at, colors, color_identity, cmc, legalities)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := e.Exec(query, card.ID, card.ScryfallID, card.Name, card.SetCode, card.CollectorNumber,
+		card.ImageURI, card.OracleText, card.TypeLine, card.ManaCost, card.Rarity, card.CreatedAt,
+		nullString(card.ReleasedAt), card.Colors, card.ColorIdentity, card.CMC, legalitiesValue(card.Legalities))
+	return err
+}
+
+func updateCard(e execer, card *models.Card) error {
+	query := `UPDATE cards
+	          SET name = ?, set_code = ?, collector_number = ?, image_uri = ?, oracle_text = ?, type_line = ?, mana_cost = ?, rarity = ?,
+	              released_at = ?, colors = ?, color_identity = ?, cmc = ?, legalities = ?
+	          WHERE id = ?`
+	_, err := e.Exec(query, card.Name, card.SetCode, card.CollectorNumber, card.ImageURI,
+		card.OracleText, card.TypeLine, card.ManaCost, card.Rarity,
+		nullString(card.ReleasedAt), card.Colors, card.ColorIdentity, card.CMC, legalitiesValue(card.Legalities), card.ID)
+	return err
+}
+
+// sameCatalogData reports whether two printings carry identical Scryfall data
+func sameCatalogData(a, b *models.Card) bool {
+	return a.Name == b.Name && a.SetCode == b.SetCode && a.CollectorNumber == b.CollectorNumber &&
+		a.ImageURI == b.ImageURI && a.OracleText == b.OracleText && a.TypeLine == b.TypeLine &&
+		a.ManaCost == b.ManaCost && a.Rarity == b.Rarity && a.ReleasedAt == b.ReleasedAt &&
+		a.Colors == b.Colors && a.ColorIdentity == b.ColorIdentity && a.CMC == b.CMC &&
+		maps.Equal(a.Legalities, b.Legalities)
+}
+
+// CreateCard inserts a new card and its prices into the database in a single
+// transaction
+func (db *DB) CreateCard(card *models.Card) error {
+	return db.withTx(func(tx *sql.Tx) error {
+		if err := insertCard(tx, card); err != nil {
+			return fmt.Errorf("failed to create card: %w", err)
+		}
+		return setCardPrices(tx, card.ID, card.Prices)
+	})
+}
+
+// GetCardByID retrieves a card by ID
+func (db *DB) GetCardByID(id string) (*models.Card, error) {
+	card, err := scanCard(db.QueryRow(`SELECT `+cardColumns+` FROM cards WHERE id = ?`, id))
+	if err != nil {
 		return nil, fmt.Errorf("failed to get card: %w", err)
 	}
 	return card, nil
@@ -37,15 +172,9 @@ func (db *DB) GetCardByID(id string) (*models.Card, error) {
 
 // GetCardBySetAndNumber retrieves a card by set code and collector number
 func (db *DB) GetCardBySetAndNumber(setCode, collectorNumber string) (*models.Card, error) {
-	query := `SELECT id, scryfall_id, name, set_code, collector_number, image_uri, oracle_text, type_line, mana_cost, rarity, created_at
-	          FROM cards WHERE set_code = ? AND collector_number = ?`
-	card := &models.Card{}
-	err := db.QueryRow(query, setCode, collectorNumber).Scan(&card.ID, &card.ScryfallID, &card.Name, &card.SetCode,
-		&card.CollectorNumber, &card.ImageURI, &card.OracleText, &card.TypeLine, &card.ManaCost, &card.Rarity, &card.CreatedAt)
+	query := `SELECT ` + cardColumns + ` FROM cards WHERE set_code = ? AND collector_number = ?`
+	card, err := scanCard(db.QueryRow(query, setCode, collectorNumber))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
 		return nil, fmt.Errorf("failed to get card by set and number: %w", err)
 	}
 	return card, nil
@@ -53,15 +182,8 @@ func (db *DB) GetCardBySetAndNumber(setCode, collectorNumber string) (*models.Ca
 
 // GetCardByScryfallID retrieves a card by Scryfall ID
 func (db *DB) GetCardByScryfallID(scryfallID string) (*models.Card, error) {
-	query := `SELECT id, scryfall_id, name, set_code, collector_number, image_uri, oracle_text, type_line, mana_cost, rarity, created_at
-	          FROM cards WHERE scryfall_id = ?`
-	card := &models.Card{}
-	err := db.QueryRow(query, scryfallID).Scan(&card.ID, &card.ScryfallID, &card.Name, &card.SetCode,
-		&card.CollectorNumber, &card.ImageURI, &card.OracleText, &card.TypeLine, &card.ManaCost, &card.Rarity, &card.CreatedAt)
+	card, err := scanCard(db.QueryRow(`SELECT `+cardColumns+` FROM cards WHERE scryfall_id = ?`, scryfallID))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
 		return nil, fmt.Errorf("failed to get card by scryfall ID: %w", err)
 	}
 	return card, nil
@@ -69,24 +191,109 @@ func (db *DB) GetCardByScryfallID(scryfallID string) (*models.Card, error) {
 
 // SearchCardsByName searches for cards by name (partial match)
 func (db *DB) SearchCardsByName(name string, limit int) ([]models.Card, error) {
-	query := `SELECT id, scryfall_id, name, set_code, collector_number, image_uri, oracle_text, type_line, mana_cost, rarity, created_at
-	          FROM cards WHERE name LIKE ? ORDER BY name LIMIT ?`
+	query := `SELECT ` + cardColumns + ` FROM cards WHERE name LIKE ? ORDER BY name LIMIT ?`
 	rows, err := db.Query(query, "%"+name+"%", limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search cards: %w", err)
 	}
+	return scanCards(rows)
+}
+
+// GetCardByName retrieves a card by its exact name (case-insensitive), optionally restricted to a set
+func (db *DB) GetCardByName(name, setCode string) (*models.Card, error) {
+	query := `SELECT ` + cardColumns + `
+	          FROM cards WHERE name = ? COLLATE NOCASE AND (? = '' OR set_code = ? COLLATE NOCASE)
+	          ORDER BY released_at DESC, created_at DESC LIMIT 1`
+	card, err := scanCard(db.QueryRow(query, name, setCode, setCode))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get card by name: %w", err)
+	}
+	return card, nil
+}
+
+// GetCardsByName retrieves every printing with an exact name (case-insensitive),
+// optionally restricted to a set, newest first
+func (db *DB) GetCardsByName(name, setCode string) ([]models.Card, error) {
+	query := `SELECT ` + cardColumns + `
+	          FROM cards WHERE name = ? COLLATE NOCASE AND (? = '' OR set_code = ? COLLATE NOCASE)
+	          ORDER BY released_at DESC, created_at DESC`
+	rows, err := db.Query(query, name, setCode, setCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cards by name: %w", err)
+	}
+	return scanCards(rows)
+}
+
+// UpsertCardsByScryfallID inserts or updates a batch of cards keyed by Scryfall ID
+// in a single transaction, along with their prices. Existing cards keep their
+// internal ID.
+func (db *DB) UpsertCardsByScryfallID(cards []models.Card) (*models.CatalogImportResult, error) {
+	result := &models.CatalogImportResult{}
+	err := db.withTx(func(tx *sql.Tx) error {
+		for i := range cards {
+			card := &cards[i]
+
+			existing, err := scanCard(tx.QueryRow(`SELECT `+cardColumns+` FROM cards WHERE scryfall_id = ?`, card.ScryfallID))
+			switch {
+			case err != nil:
+				return fmt.Errorf("failed to check card %s: %w", card.ScryfallID, err)
+			case existing == nil:
+				if err := insertCard(tx, card); err != nil {
+					return fmt.Errorf("failed to insert card %s: %w", card.ScryfallID, err)
+				}
+				result.Inserted++
+			case sameCatalogData(existing, card):
+				card.ID = existing.ID
+				result.Unchanged++
+			default:
+				card.ID = existing.ID
+				if err := updateCard(tx, card); err != nil {
+					return fmt.Errorf("failed to update card %s: %w", card.ScryfallID, err)
+				}
+				result.Updated++
+			}
+
+			// Prices change daily even when the printing's data doesn't
+			if err := setCardPrices(tx, card.ID, card.Prices); err != nil {
+				return fmt.Errorf("failed to store prices of card %s: %w", card.ScryfallID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetCardNameIndex retrieves the ID, name, set, collector number and type line
+// of every card, for building in-memory name indexes
+func (db *DB) GetCardNameIndex() ([]models.Card, error) {
+	rows, err := db.Query(`SELECT id, name, set_code, collector_number, type_line FROM cards`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get card name index: %w", err)
+	}
 	defer rows.Close()
 
 	var cards []models.Card
 	for rows.Next() {
 		var card models.Card
-		err := rows.Scan(&card.ID, &card.ScryfallID, &card.Name, &card.SetCode, &card.CollectorNumber,
-			&card.ImageURI, &card.OracleText, &card.TypeLine, &card.ManaCost, &card.Rarity, &card.CreatedAt)
-		if err != nil {
+		var typeLine sql.NullString
+		if err := rows.Scan(&card.ID, &card.Name, &card.SetCode, &card.CollectorNumber, &typeLine); err != nil {
 			return nil, fmt.Errorf("failed to scan card: %w", err)
 		}
+		card.TypeLine = typeLine.String
 		cards = append(cards, card)
 	}
 
 	return cards, nil
 }
+
+// GetCardCount returns the number of cards in the catalog
+func (db *DB) GetCardCount() (int, error) {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM cards`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count cards: %w", err)
+	}
+	return count, nil
+}
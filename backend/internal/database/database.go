@@ -2,20 +2,34 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 
 	_ "modernc.org/sqlite"
 )
 
+// DB is the application's database. A DB passed to a WithTx function runs
+// all its queries in that transaction.
 type DB struct {
 	*sql.DB
+	tx *sql.Tx
 }
 
+var (
+	// ErrNotInInventory is returned when an inventory entry does not exist for the user
+	ErrNotInInventory = errors.New("card not found in inventory")
+	// ErrNotEnoughCopies is returned when moving more copies than are available
+	ErrNotEnoughCopies = errors.New("not enough copies")
+	// ErrInvalidQuery is returned for an unknown sort key, malformed cursor or filter
+	ErrInvalidQuery = errors.New("invalid query")
+)
+
 // New creates a new database connection
 func New(dataSourceName string) (*DB, error) {
-	db, err := sql.Open("sqlite", dataSourceName+"?_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+	// Transactions begin IMMEDIATE so read-modify-write updates hold the write
+	// lock throughout, and writers wait for each other instead of failing busy
+	db, err := sql.Open("sqlite", dataSourceName+
+		"?_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -29,27 +43,78 @@ func New(dataSourceName string) (*DB, error) {
 	db.SetMaxOpenConns(25)
 	db.SetMaxIdleConns(5)
 
-	return &DB{db}, nil
+	return &DB{DB: db}, nil
 }
 
-// RunMigrations executes all migration files
-func (db *DB) RunMigrations(migrationsPath string) error {
-	files, err := filepath.Glob(filepath.Join(migrationsPath, "*.sql"))
-	if err != nil {
-		return fmt.Errorf("failed to read migration files: %w", err)
+// Exec executes a query in the DB's transaction, if it has one
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if db.tx != nil {
+		return db.tx.Exec(query, args...)
 	}
+	return db.DB.Exec(query, args...)
+}
 
-	for _, file := range files {
-		content, err := os.ReadFile(file)
-		if err != nil {
-			return fmt.Errorf("failed to read migration file %s: %w", file, err)
-		}
+// Query runs a query in the DB's transaction, if it has one
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if db.tx != nil {
+		return db.tx.Query(query, args...)
+	}
+	return db.DB.Query(query, args...)
+}
+
+// QueryRow runs a single row query in the DB's transaction, if it has one
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	if db.tx != nil {
+		return db.tx.QueryRow(query, args...)
+	}
+	return db.DB.QueryRow(query, args...)
+}
+
+// WithTx runs fn with a DB whose queries all run in one transaction,
+// committing if fn returns nil and rolling back otherwise. Methods that use a
+// transaction of their own run it as a savepoint within fn's, so one that
+// fails is undone without rolling back the rest.
+func (db *DB) WithTx(fn func(tx *DB) error) error {
+	return db.withTx(func(tx *sql.Tx) error {
+		return fn(&DB{DB: db.DB, tx: tx})
+	})
+}
 
-		if _, err := db.Exec(string(content)); err != nil {
-			return fmt.Errorf("failed to execute migration %s: %w", file, err)
-		}
+// withTx runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise. Within the DB's own transaction fn runs in a savepoint.
+func (db *DB) withTx(fn func(tx *sql.Tx) error) error {
+	if db.tx != nil {
+		return db.withSavepoint(fn)
 	}
 
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// withSavepoint runs fn in a savepoint of the DB's transaction, rolling back
+// to it if fn fails
+func (db *DB) withSavepoint(fn func(tx *sql.Tx) error) error {
+	if _, err := db.tx.Exec(`SAVEPOINT nested`); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+	if err := fn(db.tx); err != nil {
+		db.tx.Exec(`ROLLBACK TO nested`)
+		db.tx.Exec(`RELEASE nested`)
+		return err
+	}
+	if _, err := db.tx.Exec(`RELEASE nested`); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
 	return nil
 }
 
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// CreateDeck inserts a deck and its cards in one transaction and sets its ID
+func (db *DB) CreateDeck(deck *models.Deck) error {
+	return db.withTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`INSERT INTO decks (user_id, name, format, created_at) VALUES (?, ?, ?, ?)`,
+			deck.UserID, deck.Name, nullString(deck.Format), deck.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create deck: %w", err)
+		}
+		if deck.ID, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to get deck ID: %w", err)
+		}
+
+		deck.CardCount = 0
+		for _, c := range deck.Cards {
+			_, err := tx.Exec(`INSERT INTO deck_cards (deck_id, section, name, card_id, quantity) VALUES (?, ?, ?, ?, ?)`,
+				deck.ID, c.Section, c.Name, nullString(c.CardID), c.Quantity)
+			if err != nil {
+				return fmt.Errorf("failed to add deck card: %w", err)
+			}
+			deck.CardCount += c.Quantity
+		}
+		return nil
+	})
+}
+
+// deckColumns selects a deck "d" with its card count
+const deckColumns = `d.id, d.user_id, d.name, COALESCE(d.format, ''), d.created_at,
+	COALESCE((SELECT SUM(quantity) FROM deck_cards WHERE deck_id = d.id), 0)`
+
+func scanDeck(row rowScanner) (*models.Deck, error) {
+	deck := &models.Deck{}
+	if err := row.Scan(&deck.ID, &deck.UserID, &deck.Name, &deck.Format, &deck.CreatedAt, &deck.CardCount); err != nil {
+		return nil, err
+	}
+	return deck, nil
+}
+
+// GetDeck retrieves a deck by ID without its cards
+func (db *DB) GetDeck(id int64) (*models.Deck, error) {
+	deck, err := scanDeck(db.QueryRow(`SELECT `+deckColumns+` FROM decks d WHERE d.id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get deck: %w", err)
+	}
+	return deck, nil
+}
+
+// GetUserDecks retrieves all of a user's decks without their cards
+func (db *DB) GetUserDecks(userID string) ([]models.Deck, error) {
+	rows, err := db.Query(`SELECT `+deckColumns+` FROM decks d WHERE d.user_id = ? ORDER BY d.name COLLATE NOCASE, d.id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get decks: %w", err)
+	}
+	defer rows.Close()
+
+	decks := []models.Deck{}
+	for rows.Next() {
+		deck, err := scanDeck(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deck: %w", err)
+		}
+		decks = append(decks, *deck)
+	}
+	return decks, rows.Err()
+}
+
+// GetDeckCards retrieves a deck's cards, commander first, then mainboard
+// and sideboard, in the order they were listed
+func (db *DB) GetDeckCards(deckID int64) ([]models.DeckCard, error) {
+	query := `SELECT dc.section, dc.name, COALESCE(dc.card_id, ''), dc.quantity, ` + prefixedCardColumns + `
+	          FROM deck_cards dc
+	          LEFT JOIN cards c ON dc.card_id = c.id
+	          WHERE dc.deck_id = ?
+	          ORDER BY CASE dc.section WHEN 'commander' THEN 0 WHEN 'mainboard' THEN 1 ELSE 2 END, dc.id`
+	rows, err := db.Query(query, deckID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deck cards: %w", err)
+	}
+	defer rows.Close()
+
+	cards := []models.DeckCard{}
+	for rows.Next() {
+		var dc models.DeckCard
+		var card nullableCard
+		if err := rows.Scan(append([]interface{}{&dc.Section, &dc.Name, &dc.CardID, &dc.Quantity}, card.fields()...)...); err != nil {
+			return nil, fmt.Errorf("failed to scan deck card: %w", err)
+		}
+		dc.Card = card.get()
+		cards = append(cards, dc)
+	}
+	return cards, rows.Err()
+}
+
+// DeleteDeck deletes a deck and its cards
+func (db *DB) DeleteDeck(id int64) error {
+	if _, err := db.Exec(`DELETE FROM decks WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete deck: %w", err)
+	}
+	return nil
+}
+
+// GetHoldingsByName counts the copies a user holds of each printing of the
+// named cards, keyed by card name and then card ID
+func (db *DB) GetHoldingsByName(userID string, names []string) (map[string]map[string]int, error) {
+	holdings := make(map[string]map[string]int)
+	if len(names) == 0 {
+		return holdings, nil
+	}
+
+	args := []interface{}{userID}
+	for _, name := range names {
+		args = append(args, name)
+	}
+	query := `SELECT c.name, i.card_id, SUM(i.quantity)
+	          FROM inventory i
+	          JOIN cards c ON i.card_id = c.id
+	          WHERE i.user_id = ? AND c.name IN (?` + strings.Repeat(", ?", len(names)-1) + `)
+	          GROUP BY c.name, i.card_id`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get holdings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, cardID string
+		var quantity int
+		if err := rows.Scan(&name, &cardID, &quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan holding: %w", err)
+		}
+		if holdings[name] == nil {
+			holdings[name] = make(map[string]int)
+		}
+		holdings[name][cardID] = quantity
+	}
+	return holdings, rows.Err()
+}
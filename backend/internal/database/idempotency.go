@@ -0,0 +1,71 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// ClaimIdempotencyKey records a key for a request about to be processed,
+// clearing out expired keys first. It returns nil if the key was claimed, or
+// the live key a previous request already holds. A key left without a
+// response by a request that never finished is claimed again.
+func (db *DB) ClaimIdempotencyKey(key *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	var existing *models.IdempotencyKey
+	err := db.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= ?`, key.CreatedAt); err != nil {
+			return fmt.Errorf("failed to expire idempotency keys: %w", err)
+		}
+
+		result, err := tx.Exec(`INSERT INTO idempotency_keys (user_id, key, fingerprint, created_at, expires_at)
+		                        VALUES (?, ?, ?, ?, ?)
+		                        ON CONFLICT (user_id, key) DO UPDATE SET fingerprint = excluded.fingerprint,
+		                            created_at = excluded.created_at, expires_at = excluded.expires_at
+		                        WHERE response IS NULL`,
+			key.UserID, key.Key, key.Fingerprint, key.CreatedAt, key.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to claim idempotency key: %w", err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to claim idempotency key: %w", err)
+		}
+		if n > 0 {
+			return nil
+		}
+
+		existing = &models.IdempotencyKey{UserID: key.UserID, Key: key.Key}
+		var response sql.NullString
+		err = tx.QueryRow(`SELECT fingerprint, response, created_at, expires_at FROM idempotency_keys WHERE user_id = ? AND key = ?`,
+			key.UserID, key.Key).Scan(&existing.Fingerprint, &response, &existing.CreatedAt, &existing.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to get idempotency key: %w", err)
+		}
+		if response.Valid {
+			existing.Response = []byte(response.String)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// SaveIdempotentResponse stores the response to the request holding a key
+func (db *DB) SaveIdempotentResponse(userID, key string, response []byte) error {
+	_, err := db.Exec(`UPDATE idempotency_keys SET response = ? WHERE user_id = ? AND key = ?`, string(response), userID, key)
+	if err != nil {
+		return fmt.Errorf("failed to save idempotent response: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey drops a key whose request failed, so it can be retried
+func (db *DB) ReleaseIdempotencyKey(userID, key string) error {
+	if _, err := db.Exec(`DELETE FROM idempotency_keys WHERE user_id = ? AND key = ?`, userID, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
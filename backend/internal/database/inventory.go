@@ -7,24 +7,215 @@ import (
 	"github.com/abzi/mtg_card_detector/internal/models"
 )
 
-// AddToInventory adds a card to user's inventory or increments quantity
-func (db *DB) AddToInventory(userID, cardID string, quantity int) error {
-	query := `INSERT INTO inventory (user_id, card_id, quantity)
-	          VALUES (?, ?, ?)
-	          ON CONFLICT(user_id, card_id)
-	          DO UPDATE SET quantity = quantity + ?`
-	_, err := db.Exec(query, userID, cardID, quantity, quantity)
+// inventoryColumns lists inventory columns in the order inventoryFields scans them
+const inventoryColumns = `i.id, i.user_id, i.card_id, i.quantity, i.finish, i.condition, i.language,
+	i.signed, i.altered, i.misprint, i.added_at`
+
+// inventoryFields returns scan destinations for inventoryColumns
+func inventoryFields(item *models.InventoryItem) []interface{} {
+	return []interface{}{&item.ID, &item.UserID, &item.CardID, &item.Quantity, &item.Finish, &item.Condition,
+		&item.Language, &item.Signed, &item.Altered, &item.Misprint, &item.AddedAt}
+}
+
+// copyKey is the WHERE clause matching an inventory entry by user, card and copy attributes
+const copyKey = `user_id = ? AND card_id = ? AND finish = ? AND condition = ? AND language = ?
+	AND signed = ? AND altered = ? AND misprint = ?`
+
+// copyKeyArgs returns the arguments for copyKey
+func copyKeyArgs(userID, cardID string, attrs models.CopyAttributes) []interface{} {
+	return []interface{}{userID, cardID, attrs.Finish, attrs.Condition, attrs.Language,
+		attrs.Signed, attrs.Altered, attrs.Misprint}
+}
+
+// AddToInventory adds copies of a card with the given attributes to user's
+// inventory or increments the quantity of the matching entry, returning the
+// updated entry. A non-zero locationID places the new copies at that location.
+// The change is recorded in the ledger as coming from source.
+func (db *DB) AddToInventory(userID, cardID string, attrs models.CopyAttributes, quantity int, locationID int64, source models.LedgerSource) (*models.InventoryItem, error) {
+	var item *models.InventoryItem
+	err := db.withTx(func(tx *sql.Tx) error {
+		inventoryID, err := addToInventory(tx, userID, cardID, attrs, quantity, locationID, source)
+		if err != nil {
+			return err
+		}
+		item, err = getInventoryItem(tx, inventoryID)
+		return err
+	})
+	return item, err
+}
+
+// AddItemsToInventory adds each item's quantity of its card and copy
+// attributes in a single transaction, so either all are added or none
+func (db *DB) AddItemsToInventory(userID string, items []models.InventoryItem, source models.LedgerSource) error {
+	return db.withTx(func(tx *sql.Tx) error {
+		for _, item := range items {
+			if _, err := addToInventory(tx, userID, item.CardID, item.CopyAttributes, item.Quantity, 0, source); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// addToInventory upserts copies within a transaction, places them at the
+// location (0 for unplaced) and records the change, returning the inventory
+// entry's ID
+func addToInventory(tx *sql.Tx, userID, cardID string, attrs models.CopyAttributes, quantity int, locationID int64, source models.LedgerSource) (int, error) {
+	query := `INSERT INTO inventory (user_id, card_id, finish, condition, language, signed, altered, misprint, quantity)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	          ON CONFLICT(user_id, card_id, finish, condition, language, signed, altered, misprint)
+	          DO UPDATE SET quantity = quantity + excluded.quantity
+	          RETURNING id`
+	args := append(copyKeyArgs(userID, cardID, attrs), quantity)
+	var inventoryID int
+	if err := tx.QueryRow(query, args...).Scan(&inventoryID); err != nil {
+		return 0, fmt.Errorf("failed to add to inventory: %w", err)
+	}
+	if _, err := recordChange(tx, userID, cardID, attrs, quantity, source); err != nil {
+		return 0, err
+	}
+
+	if locationID != 0 {
+		if err := addPlacement(tx, inventoryID, locationID, quantity, 0, 0); err != nil {
+			return 0, err
+		}
+	}
+	return inventoryID, nil
+}
+
+// SetInventoryQuantity sets the number of copies of a card with the given
+// attributes, removing the entry at zero
+func (db *DB) SetInventoryQuantity(userID, cardID string, attrs models.CopyAttributes, quantity int, source models.LedgerSource) (*models.InventoryItem, error) {
+	return db.updateQuantity(userID, cardID, attrs, source, func(current int, exists bool) (int, error) {
+		if !exists && quantity == 0 {
+			return 0, ErrNotInInventory
+		}
+		return quantity, nil
+	})
+}
+
+// AdjustInventoryQuantity adds delta copies of a card with the given
+// attributes, or removes them if negative. Removing more copies than are held
+// fails with ErrNotEnoughCopies.
+func (db *DB) AdjustInventoryQuantity(userID, cardID string, attrs models.CopyAttributes, delta int, source models.LedgerSource) (*models.InventoryItem, error) {
+	return db.updateQuantity(userID, cardID, attrs, source, func(current int, exists bool) (int, error) {
+		if !exists && delta <= 0 {
+			return 0, ErrNotInInventory
+		}
+		if current+delta < 0 {
+			return 0, ErrNotEnoughCopies
+		}
+		return current + delta, nil
+	})
+}
+
+// RemoveFromInventory removes up to quantity copies of a card with the given
+// attributes, deleting the entry when none are left. The returned entry has
+// the remaining quantity.
+func (db *DB) RemoveFromInventory(userID, cardID string, attrs models.CopyAttributes, quantity int, source models.LedgerSource) (*models.InventoryItem, error) {
+	return db.updateQuantity(userID, cardID, attrs, source, func(current int, exists bool) (int, error) {
+		if !exists {
+			return 0, ErrNotInInventory
+		}
+		return max(current-quantity, 0), nil
+	})
+}
+
+// updateQuantity reads an inventory entry's quantity, computes the new one
+// with update and writes it back in one transaction with its ledger entry,
+// deleting the entry at zero and trimming placements so no more copies are
+// placed than remain.
+// Transactions take the write lock when they begin (see New), so concurrent
+// updates of the same entry serialize instead of racing.
+func (db *DB) updateQuantity(userID, cardID string, attrs models.CopyAttributes, source models.LedgerSource, update func(current int, exists bool) (int, error)) (*models.InventoryItem, error) {
+	key := copyKeyArgs(userID, cardID, attrs)
+
+	var item *models.InventoryItem
+	err := db.withTx(func(tx *sql.Tx) error {
+		var inventoryID, current int
+		err := tx.QueryRow(`SELECT id, quantity FROM inventory WHERE `+copyKey, key...).Scan(&inventoryID, &current)
+		exists := err == nil
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to check inventory: %w", err)
+		}
+
+		quantity, err := update(current, exists)
+		if err != nil {
+			return err
+		}
+		if quantity != current {
+			if _, err := recordChange(tx, userID, cardID, attrs, quantity-current, source); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case quantity == 0:
+			if item, err = getInventoryItem(tx, inventoryID); err != nil {
+				return err
+			}
+			item.Quantity = 0
+			item.Locations = nil
+			_, err = tx.Exec(`DELETE FROM inventory WHERE id = ?`, inventoryID)
+			if err != nil {
+				return fmt.Errorf("failed to remove from inventory: %w", err)
+			}
+			return nil
+		case !exists:
+			query := `INSERT INTO inventory (user_id, card_id, finish, condition, language, signed, altered, misprint, quantity)
+			          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			          RETURNING id`
+			if err := tx.QueryRow(query, append(key, quantity)...).Scan(&inventoryID); err != nil {
+				return fmt.Errorf("failed to add to inventory: %w", err)
+			}
+		default:
+			if _, err := tx.Exec(`UPDATE inventory SET quantity = ? WHERE id = ?`, quantity, inventoryID); err != nil {
+				return fmt.Errorf("failed to update inventory: %w", err)
+			}
+			if err := trimPlacements(tx, inventoryID); err != nil {
+				return err
+			}
+		}
+
+		item, err = getInventoryItem(tx, inventoryID)
+		return err
+	})
+	return item, err
+}
+
+// getInventoryItem reads an inventory entry with its card and placements
+func getInventoryItem(tx *sql.Tx, inventoryID int) (*models.InventoryItem, error) {
+	query := `SELECT ` + inventoryColumns + `, ` + prefixedCardColumns + `
+	          FROM inventory i
+	          JOIN cards c ON i.card_id = c.id
+	          WHERE i.id = ?`
+
+	item := &models.InventoryItem{Card: &models.Card{}}
+	fields := append(inventoryFields(item), cardFields(item.Card)...)
+	if err := tx.QueryRow(query, inventoryID).Scan(fields...); err != nil {
+		return nil, fmt.Errorf("failed to get inventory item: %w", err)
+	}
+
+	rows, err := tx.Query(`SELECT location_id, quantity, page, slot FROM inventory_locations
+	                       WHERE inventory_id = ? ORDER BY location_id, page, slot`, inventoryID)
 	if err != nil {
-		return fmt.Errorf("failed to add to inventory: %w", err)
+		return nil, fmt.Errorf("failed to get placements: %w", err)
 	}
-	return nil
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Placement
+		if err := rows.Scan(&p.LocationID, &p.Quantity, &p.Page, &p.Slot); err != nil {
+			return nil, fmt.Errorf("failed to scan placement: %w", err)
+		}
+		item.Locations = append(item.Locations, p)
+	}
+	return item, rows.Err()
 }
 
 // GetUserInventory retrieves all cards in user's inventory
 func (db *DB) GetUserInventory(userID string) ([]models.InventoryItem, error) {
-	query := `SELECT i.id, i.user_id, i.card_id, i.quantity, i.added_at,
-	                 c.id, c.scryfall_id, c.name, c.set_code, c.collector_number,
-	                 c.image_uri, c.oracle_text, c.type_line, c.mana_cost, c.rarity, c.created_at
+	query := `SELECT ` + inventoryColumns + `, ` + prefixedCardColumns + `
 	          FROM inventory i
 	          JOIN cards c ON i.card_id = c.id
 	          WHERE i.user_id = ?
@@ -40,43 +231,26 @@ func (db *DB) GetUserInventory(userID string) ([]models.InventoryItem, error) {
 	for rows.Next() {
 		var item models.InventoryItem
 		item.Card = &models.Card{}
-		err := rows.Scan(&item.ID, &item.UserID, &item.CardID, &item.Quantity, &item.AddedAt,
-			&item.Card.ID, &item.Card.ScryfallID, &item.Card.Name, &item.Card.SetCode, &item.Card.CollectorNumber,
-			&item.Card.ImageURI, &item.Card.OracleText, &item.Card.TypeLine, &item.Card.ManaCost,
-			&item.Card.Rarity, &item.Card.CreatedAt)
+		fields := append(inventoryFields(&item), cardFields(item.Card)...)
+		err := rows.Scan(fields...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan inventory item: %w", err)
 		}
 		items = append(items, item)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get inventory: %w", err)
+	}
 
-	return items, nil
-}
-
-// RemoveFromInventory removes a card from inventory or decrements quantity
-func (db *DB) RemoveFromInventory(userID, cardID string, quantity int) error {
-	// First check current quantity
-	var currentQty int
-	err := db.QueryRow(`SELECT quantity FROM inventory WHERE user_id = ? AND card_id = ?`, userID, cardID).Scan(&currentQty)
+	placements, err := db.getUserPlacements(userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("card not found in inventory")
-		}
-		return fmt.Errorf("failed to check inventory: %w", err)
+		return nil, err
 	}
-
-	if currentQty <= quantity {
-		// Remove completely
-		_, err = db.Exec(`DELETE FROM inventory WHERE user_id = ? AND card_id = ?`, userID, cardID)
-	} else {
-		// Decrement quantity
-		_, err = db.Exec(`UPDATE inventory SET quantity = quantity - ? WHERE user_id = ? AND card_id = ?`, quantity, userID, cardID)
+	for i := range items {
+		items[i].Locations = placements[items[i].ID]
 	}
 
-	if err != nil {
-		return fmt.Errorf("failed to remove from inventory: %w", err)
-	}
-	return nil
+	return items, nil
 }
 
 // GetInventoryCount returns total number of cards in user's inventory
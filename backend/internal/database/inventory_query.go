@@ -0,0 +1,245 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// sqliteTimeFormat is the format of CURRENT_TIMESTAMP values, so time
+// parameters compare correctly against columns defaulting to it
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// inventorySort is an inventory sort order. Pages are keyed on the sort
+// expression and the entry ID, so cursors stay stable as entries are added.
+type inventorySort struct {
+	expr string // ORDER BY and cursor comparison expression
+	key  string // expression selected as the cursor key
+}
+
+var inventorySorts = map[string]inventorySort{
+	"name":     {expr: "c.name COLLATE NOCASE", key: "c.name"},
+	"set":      {expr: "c.set_code", key: "c.set_code"},
+	"quantity": {expr: "i.quantity", key: "i.quantity"},
+	"added_at": {expr: "i.added_at", key: "CAST(i.added_at AS TEXT)"}, // raw text, as compared
+}
+
+// valueSort orders entries by the market value of their copies in a
+// currency, with unpriced entries valued at 0
+func valueSort(currency string) (inventorySort, error) {
+	switch currency {
+	case "":
+		currency = models.CurrencyUSD
+	case models.CurrencyUSD, models.CurrencyEUR:
+	default:
+		return inventorySort{}, fmt.Errorf("%w: unknown currency %q", ErrInvalidQuery, currency)
+	}
+
+	// The currency is one of the constants above, so it's safe to inline
+	expr := `COALESCE((SELECT p.price FROM card_prices p
+	                   WHERE p.card_id = i.card_id AND p.currency = '` + currency + `' AND p.finish = i.finish), 0) * i.quantity`
+	return inventorySort{expr: expr, key: expr}, nil
+}
+
+// inventoryCursor is the position after the last entry of a page
+type inventoryCursor struct {
+	Key interface{} `json:"k"`
+	ID  int         `json:"id"`
+}
+
+// QueryInventory retrieves a page of a user's inventory matching the query's
+// filters, in the query's sort order, with totals over all matching entries
+func (db *DB) QueryInventory(userID string, q *models.InventoryQuery) (*models.InventoryPage, error) {
+	sortName := q.Sort
+	if sortName == "" {
+		sortName = "added_at"
+	}
+	sort, ok := inventorySorts[sortName]
+	if sortName == "value" {
+		var err error
+		if sort, err = valueSort(q.Currency); err != nil {
+			return nil, err
+		}
+	} else if !ok {
+		return nil, fmt.Errorf("%w: unknown sort %q", ErrInvalidQuery, q.Sort)
+	}
+
+	where, args, err := inventoryFilters(userID, q)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.InventoryPage{Items: []models.InventoryItem{}}
+
+	// Totals ignore the cursor so every page reports the same numbers
+	countQuery := `SELECT COUNT(*), COALESCE(SUM(i.quantity), 0)
+	               FROM inventory i
+	               JOIN cards c ON i.card_id = c.id
+	               WHERE ` + where
+	if err := db.QueryRow(countQuery, args...).Scan(&page.TotalEntries, &page.TotalCards); err != nil {
+		return nil, fmt.Errorf("failed to count inventory: %w", err)
+	}
+
+	direction, compare := "ASC", ">"
+	if q.Descending {
+		direction, compare = "DESC", "<"
+	}
+
+	if q.Cursor != "" {
+		cursor, err := decodeInventoryCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		where += fmt.Sprintf(` AND (%[1]s %[2]s ? OR (%[1]s = ? AND i.id %[2]s ?))`, sort.expr, compare)
+		args = append(args, cursor.Key, cursor.Key, cursor.ID)
+	}
+
+	query := `SELECT ` + inventoryColumns + `, ` + prefixedCardColumns + `, ` + sort.key + `
+	          FROM inventory i
+	          JOIN cards c ON i.card_id = c.id
+	          WHERE ` + where + `
+	          ORDER BY ` + sort.expr + ` ` + direction + `, i.id ` + direction + `
+	          LIMIT ?`
+	// Fetch one extra entry to learn whether there is a next page
+	rows, err := db.Query(query, append(args, q.Limit+1)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query inventory: %w", err)
+	}
+	defer rows.Close()
+
+	var lastKey interface{}
+	for rows.Next() {
+		if len(page.Items) == q.Limit {
+			page.NextCursor = encodeInventoryCursor(inventoryCursor{Key: lastKey, ID: page.Items[len(page.Items)-1].ID})
+			break
+		}
+
+		var item models.InventoryItem
+		item.Card = &models.Card{}
+		fields := append(inventoryFields(&item), cardFields(item.Card)...)
+		if err := rows.Scan(append(fields, &lastKey)...); err != nil {
+			return nil, fmt.Errorf("failed to scan inventory item: %w", err)
+		}
+		page.Items = append(page.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query inventory: %w", err)
+	}
+	page.Count = len(page.Items)
+
+	if err := db.attachPlacements(page.Items); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// inventoryFilters builds the WHERE clause for an inventory query
+func inventoryFilters(userID string, q *models.InventoryQuery) (string, []interface{}, error) {
+	conditions := []string{"i.user_id = ?"}
+	args := []interface{}{userID}
+
+	if q.Name != "" {
+		conditions = append(conditions, `c.name LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(q.Name)+"%")
+	}
+	if q.SetCode != "" {
+		conditions = append(conditions, "c.set_code = ?")
+		args = append(args, strings.ToUpper(q.SetCode))
+	}
+	if q.Rarity != "" {
+		conditions = append(conditions, "c.rarity = ?")
+		args = append(args, strings.ToLower(q.Rarity))
+	}
+	if q.TypeLine != "" {
+		conditions = append(conditions, `c.type_line LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(q.TypeLine)+"%")
+	}
+	if q.Colors != "" {
+		colors := strings.ToUpper(q.Colors)
+		if colors == "C" {
+			conditions = append(conditions, "COALESCE(c.colors, '') = ''")
+		} else {
+			for _, color := range colors {
+				if !strings.ContainsRune("WUBRG", color) {
+					return "", nil, fmt.Errorf("%w: unknown color %q", ErrInvalidQuery, color)
+				}
+				conditions = append(conditions, "instr(COALESCE(c.colors, ''), ?) > 0")
+				args = append(args, string(color))
+			}
+		}
+	}
+	if q.AddedAfter != nil {
+		conditions = append(conditions, "i.added_at >= ?")
+		args = append(args, q.AddedAfter.UTC().Format(sqliteTimeFormat))
+	}
+	if q.AddedBefore != nil {
+		conditions = append(conditions, "i.added_at < ?")
+		args = append(args, q.AddedBefore.UTC().Format(sqliteTimeFormat))
+	}
+	if q.LocationID != 0 {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM inventory_locations p WHERE p.inventory_id = i.id AND p.location_id = ?)")
+		args = append(args, q.LocationID)
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func encodeInventoryCursor(c inventoryCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeInventoryCursor(s string) (*inventoryCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var c inventoryCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Key == nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return &c, nil
+}
+
+// attachPlacements loads the placements of the given inventory entries
+func (db *DB) attachPlacements(items []models.InventoryItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	index := make(map[int]int, len(items))
+	args := make([]interface{}, len(items))
+	for i, item := range items {
+		index[item.ID] = i
+		args[i] = item.ID
+	}
+
+	query := `SELECT inventory_id, location_id, quantity, page, slot
+	          FROM inventory_locations
+	          WHERE inventory_id IN (?` + strings.Repeat(", ?", len(items)-1) + `)
+	          ORDER BY location_id, page, slot`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to get placements: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var inventoryID int
+		var p models.Placement
+		if err := rows.Scan(&inventoryID, &p.LocationID, &p.Quantity, &p.Page, &p.Slot); err != nil {
+			return fmt.Errorf("failed to scan placement: %w", err)
+		}
+		item := &items[index[inventoryID]]
+		item.Locations = append(item.Locations, p)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// cardTypes selects the card types counted in the type breakdown. Tribal is
+// the older name of Kindred on printings before the rename.
+const cardTypes = `SELECT 'Artifact' AS name UNION ALL SELECT 'Battle' UNION ALL SELECT 'Creature'
+	UNION ALL SELECT 'Enchantment' UNION ALL SELECT 'Instant' UNION ALL SELECT 'Kindred'
+	UNION ALL SELECT 'Land' UNION ALL SELECT 'Planeswalker' UNION ALL SELECT 'Sorcery'
+	UNION ALL SELECT 'Tribal'`
+
+// statBreakdowns are the grouped inventory breakdowns, as the grouping key
+// expression and any extra FROM and WHERE clauses
+var statBreakdowns = []struct {
+	key   string
+	from  string
+	where string
+	dest  func(stats *models.InventoryStats) *[]models.StatBucket
+}{
+	{
+		key:  "c.set_code",
+		dest: func(s *models.InventoryStats) *[]models.StatBucket { return &s.BySet },
+	},
+	{
+		key:  "c.rarity",
+		dest: func(s *models.InventoryStats) *[]models.StatBucket { return &s.ByRarity },
+	},
+	{
+		key:  "COALESCE(NULLIF(c.color_identity, ''), 'C')",
+		dest: func(s *models.InventoryStats) *[]models.StatBucket { return &s.ByColorIdentity },
+	},
+	{
+		key:   "t.name",
+		from:  "JOIN (" + cardTypes + ") t",
+		where: "(' ' || c.type_line || ' ') LIKE '% ' || t.name || ' %'",
+		dest:  func(s *models.InventoryStats) *[]models.StatBucket { return &s.ByType },
+	},
+	{
+		key:   "CASE WHEN COALESCE(c.cmc, 0) >= 7 THEN '7+' ELSE CAST(CAST(COALESCE(c.cmc, 0) AS INTEGER) AS TEXT) END",
+		where: "c.type_line NOT LIKE '%Land%'",
+		dest:  func(s *models.InventoryStats) *[]models.StatBucket { return &s.ByManaValue },
+	},
+}
+
+// GetInventoryStats aggregates a user's inventory totals and breakdowns
+func (db *DB) GetInventoryStats(userID string) (*models.InventoryStats, error) {
+	stats := &models.InventoryStats{}
+
+	query := `SELECT COALESCE(SUM(i.quantity), 0), COUNT(DISTINCT i.card_id), COUNT(DISTINCT c.name)
+	          FROM inventory i
+	          JOIN cards c ON i.card_id = c.id
+	          WHERE i.user_id = ?`
+	if err := db.QueryRow(query, userID).Scan(&stats.TotalCards, &stats.UniqueCards, &stats.UniqueNames); err != nil {
+		return nil, fmt.Errorf("failed to get inventory totals: %w", err)
+	}
+
+	var lastUpdated sql.NullTime
+	if err := db.QueryRow(`SELECT inventory_updated_at FROM users WHERE id = ?`, userID).Scan(&lastUpdated); err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get inventory update time: %w", err)
+	}
+	if lastUpdated.Valid {
+		stats.LastUpdated = &lastUpdated.Time
+	}
+
+	for _, b := range statBreakdowns {
+		where := "i.user_id = ?"
+		if b.where != "" {
+			where += " AND " + b.where
+		}
+
+		// The subquery names the key so SQLite groups on the computed value
+		query := `SELECT key, SUM(quantity), COUNT(DISTINCT card_id) FROM (
+		              SELECT ` + b.key + ` AS key, i.quantity, i.card_id
+		              FROM inventory i
+		              JOIN cards c ON i.card_id = c.id ` + b.from + `
+		              WHERE ` + where + `
+		          )
+		          GROUP BY key
+		          ORDER BY SUM(quantity) DESC, key`
+		buckets, err := db.queryStatBuckets(query, userID)
+		if err != nil {
+			return nil, err
+		}
+		*b.dest(stats) = buckets
+	}
+
+	return stats, nil
+}
+
+func (db *DB) queryStatBuckets(query string, args ...interface{}) ([]models.StatBucket, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory breakdown: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := []models.StatBucket{}
+	for rows.Next() {
+		var b models.StatBucket
+		if err := rows.Scan(&b.Key, &b.Cards, &b.UniqueCards); err != nil {
+			return nil, fmt.Errorf("failed to scan inventory breakdown: %w", err)
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
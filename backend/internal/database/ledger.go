@@ -0,0 +1,334 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// recordChange appends an inventory change to the ledger within a
+// transaction, returning the entry's ID
+func recordChange(tx *sql.Tx, userID, cardID string, attrs models.CopyAttributes, delta int, source models.LedgerSource) (int64, error) {
+	query := `INSERT INTO inventory_ledger (user_id, card_id, finish, condition, language, signed, altered, misprint,
+	          delta, source, session_id, scan_id, trade_id, reverts_id)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	args := append(copyKeyArgs(userID, cardID, attrs), delta, source.Source, nullInt(int64(source.SessionID)),
+		nullInt(source.ScanID), nullInt(source.TradeID), nullInt(source.RevertsID))
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record inventory change: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get ledger entry ID: %w", err)
+	}
+	return id, nil
+}
+
+// nullInt converts an optional ID, 0 when absent, to a nullable column value
+func nullInt(n int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: n, Valid: n != 0}
+}
+
+// removeCopies takes copies of a card with the given attributes out of a
+// user's inventory within a transaction and records the change, deleting the
+// entry when none are left and trimming its placements otherwise
+func removeCopies(tx *sql.Tx, userID, cardID string, attrs models.CopyAttributes, quantity int, source models.LedgerSource) error {
+	var inventoryID, held int
+	err := tx.QueryRow(`SELECT id, quantity FROM inventory WHERE `+copyKey, copyKeyArgs(userID, cardID, attrs)...).Scan(&inventoryID, &held)
+	if err == sql.ErrNoRows {
+		return ErrNotInInventory
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check inventory: %w", err)
+	}
+	if held < quantity {
+		return ErrNotEnoughCopies
+	}
+
+	if held == quantity {
+		if _, err := tx.Exec(`DELETE FROM inventory WHERE id = ?`, inventoryID); err != nil {
+			return fmt.Errorf("failed to remove from inventory: %w", err)
+		}
+	} else {
+		if _, err := tx.Exec(`UPDATE inventory SET quantity = quantity - ? WHERE id = ?`, quantity, inventoryID); err != nil {
+			return fmt.Errorf("failed to update inventory: %w", err)
+		}
+		if err := trimPlacements(tx, inventoryID); err != nil {
+			return err
+		}
+	}
+
+	_, err = recordChange(tx, userID, cardID, attrs, -quantity, source)
+	return err
+}
+
+// ledgerColumns selects a ledger entry "l", the undo entry "u" reverting it
+// and its card "c"
+const ledgerColumns = `l.id, l.user_id, l.card_id, l.finish, l.condition, l.language, l.signed, l.altered, l.misprint,
+	l.delta, l.source, COALESCE(l.session_id, 0), COALESCE(l.scan_id, 0), COALESCE(l.trade_id, 0), COALESCE(l.reverts_id, 0),
+	COALESCE(u.id, 0), l.created_at, ` + prefixedCardColumns
+
+const ledgerFrom = `FROM inventory_ledger l
+	LEFT JOIN inventory_ledger u ON u.reverts_id = l.id
+	JOIN cards c ON l.card_id = c.id`
+
+func scanLedgerEntry(row rowScanner) (*models.LedgerEntry, error) {
+	e := &models.LedgerEntry{Card: &models.Card{}}
+	fields := append([]interface{}{&e.ID, &e.UserID, &e.CardID, &e.Finish, &e.Condition, &e.Language, &e.Signed, &e.Altered,
+		&e.Misprint, &e.Delta, &e.Source, &e.SessionID, &e.ScanID, &e.TradeID, &e.RevertsID, &e.RevertedBy, &e.CreatedAt},
+		cardFields(e.Card)...)
+	if err := row.Scan(fields...); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// GetLedgerEntry retrieves a ledger entry by ID
+func (db *DB) GetLedgerEntry(id int64) (*models.LedgerEntry, error) {
+	entry, err := scanLedgerEntry(db.QueryRow(`SELECT `+ledgerColumns+` `+ledgerFrom+` WHERE l.id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get ledger entry: %w", err)
+	}
+	return entry, nil
+}
+
+// QueryLedger retrieves a page of a user's ledger entries matching the
+// query's filters, newest first. The cursor is the ID of the last entry of
+// the previous page.
+func (db *DB) QueryLedger(userID string, q *models.LedgerQuery) (*models.LedgerPage, error) {
+	where := []string{"l.user_id = ?"}
+	args := []interface{}{userID}
+	if q.Source != "" {
+		where = append(where, "l.source = ?")
+		args = append(args, q.Source)
+	}
+	if q.SessionID != 0 {
+		where = append(where, "l.session_id = ?")
+		args = append(args, q.SessionID)
+	}
+	if q.CardID != "" {
+		where = append(where, "l.card_id = ?")
+		args = append(args, q.CardID)
+	}
+	if q.Cursor != "" {
+		before, err := strconv.ParseInt(q.Cursor, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+		}
+		where = append(where, "l.id < ?")
+		args = append(args, before)
+	}
+
+	// Fetch one extra entry to know whether there is another page
+	query := `SELECT ` + ledgerColumns + ` ` + ledgerFrom + `
+	          WHERE ` + strings.Join(where, " AND ") + `
+	          ORDER BY l.id DESC
+	          LIMIT ?`
+	rows, err := db.Query(query, append(args, q.Limit+1)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ledger: %w", err)
+	}
+	defer rows.Close()
+
+	page := &models.LedgerPage{Entries: []models.LedgerEntry{}}
+	for rows.Next() {
+		entry, err := scanLedgerEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ledger entry: %w", err)
+		}
+		page.Entries = append(page.Entries, *entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query ledger: %w", err)
+	}
+
+	if len(page.Entries) > q.Limit {
+		page.Entries = page.Entries[:q.Limit]
+		page.NextCursor = strconv.FormatInt(page.Entries[q.Limit-1].ID, 10)
+	}
+	page.Count = len(page.Entries)
+	return page, nil
+}
+
+// GetSessionLedger retrieves the ledger entries a scan session made that
+// haven't been reverted, newest first
+func (db *DB) GetSessionLedger(sessionID int) ([]models.LedgerEntry, error) {
+	query := `SELECT ` + ledgerColumns + ` ` + ledgerFrom + `
+	          WHERE l.session_id = ? AND l.source = ? AND u.id IS NULL
+	          ORDER BY l.id DESC`
+	rows, err := db.Query(query, sessionID, models.LedgerScan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session ledger: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.LedgerEntry{}
+	for rows.Next() {
+		entry, err := scanLedgerEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ledger entry: %w", err)
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, rows.Err()
+}
+
+// RevertLedgerEntries reverses ledger entries in order within one
+// transaction, recording an undo entry for each, and returns the undo entries.
+// Reverting a scan's entry also marks the scan undone, takes it off its
+// session's successful scans and gives back the wishlist copy it ticked off.
+// Removing copies that are no longer held fails with ErrNotInInventory or
+// ErrNotEnoughCopies and reverts none of them. Reverting an entry twice is
+// rejected by the ledger's unique reverts_id.
+func (db *DB) RevertLedgerEntries(entries []models.LedgerEntry) ([]models.LedgerEntry, error) {
+	var ids []int64
+	err := db.withTx(func(tx *sql.Tx) error {
+		for _, e := range entries {
+			source := models.LedgerSource{Source: models.LedgerUndo, SessionID: e.SessionID, RevertsID: e.ID}
+			if e.Delta > 0 {
+				if err := removeCopies(tx, e.UserID, e.CardID, e.CopyAttributes, e.Delta, source); err != nil {
+					return err
+				}
+			} else if _, err := addToInventory(tx, e.UserID, e.CardID, e.CopyAttributes, -e.Delta, 0, source); err != nil {
+				return err
+			}
+			if e.ScanID != 0 {
+				if err := undoScan(tx, e.ScanID); err != nil {
+					return err
+				}
+			}
+
+			var id int64
+			if err := tx.QueryRow(`SELECT id FROM inventory_ledger WHERE reverts_id = ?`, e.ID).Scan(&id); err != nil {
+				return fmt.Errorf("failed to get undo entry: %w", err)
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	undone := make([]models.LedgerEntry, 0, len(ids))
+	for _, id := range ids {
+		entry, err := db.GetLedgerEntry(id)
+		if err != nil {
+			return nil, err
+		}
+		undone = append(undone, *entry)
+	}
+	return undone, nil
+}
+
+// undoScan marks a committed scan undone within a transaction and takes back
+// what it counted towards its session and the wishlist
+func undoScan(tx *sql.Tx, scanID int64) error {
+	var sessionID, wishlistID sql.NullInt64
+	query := `UPDATE scans SET status = ? WHERE id = ? AND status = ?
+	          RETURNING session_id, wishlist_id`
+	err := tx.QueryRow(query, models.ScanStatusUndone, scanID, models.ScanStatusCommitted).Scan(&sessionID, &wishlistID)
+	if err == sql.ErrNoRows {
+		// The scan was deleted along with its user
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to undo scan: %w", err)
+	}
+
+	if sessionID.Valid {
+		query := `UPDATE scan_sessions SET successful_scans = successful_scans - 1 WHERE id = ? AND successful_scans > 0`
+		if _, err := tx.Exec(query, sessionID.Int64); err != nil {
+			return fmt.Errorf("failed to update scan session: %w", err)
+		}
+	}
+	if wishlistID.Valid {
+		query := `UPDATE wishlist SET acquired = acquired - 1 WHERE id = ? AND acquired > 0`
+		if _, err := tx.Exec(query, wishlistID.Int64); err != nil {
+			return fmt.Errorf("failed to update wishlist: %w", err)
+		}
+	}
+	return nil
+}
+
+// CheckLedger rebuilds a user's quantities from the ledger and compares them
+// with the inventory
+func (db *DB) CheckLedger(userID string) (*models.LedgerCheck, error) {
+	type ledgerKey struct {
+		cardID string
+		attrs  models.CopyAttributes
+	}
+	quantities := make(map[ledgerKey]*models.LedgerDiscrepancy)
+	get := func(k ledgerKey) *models.LedgerDiscrepancy {
+		d, ok := quantities[k]
+		if !ok {
+			d = &models.LedgerDiscrepancy{CardID: k.cardID, CopyAttributes: k.attrs}
+			quantities[k] = d
+		}
+		return d
+	}
+
+	check := &models.LedgerCheck{Discrepancies: []models.LedgerDiscrepancy{}}
+	rows, err := db.Query(`SELECT card_id, finish, condition, language, signed, altered, misprint, SUM(delta), COUNT(*)
+	                       FROM inventory_ledger WHERE user_id = ?
+	                       GROUP BY card_id, finish, condition, language, signed, altered, misprint`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rebuild inventory from ledger: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k ledgerKey
+		var quantity, entries int
+		if err := rows.Scan(&k.cardID, &k.attrs.Finish, &k.attrs.Condition, &k.attrs.Language, &k.attrs.Signed,
+			&k.attrs.Altered, &k.attrs.Misprint, &quantity, &entries); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger quantity: %w", err)
+		}
+		get(k).LedgerQuantity = quantity
+		check.Entries += entries
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to rebuild inventory from ledger: %w", err)
+	}
+
+	rows, err = db.Query(`SELECT card_id, finish, condition, language, signed, altered, misprint, quantity
+	                      FROM inventory WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k ledgerKey
+		var quantity int
+		if err := rows.Scan(&k.cardID, &k.attrs.Finish, &k.attrs.Condition, &k.attrs.Language, &k.attrs.Signed,
+			&k.attrs.Altered, &k.attrs.Misprint, &quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan inventory quantity: %w", err)
+		}
+		get(k).InventoryQuantity = quantity
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get inventory: %w", err)
+	}
+
+	for _, d := range quantities {
+		if d.LedgerQuantity != d.InventoryQuantity {
+			check.Discrepancies = append(check.Discrepancies, *d)
+		}
+	}
+	sort.Slice(check.Discrepancies, func(i, j int) bool {
+		a, b := check.Discrepancies[i], check.Discrepancies[j]
+		if a.CardID != b.CardID {
+			return a.CardID < b.CardID
+		}
+		return fmt.Sprint(a.CopyAttributes) < fmt.Sprint(b.CopyAttributes)
+	})
+	check.Consistent = len(check.Discrepancies) == 0
+	return check, nil
+}
@@ -0,0 +1,305 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+const locationColumns = `id, user_id, parent_id, name, kind, created_at`
+
+// scanLocation scans a row of locationColumns
+func scanLocation(row rowScanner) (*models.Location, error) {
+	loc := &models.Location{}
+	var parentID sql.NullInt64
+	if err := row.Scan(&loc.ID, &loc.UserID, &parentID, &loc.Name, &loc.Kind, &loc.CreatedAt); err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		loc.ParentID = &parentID.Int64
+	}
+	return loc, nil
+}
+
+// CreateLocation inserts a new location and sets its ID
+func (db *DB) CreateLocation(loc *models.Location) error {
+	var parentID sql.NullInt64
+	if loc.ParentID != nil {
+		parentID = sql.NullInt64{Int64: *loc.ParentID, Valid: true}
+	}
+
+	query := `INSERT INTO locations (user_id, parent_id, name, kind, created_at) VALUES (?, ?, ?, ?, ?)`
+	result, err := db.Exec(query, loc.UserID, parentID, loc.Name, loc.Kind, loc.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create location: %w", err)
+	}
+
+	loc.ID, err = result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get location ID: %w", err)
+	}
+	return nil
+}
+
+// GetLocation retrieves a location by ID
+func (db *DB) GetLocation(id int64) (*models.Location, error) {
+	loc, err := scanLocation(db.QueryRow(`SELECT `+locationColumns+` FROM locations WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get location: %w", err)
+	}
+	return loc, nil
+}
+
+// GetUserLocations retrieves all of a user's locations
+func (db *DB) GetUserLocations(userID string) ([]models.Location, error) {
+	return db.queryLocations(`SELECT `+locationColumns+` FROM locations WHERE user_id = ? ORDER BY name`, userID)
+}
+
+// GetChildLocations retrieves the locations directly inside a location
+func (db *DB) GetChildLocations(id int64) ([]models.Location, error) {
+	return db.queryLocations(`SELECT `+locationColumns+` FROM locations WHERE parent_id = ? ORDER BY name`, id)
+}
+
+func (db *DB) queryLocations(query string, args ...interface{}) ([]models.Location, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get locations: %w", err)
+	}
+	defer rows.Close()
+
+	locations := []models.Location{}
+	for rows.Next() {
+		loc, err := scanLocation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan location: %w", err)
+		}
+		locations = append(locations, *loc)
+	}
+	return locations, rows.Err()
+}
+
+// DeleteLocation deletes a location and the locations nested in it. Cards
+// stored in them stay in inventory as unplaced copies.
+func (db *DB) DeleteLocation(id int64) error {
+	if _, err := db.Exec(`DELETE FROM locations WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete location: %w", err)
+	}
+	return nil
+}
+
+// GetCurrentLocation returns the location a user's scans land in, or 0 for none
+func (db *DB) GetCurrentLocation(userID string) (int64, error) {
+	var locationID sql.NullInt64
+	err := db.QueryRow(`SELECT current_location_id FROM users WHERE id = ?`, userID).Scan(&locationID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to get current location: %w", err)
+	}
+	return locationID.Int64, nil
+}
+
+// SetCurrentLocation sets the location a user's scans land in; nil clears it
+func (db *DB) SetCurrentLocation(userID string, locationID *int64) error {
+	var id sql.NullInt64
+	if locationID != nil {
+		id = sql.NullInt64{Int64: *locationID, Valid: true}
+	}
+	if _, err := db.Exec(`UPDATE users SET current_location_id = ? WHERE id = ?`, id, userID); err != nil {
+		return fmt.Errorf("failed to set current location: %w", err)
+	}
+	return nil
+}
+
+// GetLocationContents retrieves the inventory placed at a location,
+// including locations nested inside it if recursive is set
+func (db *DB) GetLocationContents(locationID int64, recursive bool) ([]models.LocationItem, error) {
+	tree := `SELECT ?`
+	if recursive {
+		tree += ` UNION ALL SELECT l.id FROM locations l JOIN tree t ON l.parent_id = t.id`
+	}
+
+	query := `WITH RECURSIVE tree(id) AS (` + tree + `)
+	          SELECT p.location_id, p.quantity, p.page, p.slot, ` + inventoryColumns + `, ` + prefixedCardColumns + `
+	          FROM inventory_locations p
+	          JOIN inventory i ON p.inventory_id = i.id
+	          JOIN cards c ON i.card_id = c.id
+	          WHERE p.location_id IN (SELECT id FROM tree)
+	          ORDER BY p.location_id, p.page, p.slot, c.name`
+
+	rows, err := db.Query(query, locationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get location contents: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.LocationItem{}
+	for rows.Next() {
+		var entry models.LocationItem
+		entry.Item = &models.InventoryItem{Card: &models.Card{}}
+		fields := []interface{}{&entry.LocationID, &entry.Quantity, &entry.Page, &entry.Slot}
+		fields = append(fields, inventoryFields(entry.Item)...)
+		fields = append(fields, cardFields(entry.Item.Card)...)
+		if err := rows.Scan(fields...); err != nil {
+			return nil, fmt.Errorf("failed to scan location item: %w", err)
+		}
+		items = append(items, entry)
+	}
+	return items, rows.Err()
+}
+
+// MoveInventory moves copies of one of a user's inventory entries between
+// locations, or between a location and the entry's unplaced copies
+func (db *DB) MoveInventory(userID string, req *models.MoveRequest) error {
+	return db.withTx(func(tx *sql.Tx) error {
+		var quantity int
+		err := tx.QueryRow(`SELECT quantity FROM inventory WHERE id = ? AND user_id = ?`, req.InventoryID, userID).Scan(&quantity)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotInInventory
+			}
+			return fmt.Errorf("failed to check inventory: %w", err)
+		}
+
+		if req.FromLocationID == nil {
+			var placed int
+			err := tx.QueryRow(`SELECT COALESCE(SUM(quantity), 0) FROM inventory_locations WHERE inventory_id = ?`,
+				req.InventoryID).Scan(&placed)
+			if err != nil {
+				return fmt.Errorf("failed to check placements: %w", err)
+			}
+			if quantity-placed < req.Quantity {
+				return ErrNotEnoughCopies
+			}
+		} else {
+			placements, err := getPlacements(tx, `inventory_id = ? AND location_id = ? ORDER BY page, slot`,
+				req.InventoryID, *req.FromLocationID)
+			if err != nil {
+				return err
+			}
+			remaining, err := takePlacements(tx, placements, req.Quantity)
+			if err != nil {
+				return err
+			}
+			if remaining > 0 {
+				return ErrNotEnoughCopies
+			}
+		}
+
+		if req.ToLocationID != nil {
+			return addPlacement(tx, req.InventoryID, *req.ToLocationID, req.Quantity, req.Page, req.Slot)
+		}
+		return nil
+	})
+}
+
+// getUserPlacements returns a user's placements keyed by inventory ID
+func (db *DB) getUserPlacements(userID string) (map[int][]models.Placement, error) {
+	query := `SELECT p.inventory_id, p.location_id, p.quantity, p.page, p.slot
+	          FROM inventory_locations p
+	          JOIN inventory i ON p.inventory_id = i.id
+	          WHERE i.user_id = ?
+	          ORDER BY p.location_id, p.page, p.slot`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get placements: %w", err)
+	}
+	defer rows.Close()
+
+	placements := make(map[int][]models.Placement)
+	for rows.Next() {
+		var inventoryID int
+		var p models.Placement
+		if err := rows.Scan(&inventoryID, &p.LocationID, &p.Quantity, &p.Page, &p.Slot); err != nil {
+			return nil, fmt.Errorf("failed to scan placement: %w", err)
+		}
+		placements[inventoryID] = append(placements[inventoryID], p)
+	}
+	return placements, rows.Err()
+}
+
+// addPlacement places copies of an inventory entry at a location, page and slot
+func addPlacement(tx *sql.Tx, inventoryID int, locationID int64, quantity, page, slot int) error {
+	query := `INSERT INTO inventory_locations (inventory_id, location_id, quantity, page, slot)
+	          VALUES (?, ?, ?, ?, ?)
+	          ON CONFLICT(inventory_id, location_id, page, slot)
+	          DO UPDATE SET quantity = quantity + excluded.quantity`
+	if _, err := tx.Exec(query, inventoryID, locationID, quantity, page, slot); err != nil {
+		return fmt.Errorf("failed to place cards: %w", err)
+	}
+	return nil
+}
+
+// placementRow is a placement's row ID and quantity
+type placementRow struct {
+	id       int
+	quantity int
+}
+
+// getPlacements reads placement rows matching a WHERE clause
+func getPlacements(tx *sql.Tx, where string, args ...interface{}) ([]placementRow, error) {
+	rows, err := tx.Query(`SELECT id, quantity FROM inventory_locations WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get placements: %w", err)
+	}
+	defer rows.Close()
+
+	var placements []placementRow
+	for rows.Next() {
+		var p placementRow
+		if err := rows.Scan(&p.id, &p.quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan placement: %w", err)
+		}
+		placements = append(placements, p)
+	}
+	return placements, rows.Err()
+}
+
+// takePlacements removes up to n copies from the given placements in order,
+// returning how many could not be taken
+func takePlacements(tx *sql.Tx, placements []placementRow, n int) (int, error) {
+	for _, p := range placements {
+		if n == 0 {
+			break
+		}
+
+		var err error
+		if p.quantity <= n {
+			_, err = tx.Exec(`DELETE FROM inventory_locations WHERE id = ?`, p.id)
+			n -= p.quantity
+		} else {
+			_, err = tx.Exec(`UPDATE inventory_locations SET quantity = quantity - ? WHERE id = ?`, n, p.id)
+			n = 0
+		}
+		if err != nil {
+			return n, fmt.Errorf("failed to update placement: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// trimPlacements removes the most recently placed copies of an inventory
+// entry until no more copies are placed than the entry holds
+func trimPlacements(tx *sql.Tx, inventoryID int) error {
+	var excess int
+	query := `SELECT COALESCE(SUM(p.quantity), 0) - COALESCE(MAX(i.quantity), 0)
+	          FROM inventory_locations p
+	          LEFT JOIN inventory i ON i.id = p.inventory_id
+	          WHERE p.inventory_id = ?`
+	if err := tx.QueryRow(query, inventoryID).Scan(&excess); err != nil {
+		return fmt.Errorf("failed to check placements: %w", err)
+	}
+	if excess <= 0 {
+		return nil
+	}
+
+	placements, err := getPlacements(tx, `inventory_id = ? ORDER BY id DESC`, inventoryID)
+	if err != nil {
+		return err
+	}
+	_, err = takePlacements(tx, placements, excess)
+	return err
+}
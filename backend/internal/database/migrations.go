@@ -0,0 +1,91 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// initialMigration is the schema the first release created before migrations
+// were tracked
+const initialMigration = "001_initial_schema.sql"
+
+// RunMigrations executes migration files that have not been applied yet,
+// in filename order, recording each one in schema_migrations
+func (db *DB) RunMigrations(migrationsPath string) error {
+	files, err := filepath.Glob(filepath.Join(migrationsPath, "*.sql"))
+	if err != nil {
+		return fmt.Errorf("failed to read migration files: %w", err)
+	}
+	sort.Strings(files)
+
+	if err := db.trackMigrations(); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		name := filepath.Base(file)
+
+		var applied int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE filename = ?`, name).Scan(&applied); err != nil {
+			return fmt.Errorf("failed to check migration %s: %w", file, err)
+		}
+		if applied > 0 {
+			continue
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read migration file %s: %w", file, err)
+		}
+
+		err = db.withTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(string(content)); err != nil {
+				return fmt.Errorf("failed to execute migration %s: %w", file, err)
+			}
+			if _, err := tx.Exec(`INSERT INTO schema_migrations (filename) VALUES (?)`, name); err != nil {
+				return fmt.Errorf("failed to record migration %s: %w", file, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// trackMigrations creates the schema_migrations table. A database created
+// before migrations were tracked already has the initial schema, whose
+// indexes can't be created twice, so it is recorded as applied; the later
+// untracked migrations only create what doesn't exist and run again safely.
+func (db *DB) trackMigrations() error {
+	var tracked, existing bool
+	if err := db.QueryRow(`SELECT
+	                           EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'),
+	                           EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'users')`).Scan(&tracked, &existing); err != nil {
+		return fmt.Errorf("failed to check schema: %w", err)
+	}
+	if tracked {
+		return nil
+	}
+
+	return db.withTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE schema_migrations (
+		                       filename TEXT PRIMARY KEY,
+		                       applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		                   )`)
+		if err != nil {
+			return fmt.Errorf("failed to create schema_migrations table: %w", err)
+		}
+		if existing {
+			if _, err := tx.Exec(`INSERT INTO schema_migrations (filename) VALUES (?)`, initialMigration); err != nil {
+				return fmt.Errorf("failed to record migration %s: %w", initialMigration, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// setCardPrices replaces a card's prices. Nil prices leave the stored ones
+// untouched, since the card data carried no price information.
+func setCardPrices(e execer, cardID string, prices []models.CardPrice) error {
+	if prices == nil {
+		return nil
+	}
+	if _, err := e.Exec(`DELETE FROM card_prices WHERE card_id = ?`, cardID); err != nil {
+		return fmt.Errorf("failed to clear card prices: %w", err)
+	}
+	for _, p := range prices {
+		updatedAt := p.UpdatedAt
+		if updatedAt.IsZero() {
+			updatedAt = time.Now()
+		}
+		_, err := e.Exec(`INSERT INTO card_prices (card_id, currency, finish, price, updated_at) VALUES (?, ?, ?, ?, ?)`,
+			cardID, p.Currency, p.Finish, p.Price, updatedAt.UTC().Format(sqliteTimeFormat))
+		if err != nil {
+			return fmt.Errorf("failed to store card price: %w", err)
+		}
+	}
+	return nil
+}
+
+// SetCardPrices replaces a card's prices
+func (db *DB) SetCardPrices(cardID string, prices []models.CardPrice) error {
+	return db.withTx(func(tx *sql.Tx) error {
+		return setCardPrices(tx, cardID, prices)
+	})
+}
+
+// GetCardPrices retrieves a card's prices
+func (db *DB) GetCardPrices(cardID string) ([]models.CardPrice, error) {
+	rows, err := db.Query(`SELECT currency, finish, price, updated_at FROM card_prices
+	                       WHERE card_id = ? ORDER BY currency, finish`, cardID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get card prices: %w", err)
+	}
+	defer rows.Close()
+
+	prices := []models.CardPrice{}
+	for rows.Next() {
+		var p models.CardPrice
+		if err := rows.Scan(&p.Currency, &p.Finish, &p.Price, &p.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan card price: %w", err)
+		}
+		prices = append(prices, p)
+	}
+	return prices, rows.Err()
+}
+
+// priceJoin joins each inventory entry "i" to the price "p" of its finish in
+// the currency given as the first argument
+const priceJoin = `LEFT JOIN card_prices p ON p.card_id = i.card_id AND p.currency = ? AND p.finish = i.finish`
+
+// GetInventoryValue totals the market value of a user's inventory and lists
+// the limit most valuable entries
+func (db *DB) GetInventoryValue(userID, currency string, limit int) (*models.InventoryValue, error) {
+	value := &models.InventoryValue{Currency: currency, TopCards: []models.ValuedItem{}}
+
+	query := `SELECT COALESCE(ROUND(SUM(i.quantity * p.price), 2), 0),
+	                 COALESCE(SUM(CASE WHEN p.price IS NOT NULL THEN i.quantity END), 0),
+	                 COALESCE(SUM(CASE WHEN p.price IS NULL THEN i.quantity END), 0)
+	          FROM inventory i ` + priceJoin + `
+	          WHERE i.user_id = ?`
+	if err := db.QueryRow(query, currency, userID).Scan(&value.Total, &value.PricedCards, &value.UnpricedCards); err != nil {
+		return nil, fmt.Errorf("failed to value inventory: %w", err)
+	}
+
+	// Aggregates lose the column type, so read the newest timestamp as a row
+	var updated sql.NullTime
+	query = `SELECT p.updated_at FROM inventory i JOIN card_prices p ON p.card_id = i.card_id AND p.currency = ? AND p.finish = i.finish
+	         WHERE i.user_id = ? ORDER BY p.updated_at DESC LIMIT 1`
+	if err := db.QueryRow(query, currency, userID).Scan(&updated); err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get price date: %w", err)
+	}
+	if updated.Valid {
+		value.PricesUpdated = &updated.Time
+	}
+
+	query = `SELECT ` + inventoryColumns + `, ` + prefixedCardColumns + `, p.price
+	         FROM inventory i
+	         JOIN cards c ON i.card_id = c.id
+	         JOIN card_prices p ON p.card_id = i.card_id AND p.currency = ? AND p.finish = i.finish
+	         WHERE i.user_id = ?
+	         ORDER BY i.quantity * p.price DESC, i.id
+	         LIMIT ?`
+	rows, err := db.Query(query, currency, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top cards: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.ValuedItem
+		item.Card = &models.Card{}
+		fields := append(inventoryFields(&item.InventoryItem), cardFields(item.Card)...)
+		if err := rows.Scan(append(fields, &item.UnitPrice)...); err != nil {
+			return nil, fmt.Errorf("failed to scan inventory item: %w", err)
+		}
+		item.Value = math.Round(float64(item.Quantity)*item.UnitPrice*100) / 100
+		value.TopCards = append(value.TopCards, item)
+	}
+	return value, rows.Err()
+}
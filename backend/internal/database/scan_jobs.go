@@ -0,0 +1,157 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// CreateScanJob queues a bulk scan job and sets its ID
+func (db *DB) CreateScanJob(job *models.ScanJob) error {
+	request, err := json.Marshal(job.Request)
+	if err != nil {
+		return fmt.Errorf("failed to encode scan job request: %w", err)
+	}
+
+	query := `INSERT INTO scan_jobs (user_id, session_id, status, request, total, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := db.Exec(query, job.UserID, nullInt(int64(job.SessionID)), job.Status, string(request), job.Total, job.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create scan job: %w", err)
+	}
+	if job.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get scan job ID: %w", err)
+	}
+	return nil
+}
+
+// scanJobColumns selects a job "j" with its outcome counts. A result is
+// pending by its status, successful if it succeeded and failed otherwise.
+const scanJobColumns = `j.id, j.user_id, COALESCE(j.session_id, 0), j.status, j.request, j.total, j.processed,
+	(SELECT COUNT(*) FROM scan_job_results r WHERE r.job_id = j.id AND r.success),
+	(SELECT COUNT(*) FROM scan_job_results r WHERE r.job_id = j.id AND NOT r.success AND COALESCE(r.status, '') <> 'pending'),
+	(SELECT COUNT(*) FROM scan_job_results r WHERE r.job_id = j.id AND r.status = 'pending'),
+	j.error, j.created_at, j.started_at, j.completed_at`
+
+func scanScanJob(row rowScanner) (*models.ScanJob, error) {
+	job := &models.ScanJob{}
+	var request, jobErr sql.NullString
+	var startedAt, completedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.UserID, &job.SessionID, &job.Status, &request, &job.Total, &job.Processed,
+		&job.SuccessfulScans, &job.FailedScans, &job.PendingScans, &jobErr, &job.CreatedAt, &startedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Error = jobErr.String
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	if request.Valid {
+		job.Request = &models.BulkScanRequest{}
+		if err := json.Unmarshal([]byte(request.String), job.Request); err != nil {
+			return nil, fmt.Errorf("failed to decode scan job request: %w", err)
+		}
+	}
+	return job, nil
+}
+
+// GetScanJob retrieves a scan job by ID, without its results
+func (db *DB) GetScanJob(jobID int64) (*models.ScanJob, error) {
+	job, err := scanScanJob(db.QueryRow(`SELECT `+scanJobColumns+` FROM scan_jobs j WHERE j.id = ?`, jobID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get scan job: %w", err)
+	}
+	return job, nil
+}
+
+// GetScanJobResults retrieves a job's results from a position on, in order
+func (db *DB) GetScanJobResults(jobID int64, from int) ([]models.ScanJobResult, error) {
+	rows, err := db.Query(`SELECT position, result FROM scan_job_results WHERE job_id = ? AND position >= ? ORDER BY position`, jobID, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scan job results: %w", err)
+	}
+	defer rows.Close()
+
+	results := []models.ScanJobResult{}
+	for rows.Next() {
+		var r models.ScanJobResult
+		var result string
+		if err := rows.Scan(&r.Position, &result); err != nil {
+			return nil, fmt.Errorf("failed to scan scan job result: %w", err)
+		}
+		if err := json.Unmarshal([]byte(result), &r.ScanResponse); err != nil {
+			return nil, fmt.Errorf("failed to decode scan job result: %w", err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// ClaimScanJob marks the oldest queued job running and returns it, or nil
+// if none are queued
+func (db *DB) ClaimScanJob() (*models.ScanJob, error) {
+	query := `UPDATE scan_jobs SET status = ?, started_at = COALESCE(started_at, ?)
+	          WHERE id = (SELECT id FROM scan_jobs WHERE status = ? ORDER BY id LIMIT 1)
+	          RETURNING id`
+	var id int64
+	if err := db.QueryRow(query, models.ScanJobRunning, time.Now(), models.ScanJobQueued).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to claim scan job: %w", err)
+	}
+	return db.GetScanJob(id)
+}
+
+// RequeueScanJobs puts jobs left running, by a server that stopped before
+// finishing them, back in the queue and returns how many there were
+func (db *DB) RequeueScanJobs() (int, error) {
+	result, err := db.Exec(`UPDATE scan_jobs SET status = ? WHERE status = ?`, models.ScanJobQueued, models.ScanJobRunning)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue scan jobs: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue scan jobs: %w", err)
+	}
+	return int(n), nil
+}
+
+// AddScanJobResult records the result of the scan at a position of a job
+// and counts it as processed
+func (db *DB) AddScanJobResult(jobID int64, position int, result *models.ScanResponse) error {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode scan job result: %w", err)
+	}
+
+	return db.withTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO scan_job_results (job_id, position, status, success, result) VALUES (?, ?, ?, ?, ?)`,
+			jobID, position, nullString(result.Status), result.Success, string(encoded))
+		if err != nil {
+			return fmt.Errorf("failed to add scan job result: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE scan_jobs SET processed = processed + 1 WHERE id = ?`, jobID); err != nil {
+			return fmt.Errorf("failed to update scan job: %w", err)
+		}
+		return nil
+	})
+}
+
+// FinishScanJob moves a job to its final status, dropping its request
+func (db *DB) FinishScanJob(jobID int64, status, jobErr string) error {
+	query := `UPDATE scan_jobs SET status = ?, error = ?, request = NULL, completed_at = ? WHERE id = ?`
+	if _, err := db.Exec(query, status, nullString(jobErr), time.Now(), jobID); err != nil {
+		return fmt.Errorf("failed to finish scan job: %w", err)
+	}
+	return nil
+}
@@ -38,25 +38,119 @@ func (db *DB) UpdateScanSession(sessionID int, cardsScanned, successful, failed
 	return nil
 }
 
-// GetScanSession retrieves a scan session by ID
-func (db *DB) GetScanSession(sessionID int) (*models.ScanSession, error) {
-	query := `SELECT id, user_id, scan_type, cards_scanned, successful_scans, failed_scans, started_at, completed_at
-	          FROM scan_sessions WHERE id = ?`
+const scanSessionColumns = `id, user_id, scan_type, cards_scanned, successful_scans, failed_scans, started_at, completed_at`
 
+func scanScanSession(row rowScanner) (*models.ScanSession, error) {
 	session := &models.ScanSession{}
 	var completedAt sql.NullTime
-	err := db.QueryRow(query, sessionID).Scan(&session.ID, &session.UserID, &session.ScanType,
+	err := row.Scan(&session.ID, &session.UserID, &session.ScanType,
 		&session.CardsScanned, &session.SuccessfulScans, &session.FailedScans, &session.StartedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if completedAt.Valid {
+		session.CompletedAt = &completedAt.Time
+	}
+
+	return session, nil
+}
+
+// GetScanSession retrieves a scan session by ID
+func (db *DB) GetScanSession(sessionID int) (*models.ScanSession, error) {
+	session, err := scanScanSession(db.QueryRow(`SELECT `+scanSessionColumns+` FROM scan_sessions WHERE id = ?`, sessionID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("failed to get scan session: %w", err)
 	}
+	return session, nil
+}
 
-	if completedAt.Valid {
-		session.CompletedAt = &completedAt.Time
+// GetUserScanSessions retrieves a user's scan sessions, newest first,
+// optionally only those of one scan type
+func (db *DB) GetUserScanSessions(userID, scanType string) ([]models.ScanSession, error) {
+	query := `SELECT ` + scanSessionColumns + ` FROM scan_sessions
+	          WHERE user_id = ? AND (? = '' OR scan_type = ?)
+	          ORDER BY id DESC`
+	rows, err := db.Query(query, userID, scanType, scanType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scan sessions: %w", err)
 	}
+	defer rows.Close()
 
-	return session, nil
+	sessions := []models.ScanSession{}
+	for rows.Next() {
+		session, err := scanScanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scan session: %w", err)
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// AddScanSessionCounts adds the outcome of scans to a session's counts
+// without completing it
+func (db *DB) AddScanSessionCounts(sessionID int, cardsScanned, successful, failed int) error {
+	query := `UPDATE scan_sessions
+	          SET cards_scanned = cards_scanned + ?, successful_scans = successful_scans + ?, failed_scans = failed_scans + ?
+	          WHERE id = ?`
+	if _, err := db.Exec(query, cardsScanned, successful, failed, sessionID); err != nil {
+		return fmt.Errorf("failed to update scan session: %w", err)
+	}
+	return nil
+}
+
+// CompleteScanSession closes a scan session, reporting whether it was still open
+func (db *DB) CompleteScanSession(sessionID int) (bool, error) {
+	result, err := db.Exec(`UPDATE scan_sessions SET completed_at = ? WHERE id = ? AND completed_at IS NULL`, time.Now(), sessionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to complete scan session: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to complete scan session: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetSessionCards retrieves the copies a scan session added to inventory,
+// net of undone scans, in the order they were first scanned
+func (db *DB) GetSessionCards(sessionID int) ([]models.SessionCard, error) {
+	query := `SELECT l.card_id, l.finish, l.condition, l.language, l.signed, l.altered, l.misprint, SUM(l.delta),
+	                 ` + prefixedCardColumns + `
+	          FROM inventory_ledger l
+	          JOIN cards c ON l.card_id = c.id
+	          WHERE l.session_id = ?
+	          GROUP BY l.card_id, l.finish, l.condition, l.language, l.signed, l.altered, l.misprint
+	          HAVING SUM(l.delta) > 0
+	          ORDER BY MIN(l.id)`
+	rows, err := db.Query(query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session cards: %w", err)
+	}
+	defer rows.Close()
+
+	cards := []models.SessionCard{}
+	for rows.Next() {
+		sc := models.SessionCard{Card: &models.Card{}}
+		fields := append([]interface{}{&sc.CardID, &sc.Finish, &sc.Condition, &sc.Language, &sc.Signed, &sc.Altered,
+			&sc.Misprint, &sc.Quantity}, cardFields(sc.Card)...)
+		if err := rows.Scan(fields...); err != nil {
+			return nil, fmt.Errorf("failed to scan session card: %w", err)
+		}
+		cards = append(cards, sc)
+	}
+	return cards, rows.Err()
+}
+
+// IncrementScanSessionSuccess counts a late success, such as a confirmed pending scan, against a session
+func (db *DB) IncrementScanSessionSuccess(sessionID int) error {
+	query := `UPDATE scan_sessions SET successful_scans = successful_scans + 1 WHERE id = ?`
+	if _, err := db.Exec(query, sessionID); err != nil {
+		return fmt.Errorf("failed to update scan session: %w", err)
+	}
+	return nil
 }
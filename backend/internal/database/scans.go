@@ -0,0 +1,143 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// CreateScan records a scan and its outcome
+func (db *DB) CreateScan(scan *models.Scan) (int64, error) {
+	var request, candidates []byte
+	var err error
+	if scan.Request != nil {
+		// The photo is only needed while resolving, so don't keep it around
+		req := *scan.Request
+		req.Image = nil
+		if request, err = json.Marshal(&req); err != nil {
+			return 0, fmt.Errorf("failed to encode scan request: %w", err)
+		}
+	}
+	if len(scan.Candidates) > 0 {
+		if candidates, err = json.Marshal(scan.Candidates); err != nil {
+			return 0, fmt.Errorf("failed to encode scan candidates: %w", err)
+		}
+	}
+
+	var resolvedAt sql.NullTime
+	if scan.ResolvedAt != nil {
+		resolvedAt = sql.NullTime{Time: *scan.ResolvedAt, Valid: true}
+	}
+
+	query := `INSERT INTO scans (user_id, session_id, status, card_id, location_id, request, candidates, error, created_at, resolved_at)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := db.Exec(query, scan.UserID, sql.NullInt64{Int64: int64(scan.SessionID), Valid: scan.SessionID != 0},
+		scan.Status, nullString(scan.CardID), sql.NullInt64{Int64: scan.LocationID, Valid: scan.LocationID != 0},
+		nullString(string(request)), nullString(string(candidates)), nullString(scan.Error), scan.CreatedAt, resolvedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create scan: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get scan ID: %w", err)
+	}
+	return id, nil
+}
+
+const scanColumns = `id, user_id, session_id, status, card_id, location_id, request, candidates, error, created_at, resolved_at`
+
+func scanScan(row rowScanner) (*models.Scan, error) {
+	scan := &models.Scan{}
+	var sessionID, locationID sql.NullInt64
+	var cardID, request, candidates, scanErr sql.NullString
+	var resolvedAt sql.NullTime
+	err := row.Scan(&scan.ID, &scan.UserID, &sessionID, &scan.Status, &cardID, &locationID,
+		&request, &candidates, &scanErr, &scan.CreatedAt, &resolvedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	scan.SessionID = int(sessionID.Int64)
+	scan.CardID = cardID.String
+	scan.LocationID = locationID.Int64
+	scan.Error = scanErr.String
+	if resolvedAt.Valid {
+		scan.ResolvedAt = &resolvedAt.Time
+	}
+	if request.Valid {
+		scan.Request = &models.ScanRequest{}
+		if err := json.Unmarshal([]byte(request.String), scan.Request); err != nil {
+			return nil, fmt.Errorf("failed to decode scan request: %w", err)
+		}
+	}
+	if candidates.Valid {
+		if err := json.Unmarshal([]byte(candidates.String), &scan.Candidates); err != nil {
+			return nil, fmt.Errorf("failed to decode scan candidates: %w", err)
+		}
+	}
+
+	return scan, nil
+}
+
+// GetScan retrieves a scan by ID
+func (db *DB) GetScan(scanID int64) (*models.Scan, error) {
+	scan, err := scanScan(db.QueryRow(`SELECT `+scanColumns+` FROM scans WHERE id = ?`, scanID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get scan: %w", err)
+	}
+	return scan, nil
+}
+
+// GetSessionScans retrieves the scans recorded in a scan session, in the
+// order they were made
+func (db *DB) GetSessionScans(sessionID int) ([]models.Scan, error) {
+	rows, err := db.Query(`SELECT `+scanColumns+` FROM scans WHERE session_id = ? ORDER BY id`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session scans: %w", err)
+	}
+	defer rows.Close()
+
+	scans := []models.Scan{}
+	for rows.Next() {
+		scan, err := scanScan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scan: %w", err)
+		}
+		scans = append(scans, *scan)
+	}
+	return scans, rows.Err()
+}
+
+// ResolvePendingScan moves a pending scan to a final status. It reports false
+// if the scan was no longer pending, so concurrent confirmations of the same
+// scan commit it only once.
+func (db *DB) ResolvePendingScan(scanID int64, status, cardID string) (bool, error) {
+	query := `UPDATE scans SET status = ?, card_id = ?, resolved_at = ?
+	          WHERE id = ? AND status = ?`
+	result, err := db.Exec(query, status, nullString(cardID), time.Now(), scanID, models.ScanStatusPending)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve scan: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve scan: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// SetScanWishlistItem records the wishlist item a committed scan's copy
+// ticked off, so undoing the scan can give it back
+func (db *DB) SetScanWishlistItem(scanID, wishlistID int64) error {
+	if _, err := db.Exec(`UPDATE scans SET wishlist_id = ? WHERE id = ?`, wishlistID, scanID); err != nil {
+		return fmt.Errorf("failed to update scan: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// ErrTradeUnavailable is returned when accepting a trade whose copies are no
+// longer held or offered for trade
+var ErrTradeUnavailable = errors.New("traded copies are no longer available")
+
+// AddTradePartner records that a user agrees to trade with a partner
+func (db *DB) AddTradePartner(userID, partnerID string) error {
+	_, err := db.Exec(`INSERT INTO trade_partners (user_id, partner_id) VALUES (?, ?) ON CONFLICT DO NOTHING`, userID, partnerID)
+	if err != nil {
+		return fmt.Errorf("failed to add trade partner: %w", err)
+	}
+	return nil
+}
+
+// RemoveTradePartner withdraws a user's agreement to trade with a partner,
+// reporting whether there was one
+func (db *DB) RemoveTradePartner(userID, partnerID string) (bool, error) {
+	result, err := db.Exec(`DELETE FROM trade_partners WHERE user_id = ? AND partner_id = ?`, userID, partnerID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove trade partner: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove trade partner: %w", err)
+	}
+	return n > 0, nil
+}
+
+// GetTradePartners retrieves the users a user has agreed to trade with
+func (db *DB) GetTradePartners(userID string) ([]models.TradePartner, error) {
+	query := `SELECT p.partner_id, EXISTS (SELECT 1 FROM trade_partners r WHERE r.user_id = p.partner_id AND r.partner_id = p.user_id),
+	                 p.created_at
+	          FROM trade_partners p
+	          WHERE p.user_id = ?
+	          ORDER BY p.created_at, p.partner_id`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trade partners: %w", err)
+	}
+	defer rows.Close()
+
+	partners := []models.TradePartner{}
+	for rows.Next() {
+		var p models.TradePartner
+		if err := rows.Scan(&p.UserID, &p.Mutual, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan trade partner: %w", err)
+		}
+		partners = append(partners, p)
+	}
+	return partners, rows.Err()
+}
+
+// AreTradePartners reports whether two users have each agreed to trade with the other
+func (db *DB) AreTradePartners(userID, partnerID string) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM trade_partners WHERE (user_id = ? AND partner_id = ?) OR (user_id = ? AND partner_id = ?)`,
+		userID, partnerID, partnerID, userID).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check trade partners: %w", err)
+	}
+	return n == 2, nil
+}
+
+// CreateTrade inserts a proposed trade and its items and sets its ID
+func (db *DB) CreateTrade(trade *models.Trade) error {
+	return db.withTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`INSERT INTO trades (proposer_id, partner_id, status, currency, created_at) VALUES (?, ?, ?, ?, ?)`,
+			trade.ProposerID, trade.PartnerID, trade.Status, trade.Currency, trade.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create trade: %w", err)
+		}
+		if trade.ID, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to get trade ID: %w", err)
+		}
+
+		insert := func(fromUserID string, items []models.TradeItem) error {
+			for _, item := range items {
+				_, err := tx.Exec(`INSERT INTO trade_items (trade_id, from_user_id, inventory_id, card_id, finish, condition, language,
+				                   signed, altered, misprint, quantity, unit_price)
+				                   VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+					trade.ID, fromUserID, item.InventoryID, item.CardID, item.Finish, item.Condition, item.Language,
+					item.Signed, item.Altered, item.Misprint, item.Quantity, nullFloat(item.UnitPrice))
+				if err != nil {
+					return fmt.Errorf("failed to add trade item: %w", err)
+				}
+			}
+			return nil
+		}
+		if err := insert(trade.ProposerID, trade.Give); err != nil {
+			return err
+		}
+		return insert(trade.PartnerID, trade.Receive)
+	})
+}
+
+const tradeColumns = `id, proposer_id, partner_id, status, currency, created_at, resolved_at`
+
+func scanTrade(row rowScanner) (*models.Trade, error) {
+	trade := &models.Trade{Give: []models.TradeItem{}, Receive: []models.TradeItem{}}
+	var resolvedAt sql.NullTime
+	err := row.Scan(&trade.ID, &trade.ProposerID, &trade.PartnerID, &trade.Status, &trade.Currency, &trade.CreatedAt, &resolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	if resolvedAt.Valid {
+		trade.ResolvedAt = &resolvedAt.Time
+	}
+	return trade, nil
+}
+
+// GetTrade retrieves a trade by ID with its items
+func (db *DB) GetTrade(id int64) (*models.Trade, error) {
+	trade, err := scanTrade(db.QueryRow(`SELECT `+tradeColumns+` FROM trades WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get trade: %w", err)
+	}
+	if err := db.attachTradeItems(trade); err != nil {
+		return nil, err
+	}
+	return trade, nil
+}
+
+// GetUserTrades retrieves the trades a user proposed or was offered, newest
+// first, with their items
+func (db *DB) GetUserTrades(userID string) ([]models.Trade, error) {
+	rows, err := db.Query(`SELECT `+tradeColumns+` FROM trades WHERE proposer_id = ? OR partner_id = ? ORDER BY id DESC`, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trades: %w", err)
+	}
+	defer rows.Close()
+
+	trades := []models.Trade{}
+	for rows.Next() {
+		trade, err := scanTrade(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan trade: %w", err)
+		}
+		trades = append(trades, *trade)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get trades: %w", err)
+	}
+
+	for i := range trades {
+		if err := db.attachTradeItems(&trades[i]); err != nil {
+			return nil, err
+		}
+	}
+	return trades, nil
+}
+
+// attachTradeItems reads a trade's items into Give and Receive and totals
+// their values
+func (db *DB) attachTradeItems(trade *models.Trade) error {
+	query := `SELECT t.from_user_id, t.inventory_id, t.card_id, t.finish, t.condition, t.language,
+	                 t.signed, t.altered, t.misprint, t.quantity, t.unit_price, ` + prefixedCardColumns + `
+	          FROM trade_items t
+	          JOIN cards c ON t.card_id = c.id
+	          WHERE t.trade_id = ?
+	          ORDER BY t.id`
+	rows, err := db.Query(query, trade.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get trade items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := models.TradeItem{Card: &models.Card{}}
+		var fromUserID string
+		var unitPrice sql.NullFloat64
+		fields := append([]interface{}{&fromUserID, &item.InventoryID, &item.CardID, &item.Finish, &item.Condition, &item.Language,
+			&item.Signed, &item.Altered, &item.Misprint, &item.Quantity, &unitPrice}, cardFields(item.Card)...)
+		if err := rows.Scan(fields...); err != nil {
+			return fmt.Errorf("failed to scan trade item: %w", err)
+		}
+
+		var value float64
+		if unitPrice.Valid {
+			item.UnitPrice = &unitPrice.Float64
+			value = unitPrice.Float64 * float64(item.Quantity)
+		}
+		if fromUserID == trade.ProposerID {
+			trade.Give = append(trade.Give, item)
+			trade.GiveValue += value
+		} else {
+			trade.Receive = append(trade.Receive, item)
+			trade.ReceiveValue += value
+		}
+	}
+	return rows.Err()
+}
+
+// ResolveTrade moves a proposed trade to status without exchanging cards,
+// reporting whether it was still proposed
+func (db *DB) ResolveTrade(id int64, status string) (bool, error) {
+	result, err := db.Exec(`UPDATE trades SET status = ?, resolved_at = ? WHERE id = ? AND status = ?`,
+		status, time.Now(), id, models.TradeProposed)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve trade: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve trade: %w", err)
+	}
+	return n > 0, nil
+}
+
+// AcceptTrade marks a proposed trade accepted and moves its copies between
+// the two inventories in one transaction, reporting whether it was still
+// proposed. Every copy must still be held and offered for trade by its owner,
+// otherwise nothing changes and ErrTradeUnavailable is returned.
+func (db *DB) AcceptTrade(trade *models.Trade) (bool, error) {
+	accepted := false
+	err := db.withTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE trades SET status = ?, resolved_at = ? WHERE id = ? AND status = ?`,
+			models.TradeAccepted, time.Now(), trade.ID, models.TradeProposed)
+		if err != nil {
+			return fmt.Errorf("failed to accept trade: %w", err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to accept trade: %w", err)
+		}
+		if n == 0 {
+			return nil
+		}
+
+		for _, item := range trade.Give {
+			if err := transferCopies(tx, trade.ID, item, trade.ProposerID, trade.PartnerID); err != nil {
+				return err
+			}
+		}
+		for _, item := range trade.Receive {
+			if err := transferCopies(tx, trade.ID, item, trade.PartnerID, trade.ProposerID); err != nil {
+				return err
+			}
+		}
+		accepted = true
+		return nil
+	})
+	return accepted, err
+}
+
+// transferCopies moves a trade item's copies from one user's inventory entry
+// to the other user's inventory, taking them off the trade list and out of
+// their storage locations
+func transferCopies(tx *sql.Tx, tradeID int64, item models.TradeItem, fromUserID, toUserID string) error {
+	var held, offered int
+	query := `SELECT i.quantity, COALESCE(t.quantity, 0)
+	          FROM inventory i
+	          LEFT JOIN trade_list t ON t.inventory_id = i.id
+	          WHERE i.id = ? AND i.user_id = ? AND i.card_id = ?`
+	err := tx.QueryRow(query, item.InventoryID, fromUserID, item.CardID).Scan(&held, &offered)
+	if err == sql.ErrNoRows {
+		return ErrTradeUnavailable
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check traded copies: %w", err)
+	}
+	if held < item.Quantity || offered < item.Quantity {
+		return ErrTradeUnavailable
+	}
+
+	// The trade list entry goes with the inventory entry when no copies are left
+	if held > item.Quantity {
+		if offered == item.Quantity {
+			_, err = tx.Exec(`DELETE FROM trade_list WHERE inventory_id = ?`, item.InventoryID)
+		} else {
+			_, err = tx.Exec(`UPDATE trade_list SET quantity = quantity - ? WHERE inventory_id = ?`, item.Quantity, item.InventoryID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update trade list: %w", err)
+		}
+	}
+
+	source := models.LedgerSource{Source: models.LedgerTrade, TradeID: tradeID}
+	if err := removeCopies(tx, fromUserID, item.CardID, item.CopyAttributes, item.Quantity, source); err != nil {
+		return err
+	}
+	_, err = addToInventory(tx, toUserID, item.CardID, item.CopyAttributes, item.Quantity, 0, source)
+	return err
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// RecordValueSnapshot records the current price of every card held in any
+// inventory and each user's inventory value in every currency under the
+// given date (YYYY-MM-DD). Recording a date again replaces its snapshot.
+func (db *DB) RecordValueSnapshot(date string) (*models.SnapshotResult, error) {
+	result := &models.SnapshotResult{Date: date}
+	err := db.withTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`INSERT INTO card_price_history (card_id, currency, finish, date, price)
+		                     SELECT p.card_id, p.currency, p.finish, ?, p.price
+		                     FROM card_prices p
+		                     WHERE p.card_id IN (SELECT card_id FROM inventory)
+		                     ON CONFLICT(card_id, currency, finish, date) DO UPDATE SET price = excluded.price`, date)
+		if err != nil {
+			return fmt.Errorf("failed to record card prices: %w", err)
+		}
+		prices, _ := res.RowsAffected()
+		result.Prices = int(prices)
+
+		_, err = tx.Exec(`INSERT INTO inventory_value_history (user_id, currency, date, total, priced_cards, unpriced_cards)
+		                  SELECT i.user_id, cur.currency, ?,
+		                         COALESCE(ROUND(SUM(i.quantity * p.price), 2), 0),
+		                         COALESCE(SUM(CASE WHEN p.price IS NOT NULL THEN i.quantity END), 0),
+		                         COALESCE(SUM(CASE WHEN p.price IS NULL THEN i.quantity END), 0)
+		                  FROM inventory i
+		                  CROSS JOIN (SELECT ? AS currency UNION ALL SELECT ?) cur
+		                  LEFT JOIN card_prices p ON p.card_id = i.card_id AND p.currency = cur.currency AND p.finish = i.finish
+		                  GROUP BY i.user_id, cur.currency
+		                  ON CONFLICT(user_id, currency, date) DO UPDATE SET
+		                      total = excluded.total, priced_cards = excluded.priced_cards, unpriced_cards = excluded.unpriced_cards`,
+			date, models.CurrencyUSD, models.CurrencyEUR)
+		if err != nil {
+			return fmt.Errorf("failed to record inventory values: %w", err)
+		}
+
+		return tx.QueryRow(`SELECT COUNT(DISTINCT user_id) FROM inventory_value_history WHERE date = ?`, date).Scan(&result.Users)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetValueHistory retrieves a user's daily inventory values between two dates
+// (inclusive, YYYY-MM-DD) and the movers limit entries whose value changed
+// most between the first and last snapshot in that range
+func (db *DB) GetValueHistory(userID, currency, from, to string, movers int) (*models.ValueHistory, error) {
+	history := &models.ValueHistory{Currency: currency, From: from, To: to, Points: []models.ValuePoint{}, Movers: []models.ValueMover{}}
+
+	rows, err := db.Query(`SELECT date, total, priced_cards, unpriced_cards
+	                       FROM inventory_value_history
+	                       WHERE user_id = ? AND currency = ? AND date BETWEEN ? AND ?
+	                       ORDER BY date`, userID, currency, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get value history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.ValuePoint
+		if err := rows.Scan(&p.Date, &p.Total, &p.PricedCards, &p.UnpricedCards); err != nil {
+			return nil, fmt.Errorf("failed to scan value history: %w", err)
+		}
+		history.Points = append(history.Points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get value history: %w", err)
+	}
+
+	if len(history.Points) < 2 || movers <= 0 {
+		return history, nil
+	}
+	first, last := history.Points[0].Date, history.Points[len(history.Points)-1].Date
+
+	// Movers are the entries held now, valued at both snapshots' prices
+	query := `SELECT ` + inventoryColumns + `, ` + prefixedCardColumns + `, a.price, b.price
+	          FROM inventory i
+	          JOIN cards c ON i.card_id = c.id
+	          JOIN card_price_history a ON a.card_id = i.card_id AND a.currency = ? AND a.finish = i.finish AND a.date = ?
+	          JOIN card_price_history b ON b.card_id = i.card_id AND b.currency = ? AND b.finish = i.finish AND b.date = ?
+	          WHERE i.user_id = ? AND a.price != b.price
+	          ORDER BY ABS(b.price - a.price) * i.quantity DESC, i.id
+	          LIMIT ?`
+	moverRows, err := db.Query(query, currency, first, currency, last, userID, movers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get value movers: %w", err)
+	}
+	defer moverRows.Close()
+
+	for moverRows.Next() {
+		var m models.ValueMover
+		m.Card = &models.Card{}
+		fields := append(inventoryFields(&m.InventoryItem), cardFields(m.Card)...)
+		if err := moverRows.Scan(append(fields, &m.FromPrice, &m.ToPrice)...); err != nil {
+			return nil, fmt.Errorf("failed to scan value mover: %w", err)
+		}
+		m.Change = math.Round(float64(m.Quantity)*(m.ToPrice-m.FromPrice)*100) / 100
+		m.ChangePercent = math.Round((m.ToPrice-m.FromPrice)/m.FromPrice*1000) / 10
+		history.Movers = append(history.Movers, m)
+	}
+	return history, moverRows.Err()
+}
@@ -0,0 +1,236 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// wishlistColumns selects a wishlist item "w" with its optional printing "c"
+const wishlistColumns = `w.id, w.user_id, w.name, COALESCE(w.card_id, ''), w.quantity, w.acquired, w.max_price,
+	w.currency, COALESCE(w.min_condition, ''), w.created_at, ` + prefixedCardColumns
+
+func scanWishlistItem(row rowScanner) (*models.WishlistItem, error) {
+	item := &models.WishlistItem{}
+	var maxPrice sql.NullFloat64
+	var card nullableCard
+	fields := append([]interface{}{&item.ID, &item.UserID, &item.Name, &item.CardID, &item.Quantity, &item.Acquired,
+		&maxPrice, &item.Currency, &item.MinCondition, &item.CreatedAt}, card.fields()...)
+	if err := row.Scan(fields...); err != nil {
+		return nil, err
+	}
+	if maxPrice.Valid {
+		item.MaxPrice = &maxPrice.Float64
+	}
+	item.Card = card.get()
+	item.Fulfilled = item.Acquired >= item.Quantity
+	return item, nil
+}
+
+// nullFloat converts an optional float to a nullable column value
+func nullFloat(f *float64) sql.NullFloat64 {
+	if f == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *f, Valid: true}
+}
+
+// CreateWishlistItem inserts a wishlist item and sets its ID
+func (db *DB) CreateWishlistItem(item *models.WishlistItem) error {
+	query := `INSERT INTO wishlist (user_id, name, card_id, quantity, acquired, max_price, currency, min_condition, created_at)
+	          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := db.Exec(query, item.UserID, item.Name, nullString(item.CardID), item.Quantity, item.Acquired,
+		nullFloat(item.MaxPrice), item.Currency, nullString(item.MinCondition), item.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create wishlist item: %w", err)
+	}
+	if item.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get wishlist item ID: %w", err)
+	}
+	return nil
+}
+
+// GetWishlistItem retrieves a wishlist item by ID
+func (db *DB) GetWishlistItem(id int64) (*models.WishlistItem, error) {
+	row := db.QueryRow(`SELECT `+wishlistColumns+` FROM wishlist w LEFT JOIN cards c ON w.card_id = c.id WHERE w.id = ?`, id)
+	item, err := scanWishlistItem(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get wishlist item: %w", err)
+	}
+	return item, nil
+}
+
+// GetUserWishlist retrieves a user's wishlist, outstanding items first
+func (db *DB) GetUserWishlist(userID string) ([]models.WishlistItem, error) {
+	query := `SELECT ` + wishlistColumns + `
+	          FROM wishlist w
+	          LEFT JOIN cards c ON w.card_id = c.id
+	          WHERE w.user_id = ?
+	          ORDER BY w.acquired >= w.quantity, w.name COLLATE NOCASE, w.id`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wishlist: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.WishlistItem{}
+	for rows.Next() {
+		item, err := scanWishlistItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan wishlist item: %w", err)
+		}
+		items = append(items, *item)
+	}
+	return items, rows.Err()
+}
+
+// UpdateWishlistItem writes a wishlist item's quantity, acquired count,
+// max price and minimum condition
+func (db *DB) UpdateWishlistItem(item *models.WishlistItem) error {
+	_, err := db.Exec(`UPDATE wishlist SET quantity = ?, acquired = ?, max_price = ?, min_condition = ? WHERE id = ?`,
+		item.Quantity, item.Acquired, nullFloat(item.MaxPrice), nullString(item.MinCondition), item.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update wishlist item: %w", err)
+	}
+	return nil
+}
+
+// DeleteWishlistItem deletes a wishlist item
+func (db *DB) DeleteWishlistItem(id int64) error {
+	if _, err := db.Exec(`DELETE FROM wishlist WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete wishlist item: %w", err)
+	}
+	return nil
+}
+
+// TickOffWishlist counts a copy of a printing towards the user's oldest
+// outstanding wishlist item it satisfies, preferring items wanting that exact
+// printing over items wanting any printing of the card. Items with a minimum
+// condition only match if it is one of minConditions. It returns the updated
+// item, or nil if none matched.
+func (db *DB) TickOffWishlist(userID, cardID, name string, minConditions []string) (*models.WishlistItem, error) {
+	args := []interface{}{userID, cardID, name}
+	conditionFilter := `w.min_condition IS NULL`
+	if len(minConditions) > 0 {
+		conditionFilter = `(w.min_condition IS NULL OR w.min_condition IN (?` + strings.Repeat(", ?", len(minConditions)-1) + `))`
+		for _, c := range minConditions {
+			args = append(args, c)
+		}
+	}
+
+	// A single statement, so concurrent scans can't both take the last wanted copy
+	query := `UPDATE wishlist SET acquired = acquired + 1
+	          WHERE id = (SELECT w.id FROM wishlist w
+	                      WHERE w.user_id = ? AND w.acquired < w.quantity
+	                      AND (w.card_id = ? OR (w.card_id IS NULL AND w.name = ?))
+	                      AND ` + conditionFilter + `
+	                      ORDER BY w.card_id IS NULL, w.id
+	                      LIMIT 1)
+	          RETURNING id`
+	var id int64
+	if err := db.QueryRow(query, args...).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to tick off wishlist: %w", err)
+	}
+	return db.GetWishlistItem(id)
+}
+
+// tradeListColumns selects the trade list entry "t" of an inventory entry "i"
+// and its card "c". Copies may have left inventory since they were offered,
+// so the offered quantity is capped at what's held.
+const tradeListColumns = inventoryColumns + `, ` + prefixedCardColumns + `, MIN(t.quantity, i.quantity)`
+
+func scanTradeListItem(row rowScanner) (*models.TradeListItem, error) {
+	item := &models.TradeListItem{}
+	item.Card = &models.Card{}
+	fields := append(inventoryFields(&item.InventoryItem), cardFields(item.Card)...)
+	if err := row.Scan(append(fields, &item.TradeQuantity)...); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// SetTradeQuantity offers quantity copies of one of the user's inventory
+// entries for trade, replacing any earlier offer. It fails with
+// ErrNotInInventory if the user has no such entry and ErrNotEnoughCopies if
+// it holds fewer copies.
+func (db *DB) SetTradeQuantity(userID string, inventoryID, quantity int) (*models.TradeListItem, error) {
+	var item *models.TradeListItem
+	err := db.withTx(func(tx *sql.Tx) error {
+		var held int
+		err := tx.QueryRow(`SELECT quantity FROM inventory WHERE id = ? AND user_id = ?`, inventoryID, userID).Scan(&held)
+		if err == sql.ErrNoRows {
+			return ErrNotInInventory
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check inventory: %w", err)
+		}
+		if quantity > held {
+			return ErrNotEnoughCopies
+		}
+
+		_, err = tx.Exec(`INSERT INTO trade_list (user_id, inventory_id, quantity) VALUES (?, ?, ?)
+		                  ON CONFLICT(inventory_id) DO UPDATE SET quantity = excluded.quantity`,
+			userID, inventoryID, quantity)
+		if err != nil {
+			return fmt.Errorf("failed to set trade quantity: %w", err)
+		}
+
+		query := `SELECT ` + tradeListColumns + `
+		          FROM trade_list t
+		          JOIN inventory i ON t.inventory_id = i.id
+		          JOIN cards c ON i.card_id = c.id
+		          WHERE t.inventory_id = ?`
+		if item, err = scanTradeListItem(tx.QueryRow(query, inventoryID)); err != nil {
+			return fmt.Errorf("failed to get trade list item: %w", err)
+		}
+		return nil
+	})
+	return item, err
+}
+
+// GetUserTradeList retrieves the inventory entries a user offers for trade
+func (db *DB) GetUserTradeList(userID string) ([]models.TradeListItem, error) {
+	query := `SELECT ` + tradeListColumns + `
+	          FROM trade_list t
+	          JOIN inventory i ON t.inventory_id = i.id
+	          JOIN cards c ON i.card_id = c.id
+	          WHERE t.user_id = ?
+	          ORDER BY c.name COLLATE NOCASE, i.id`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trade list: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.TradeListItem{}
+	for rows.Next() {
+		item, err := scanTradeListItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan trade list item: %w", err)
+		}
+		items = append(items, *item)
+	}
+	return items, rows.Err()
+}
+
+// RemoveFromTradeList withdraws an inventory entry from the user's trade
+// list, reporting whether it was on it
+func (db *DB) RemoveFromTradeList(userID string, inventoryID int) (bool, error) {
+	result, err := db.Exec(`DELETE FROM trade_list WHERE inventory_id = ? AND user_id = ?`, inventoryID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove from trade list: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove from trade list: %w", err)
+	}
+	return n > 0, nil
+}
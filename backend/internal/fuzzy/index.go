@@ -0,0 +1,186 @@
+package fuzzy
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxNameCandidates is how many names sharing trigrams with a query are
+// scored with the more expensive edit distance
+const maxNameCandidates = 50
+
+// Entry is a printing in the index
+type Entry struct {
+	CardID          string
+	Name            string
+	SetCode         string
+	CollectorNumber string
+	TypeLine        string
+}
+
+// Hints are optional extra OCR fragments used to disambiguate matches
+type Hints struct {
+	TypeLine        string
+	SetCode         string
+	CollectorNumber string
+}
+
+// Match is a printing ranked by how well it matches a query
+type Match struct {
+	CardID string
+	Name   string
+	Score  float64 // 0 to 1
+}
+
+// nameEntry is a distinct searchable name: a card name or one face of a multi-faced card
+type nameEntry struct {
+	normalized string
+	grams      int
+	printings  []int
+}
+
+// Index is a trigram index over card names for fuzzy OCR matching. Adding
+// printings must not run concurrently with searches.
+type Index struct {
+	entries []Entry
+	names   []nameEntry
+	byName  map[string]int
+	grams   map[string][]int
+}
+
+// NewIndex builds an index over the given printings
+func NewIndex(entries []Entry) *Index {
+	idx := &Index{
+		entries: make([]Entry, 0, len(entries)),
+		byName:  make(map[string]int),
+		grams:   make(map[string][]int),
+	}
+	for _, e := range entries {
+		idx.Add(e)
+	}
+	return idx
+}
+
+// Add indexes another printing
+func (idx *Index) Add(e Entry) {
+	printing := len(idx.entries)
+	idx.entries = append(idx.entries, e)
+	idx.addName(e.Name, printing)
+	for _, face := range Faces(e.Name) {
+		idx.addName(face, printing)
+	}
+}
+
+// addName makes a printing searchable by one of its names
+func (idx *Index) addName(name string, printing int) {
+	normalized := Normalize(name)
+	if normalized == "" {
+		return
+	}
+	id, ok := idx.byName[normalized]
+	if !ok {
+		id = len(idx.names)
+		idx.byName[normalized] = id
+		grams := trigrams(normalized)
+		idx.names = append(idx.names, nameEntry{normalized: normalized, grams: len(grams)})
+		for _, g := range grams {
+			idx.grams[g] = append(idx.grams[g], id)
+		}
+	}
+	idx.names[id].printings = append(idx.names[id].printings, printing)
+}
+
+// Len returns the number of printings in the index
+func (idx *Index) Len() int {
+	return len(idx.entries)
+}
+
+// Search returns up to limit printings whose names best match query, best first
+func (idx *Index) Search(query string, hints Hints, limit int) []Match {
+	normalized := Normalize(query)
+	if len([]rune(normalized)) < 3 {
+		return nil
+	}
+
+	// Count shared trigrams to find names worth scoring
+	queryGrams := trigrams(normalized)
+	shared := make(map[int]int)
+	for _, g := range queryGrams {
+		for _, id := range idx.grams[g] {
+			shared[id]++
+		}
+	}
+
+	type scoredName struct {
+		id   int
+		dice float64
+	}
+	names := make([]scoredName, 0, len(shared))
+	for id, n := range shared {
+		dice := 2 * float64(n) / float64(len(queryGrams)+idx.names[id].grams)
+		names = append(names, scoredName{id: id, dice: dice})
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i].dice > names[j].dice
+	})
+	if len(names) > maxNameCandidates {
+		names = names[:maxNameCandidates]
+	}
+
+	typeLine := Normalize(hints.TypeLine)
+	collectorNumber := strings.TrimLeft(strings.ToLower(strings.TrimSpace(hints.CollectorNumber)), "0")
+
+	// Score each printing, keeping the best score when a printing is reachable
+	// through both its full name and one of its faces
+	best := make(map[int]float64)
+	for _, n := range names {
+		name := idx.names[n.id]
+		nameScore := 0.7*similarity(normalized, name.normalized) + 0.3*n.dice
+
+		for _, p := range name.printings {
+			e := idx.entries[p]
+			score := nameScore
+
+			if typeLine != "" {
+				score = 0.85*score + 0.15*similarity(typeLine, Normalize(e.TypeLine))
+			}
+			// Set and collector number hints each carry a tenth of the score,
+			// so a matching printing outranks other printings of the same name
+			if hints.SetCode != "" {
+				score *= 0.9
+				if strings.EqualFold(hints.SetCode, e.SetCode) {
+					score += 0.1
+				}
+			}
+			if collectorNumber != "" {
+				score *= 0.9
+				number := strings.TrimLeft(strings.ToLower(e.CollectorNumber), "0")
+				if number == collectorNumber {
+					score += 0.1
+				} else if strings.Contains(number, collectorNumber) {
+					score += 0.05
+				}
+			}
+
+			if score > best[p] {
+				best[p] = score
+			}
+		}
+	}
+
+	matches := make([]Match, 0, len(best))
+	for p, score := range best {
+		matches = append(matches, Match{CardID: idx.entries[p].CardID, Name: idx.entries[p].Name, Score: score})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].CardID < matches[j].CardID
+	})
+
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
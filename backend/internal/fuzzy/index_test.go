@@ -0,0 +1,100 @@
+package fuzzy
+
+import "testing"
+
+var testEntries = []Entry{
+	{CardID: "bolt-m10", Name: "Lightning Bolt", SetCode: "M10", CollectorNumber: "146", TypeLine: "Instant"},
+	{CardID: "bolt-2xm", Name: "Lightning Bolt", SetCode: "2XM", CollectorNumber: "129", TypeLine: "Instant"},
+	{CardID: "helix", Name: "Lightning Helix", SetCode: "RAV", CollectorNumber: "213", TypeLine: "Instant"},
+	{CardID: "vial", Name: "Æther Vial", SetCode: "DST", CollectorNumber: "91", TypeLine: "Artifact"},
+	{CardID: "jace", Name: "Jace's Ingenuity", SetCode: "M11", CollectorNumber: "60", TypeLine: "Instant"},
+	{CardID: "giant", Name: "Bonecrusher Giant // Stomp", SetCode: "ELD", CollectorNumber: "115", TypeLine: "Creature — Giant // Instant — Adventure"},
+	{CardID: "fireice", Name: "Fire // Ice", SetCode: "MH2", CollectorNumber: "290", TypeLine: "Instant // Instant"},
+	{CardID: "dragon", Name: "Lightning Dragon", SetCode: "USG", CollectorNumber: "202", TypeLine: "Creature — Dragon"},
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"Æther Vial":                 "aether vial",
+		"Jace's Ingenuity":           "jaces ingenuity",
+		"Jace’s  Ingenuity!":         "jaces ingenuity",
+		"Fire // Ice":                "fire ice",
+		"Lim-Dûl's Vault":            "lim duls vault",
+		"  Borrowing 100,000 Arrows": "borrowing 100 000 arrows",
+	}
+
+	for input, expected := range tests {
+		if got := Normalize(input); got != expected {
+			t.Errorf("Normalize(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	if d := Levenshtein("kitten", "sitting"); d != 3 {
+		t.Errorf("Expected distance 3, got %d", d)
+	}
+	if d := Levenshtein("", "bolt"); d != 4 {
+		t.Errorf("Expected distance 4, got %d", d)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	idx := NewIndex(testEntries)
+
+	tests := []struct {
+		query    string
+		hints    Hints
+		expected string
+	}{
+		{"Lightnmg Bo1t", Hints{}, "Lightning Bolt"},
+		{"AEther Vial", Hints{}, "Æther Vial"},
+		{"Jaces Ingenuity", Hints{}, "Jace's Ingenuity"},
+		{"Bonecrusher Giant", Hints{}, "Bonecrusher Giant // Stomp"},
+		{"Stomp", Hints{}, "Bonecrusher Giant // Stomp"},
+		{"Fire Ice", Hints{}, "Fire // Ice"},
+		{"Lightning", Hints{TypeLine: "Creature Dragon"}, "Lightning Dragon"},
+	}
+
+	for _, tt := range tests {
+		matches := idx.Search(tt.query, tt.hints, 5)
+		if len(matches) == 0 || matches[0].Name != tt.expected {
+			t.Errorf("Search(%q): expected %q first, got %+v", tt.query, tt.expected, matches)
+		}
+	}
+}
+
+func TestSearchCollectorNumberHint(t *testing.T) {
+	idx := NewIndex(testEntries)
+
+	matches := idx.Search("Lightning Bolt", Hints{CollectorNumber: "129"}, 5)
+	if len(matches) < 2 || matches[0].CardID != "bolt-2xm" {
+		t.Fatalf("Expected collector number hint to pick the 2XM printing, got %+v", matches)
+	}
+	if matches[0].Score <= matches[1].Score {
+		t.Errorf("Expected hinted printing to score higher, got %+v", matches)
+	}
+}
+
+func TestSearchShortQuery(t *testing.T) {
+	idx := NewIndex(testEntries)
+	if matches := idx.Search("Bo", Hints{}, 5); matches != nil {
+		t.Errorf("Expected no matches for a short query, got %+v", matches)
+	}
+}
+
+func TestIndexAdd(t *testing.T) {
+	idx := NewIndex(testEntries[:2])
+	idx.Add(Entry{CardID: "giant", Name: "Bonecrusher Giant // Stomp", SetCode: "ELD", CollectorNumber: "115"})
+	idx.Add(Entry{CardID: "bolt-a25", Name: "Lightning Bolt", SetCode: "A25", CollectorNumber: "141"})
+
+	if idx.Len() != 4 {
+		t.Errorf("Expected 4 printings, got %d", idx.Len())
+	}
+	if matches := idx.Search("Stomp", Hints{}, 5); len(matches) == 0 || matches[0].CardID != "giant" {
+		t.Errorf("Expected the added card by its face name, got %+v", matches)
+	}
+	if matches := idx.Search("Lightning Bolt", Hints{}, 5); len(matches) < 3 || matches[2].Name != "Lightning Bolt" {
+		t.Errorf("Expected the added printing alongside the others, got %+v", matches)
+	}
+}
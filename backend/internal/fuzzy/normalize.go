@@ -0,0 +1,123 @@
+package fuzzy
+
+import (
+	"strings"
+	"unicode"
+)
+
+// foldings maps ligatures and accented letters found in card names to the
+// plain ASCII an OCR engine or a user typing is likely to produce
+var foldings = map[rune]string{
+	'æ': "ae", 'œ': "oe", 'ß': "ss",
+	'ﬁ': "fi", 'ﬂ': "fl", 'ﬀ': "ff", 'ﬃ': "ffi", 'ﬄ': "ffl",
+	'à': "a", 'á': "a", 'â': "a", 'ä': "a", 'ã': "a", 'å': "a",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ò': "o", 'ó': "o", 'ô': "o", 'ö': "o", 'õ': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u",
+	'ñ': "n", 'ç': "c",
+}
+
+// Normalize lowercases a card name, folds ligatures and accents, drops
+// apostrophes and other punctuation and collapses whitespace, so that
+// "Æther Vial" and "aether vial" or "Jace's Ingenuity" and "Jaces
+// Ingenuity" normalize identically
+func Normalize(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := true
+
+	for _, r := range strings.ToLower(s) {
+		if folded, ok := foldings[r]; ok {
+			b.WriteString(folded)
+			space = false
+			continue
+		}
+
+		switch {
+		case r == '\'' || r == '’' || r == '`' || r == '.':
+			// Dropped entirely so possessives match with or without the apostrophe
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			space = false
+		default:
+			if !space {
+				b.WriteByte(' ')
+				space = true
+			}
+		}
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// Faces splits a split, adventure or double-faced card name ("Fire // Ice")
+// into its face names. Single-faced names return nil.
+func Faces(name string) []string {
+	if !strings.Contains(name, "//") {
+		return nil
+	}
+
+	var faces []string
+	for _, face := range strings.Split(name, "//") {
+		if face = strings.TrimSpace(face); face != "" {
+			faces = append(faces, face)
+		}
+	}
+	return faces
+}
+
+// trigrams returns the distinct padded character trigrams of a normalized string
+func trigrams(s string) []string {
+	runes := []rune("  " + s + " ")
+	seen := make(map[string]bool, len(runes))
+	grams := make([]string, 0, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		g := string(runes[i : i+3])
+		if !seen[g] {
+			seen[g] = true
+			grams = append(grams, g)
+		}
+	}
+	return grams
+}
+
+// Levenshtein returns the edit distance between two strings
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 {
+		return len(rb)
+	}
+	if len(rb) == 0 {
+		return len(ra)
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// similarity returns the edit similarity of two normalized strings, from 0 to 1
+func similarity(a, b string) float64 {
+	longest := max(len([]rune(a)), len([]rune(b)))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(Levenshtein(a, b))/float64(longest)
+}
@@ -0,0 +1,87 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// ErrInvalidAttributes is returned for an unknown finish, condition or language
+var ErrInvalidAttributes = errors.New("invalid card attributes")
+
+// finishes are the accepted finish values
+var finishes = map[string]bool{
+	models.FinishNonfoil: true,
+	models.FinishFoil:    true,
+	models.FinishEtched:  true,
+}
+
+// conditions maps accepted condition spellings to their canonical grade
+var conditions = map[string]string{
+	"NM":  models.ConditionNearMint,
+	"M":   models.ConditionNearMint,
+	"LP":  models.ConditionLightlyPlayed,
+	"SP":  models.ConditionLightlyPlayed,
+	"MP":  models.ConditionModeratelyPlayed,
+	"HP":  models.ConditionHeavilyPlayed,
+	"DMG": models.ConditionDamaged,
+	"D":   models.ConditionDamaged,
+}
+
+// languages are the Scryfall language codes cards are printed in
+var languages = map[string]bool{
+	"en": true, "es": true, "fr": true, "de": true, "it": true, "pt": true,
+	"ja": true, "ko": true, "ru": true, "zhs": true, "zht": true, "he": true,
+	"la": true, "grc": true, "ar": true, "sa": true, "ph": true,
+}
+
+// NormalizeAttributes validates copy attributes and fills in the defaults:
+// nonfoil, near mint and English
+func NormalizeAttributes(attrs models.CopyAttributes) (models.CopyAttributes, error) {
+	attrs.Finish = strings.ToLower(strings.TrimSpace(attrs.Finish))
+	if attrs.Finish == "" {
+		attrs.Finish = models.FinishNonfoil
+	}
+	if !finishes[attrs.Finish] {
+		return attrs, fmt.Errorf("%w: unknown finish %q", ErrInvalidAttributes, attrs.Finish)
+	}
+
+	condition := strings.ToUpper(strings.TrimSpace(attrs.Condition))
+	if condition == "" {
+		condition = models.ConditionNearMint
+	}
+	canonical, ok := conditions[condition]
+	if !ok {
+		return attrs, fmt.Errorf("%w: unknown condition %q", ErrInvalidAttributes, attrs.Condition)
+	}
+	attrs.Condition = canonical
+
+	attrs.Language = strings.ToLower(strings.TrimSpace(attrs.Language))
+	if attrs.Language == "" {
+		attrs.Language = "en"
+	}
+	if !languages[attrs.Language] {
+		return attrs, fmt.Errorf("%w: unknown language %q", ErrInvalidAttributes, attrs.Language)
+	}
+
+	return attrs, nil
+}
+
+// withDefaults fills attributes a scan leaves unset from bulk scan defaults
+func withDefaults(attrs, defaults models.CopyAttributes) models.CopyAttributes {
+	if attrs.Finish == "" {
+		attrs.Finish = defaults.Finish
+	}
+	if attrs.Condition == "" {
+		attrs.Condition = defaults.Condition
+	}
+	if attrs.Language == "" {
+		attrs.Language = defaults.Language
+	}
+	attrs.Signed = attrs.Signed || defaults.Signed
+	attrs.Altered = attrs.Altered || defaults.Altered
+	attrs.Misprint = attrs.Misprint || defaults.Misprint
+	return attrs
+}
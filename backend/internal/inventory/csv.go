@@ -0,0 +1,399 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// ErrUnknownFormat is returned for a CSV format name or header layout that isn't supported
+var ErrUnknownFormat = errors.New("unknown CSV format")
+
+// csvRecord is an inventory line of a CSV file, independent of its column layout
+type csvRecord struct {
+	Quantity        int
+	Name            string
+	SetCode         string
+	CollectorNumber string
+	ScryfallID      string
+	models.CopyAttributes
+}
+
+// csvRow reads a CSV line's fields by column name
+type csvRow struct {
+	columns map[string]int
+	fields  []string
+}
+
+// get returns the field in the named column, matched case-insensitively
+func (r csvRow) get(column string) string {
+	i, ok := r.columns[strings.ToLower(column)]
+	if !ok || i >= len(r.fields) {
+		return ""
+	}
+	return strings.TrimSpace(r.fields[i])
+}
+
+// csvFormat is the column layout of a collection tool's CSV files
+type csvFormat struct {
+	name   string
+	header []string
+	// detect lists columns that together identify the format's header
+	detect []string
+	read   func(row csvRow) (csvRecord, error)
+	write  func(item *models.InventoryItem) []string
+}
+
+// csvFormats are the supported formats in detection order, most specific header first
+var csvFormats = []*csvFormat{nativeFormat, archidektFormat, tcgplayerFormat, deckboxFormat, moxfieldFormat}
+
+// csvFormatByName returns a supported format by name
+func csvFormatByName(name string) (*csvFormat, error) {
+	for _, f := range csvFormats {
+		if f.name == strings.ToLower(name) {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, name)
+}
+
+// detectCSVFormat identifies a format from a CSV header
+func detectCSVFormat(columns map[string]int) (*csvFormat, error) {
+	for _, f := range csvFormats {
+		found := true
+		for _, column := range f.detect {
+			if _, ok := columns[column]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: header doesn't match any supported layout", ErrUnknownFormat)
+}
+
+// nativeFormat is this server's own layout, carrying every copy attribute
+var nativeFormat = &csvFormat{
+	name: "native",
+	header: []string{"quantity", "name", "set_code", "collector_number", "scryfall_id",
+		"finish", "condition", "language", "signed", "altered", "misprint"},
+	detect: []string{"quantity", "name", "set_code"},
+	read: func(row csvRow) (csvRecord, error) {
+		quantity, err := parseQuantity(row.get("quantity"))
+		return csvRecord{
+			Quantity:        quantity,
+			Name:            row.get("name"),
+			SetCode:         row.get("set_code"),
+			CollectorNumber: row.get("collector_number"),
+			ScryfallID:      row.get("scryfall_id"),
+			CopyAttributes: models.CopyAttributes{
+				Finish:    row.get("finish"),
+				Condition: row.get("condition"),
+				Language:  row.get("language"),
+				Signed:    parseFlag(row.get("signed"), "signed"),
+				Altered:   parseFlag(row.get("altered"), "altered"),
+				Misprint:  parseFlag(row.get("misprint"), "misprint"),
+			},
+		}, err
+	},
+	write: func(item *models.InventoryItem) []string {
+		return []string{strconv.Itoa(item.Quantity), item.Card.Name, item.Card.SetCode, item.Card.CollectorNumber,
+			item.Card.ScryfallID, item.Finish, item.Condition, item.Language,
+			strconv.FormatBool(item.Signed), strconv.FormatBool(item.Altered), strconv.FormatBool(item.Misprint)}
+	},
+}
+
+// moxfieldFormat is Moxfield's collection export
+var moxfieldFormat = &csvFormat{
+	name: "moxfield",
+	header: []string{"Count", "Tradelist Count", "Name", "Edition", "Condition", "Language", "Foil", "Tags",
+		"Last Modified", "Collector Number", "Alter", "Proxy", "Purchase Price"},
+	detect: []string{"count", "name", "edition"},
+	read: func(row csvRow) (csvRecord, error) {
+		quantity, err := parseQuantity(row.get("Count"))
+		return csvRecord{
+			Quantity:        quantity,
+			Name:            row.get("Name"),
+			SetCode:         row.get("Edition"),
+			CollectorNumber: row.get("Collector Number"),
+			CopyAttributes: models.CopyAttributes{
+				Finish:    parseFinish(row.get("Foil")),
+				Condition: parseCondition(row.get("Condition")),
+				Language:  parseLanguage(row.get("Language")),
+				Altered:   parseFlag(row.get("Alter"), "alter"),
+			},
+		}, err
+	},
+	write: func(item *models.InventoryItem) []string {
+		foil := ""
+		if item.Finish != models.FinishNonfoil {
+			foil = item.Finish
+		}
+		return []string{strconv.Itoa(item.Quantity), "0", item.Card.Name, strings.ToLower(item.Card.SetCode),
+			conditionNames[item.Condition], languageName(item.Language), foil, "",
+			item.AddedAt.UTC().Format("2006-01-02 15:04:05"), item.Card.CollectorNumber,
+			titleBool(item.Altered), "False", ""}
+	},
+}
+
+// deckboxFormat is Deckbox's inventory export. Deckbox names editions in
+// full, which the local catalog doesn't know, so imports identify printings
+// by name and card number and exports write the set code.
+var deckboxFormat = &csvFormat{
+	name: "deckbox",
+	header: []string{"Count", "Tradelist Count", "Name", "Edition", "Card Number", "Condition", "Language",
+		"Foil", "Signed", "Artist Proof", "Altered Art", "Misprint", "Promo", "Textless", "My Price"},
+	detect: []string{"count", "name", "edition", "card number"},
+	read: func(row csvRow) (csvRecord, error) {
+		quantity, err := parseQuantity(row.get("Count"))
+		return csvRecord{
+			Quantity:        quantity,
+			Name:            row.get("Name"),
+			CollectorNumber: row.get("Card Number"),
+			CopyAttributes: models.CopyAttributes{
+				Finish:    parseFinish(row.get("Foil")),
+				Condition: parseCondition(row.get("Condition")),
+				Language:  parseLanguage(row.get("Language")),
+				Signed:    parseFlag(row.get("Signed"), "signed"),
+				Altered:   parseFlag(row.get("Altered Art"), "altered"),
+				Misprint:  parseFlag(row.get("Misprint"), "misprint"),
+			},
+		}, err
+	},
+	write: func(item *models.InventoryItem) []string {
+		return []string{strconv.Itoa(item.Quantity), "0", item.Card.Name, item.Card.SetCode, item.Card.CollectorNumber,
+			deckboxConditions[item.Condition], languageName(item.Language), flagValue(item.Finish != models.FinishNonfoil, "foil"),
+			flagValue(item.Signed, "signed"), "", flagValue(item.Altered, "altered"), flagValue(item.Misprint, "misprint"),
+			"", "", ""}
+	},
+}
+
+// tcgplayerFormat is TCGplayer's collection export
+var tcgplayerFormat = &csvFormat{
+	name: "tcgplayer",
+	header: []string{"Quantity", "Name", "Simple Name", "Set", "Card Number", "Set Code", "Printing",
+		"Condition", "Language", "Rarity", "Product ID", "SKU"},
+	detect: []string{"quantity", "simple name", "printing"},
+	read: func(row csvRow) (csvRecord, error) {
+		quantity, err := parseQuantity(row.get("Quantity"))
+		name := row.get("Simple Name")
+		if name == "" {
+			name = row.get("Name")
+		}
+
+		// Foil copies may be graded "Near Mint Foil"
+		condition := row.get("Condition")
+		finish := parseFinish(row.get("Printing"))
+		if trimmed, ok := strings.CutSuffix(strings.ToLower(condition), " foil"); ok {
+			condition = trimmed
+			finish = models.FinishFoil
+		}
+
+		return csvRecord{
+			Quantity:        quantity,
+			Name:            name,
+			SetCode:         row.get("Set Code"),
+			CollectorNumber: row.get("Card Number"),
+			CopyAttributes: models.CopyAttributes{
+				Finish:    finish,
+				Condition: parseCondition(condition),
+				Language:  parseLanguage(row.get("Language")),
+			},
+		}, err
+	},
+	write: func(item *models.InventoryItem) []string {
+		printing := "Normal"
+		if item.Finish != models.FinishNonfoil {
+			printing = "Foil"
+		}
+		return []string{strconv.Itoa(item.Quantity), item.Card.Name, item.Card.Name, item.Card.SetCode,
+			item.Card.CollectorNumber, item.Card.SetCode, printing, conditionNames[item.Condition],
+			languageName(item.Language), titleCase(item.Card.Rarity), "", ""}
+	},
+}
+
+// archidektFormat is Archidekt's collection export
+var archidektFormat = &csvFormat{
+	name: "archidekt",
+	header: []string{"Quantity", "Name", "Finish", "Condition", "Date Added", "Language", "Purchase Price", "Tags",
+		"Edition Name", "Edition Code", "Multiverse Id", "Scryfall ID", "MTGO ID", "Collector Number"},
+	detect: []string{"quantity", "name", "edition code"},
+	read: func(row csvRow) (csvRecord, error) {
+		quantity, err := parseQuantity(row.get("Quantity"))
+		return csvRecord{
+			Quantity:        quantity,
+			Name:            row.get("Name"),
+			SetCode:         row.get("Edition Code"),
+			CollectorNumber: row.get("Collector Number"),
+			ScryfallID:      row.get("Scryfall ID"),
+			CopyAttributes: models.CopyAttributes{
+				Finish:    parseFinish(row.get("Finish")),
+				Condition: parseCondition(row.get("Condition")),
+				Language:  parseLanguage(row.get("Language")),
+			},
+		}, err
+	},
+	write: func(item *models.InventoryItem) []string {
+		return []string{strconv.Itoa(item.Quantity), item.Card.Name, titleCase(item.Finish), item.Condition,
+			item.AddedAt.UTC().Format("2006-01-02"), languageName(item.Language), "", "", "",
+			strings.ToLower(item.Card.SetCode), "", item.Card.ScryfallID, "", item.Card.CollectorNumber}
+	},
+}
+
+// conditionNames are the full condition names used by most tools
+var conditionNames = map[string]string{
+	models.ConditionNearMint:         "Near Mint",
+	models.ConditionLightlyPlayed:    "Lightly Played",
+	models.ConditionModeratelyPlayed: "Moderately Played",
+	models.ConditionHeavilyPlayed:    "Heavily Played",
+	models.ConditionDamaged:          "Damaged",
+}
+
+// deckboxConditions are Deckbox's condition names
+var deckboxConditions = map[string]string{
+	models.ConditionNearMint:         "Near Mint",
+	models.ConditionLightlyPlayed:    "Good (Lightly Played)",
+	models.ConditionModeratelyPlayed: "Played",
+	models.ConditionHeavilyPlayed:    "Heavily Played",
+	models.ConditionDamaged:          "Poor",
+}
+
+// conditionAliases maps condition names used across tools to grades
+var conditionAliases = map[string]string{
+	"mint":                  models.ConditionNearMint,
+	"near mint":             models.ConditionNearMint,
+	"lightly played":        models.ConditionLightlyPlayed,
+	"slightly played":       models.ConditionLightlyPlayed,
+	"good (lightly played)": models.ConditionLightlyPlayed,
+	"excellent":             models.ConditionLightlyPlayed,
+	"ex":                    models.ConditionLightlyPlayed,
+	"moderately played":     models.ConditionModeratelyPlayed,
+	"played":                models.ConditionModeratelyPlayed,
+	"good":                  models.ConditionModeratelyPlayed,
+	"heavily played":        models.ConditionHeavilyPlayed,
+	"damaged":               models.ConditionDamaged,
+	"poor":                  models.ConditionDamaged,
+}
+
+// parseCondition maps a tool's condition name to a grade, leaving
+// abbreviations for NormalizeAttributes
+func parseCondition(v string) string {
+	if grade, ok := conditionAliases[strings.ToLower(strings.TrimSpace(v))]; ok {
+		return grade
+	}
+	return v
+}
+
+// languageNames maps Scryfall language codes to the names tools export
+var languageNames = map[string]string{
+	"en": "English", "es": "Spanish", "fr": "French", "de": "German", "it": "Italian",
+	"pt": "Portuguese", "ja": "Japanese", "ko": "Korean", "ru": "Russian",
+	"zhs": "Chinese Simplified", "zht": "Chinese Traditional", "he": "Hebrew",
+	"la": "Latin", "grc": "Ancient Greek", "ar": "Arabic", "sa": "Sanskrit", "ph": "Phyrexian",
+}
+
+// languageName returns a language's name, or the code if unnamed
+func languageName(code string) string {
+	if name, ok := languageNames[code]; ok {
+		return name
+	}
+	return code
+}
+
+// parseLanguage maps a language name to its code, leaving codes as they are
+func parseLanguage(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	for code, name := range languageNames {
+		if strings.ToLower(name) == v {
+			return code
+		}
+	}
+	switch v {
+	case "simplified chinese":
+		return "zhs"
+	case "traditional chinese":
+		return "zht"
+	case "portuguese (brazil)":
+		return "pt"
+	}
+	return v
+}
+
+// parseFinish maps a tool's foil or printing column to a finish
+func parseFinish(v string) string {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", "normal", "nonfoil", "non-foil", "false", "no":
+		return models.FinishNonfoil
+	case "foil", "true", "yes":
+		return models.FinishFoil
+	case "etched", "etched foil", "foil etched":
+		return models.FinishEtched
+	}
+	return v
+}
+
+// parseQuantity parses a quantity column, defaulting to 1 when empty
+func parseQuantity(v string) (int, error) {
+	if v == "" {
+		return 1, nil
+	}
+	quantity, err := strconv.Atoi(v)
+	if err != nil || quantity <= 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidQuantity, v)
+	}
+	return quantity, nil
+}
+
+// parseFlag reads a boolean column, which some tools fill with the column's
+// own name (e.g. "signed") instead of true
+func parseFlag(v, name string) bool {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if v == name {
+		return true
+	}
+	b, _ := strconv.ParseBool(v)
+	return b || v == "yes"
+}
+
+// flagValue writes a boolean column as its name or empty, as Deckbox does
+func flagValue(v bool, name string) string {
+	if v {
+		return name
+	}
+	return ""
+}
+
+// titleBool writes a boolean as True or False
+func titleBool(v bool) string {
+	if v {
+		return "True"
+	}
+	return "False"
+}
+
+// titleCase uppercases the first letter of a word
+func titleCase(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// writeShoppingCSV writes cards to buy as quantity, name, set code and
+// collector number, the columns shared by most card shops' mass entry
+func writeShoppingCSV(w io.Writer, items []models.InventoryItem) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"quantity", "name", "set_code", "collector_number"})
+	for _, item := range items {
+		writer.Write([]string{strconv.Itoa(item.Quantity), item.Card.Name, item.Card.SetCode, item.Card.CollectorNumber})
+	}
+	writer.Flush()
+	return writer.Error()
+}
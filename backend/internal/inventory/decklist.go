@@ -0,0 +1,90 @@
+package inventory
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// decklistLine is a card line of a plain-text decklist
+type decklistLine struct {
+	line int
+	text string
+	card models.DeckCardRequest
+}
+
+// decklistCard matches "4 Lightning Bolt", "4x Lightning Bolt (M10) 146" and
+// the foil and etched markers Moxfield appends ("*F*", "*E*")
+var decklistCard = regexp.MustCompile(`^(?:(\d+)x?\s+)?(.+?)(?:\s+\(([A-Za-z0-9]{2,6})\)(?:\s+([A-Za-z0-9★-]+))?)?(?:\s+\*[A-Z]\*)?$`)
+
+// decklistSections maps section headers to sections. Companions are kept in
+// the sideboard, as in paper play.
+var decklistSections = map[string]string{
+	"deck":       models.DeckMainboard,
+	"main":       models.DeckMainboard,
+	"mainboard":  models.DeckMainboard,
+	"maindeck":   models.DeckMainboard,
+	"sideboard":  models.DeckSideboard,
+	"side":       models.DeckSideboard,
+	"sb":         models.DeckSideboard,
+	"companion":  models.DeckSideboard,
+	"commander":  models.DeckCommander,
+	"commanders": models.DeckCommander,
+	"about":      "", // Arena deck metadata
+}
+
+// parseDecklist parses a plain-text decklist in the MTG Arena, MTGO or
+// Moxfield style. Cards are listed one per line with an optional quantity,
+// set code and collector number. Sections start with a header line
+// ("Sideboard"), an "SB:" prefix, or for MTGO lists a blank line after the
+// mainboard. It returns the card lines and the deck name from Arena's About
+// section, if any.
+func parseDecklist(text string) ([]decklistLine, string) {
+	var lines []decklistLine
+	var name string
+	section := models.DeckMainboard
+	headers, mainCards := false, 0
+
+	for i, raw := range strings.Split(text, "\n") {
+		text := strings.TrimSpace(raw)
+		if text == "" {
+			if !headers && section == models.DeckMainboard && mainCards > 0 {
+				section = models.DeckSideboard
+			}
+			continue
+		}
+		if strings.HasPrefix(text, "//") || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		header := strings.ToLower(strings.TrimSuffix(text, ":"))
+		if s, ok := decklistSections[header]; ok {
+			section, headers = s, true
+			continue
+		}
+		if section == "" {
+			if v, ok := strings.CutPrefix(text, "Name "); ok && name == "" {
+				name = strings.TrimSpace(v)
+			}
+			continue
+		}
+
+		cardSection := section
+		if v, ok := strings.CutPrefix(text, "SB:"); ok {
+			text, cardSection = strings.TrimSpace(v), models.DeckSideboard
+		}
+
+		m := decklistCard.FindStringSubmatch(text)
+		card := models.DeckCardRequest{Section: cardSection, Name: m[2], SetCode: m[3], CollectorNumber: m[4], Quantity: 1}
+		if m[1] != "" {
+			card.Quantity, _ = strconv.Atoi(m[1])
+		}
+		if cardSection == models.DeckMainboard {
+			mainCards++
+		}
+		lines = append(lines, decklistLine{line: i + 1, text: text, card: card})
+	}
+	return lines, name
+}
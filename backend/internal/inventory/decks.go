@@ -0,0 +1,274 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+var (
+	// ErrDeckNotFound is returned when a deck does not exist or belongs to another user
+	ErrDeckNotFound = errors.New("deck not found")
+	// ErrInvalidDeck is returned for a deck without a name or cards
+	ErrInvalidDeck = errors.New("invalid deck")
+)
+
+// deckSections are the accepted deck sections
+var deckSections = map[string]bool{
+	models.DeckMainboard: true,
+	models.DeckSideboard: true,
+	models.DeckCommander: true,
+}
+
+// CreateDeck creates a deck from a plain-text decklist and/or card lines.
+// Each line is resolved against the catalog; lines that can't be are left
+// out and reported, but a deck needs at least one card.
+func (s *Service) CreateDeck(userID string, req *models.DeckRequest) (*models.DeckImportResponse, error) {
+	lines, listName := parseDecklist(req.Decklist)
+	offset := len(strings.Split(req.Decklist, "\n"))
+	if req.Decklist == "" {
+		offset = 0
+	}
+	for i, c := range req.Cards {
+		lines = append(lines, decklistLine{line: offset + i + 1, text: c.Name, card: c})
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = listName
+	}
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidDeck)
+	}
+
+	format := strings.ToLower(strings.TrimSpace(req.Format))
+	if _, ok := deckFormats[format]; format != "" && !ok {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidDeck, req.Format)
+	}
+
+	deck := &models.Deck{UserID: userID, Name: name, Format: format, CreatedAt: time.Now()}
+	response := &models.DeckImportResponse{Deck: deck}
+	merged := make(map[models.DeckCard]int)
+	for _, l := range lines {
+		card, err := s.resolveDeckCard(l.card)
+		if err != nil {
+			response.Errors = append(response.Errors, models.DeckLineError{Line: l.line, Text: l.text, Error: err.Error()})
+			continue
+		}
+
+		// Repeated lines add up
+		key := models.DeckCard{Section: card.Section, Name: card.Name, CardID: card.CardID}
+		if i, ok := merged[key]; ok {
+			deck.Cards[i].Quantity += card.Quantity
+			continue
+		}
+		merged[key] = len(deck.Cards)
+		deck.Cards = append(deck.Cards, *card)
+	}
+	if len(deck.Cards) == 0 {
+		return nil, fmt.Errorf("%w: no cards could be resolved", ErrInvalidDeck)
+	}
+
+	if err := s.db.CreateDeck(deck); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// resolveDeckCard identifies a decklist line's card by name, pinning it to a
+// printing when the line names a set
+func (s *Service) resolveDeckCard(req models.DeckCardRequest) (*models.DeckCard, error) {
+	section := strings.ToLower(strings.TrimSpace(req.Section))
+	if section == "" {
+		section = models.DeckMainboard
+	}
+	if !deckSections[section] {
+		return nil, fmt.Errorf("%w: unknown section %q", ErrInvalidDeck, req.Section)
+	}
+	if req.Quantity <= 0 {
+		return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidQuantity)
+	}
+
+	candidates, err := s.resolveRecord(csvRecord{
+		Name:            strings.TrimSpace(req.Name),
+		SetCode:         req.SetCode,
+		CollectorNumber: req.CollectorNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	card := candidates[0].Card
+	deckCard := &models.DeckCard{Section: section, Name: card.Name, Quantity: req.Quantity}
+	if req.SetCode != "" {
+		deckCard.CardID = card.ID
+		deckCard.Card = card
+	}
+	return deckCard, nil
+}
+
+// GetDecks retrieves a user's decks without their cards
+func (s *Service) GetDecks(userID string) ([]models.Deck, error) {
+	return s.db.GetUserDecks(userID)
+}
+
+// GetDeck retrieves one of the user's decks with its cards
+func (s *Service) GetDeck(userID string, deckID int64) (*models.Deck, error) {
+	deck, err := s.getDeck(userID, deckID)
+	if err != nil {
+		return nil, err
+	}
+	if deck.Cards, err = s.db.GetDeckCards(deckID); err != nil {
+		return nil, err
+	}
+	return deck, nil
+}
+
+// DeleteDeck deletes one of the user's decks
+func (s *Service) DeleteDeck(userID string, deckID int64) error {
+	if _, err := s.getDeck(userID, deckID); err != nil {
+		return err
+	}
+	return s.db.DeleteDeck(deckID)
+}
+
+// GetDeckReport compares a deck against the user's inventory. Held copies
+// are shared out across the deck's lines so none is counted twice: lines
+// pinned to a printing take that printing first, then lines accepting any
+// printing take what's left, and pinned lines still short take other
+// printings last.
+func (s *Service) GetDeckReport(userID string, deckID int64) (*models.DeckReport, error) {
+	deck, err := s.GetDeck(userID, deckID)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, c := range deck.Cards {
+		if !seen[c.Name] {
+			seen[c.Name] = true
+			names = append(names, c.Name)
+		}
+	}
+	holdings, err := s.db.GetHoldingsByName(userID, names)
+	if err != nil {
+		return nil, err
+	}
+
+	// take removes up to n copies of the name's printings matching the filter
+	take := func(name string, n int, match func(cardID string) bool) int {
+		taken := 0
+		printings := holdings[name]
+		ids := make([]string, 0, len(printings))
+		for id := range printings {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			if taken == n {
+				break
+			}
+			if match(id) {
+				t := min(printings[id], n-taken)
+				printings[id] -= t
+				taken += t
+			}
+		}
+		return taken
+	}
+
+	report := &models.DeckReport{DeckID: deck.ID, Name: deck.Name, Cards: make([]models.DeckCardReport, len(deck.Cards))}
+	for i, c := range deck.Cards {
+		report.Cards[i].DeckCard = c
+		if c.CardID != "" {
+			report.Cards[i].Owned = take(c.Name, c.Quantity, func(id string) bool { return id == c.CardID })
+		}
+	}
+	for i, c := range deck.Cards {
+		if c.CardID == "" {
+			report.Cards[i].Owned = take(c.Name, c.Quantity, func(string) bool { return true })
+		}
+	}
+	for i, c := range deck.Cards {
+		r := &report.Cards[i]
+		if c.CardID != "" {
+			r.DifferentPrinting = take(c.Name, c.Quantity-r.Owned, func(id string) bool { return id != c.CardID })
+		}
+		r.Missing = c.Quantity - r.Owned - r.DifferentPrinting
+
+		report.Owned += r.Owned
+		report.DifferentPrinting += r.DifferentPrinting
+		report.Missing += r.Missing
+	}
+	report.Complete = report.Missing == 0 && report.DifferentPrinting == 0
+	return report, nil
+}
+
+// WriteShoppingList writes the cards missing from a deck, in "text" (one
+// "4 Lightning Bolt (M10) 146" line per card, as card shops accept) or
+// "csv" format. Copies held in a different printing aren't listed.
+func (s *Service) WriteShoppingList(userID string, deckID int64, format string, w io.Writer) error {
+	if format == "" {
+		format = "text"
+	}
+	if format != "text" && format != "csv" {
+		return fmt.Errorf("%w: %q, use text or csv", ErrUnknownFormat, format)
+	}
+
+	report, err := s.GetDeckReport(userID, deckID)
+	if err != nil {
+		return err
+	}
+
+	// Lines of the same card in several sections are bought together
+	var items []models.InventoryItem
+	index := make(map[string]int)
+	for _, r := range report.Cards {
+		if r.Missing == 0 {
+			continue
+		}
+		key := r.Name + "\x00" + r.CardID
+		if i, ok := index[key]; ok {
+			items[i].Quantity += r.Missing
+			continue
+		}
+		card := r.Card
+		if card == nil {
+			card = &models.Card{Name: r.Name}
+		}
+		index[key] = len(items)
+		items = append(items, models.InventoryItem{CardID: r.CardID, Quantity: r.Missing, Card: card})
+	}
+
+	if format == "csv" {
+		return writeShoppingCSV(w, items)
+	}
+	for _, item := range items {
+		line := fmt.Sprintf("%d %s", item.Quantity, item.Card.Name)
+		if item.Card.SetCode != "" {
+			line += fmt.Sprintf(" (%s) %s", item.Card.SetCode, item.Card.CollectorNumber)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getDeck retrieves a deck if it belongs to the user
+func (s *Service) getDeck(userID string, deckID int64) (*models.Deck, error) {
+	deck, err := s.db.GetDeck(deckID)
+	if err != nil {
+		return nil, err
+	}
+	if deck == nil || deck.UserID != userID {
+		return nil, ErrDeckNotFound
+	}
+	return deck, nil
+}
@@ -0,0 +1,127 @@
+package inventory
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+func TestParseDecklist(t *testing.T) {
+	lines, name := parseDecklist(`About
+Name Burn
+
+Deck
+4 Lightning Bolt (M10) 146
+2x Counterspell *F*
+// a comment
+
+Sideboard
+1 Lightning Bolt`)
+	if name != "Burn" {
+		t.Errorf("Expected name Burn, got %q", name)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 card lines, got %+v", lines)
+	}
+	expected := []models.DeckCardRequest{
+		{Section: models.DeckMainboard, Name: "Lightning Bolt", SetCode: "M10", CollectorNumber: "146", Quantity: 4},
+		{Section: models.DeckMainboard, Name: "Counterspell", Quantity: 2},
+		{Section: models.DeckSideboard, Name: "Lightning Bolt", Quantity: 1},
+	}
+	for i, l := range lines {
+		if l.card != expected[i] {
+			t.Errorf("Line %d: expected %+v, got %+v", l.line, expected[i], l.card)
+		}
+	}
+
+	// MTGO lists start the sideboard after a blank line
+	lines, _ = parseDecklist("4 Lightning Bolt\n\n2 Counterspell\nSB: 1 Lightning Bolt")
+	if len(lines) != 3 || lines[1].card.Section != models.DeckSideboard || lines[2].card.Section != models.DeckSideboard {
+		t.Errorf("Expected mainboard then sideboard, got %+v", lines)
+	}
+}
+
+func TestDeckReport(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	result, err := service.CreateDeck(userID, &models.DeckRequest{
+		Name: "Burn",
+		Decklist: "4 Lightning Bolt (M10) 146\n3 Counterspell\n1 Black Lotus\n\n" +
+			"2 Lightning Bolt",
+		Cards: []models.DeckCardRequest{{Section: "commander", Name: "Counterspell", Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create deck: %v", err)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Line != 3 {
+		t.Errorf("Expected Black Lotus on line 3 to be reported, got %+v", result.Errors)
+	}
+	if result.Deck.CardCount != 10 {
+		t.Errorf("Expected 10 cards, got %d", result.Deck.CardCount)
+	}
+
+	deck, err := service.GetDeck(userID, result.Deck.ID)
+	if err != nil {
+		t.Fatalf("Failed to get deck: %v", err)
+	}
+	if len(deck.Cards) != 4 || deck.Cards[0].Section != models.DeckCommander || deck.Cards[1].Card == nil || deck.Cards[1].Card.SetCode != "M10" {
+		t.Errorf("Unexpected deck cards %+v", deck.Cards)
+	}
+
+	// 2 M10 bolts and 3 2XM bolts cover 2 pinned M10 bolts, the 2 sideboard
+	// bolts, and 1 of the remaining pinned bolts in another printing
+	for cardID, quantity := range map[string]int{"bolt-m10": 2, "bolt-2xm": 3, "counterspell": 2} {
+		if _, err := service.AddCard(userID, cardID, &models.InventoryAddRequest{Quantity: quantity}); err != nil {
+			t.Fatalf("Failed to add card: %v", err)
+		}
+	}
+
+	report, err := service.GetDeckReport(userID, deck.ID)
+	if err != nil {
+		t.Fatalf("Failed to get report: %v", err)
+	}
+	byLine := make(map[string]models.DeckCardReport)
+	for _, r := range report.Cards {
+		byLine[r.Section+"/"+r.Name] = r
+	}
+	if r := byLine["mainboard/Lightning Bolt"]; r.Owned != 2 || r.DifferentPrinting != 1 || r.Missing != 1 {
+		t.Errorf("Unexpected pinned bolts %+v", r)
+	}
+	if r := byLine["sideboard/Lightning Bolt"]; r.Owned != 2 || r.Missing != 0 {
+		t.Errorf("Unexpected sideboard bolts %+v", r)
+	}
+	if r := byLine["commander/Counterspell"]; r.Owned != 1 {
+		t.Errorf("Unexpected commander %+v", r)
+	}
+	if r := byLine["mainboard/Counterspell"]; r.Owned != 1 || r.Missing != 2 {
+		t.Errorf("Unexpected counterspells %+v", r)
+	}
+	if report.Complete || report.Owned != 6 || report.DifferentPrinting != 1 || report.Missing != 3 {
+		t.Errorf("Unexpected totals %+v", report)
+	}
+
+	var buf bytes.Buffer
+	if err := service.WriteShoppingList(userID, deck.ID, "", &buf); err != nil {
+		t.Fatalf("Failed to write shopping list: %v", err)
+	}
+	if expected := "1 Lightning Bolt (M10) 146\n2 Counterspell\n"; buf.String() != expected {
+		t.Errorf("Expected shopping list %q, got %q", expected, buf.String())
+	}
+
+	if _, err := service.GetDeck("someone-else", deck.ID); !errors.Is(err, ErrDeckNotFound) {
+		t.Errorf("Expected deck not found error, got %v", err)
+	}
+	if _, err := service.CreateDeck(userID, &models.DeckRequest{Decklist: "4 Lightning Bolt"}); !errors.Is(err, ErrInvalidDeck) {
+		t.Errorf("Expected invalid deck error without a name, got %v", err)
+	}
+
+	if err := service.DeleteDeck(userID, deck.ID); err != nil {
+		t.Fatalf("Failed to delete deck: %v", err)
+	}
+	if decks, _ := service.GetDecks(userID); len(decks) != 0 {
+		t.Errorf("Expected no decks, got %+v", decks)
+	}
+}
@@ -0,0 +1,136 @@
+package inventory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// DefaultIdempotencyTTL is how long a response is kept for its idempotency key
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+var (
+	// ErrIdempotencyKeyReused is returned when an idempotency key is repeated
+	// with a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+
+	// errScanFailed tells once not to keep the response of a scan that
+	// recorded nothing, so retrying it scans again
+	errScanFailed = errors.New("scan failed")
+)
+
+// SetIdempotencyTTL sets how long responses are kept for their idempotency
+// keys. Repeats after that are processed as new requests.
+func (s *Service) SetIdempotencyTTL(ttl time.Duration) {
+	s.idempotencyTTL = ttl
+}
+
+// once runs fn, which sets *v, for the first request made with a key and
+// stores the response. Repeats of the request within the TTL get the stored
+// response decoded into v instead. The key is claimed in one transaction with
+// fn's writes and the response, so a request that dies halfway leaves no
+// claim behind; fn gets the transaction's service and must not resolve cards.
+// If fn returns errScanFailed its writes are kept but not the response.
+func (s *Service) once(userID, key string, request, v interface{}, fn func(tx *Service) error) error {
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	sum := sha256.Sum256(encoded)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	var failed error
+	err = s.inTx(func(tx *Service) error {
+		now := time.Now()
+		existing, err := tx.db.ClaimIdempotencyKey(&models.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			Fingerprint: fingerprint,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(s.idempotencyTTL),
+		})
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			if existing.Fingerprint != fingerprint {
+				return ErrIdempotencyKeyReused
+			}
+			if err := json.Unmarshal(existing.Response, v); err != nil {
+				return fmt.Errorf("failed to decode stored response: %w", err)
+			}
+			return nil
+		}
+
+		if err := fn(tx); err != nil {
+			if !errors.Is(err, errScanFailed) {
+				return err
+			}
+			// A failed scan leaves nothing to replay, so retries may go ahead
+			failed = err
+			return tx.db.ReleaseIdempotencyKey(userID, key)
+		}
+		response, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to encode response: %w", err)
+		}
+		return tx.db.SaveIdempotentResponse(userID, key, response)
+	})
+	if err != nil {
+		return err
+	}
+	return failed
+}
+
+// scanKey namespaces a client_scan_id. Single scans and the scans of bulk
+// requests share it, so a scan retried in either form is only made once.
+func scanKey(clientScanID string) string {
+	return "scan:" + clientScanID
+}
+
+// scanIdentity is what a client_scan_id stands for: the scan data and copy
+// attributes, whichever session or request the scan is sent in
+func scanIdentity(req *models.ScanRequest) models.ScanRequest {
+	identity := *req
+	identity.SessionID = 0
+	if attrs, err := NormalizeAttributes(req.CopyAttributes); err == nil {
+		identity.CopyAttributes = attrs
+	}
+	return identity
+}
+
+// scanFailure returns errScanFailed for a scan that neither committed a card
+// nor is pending confirmation, such as one that failed on a Scryfall outage
+func scanFailure(result *models.ScanResponse) error {
+	if !result.Success && result.Status != models.ScanStatusPending {
+		return errScanFailed
+	}
+	return nil
+}
+
+// scanOnce runs scanOne, unless the scan's client_scan_id was already
+// scanned, in which case the first response is returned. Failed scans aren't
+// kept, so they are made again when retried. It reports whether the scan was
+// made, so replays aren't counted again.
+func (s *Service) scanOnce(userID string, sessionID int, locationID int64, req *models.ScanRequest, resolve resolveFunc) (models.ScanResponse, bool) {
+	if req.ClientScanID == "" {
+		return s.scanOne(userID, sessionID, locationID, req, resolve), true
+	}
+
+	var result models.ScanResponse
+	scanned := false
+	err := s.once(userID, scanKey(req.ClientScanID), scanIdentity(req), &result, func(tx *Service) error {
+		result = tx.scanOne(userID, sessionID, locationID, req, resolve)
+		scanned = true
+		return scanFailure(&result)
+	})
+	if err != nil && !scanned {
+		return models.ScanResponse{Success: false, Error: err.Error()}, false
+	}
+	return result, scanned
+}
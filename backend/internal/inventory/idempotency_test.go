@@ -0,0 +1,154 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+func TestIdempotentScans(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	// A retried scan returns its first result without adding another copy
+	req := models.ScanRequest{CardName: "Counterspell", ClientScanID: "scan-1"}
+	first, err := service.ProcessSingleScan(userID, &req)
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	retry := req
+	again, err := service.ProcessSingleScan(userID, &retry)
+	if err != nil {
+		t.Fatalf("Failed to retry scan: %v", err)
+	}
+	if again.ScanID != first.ScanID || again.Card == nil || again.Card.ID != "counterspell" {
+		t.Errorf("Expected the first result %+v, got %+v", first, again)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 1 {
+		t.Errorf("Expected 1 copy after the retry, got %d", count)
+	}
+
+	other := models.ScanRequest{CardName: "Lightning Bolt", ClientScanID: "scan-1"}
+	if _, err := service.ProcessSingleScan(userID, &other); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("Expected idempotency key reused error, got %v", err)
+	}
+
+	// A bulk retry resends scans already made; only the new one is counted
+	bulk := models.BulkScanRequest{Scans: []models.ScanRequest{
+		{CardName: "Counterspell", ClientScanID: "scan-1"},
+		{SetCode: "M10", CollectorNumber: "146", ClientScanID: "scan-2"},
+	}}
+	result, err := service.ProcessBulkScan(userID, &bulk)
+	if err != nil {
+		t.Fatalf("Failed to bulk scan: %v", err)
+	}
+	if result.Results[0].ScanID != first.ScanID || result.SuccessfulScans != 2 {
+		t.Errorf("Unexpected bulk result %+v", result)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 2 {
+		t.Errorf("Expected 2 copies after the bulk scan, got %d", count)
+	}
+	session, err := service.GetSession(userID, result.SessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if session.CardsScanned != 1 || session.SuccessfulScans != 1 {
+		t.Errorf("Expected the replayed scan not to be counted again, got %+v", session)
+	}
+
+	// Repeating the bulk request's Idempotency-Key returns the first response
+	keyed := models.BulkScanRequest{IdempotencyKey: "bulk-1", Scans: []models.ScanRequest{{CardName: "Counterspell"}}}
+	firstBulk, err := service.ProcessBulkScan(userID, &keyed)
+	if err != nil {
+		t.Fatalf("Failed to bulk scan: %v", err)
+	}
+	keyed = models.BulkScanRequest{IdempotencyKey: "bulk-1", Scans: []models.ScanRequest{{CardName: "Counterspell"}}}
+	againBulk, err := service.ProcessBulkScan(userID, &keyed)
+	if err != nil {
+		t.Fatalf("Failed to retry bulk scan: %v", err)
+	}
+	if againBulk.SessionID != firstBulk.SessionID || againBulk.Results[0].ScanID != firstBulk.Results[0].ScanID {
+		t.Errorf("Expected the first response %+v, got %+v", firstBulk, againBulk)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 3 {
+		t.Errorf("Expected 3 copies after the retried bulk scan, got %d", count)
+	}
+
+	// A failed scan isn't kept, so retrying it once the card can be found
+	// adds it, singly or in a bulk request
+	lotus := models.ScanRequest{CardName: "Black Lotus", ClientScanID: "scan-lotus"}
+	failed, err := service.ProcessSingleScan(userID, &lotus)
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if failed.Success || failed.Status != models.ScanStatusFailed {
+		t.Fatalf("Expected failed scan, got %+v", failed)
+	}
+	if _, err := service.ProcessBulkScan(userID, &models.BulkScanRequest{Scans: []models.ScanRequest{lotus}}); err != nil {
+		t.Fatalf("Failed to bulk scan: %v", err)
+	}
+	card := &models.Card{ID: "lotus", ScryfallID: "lotus", Name: "Black Lotus", SetCode: "LEA", CollectorNumber: "232", TypeLine: "Artifact", Rarity: "rare", CreatedAt: time.Now()}
+	if err := db.CreateCard(card); err != nil {
+		t.Fatalf("Failed to create card: %v", err)
+	}
+	retried, err := service.ProcessSingleScan(userID, &lotus)
+	if err != nil {
+		t.Fatalf("Failed to retry scan: %v", err)
+	}
+	if !retried.Success || retried.ScanID == failed.ScanID {
+		t.Errorf("Expected the retry to be scanned again, got %+v", retried)
+	}
+	if replayed, _ := service.ProcessSingleScan(userID, &lotus); replayed.ScanID != retried.ScanID {
+		t.Errorf("Expected the successful scan to be kept, got %+v", replayed)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 4 {
+		t.Errorf("Expected 4 copies after the retried scan, got %d", count)
+	}
+
+	// Once a key expires the scan is made again
+	service.SetIdempotencyTTL(-time.Second)
+	if _, err := service.ProcessSingleScan(userID, &models.ScanRequest{CardName: "Counterspell", ClientScanID: "scan-3"}); err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if _, err := service.ProcessSingleScan(userID, &models.ScanRequest{CardName: "Counterspell", ClientScanID: "scan-3"}); err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 6 {
+		t.Errorf("Expected expired keys to be scanned again, got %d copies", count)
+	}
+}
+
+func TestAbandonedIdempotencyKey(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	// A claim left without a response by a request that died is taken over
+	// by the retry instead of blocking it until the key expires
+	now := time.Now()
+	if _, err := db.Exec(`INSERT INTO idempotency_keys (user_id, key, fingerprint, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		userID, "scan:stale", "abandoned", now, now.Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to create idempotency key: %v", err)
+	}
+
+	req := models.ScanRequest{CardName: "Counterspell", ClientScanID: "stale"}
+	first, err := service.ProcessSingleScan(userID, &req)
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if !first.Success {
+		t.Errorf("Expected the scan to succeed, got %+v", first)
+	}
+	retry := req
+	again, err := service.ProcessSingleScan(userID, &retry)
+	if err != nil {
+		t.Fatalf("Failed to retry scan: %v", err)
+	}
+	if again.ScanID != first.ScanID {
+		t.Errorf("Expected the first result %+v, got %+v", first, again)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 1 {
+		t.Errorf("Expected 1 copy, got %d", count)
+	}
+}
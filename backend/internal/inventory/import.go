@@ -0,0 +1,218 @@
+package inventory
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+	"github.com/abzi/mtg_card_detector/internal/scanner"
+)
+
+// ErrInvalidCSV is returned when an import isn't readable as CSV
+var ErrInvalidCSV = errors.New("invalid CSV")
+
+// ImportCSV adds the cards listed in an inventory CSV file. An empty or
+// "auto" format is detected from the header. Each line is resolved like a
+// scan: lines matching one printing are added in a single transaction,
+// while ambiguous and unresolvable lines are only reported. A dry run
+// reports without adding anything.
+func (s *Service) ImportCSV(userID string, r io.Reader, format string, dryRun bool) (*models.ImportReport, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read header: %v", ErrInvalidCSV, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if _, ok := columns[column]; !ok {
+			columns[column] = i
+		}
+	}
+
+	var f *csvFormat
+	if format == "" || format == "auto" {
+		f, err = detectCSVFormat(columns)
+	} else {
+		f, err = csvFormatByName(format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ImportReport{Format: f.name, DryRun: dryRun, Rows: []models.ImportRow{}}
+	resolved := make(map[string]importResolution)
+	var items []models.InventoryItem
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+		}
+		if blankRecord(fields) {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		row := s.importRow(f, csvRow{columns: columns, fields: fields}, resolved)
+		row.Line = line
+		switch row.Status {
+		case models.ImportMatched:
+			report.Matched++
+			report.CardsAdded += row.Quantity
+			items = append(items, models.InventoryItem{CardID: row.Card.ID, Quantity: row.Quantity, CopyAttributes: row.CopyAttributes})
+		case models.ImportAmbiguous:
+			report.Ambiguous++
+		default:
+			report.Failed++
+		}
+		report.Rows = append(report.Rows, row)
+	}
+
+	if dryRun || len(items) == 0 {
+		if dryRun {
+			report.CardsAdded = 0
+		}
+		return report, nil
+	}
+	if err := s.db.AddItemsToInventory(userID, items, models.LedgerSource{Source: models.LedgerImport}); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// importResolution caches how a card reference resolved, since collection
+// files often list the same printing once per condition or finish
+type importResolution struct {
+	candidates []models.CardCandidate
+	err        error
+}
+
+// importRow parses and resolves one CSV line
+func (s *Service) importRow(f *csvFormat, fields csvRow, resolved map[string]importResolution) models.ImportRow {
+	record, err := f.read(fields)
+	row := models.ImportRow{
+		Status:         models.ImportFailed,
+		Quantity:       record.Quantity,
+		Name:           record.Name,
+		CopyAttributes: record.CopyAttributes,
+	}
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	if row.CopyAttributes, err = NormalizeAttributes(record.CopyAttributes); err != nil {
+		row.Error = err.Error()
+		return row
+	}
+
+	key := strings.ToLower(strings.Join([]string{record.ScryfallID, record.Name, record.SetCode, record.CollectorNumber}, "\x00"))
+	res, ok := resolved[key]
+	if !ok {
+		res.candidates, res.err = s.resolveRecord(record)
+		resolved[key] = res
+	}
+	if res.err != nil {
+		row.Error = res.err.Error()
+		return row
+	}
+
+	if needsConfirmation(res.candidates) {
+		row.Status = models.ImportAmbiguous
+		row.Candidates = res.candidates
+		row.Error = "multiple printings match, add the set code and collector number"
+		return row
+	}
+	row.Status = models.ImportMatched
+	row.Card = res.candidates[0].Card
+	row.Name = row.Card.Name
+	return row
+}
+
+// resolveRecord identifies a CSV line's printing by Scryfall ID when given,
+// otherwise through the scanner's resolver chain, narrowing the candidates
+// by collector number for formats that don't carry set codes
+func (s *Service) resolveRecord(record csvRecord) ([]models.CardCandidate, error) {
+	if record.ScryfallID != "" {
+		if card, err := s.db.GetCardByScryfallID(record.ScryfallID); err == nil {
+			return []models.CardCandidate{{Card: card, Confidence: 1}}, nil
+		}
+	}
+
+	found, err := s.scanner.Resolve(context.Background(), &models.ScanRequest{
+		CardName:        record.Name,
+		SetCode:         strings.ToUpper(record.SetCode),
+		CollectorNumber: record.CollectorNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, scanner.ErrCardNotFound
+	}
+
+	var candidates, numbered []models.CardCandidate
+	for _, c := range found {
+		candidate := models.CardCandidate{Card: c.Card, Confidence: c.Confidence}
+		candidates = append(candidates, candidate)
+		if record.CollectorNumber != "" && strings.EqualFold(c.Card.CollectorNumber, record.CollectorNumber) {
+			numbered = append(numbered, candidate)
+		}
+	}
+	if len(numbered) == 1 {
+		// The collector number pins down the printing
+		numbered[0].Confidence = 1
+	}
+	if len(numbered) > 0 {
+		candidates = numbered
+	}
+	return candidates, nil
+}
+
+// ExportCSV writes the user's inventory as CSV in the named format
+func (s *Service) ExportCSV(userID string, format string, w io.Writer) error {
+	f, err := csvFormatByName(format)
+	if err != nil {
+		return err
+	}
+
+	items, err := s.db.GetUserInventory(userID)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(f.header); err != nil {
+		return err
+	}
+	for i := range items {
+		if items[i].Card == nil {
+			continue
+		}
+		if err := writer.Write(f.write(&items[i])); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// blankRecord reports whether every field of a CSV line is empty
+func blankRecord(fields []string) bool {
+	for _, field := range fields {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+func TestImportCSV(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	input := strings.Join([]string{
+		"Count,Tradelist Count,Name,Edition,Condition,Language,Foil,Tags,Last Modified,Collector Number,Alter,Proxy,Purchase Price",
+		"2,0,Lightning Bolt,m10,Near Mint,English,,,,146,False,False,",
+		"1,0,Lightning Bolt,,Lightly Played,Japanese,foil,,,,False,False,",
+		"1,0,Counterspell,,Damaged,English,,,,,True,False,",
+		"1,0,Black Lotus,,Near Mint,English,,,,,False,False,",
+		"x,0,Counterspell,,Near Mint,English,,,,,False,False,",
+	}, "\n")
+
+	// A dry run reports every line without adding anything
+	report, err := service.ImportCSV(userID, strings.NewReader(input), "auto", true)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if report.Format != "moxfield" {
+		t.Errorf("Expected moxfield format to be detected, got %q", report.Format)
+	}
+	if report.Matched != 2 || report.Ambiguous != 1 || report.Failed != 2 || report.CardsAdded != 0 {
+		t.Errorf("Unexpected dry run report: %+v", report)
+	}
+	if row := report.Rows[1]; row.Line != 3 || len(row.Candidates) != 2 {
+		t.Errorf("Expected ambiguous row on line 3 with two candidates, got %+v", row)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 0 {
+		t.Errorf("Expected dry run to leave inventory empty, got %d cards", count)
+	}
+
+	report, err = service.ImportCSV(userID, strings.NewReader(input), "", false)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if report.CardsAdded != 3 {
+		t.Errorf("Expected 3 cards added, got %d", report.CardsAdded)
+	}
+
+	items, err := db.GetUserInventory(userID)
+	if err != nil {
+		t.Fatalf("Failed to get inventory: %v", err)
+	}
+	byCard := make(map[string]models.InventoryItem)
+	for _, item := range items {
+		byCard[item.CardID] = item
+	}
+	if item := byCard["bolt-m10"]; item.Quantity != 2 || item.Condition != models.ConditionNearMint {
+		t.Errorf("Unexpected M10 bolts: %+v", item)
+	}
+	if item := byCard["counterspell"]; item.Condition != models.ConditionDamaged || !item.Altered {
+		t.Errorf("Unexpected counterspell: %+v", item)
+	}
+
+	if _, err := service.ImportCSV(userID, strings.NewReader("foo,bar\n1,2\n"), "", true); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Expected unknown format error, got %v", err)
+	}
+}
+
+func TestImportFormats(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	tests := []struct {
+		name   string
+		input  string
+		finish string
+		cond   string
+		lang   string
+	}{
+		{"deckbox", "Count,Tradelist Count,Name,Edition,Card Number,Condition,Language,Foil,Signed,Artist Proof,Altered Art,Misprint,Promo,Textless,My Price\n" +
+			"1,0,Lightning Bolt,Magic 2010,146,Good (Lightly Played),German,foil,signed,,,,,,\n", models.FinishFoil, models.ConditionLightlyPlayed, "de"},
+		{"tcgplayer", "Quantity,Name,Simple Name,Set,Card Number,Set Code,Printing,Condition,Language,Rarity,Product ID,SKU\n" +
+			"1,Lightning Bolt,Lightning Bolt,Magic 2010,146,M10,Normal,Near Mint Foil,English,Common,,\n", models.FinishFoil, models.ConditionNearMint, "en"},
+		{"archidekt", "Quantity,Name,Finish,Condition,Date Added,Language,Purchase Price,Tags,Edition Name,Edition Code,Multiverse Id,Scryfall ID,MTGO ID,Collector Number\n" +
+			"1,Lightning Bolt,Etched,MP,2024-01-01,EN,,,,,,bolt-m10,,\n", models.FinishEtched, models.ConditionModeratelyPlayed, "en"},
+		{"native", "quantity,name,set_code,collector_number,scryfall_id,finish,condition,language,signed,altered,misprint\n" +
+			"1,Lightning Bolt,M10,146,,nonfoil,HP,ja,false,false,true\n", models.FinishNonfoil, models.ConditionHeavilyPlayed, "ja"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := service.ImportCSV(userID, strings.NewReader(tt.input), "", true)
+			if err != nil {
+				t.Fatalf("Failed to import: %v", err)
+			}
+			if report.Format != tt.name {
+				t.Errorf("Expected %s format, got %q", tt.name, report.Format)
+			}
+			if report.Matched != 1 {
+				t.Fatalf("Expected one matched row, got %+v", report.Rows)
+			}
+			row := report.Rows[0]
+			if row.Card.ID != "bolt-m10" || row.Finish != tt.finish || row.Condition != tt.cond || row.Language != tt.lang {
+				t.Errorf("Unexpected row: %+v", row)
+			}
+		})
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	attrs := models.CopyAttributes{Finish: models.FinishFoil, Condition: models.ConditionLightlyPlayed, Language: "ja"}
+	if _, err := db.AddToInventory(userID, "bolt-2xm", attrs, 3, 0, manualChange); err != nil {
+		t.Fatalf("Failed to add card: %v", err)
+	}
+
+	for _, f := range csvFormats {
+		var buf bytes.Buffer
+		if err := service.ExportCSV(userID, f.name, &buf); err != nil {
+			t.Fatalf("Failed to export %s: %v", f.name, err)
+		}
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil || len(records) != 2 {
+			t.Fatalf("Expected header and one row in %s export, got %v (%v)", f.name, records, err)
+		}
+
+		// Every export reads back as the same copies
+		report, err := service.ImportCSV(userID, bytes.NewReader(exportBytes(t, service, userID, f.name)), f.name, true)
+		if err != nil {
+			t.Fatalf("Failed to re-import %s: %v", f.name, err)
+		}
+		row := report.Rows[0]
+		if row.Status != models.ImportMatched || row.Card.ID != "bolt-2xm" || row.Quantity != 3 || row.Finish != models.FinishFoil {
+			t.Errorf("Unexpected %s round trip: %+v", f.name, row)
+		}
+		if row.Condition != models.ConditionLightlyPlayed || row.Language != "ja" {
+			t.Errorf("Expected %s to keep condition and language, got %+v", f.name, row.CopyAttributes)
+		}
+	}
+
+	if err := service.ExportCSV(userID, "excel", &bytes.Buffer{}); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Expected unknown format error, got %v", err)
+	}
+}
+
+func exportBytes(t *testing.T, service *Service, userID, format string) []byte {
+	var buf bytes.Buffer
+	if err := service.ExportCSV(userID, format, &buf); err != nil {
+		t.Fatalf("Failed to export %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
@@ -1,6 +1,7 @@
 package inventory
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,137 +11,134 @@ import (
 )
 
 type Service struct {
-	db      *database.DB
-	scanner *scanner.Service
+	db             *database.DB
+	scanner        *scanner.Service
+	jobs           *jobBroker
+	idempotencyTTL time.Duration
 }
 
 // NewService creates a new inventory service
 func NewService(db *database.DB, scanner *scanner.Service) *Service {
 	return &Service{
-		db:      db,
-		scanner: scanner,
+		db:             db,
+		scanner:        scanner,
+		jobs:           newJobBroker(),
+		idempotencyTTL: DefaultIdempotencyTTL,
 	}
 }
 
-// ProcessSingleScan processes a single card scan and adds to inventory
-func (s *Service) ProcessSingleScan(userID string, req *models.ScanRequest) (*models.ScanResponse, error) {
-	// Create scan session
-	session := &models.ScanSession{
-		UserID:    userID,
-		ScanType:  "single",
-		StartedAt: time.Now(),
+// inTx runs fn with a copy of the service whose database writes all run in
+// one transaction, committed if fn returns nil
+func (s *Service) inTx(fn func(tx *Service) error) error {
+	return s.db.WithTx(func(db *database.DB) error {
+		tx := *s
+		tx.db = db
+		return fn(&tx)
+	})
+}
+
+// GetInventory retrieves user's inventory
+func (s *Service) GetInventory(userID string) ([]models.InventoryItem, error) {
+	return s.db.GetUserInventory(userID)
+}
+
+const (
+	// DefaultPageSize is the number of inventory entries listed per page by default
+	DefaultPageSize = 100
+	// MaxPageSize is the largest page of inventory entries that can be requested
+	MaxPageSize = 500
+)
+
+// ListInventory retrieves a filtered, sorted page of the user's inventory
+func (s *Service) ListInventory(userID string, q *models.InventoryQuery) (*models.InventoryPage, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
 	}
-	sessionID, err := s.db.CreateScanSession(session)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create scan session: %w", err)
+	q.Limit = min(q.Limit, MaxPageSize)
+	return s.db.QueryInventory(userID, q)
+}
+
+// ErrInvalidQuantity is returned for a quantity change that is missing or out of range
+var ErrInvalidQuantity = errors.New("invalid quantity")
+
+// manualChange is the ledger source of inventory edits made through the API
+var manualChange = models.LedgerSource{Source: models.LedgerManual}
+
+// AddCard adds copies of a card to the user's inventory by card ID, without
+// going through the scanner
+func (s *Service) AddCard(userID, cardID string, req *models.InventoryAddRequest) (*models.InventoryItem, error) {
+	quantity := req.Quantity
+	if quantity == 0 {
+		quantity = 1
+	}
+	if quantity < 0 {
+		return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidQuantity)
 	}
 
-	// Scan the card
-	card, err := s.scanner.ScanCard(req)
+	attrs, err := NormalizeAttributes(req.CopyAttributes)
 	if err != nil {
-		// Update session with failure
-		s.db.UpdateScanSession(sessionID, 1, 0, 1)
-		return &models.ScanResponse{
-			Success: false,
-			Error:   err.Error(),
-		}, nil
+		return nil, err
 	}
 
-	// Add to inventory
-	if err := s.db.AddToInventory(userID, card.ID, 1); err != nil {
-		s.db.UpdateScanSession(sessionID, 1, 0, 1)
-		return &models.ScanResponse{
-			Success: false,
-			Error:   fmt.Sprintf("failed to add to inventory: %v", err),
-		}, nil
+	card, err := s.db.GetCardByID(cardID)
+	if err != nil {
+		return nil, err
+	}
+	if card == nil {
+		return nil, scanner.ErrCardNotFound
 	}
 
-	// Update session with success
-	s.db.UpdateScanSession(sessionID, 1, 1, 0)
+	var locationID int64
+	if req.LocationID != nil {
+		if _, err := s.getLocation(userID, *req.LocationID); err != nil {
+			return nil, err
+		}
+		locationID = *req.LocationID
+	}
 
-	return &models.ScanResponse{
-		Success: true,
-		Card:    card,
-	}, nil
+	return s.db.AddToInventory(userID, cardID, attrs, quantity, locationID, manualChange)
 }
 
-// ProcessBulkScan processes multiple card scans
-func (s *Service) ProcessBulkScan(userID string, req *models.BulkScanRequest) (*models.BulkScanResponse, error) {
-	// Create scan session
-	session := &models.ScanSession{
-		UserID:    userID,
-		ScanType:  "bulk",
-		StartedAt: time.Now(),
+// UpdateQuantity sets or adjusts the number of copies of a card with the
+// given attributes. The entry is removed when no copies are left.
+func (s *Service) UpdateQuantity(userID, cardID string, attrs models.CopyAttributes, req *models.InventoryUpdateRequest) (*models.InventoryItem, error) {
+	if (req.Quantity == nil) == (req.Delta == nil) {
+		return nil, fmt.Errorf("%w: exactly one of quantity and delta is required", ErrInvalidQuantity)
 	}
-	sessionID, err := s.db.CreateScanSession(session)
+
+	attrs, err := NormalizeAttributes(attrs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create scan session: %w", err)
+		return nil, err
 	}
 
-	results := make([]models.ScanResponse, 0, len(req.Scans))
-	successful := 0
-	failed := 0
-
-	for _, scanReq := range req.Scans {
-		card, err := s.scanner.ScanCard(&scanReq)
-		if err != nil {
-			failed++
-			results = append(results, models.ScanResponse{
-				Success: false,
-				Error:   err.Error(),
-			})
-			continue
+	if req.Quantity != nil {
+		if *req.Quantity < 0 {
+			return nil, fmt.Errorf("%w: quantity cannot be negative", ErrInvalidQuantity)
 		}
-
-		// Add to inventory
-		if err := s.db.AddToInventory(userID, card.ID, 1); err != nil {
-			failed++
-			results = append(results, models.ScanResponse{
-				Success: false,
-				Error:   fmt.Sprintf("failed to add to inventory: %v", err),
-			})
-			continue
-		}
-
-		successful++
-		results = append(results, models.ScanResponse{
-			Success: true,
-			Card:    card,
-		})
+		return s.db.SetInventoryQuantity(userID, cardID, attrs, *req.Quantity, manualChange)
 	}
-
-	// Update scan session
-	s.db.UpdateScanSession(sessionID, len(req.Scans), successful, failed)
-
-	return &models.BulkScanResponse{
-		SessionID:       sessionID,
-		TotalScanned:    len(req.Scans),
-		SuccessfulScans: successful,
-		FailedScans:     failed,
-		Results:         results,
-	}, nil
+	return s.db.AdjustInventoryQuantity(userID, cardID, attrs, *req.Delta, manualChange)
 }
 
-// GetInventory retrieves user's inventory
-func (s *Service) GetInventory(userID string) ([]models.InventoryItem, error) {
-	return s.db.GetUserInventory(userID)
-}
+// RemoveCard removes up to quantity copies of a card with the given
+// attributes, or all of them if quantity is 0
+func (s *Service) RemoveCard(userID, cardID string, attrs models.CopyAttributes, quantity int) (*models.InventoryItem, error) {
+	if quantity < 0 {
+		return nil, fmt.Errorf("%w: quantity cannot be negative", ErrInvalidQuantity)
+	}
 
-// GetInventoryStats retrieves inventory statistics
-func (s *Service) GetInventoryStats(userID string) (map[string]interface{}, error) {
-	count, err := s.db.GetInventoryCount(userID)
+	attrs, err := NormalizeAttributes(attrs)
 	if err != nil {
 		return nil, err
 	}
 
-	inventory, err := s.db.GetUserInventory(userID)
-	if err != nil {
-		return nil, err
+	if quantity == 0 {
+		return s.db.SetInventoryQuantity(userID, cardID, attrs, 0, manualChange)
 	}
+	return s.db.RemoveFromInventory(userID, cardID, attrs, quantity, manualChange)
+}
 
-	return map[string]interface{}{
-		"total_cards":       count,
-		"unique_cards":      len(inventory),
-		"last_updated":      time.Now(),
-	}, nil
+// GetInventoryStats retrieves inventory totals and breakdowns
+func (s *Service) GetInventoryStats(userID string) (*models.InventoryStats, error) {
+	return s.db.GetInventoryStats(userID)
 }
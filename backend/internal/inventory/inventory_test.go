@@ -0,0 +1,225 @@
+package inventory
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"testing"
+
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/models"
+	"github.com/abzi/mtg_card_detector/internal/scanner"
+)
+
+func TestInventoryCRUD(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	foil := models.CopyAttributes{Finish: models.FinishFoil}
+
+	item, err := service.AddCard(userID, "counterspell", &models.InventoryAddRequest{Quantity: 3, CopyAttributes: foil})
+	if err != nil {
+		t.Fatalf("Failed to add card: %v", err)
+	}
+	if item.Quantity != 3 || item.Finish != models.FinishFoil || item.Card == nil {
+		t.Errorf("Expected 3 foil copies, got %+v", item)
+	}
+
+	if _, err := service.AddCard(userID, "no-such-card", &models.InventoryAddRequest{}); !errors.Is(err, scanner.ErrCardNotFound) {
+		t.Errorf("Expected card not found error, got %v", err)
+	}
+
+	quantity, delta := 5, -2
+	if item, err = service.UpdateQuantity(userID, "counterspell", foil, &models.InventoryUpdateRequest{Quantity: &quantity}); err != nil || item.Quantity != 5 {
+		t.Fatalf("Expected quantity set to 5, got %+v (%v)", item, err)
+	}
+	if item, err = service.UpdateQuantity(userID, "counterspell", foil, &models.InventoryUpdateRequest{Delta: &delta}); err != nil || item.Quantity != 3 {
+		t.Fatalf("Expected quantity adjusted to 3, got %+v (%v)", item, err)
+	}
+	delta = -4
+	if _, err = service.UpdateQuantity(userID, "counterspell", foil, &models.InventoryUpdateRequest{Delta: &delta}); !errors.Is(err, database.ErrNotEnoughCopies) {
+		t.Errorf("Expected not enough copies error, got %v", err)
+	}
+	if _, err = service.UpdateQuantity(userID, "counterspell", foil, &models.InventoryUpdateRequest{}); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("Expected invalid quantity error, got %v", err)
+	}
+
+	// The nonfoil entry is a different entry
+	if _, err = service.RemoveCard(userID, "counterspell", models.CopyAttributes{}, 0); !errors.Is(err, database.ErrNotInInventory) {
+		t.Errorf("Expected not in inventory error, got %v", err)
+	}
+
+	if item, err = service.RemoveCard(userID, "counterspell", foil, 0); err != nil || item.Quantity != 0 {
+		t.Fatalf("Expected all copies removed, got %+v (%v)", item, err)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 0 {
+		t.Errorf("Expected empty inventory, got %d cards", count)
+	}
+}
+
+func TestConcurrentRemoval(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	if _, err := service.AddCard(userID, "counterspell", &models.InventoryAddRequest{Quantity: 10}); err != nil {
+		t.Fatalf("Failed to add card: %v", err)
+	}
+
+	// Twice as many removals as copies race; exactly ten may succeed
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	removed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			delta := -1
+			_, err := service.UpdateQuantity(userID, "counterspell", models.CopyAttributes{}, &models.InventoryUpdateRequest{Delta: &delta})
+			if err == nil {
+				mu.Lock()
+				removed++
+				mu.Unlock()
+			} else if !errors.Is(err, database.ErrNotEnoughCopies) && !errors.Is(err, database.ErrNotInInventory) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if removed != 10 {
+		t.Errorf("Expected 10 successful removals, got %d", removed)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 0 {
+		t.Errorf("Expected empty inventory, got %d cards", count)
+	}
+}
+
+func TestListInventory(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	for cardID, quantity := range map[string]int{"bolt-m10": 2, "bolt-2xm": 1, "counterspell": 4} {
+		if _, err := service.AddCard(userID, cardID, &models.InventoryAddRequest{Quantity: quantity}); err != nil {
+			t.Fatalf("Failed to add card: %v", err)
+		}
+	}
+
+	page, err := service.ListInventory(userID, &models.InventoryQuery{Colors: "r"})
+	if err != nil {
+		t.Fatalf("Failed to list inventory: %v", err)
+	}
+	if page.TotalEntries != 2 || page.TotalCards != 3 {
+		t.Errorf("Expected 2 red entries totalling 3 cards, got %+v", page)
+	}
+
+	page, err = service.ListInventory(userID, &models.InventoryQuery{Name: "bolt", Rarity: "uncommon"})
+	if err != nil || page.Count != 1 || page.Items[0].CardID != "bolt-2xm" {
+		t.Errorf("Expected only the uncommon Lightning Bolt, got %+v (%v)", page, err)
+	}
+
+	// Walk every page one entry at a time, most copies first
+	var quantities []int
+	q := &models.InventoryQuery{Sort: "quantity", Descending: true, Limit: 1}
+	for {
+		page, err := service.ListInventory(userID, q)
+		if err != nil {
+			t.Fatalf("Failed to list inventory: %v", err)
+		}
+		if page.TotalEntries != 3 {
+			t.Errorf("Expected totals over all entries on every page, got %d", page.TotalEntries)
+		}
+		for _, item := range page.Items {
+			quantities = append(quantities, item.Quantity)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if len(quantities) != 3 || quantities[0] != 4 || quantities[1] != 2 || quantities[2] != 1 {
+		t.Errorf("Expected quantities 4, 2, 1 across pages, got %v", quantities)
+	}
+
+	// Entries added within the same second page by ID
+	seen := make(map[int]bool)
+	q = &models.InventoryQuery{Descending: true, Limit: 2}
+	for {
+		page, err := service.ListInventory(userID, q)
+		if err != nil {
+			t.Fatalf("Failed to list inventory: %v", err)
+		}
+		for _, item := range page.Items {
+			if seen[item.ID] {
+				t.Errorf("Entry %d listed twice", item.ID)
+			}
+			seen[item.ID] = true
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if len(seen) != 3 {
+		t.Errorf("Expected 3 entries newest first, got %d", len(seen))
+	}
+
+	if _, err := service.ListInventory(userID, &models.InventoryQuery{Sort: "colour"}); !errors.Is(err, database.ErrInvalidQuery) {
+		t.Errorf("Expected invalid query error, got %v", err)
+	}
+}
+
+func TestInventoryStats(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	arbor := &models.Card{ID: "arbor", ScryfallID: "arbor", Name: "Dryad Arbor", SetCode: "FUT", CollectorNumber: "174",
+		TypeLine: "Land Creature — Forest Dryad", Rarity: "uncommon", Colors: "G", ColorIdentity: "G", CreatedAt: time.Now()}
+	if err := db.CreateCard(arbor); err != nil {
+		t.Fatalf("Failed to create card: %v", err)
+	}
+
+	stats, err := service.GetInventoryStats(userID)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.TotalCards != 0 || stats.LastUpdated != nil {
+		t.Errorf("Expected empty stats, got %+v", stats)
+	}
+
+	for cardID, quantity := range map[string]int{"bolt-m10": 2, "bolt-2xm": 1, "arbor": 4} {
+		if _, err := service.AddCard(userID, cardID, &models.InventoryAddRequest{Quantity: quantity}); err != nil {
+			t.Fatalf("Failed to add card: %v", err)
+		}
+	}
+
+	stats, err = service.GetInventoryStats(userID)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.TotalCards != 7 || stats.UniqueCards != 3 || stats.UniqueNames != 2 {
+		t.Errorf("Expected 7 cards, 3 printings and 2 names, got %+v", stats)
+	}
+	if stats.LastUpdated == nil || time.Since(*stats.LastUpdated) > time.Minute {
+		t.Errorf("Expected a recent last update, got %v", stats.LastUpdated)
+	}
+
+	buckets := func(b []models.StatBucket) map[string]int {
+		m := make(map[string]int)
+		for _, bucket := range b {
+			m[bucket.Key] = bucket.Cards
+		}
+		return m
+	}
+	if types := buckets(stats.ByType); types["Land"] != 4 || types["Creature"] != 4 || types["Instant"] != 3 {
+		t.Errorf("Expected cards counted toward each of their types, got %+v", stats.ByType)
+	}
+	if identities := buckets(stats.ByColorIdentity); identities["G"] != 4 || identities["C"] != 3 {
+		t.Errorf("Expected color identities G and colorless, got %+v", stats.ByColorIdentity)
+	}
+	if manaValues := buckets(stats.ByManaValue); len(manaValues) != 1 || manaValues["0"] != 3 {
+		t.Errorf("Expected only the nonland cards in the mana values, got %+v", stats.ByManaValue)
+	}
+	if sets := buckets(stats.BySet); sets["FUT"] != 4 || sets["M10"] != 2 || sets["2XM"] != 1 {
+		t.Errorf("Expected set breakdown, got %+v", stats.BySet)
+	}
+}
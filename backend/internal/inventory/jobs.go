@@ -0,0 +1,245 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// ErrJobNotFound is returned when a scan job does not exist or belongs to another user
+var ErrJobNotFound = errors.New("scan job not found")
+
+// jobResolveBatch is how many of a job's scans are resolved together before
+// being recorded, so results keep streaming in while large jobs run
+const jobResolveBatch = 100
+
+// jobBroker wakes the job runner when a job is queued and tells watchers of a
+// job when it makes progress
+type jobBroker struct {
+	queued chan struct{}
+
+	mu       sync.Mutex
+	watchers map[int64]map[chan struct{}]bool
+}
+
+func newJobBroker() *jobBroker {
+	return &jobBroker{
+		queued:   make(chan struct{}, 1),
+		watchers: make(map[int64]map[chan struct{}]bool),
+	}
+}
+
+// wake tells the runner there is a job to claim without blocking
+func (b *jobBroker) wake() {
+	select {
+	case b.queued <- struct{}{}:
+	default:
+	}
+}
+
+// watch returns a channel signalled whenever the job changes, and a function
+// to stop watching. Signals coalesce, so watchers read the job's state
+// rather than count them.
+func (b *jobBroker) watch(jobID int64) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	b.mu.Lock()
+	if b.watchers[jobID] == nil {
+		b.watchers[jobID] = make(map[chan struct{}]bool)
+	}
+	b.watchers[jobID][ch] = true
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.watchers[jobID], ch)
+		if len(b.watchers[jobID]) == 0 {
+			delete(b.watchers, jobID)
+		}
+	}
+}
+
+// notify signals everyone watching a job
+func (b *jobBroker) notify(jobID int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.watchers[jobID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// SubmitBulkScan queues a bulk scan to be processed in the background by
+// RunJobs. The job records its scans in the open session the request names,
+// or else in a new bulk session completed with the job. Repeating the
+// request's Idempotency-Key returns the job first submitted with it.
+func (s *Service) SubmitBulkScan(userID string, req *models.BulkScanRequest) (*models.ScanJob, error) {
+	if _, err := NormalizeAttributes(req.Defaults); err != nil {
+		return nil, err
+	}
+	if req.IdempotencyKey == "" {
+		job, err := s.submitBulkScan(userID, req)
+		if err != nil {
+			return nil, err
+		}
+		s.jobs.wake()
+		return job, nil
+	}
+
+	var job *models.ScanJob
+	err := s.once(userID, "job:"+req.IdempotencyKey, req, &job, func(tx *Service) error {
+		var err error
+		job, err = tx.submitBulkScan(userID, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Wake the runner once the job is committed for it to claim
+	s.jobs.wake()
+	return s.GetJob(userID, job.ID, 0)
+}
+
+// submitBulkScan queues a bulk scan job
+func (s *Service) submitBulkScan(userID string, req *models.BulkScanRequest) (*models.ScanJob, error) {
+	sessionID, err := s.startScans(userID, req.SessionID, models.ScanTypeBulk)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.ScanJob{
+		UserID:    userID,
+		SessionID: sessionID,
+		Status:    models.ScanJobQueued,
+		Total:     len(req.Scans),
+		Request:   req,
+		CreatedAt: time.Now(),
+	}
+	if err := s.db.CreateScanJob(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetJob retrieves one of the user's scan jobs with its results from
+// position from on
+func (s *Service) GetJob(userID string, jobID int64, from int) (*models.ScanJob, error) {
+	job, err := s.db.GetScanJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil || job.UserID != userID {
+		return nil, ErrJobNotFound
+	}
+	if job.Results, err = s.db.GetScanJobResults(jobID, from); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// WatchJob returns a channel signalled whenever one of the user's scan jobs
+// records a result or finishes, and a function to stop watching
+func (s *Service) WatchJob(userID string, jobID int64) (<-chan struct{}, func(), error) {
+	job, err := s.db.GetScanJob(jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job == nil || job.UserID != userID {
+		return nil, nil, ErrJobNotFound
+	}
+	changed, stop := s.jobs.watch(jobID)
+	return changed, stop, nil
+}
+
+// RunJobs processes queued scan jobs one at a time until ctx is cancelled or
+// the queue can't be read. Jobs a previous run left unfinished are resumed
+// from their first unprocessed scan once put back in the queue with
+// database.DB.RequeueScanJobs, which the server does before starting it.
+func (s *Service) RunJobs(ctx context.Context) error {
+	for {
+		job, err := s.db.ClaimScanJob()
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			select {
+			case <-s.jobs.queued:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		err = s.processJob(ctx, job)
+		if ctx.Err() != nil {
+			// Stopped mid-job; the job stays running and is resumed next run
+			return ctx.Err()
+		}
+
+		status, message := models.ScanJobCompleted, ""
+		if err != nil {
+			status, message = models.ScanJobFailed, err.Error()
+		}
+		if err := s.db.FinishScanJob(job.ID, status, message); err != nil {
+			return err
+		}
+		// A job without its request can't tell whether it opened its session
+		if job.Request != nil && job.Request.SessionID == 0 {
+			s.db.CompleteScanSession(job.SessionID)
+		}
+		s.jobs.notify(job.ID)
+	}
+}
+
+// processJob scans a job's unprocessed scans in order. The scans are resolved
+// together, jobResolveBatch at a time, then each is recorded in one
+// transaction with its result and session counts, so a job resumed after a
+// crash never makes a scan twice.
+func (s *Service) processJob(ctx context.Context, job *models.ScanJob) error {
+	if job.Request == nil {
+		return fmt.Errorf("scan job %d has no request", job.ID)
+	}
+
+	locationID, err := s.db.GetCurrentLocation(job.UserID)
+	if err != nil {
+		return err
+	}
+
+	req := job.Request
+	for start := job.Processed; start < len(req.Scans); start += jobResolveBatch {
+		end := min(start+jobResolveBatch, len(req.Scans))
+		resolves := s.resolveScans(ctx, req.Scans[start:end], req.Defaults)
+
+		for i := start; i < end; i++ {
+			// Scans resolved as ctx was cancelled are left for the next run
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			scanReq := &req.Scans[i]
+			resolve := resolves[i-start]
+			err := s.inTx(func(tx *Service) error {
+				result, scanned := tx.scanOnce(job.UserID, job.SessionID, locationID, scanReq, resolve)
+				if err := tx.db.AddScanJobResult(job.ID, i, &result); err != nil {
+					return err
+				}
+				if !scanned {
+					return nil
+				}
+				successful, failed := scanCounts(&result)
+				return tx.db.AddScanSessionCounts(job.SessionID, 1, successful, failed)
+			})
+			if err != nil {
+				return err
+			}
+			s.jobs.notify(job.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+	"github.com/abzi/mtg_card_detector/internal/scanner"
+)
+
+func TestScanJobs(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	// A job interrupted after its first scan resumes from the second
+	interrupted, err := service.SubmitBulkScan(userID, &models.BulkScanRequest{
+		Scans:    []models.ScanRequest{{CardName: "Counterspell"}, {SetCode: "M10", CollectorNumber: "146"}},
+		Defaults: models.CopyAttributes{Condition: "LP"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to submit job: %v", err)
+	}
+	if interrupted.Status != models.ScanJobQueued || interrupted.SessionID == 0 {
+		t.Errorf("Unexpected queued job %+v", interrupted)
+	}
+	if _, err := db.ClaimScanJob(); err != nil {
+		t.Fatalf("Failed to claim job: %v", err)
+	}
+	if err := db.AddScanJobResult(interrupted.ID, 0, &models.ScanResponse{Success: true, Status: models.ScanStatusCommitted}); err != nil {
+		t.Fatalf("Failed to add job result: %v", err)
+	}
+
+	session, err := service.StartSession(userID)
+	if err != nil {
+		t.Fatalf("Failed to start session: %v", err)
+	}
+	job, err := service.SubmitBulkScan(userID, &models.BulkScanRequest{
+		SessionID: session.ID,
+		Scans:     []models.ScanRequest{{CardName: "Counterspell"}, {CardName: "Lightning Bolt"}, {CardName: "Black Lotus"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to submit job: %v", err)
+	}
+	changed, stop, err := service.WatchJob(userID, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to watch job: %v", err)
+	}
+	defer stop()
+
+	if requeued, err := db.RequeueScanJobs(); err != nil || requeued != 1 {
+		t.Fatalf("Expected the interrupted job to be requeued, got %d: %v", requeued, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() { stopped <- service.RunJobs(ctx) }()
+
+	timeout := time.After(5 * time.Second)
+	for job.CompletedAt == nil {
+		select {
+		case <-changed:
+		case <-timeout:
+			t.Fatalf("Timed out waiting for job, got %+v", job)
+		}
+		if job, err = service.GetJob(userID, job.ID, 0); err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+	}
+	cancel()
+	if err := <-stopped; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the runner to stop when cancelled, got %v", err)
+	}
+
+	if job.Status != models.ScanJobCompleted || job.Processed != 3 || len(job.Results) != 3 ||
+		job.SuccessfulScans != 1 || job.PendingScans != 1 || job.FailedScans != 1 {
+		t.Errorf("Unexpected job %+v", job)
+	}
+	for i, result := range job.Results {
+		if result.Position != i {
+			t.Errorf("Expected result %d at position %d", result.Position, i)
+		}
+	}
+	if job.Results[0].Card == nil || job.Results[0].Card.ID != "counterspell" || job.Results[1].Status != models.ScanStatusPending {
+		t.Errorf("Unexpected results %+v", job.Results)
+	}
+	if got, _ := service.GetSession(userID, session.ID); got.CardsScanned != 3 || got.SuccessfulScans != 1 || got.CompletedAt != nil {
+		t.Errorf("Expected the open session to count the job's scans, got %+v", got)
+	}
+
+	resumed, err := service.GetJob(userID, interrupted.ID, 1)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if resumed.Status != models.ScanJobCompleted || resumed.Processed != 2 || len(resumed.Results) != 1 || resumed.Results[0].Card.ID != "bolt-m10" {
+		t.Errorf("Unexpected resumed job %+v", resumed)
+	}
+	if got, _ := service.GetSession(userID, resumed.SessionID); got.CardsScanned != 1 || got.CompletedAt == nil {
+		t.Errorf("Expected the job's own session to be completed, got %+v", got)
+	}
+	items, err := db.GetUserInventory(userID)
+	if err != nil {
+		t.Fatalf("Failed to get inventory: %v", err)
+	}
+	for _, item := range items {
+		if item.CardID == "bolt-m10" && item.Condition != "LP" {
+			t.Errorf("Expected defaults to apply to resumed scans, got %+v", item.CopyAttributes)
+		}
+		if item.CardID == "counterspell" && item.Quantity != 1 {
+			t.Errorf("Expected the interrupted job's first scan not to be repeated, got %d", item.Quantity)
+		}
+	}
+
+	if _, err := service.GetJob("someone-else", job.ID, 0); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected job not found error, got %v", err)
+	}
+	if _, err := service.SubmitBulkScan(userID, &models.BulkScanRequest{
+		SessionID: session.ID + 100,
+		Scans:     []models.ScanRequest{{CardName: "Counterspell"}},
+	}); !errors.Is(err, ErrScanSessionNotFound) {
+		t.Errorf("Expected scan session not found error, got %v", err)
+	}
+}
+
+func TestScanJobWithoutRequest(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	// A job that lost its request fails without stopping the runner, and
+	// leaves its session alone
+	session, err := service.StartSession(userID)
+	if err != nil {
+		t.Fatalf("Failed to start session: %v", err)
+	}
+	result, err := db.Exec(`INSERT INTO scan_jobs (user_id, session_id, status, total, created_at) VALUES (?, ?, ?, 1, ?)`,
+		userID, session.ID, models.ScanJobQueued, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	brokenID, _ := result.LastInsertId()
+
+	job, err := service.SubmitBulkScan(userID, &models.BulkScanRequest{Scans: []models.ScanRequest{{CardName: "Counterspell"}}})
+	if err != nil {
+		t.Fatalf("Failed to submit bulk scan: %v", err)
+	}
+	changed, stop, err := service.WatchJob(userID, job.ID)
+	if err != nil {
+		t.Fatalf("Failed to watch job: %v", err)
+	}
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() { stopped <- service.RunJobs(ctx) }()
+
+	timeout := time.After(5 * time.Second)
+	for job.CompletedAt == nil {
+		select {
+		case <-changed:
+		case <-timeout:
+			t.Fatalf("Timed out waiting for job, got %+v", job)
+		}
+		if job, err = service.GetJob(userID, job.ID, 0); err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+	}
+	cancel()
+	if err := <-stopped; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the runner to keep going until cancelled, got %v", err)
+	}
+
+	broken, err := service.GetJob(userID, brokenID, 0)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if broken.Status != models.ScanJobFailed || broken.Error == "" {
+		t.Errorf("Expected the job without a request to fail, got %+v", broken)
+	}
+	if job.Status != models.ScanJobCompleted || job.SuccessfulScans != 1 {
+		t.Errorf("Expected the next job to complete, got %+v", job)
+	}
+	if got, _ := service.GetSession(userID, session.ID); got.CompletedAt != nil {
+		t.Errorf("Expected the session to stay open, got %+v", got)
+	}
+}
+
+func TestScanJobResultAtomic(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	// A scan whose result can't be recorded is undone, so resuming the job
+	// doesn't add the card twice
+	submitted, err := service.SubmitBulkScan(userID, &models.BulkScanRequest{Scans: []models.ScanRequest{{CardName: "Counterspell"}}})
+	if err != nil {
+		t.Fatalf("Failed to submit bulk scan: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO scan_job_results (job_id, position, status, success, result) VALUES (?, 0, 'committed', 1, '{}')`, submitted.ID); err != nil {
+		t.Fatalf("Failed to add result: %v", err)
+	}
+	job, err := db.ClaimScanJob()
+	if err != nil || job == nil {
+		t.Fatalf("Failed to claim job: %v", err)
+	}
+
+	if err := service.processJob(context.Background(), job); err == nil {
+		t.Fatal("Expected the scan to fail to record")
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 0 {
+		t.Errorf("Expected the scan to be rolled back, got %d copies", count)
+	}
+	if got, _ := service.GetSession(userID, job.SessionID); got.CardsScanned != 0 {
+		t.Errorf("Expected the session counts to be rolled back, got %+v", got)
+	}
+}
+
+// slowResolver resolves every scan to one card after a delay, like a lookup
+// on a remote API
+type slowResolver struct {
+	card    *models.Card
+	latency time.Duration
+}
+
+func (r *slowResolver) Name() string { return "slow" }
+
+func (r *slowResolver) Resolve(ctx context.Context, req *models.ScanRequest) ([]scanner.Candidate, error) {
+	time.Sleep(r.latency)
+	return []scanner.Candidate{{Card: r.card, Confidence: 1, Source: r.Name()}}, nil
+}
+
+// BenchmarkScanJob processes jobs of 100 scans against a resolver answering
+// in 5ms, one scan at a time against the default resolve workers
+func BenchmarkScanJob(b *testing.B) {
+	service, db, userID := setupTestService(b)
+	defer db.Close()
+
+	card, err := db.GetCardByID("counterspell")
+	if err != nil {
+		b.Fatalf("Failed to get card: %v", err)
+	}
+	service.scanner.RegisterResolver(&slowResolver{card: card, latency: 5 * time.Millisecond})
+	if err := service.scanner.UseResolvers([]string{"slow"}); err != nil {
+		b.Fatalf("Failed to configure resolvers: %v", err)
+	}
+
+	scans := make([]models.ScanRequest, 100)
+	for i := range scans {
+		scans[i] = models.ScanRequest{CardName: "Counterspell"}
+	}
+	run := func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := service.SubmitBulkScan(userID, &models.BulkScanRequest{Scans: append([]models.ScanRequest(nil), scans...)}); err != nil {
+				b.Fatalf("Failed to submit job: %v", err)
+			}
+			job, err := db.ClaimScanJob()
+			if err != nil {
+				b.Fatalf("Failed to claim job: %v", err)
+			}
+			if err := service.processJob(context.Background(), job); err != nil {
+				b.Fatalf("Failed to process job: %v", err)
+			}
+		}
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		service.scanner.SetResolveWorkers(1)
+		run(b)
+	})
+	b.Run("parallel", func(b *testing.B) {
+		service.scanner.SetResolveWorkers(scanner.DefaultResolveWorkers)
+		run(b)
+	})
+}
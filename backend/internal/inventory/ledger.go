@@ -0,0 +1,90 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+var (
+	// ErrLedgerEntryNotFound is returned when a ledger entry does not exist or belongs to another user
+	ErrLedgerEntryNotFound = errors.New("ledger entry not found")
+	// ErrCannotUndo is returned for an undo request that has nothing to reverse
+	ErrCannotUndo = errors.New("cannot undo")
+)
+
+// ledgerSources are the sources the ledger can be filtered by
+var ledgerSources = map[string]bool{
+	models.LedgerScan:    true,
+	models.LedgerImport:  true,
+	models.LedgerManual:  true,
+	models.LedgerTrade:   true,
+	models.LedgerUndo:    true,
+	models.LedgerInitial: true,
+}
+
+// GetLedger retrieves a filtered page of the user's inventory changes, newest first
+func (s *Service) GetLedger(userID string, q *models.LedgerQuery) (*models.LedgerPage, error) {
+	if q.Source != "" && !ledgerSources[q.Source] {
+		return nil, fmt.Errorf("%w: unknown source %q", database.ErrInvalidQuery, q.Source)
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	q.Limit = min(q.Limit, MaxPageSize)
+	return s.db.QueryLedger(userID, q)
+}
+
+// Undo reverses a single ledger entry, or every change a scan session made
+// that hasn't been undone yet, all at once. Trades and undos themselves can't
+// be undone, and copies added then moved on can't be taken back.
+func (s *Service) Undo(userID string, req *models.UndoRequest) (*models.UndoResponse, error) {
+	if (req.EntryID == 0) == (req.SessionID == 0) {
+		return nil, fmt.Errorf("%w: exactly one of entry_id and session_id is required", ErrCannotUndo)
+	}
+
+	var entries []models.LedgerEntry
+	if req.EntryID != 0 {
+		entry, err := s.db.GetLedgerEntry(req.EntryID)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil || entry.UserID != userID {
+			return nil, ErrLedgerEntryNotFound
+		}
+		switch {
+		case entry.Source == models.LedgerTrade:
+			return nil, fmt.Errorf("%w: trades move cards between users and can't be undone by one side", ErrCannotUndo)
+		case entry.Source == models.LedgerUndo:
+			return nil, fmt.Errorf("%w: entry is itself an undo", ErrCannotUndo)
+		case entry.RevertedBy != 0:
+			return nil, fmt.Errorf("%w: entry was already undone by entry %d", ErrCannotUndo, entry.RevertedBy)
+		}
+		entries = []models.LedgerEntry{*entry}
+	} else {
+		if _, err := s.getSession(userID, req.SessionID); err != nil {
+			return nil, err
+		}
+		var err error
+		if entries, err = s.db.GetSessionLedger(req.SessionID); err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("%w: session has no changes left to undo", ErrCannotUndo)
+		}
+	}
+
+	undone, err := s.db.RevertLedgerEntries(entries)
+	if err != nil {
+		return nil, err
+	}
+	return &models.UndoResponse{Entries: undone, Count: len(undone)}, nil
+}
+
+// CheckLedger rebuilds the user's quantities from the ledger and reports
+// copies whose inventory quantity differs
+func (s *Service) CheckLedger(userID string) (*models.LedgerCheck, error) {
+	return s.db.CheckLedger(userID)
+}
@@ -0,0 +1,129 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+func TestLedgerUndo(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	if _, err := service.AddCard(userID, "counterspell", &models.InventoryAddRequest{Quantity: 2}); err != nil {
+		t.Fatalf("Failed to add card: %v", err)
+	}
+	wanted, err := service.AddToWishlist(userID, &models.WishlistRequest{Name: "Lightning Bolt", Quantity: 1})
+	if err != nil {
+		t.Fatalf("Failed to add to wishlist: %v", err)
+	}
+	bulk, err := service.ProcessBulkScan(userID, &models.BulkScanRequest{
+		Scans: []models.ScanRequest{{CardName: "Counterspell"}, {SetCode: "M10", CollectorNumber: "146"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to bulk scan: %v", err)
+	}
+	if _, err := service.RemoveCard(userID, "counterspell", models.CopyAttributes{}, 1); err != nil {
+		t.Fatalf("Failed to remove card: %v", err)
+	}
+
+	page, err := service.GetLedger(userID, &models.LedgerQuery{})
+	if err != nil {
+		t.Fatalf("Failed to get ledger: %v", err)
+	}
+	if page.Count != 4 || page.Entries[0].Delta != -1 || page.Entries[0].Source != models.LedgerManual {
+		t.Fatalf("Unexpected ledger %+v", page.Entries)
+	}
+	page, err = service.GetLedger(userID, &models.LedgerQuery{SessionID: bulk.SessionID, Limit: 1})
+	if err != nil {
+		t.Fatalf("Failed to get ledger: %v", err)
+	}
+	if page.Count != 1 || page.NextCursor == "" || page.Entries[0].CardID != "bolt-m10" {
+		t.Errorf("Unexpected session ledger page %+v", page)
+	}
+	if _, err := service.GetLedger(userID, &models.LedgerQuery{Source: "magic"}); !errors.Is(err, database.ErrInvalidQuery) {
+		t.Errorf("Expected invalid query error, got %v", err)
+	}
+
+	// Undoing the session takes back both scanned cards at once
+	undone, err := service.Undo(userID, &models.UndoRequest{SessionID: bulk.SessionID})
+	if err != nil {
+		t.Fatalf("Failed to undo session: %v", err)
+	}
+	if undone.Count != 2 || undone.Entries[0].Delta != -1 || undone.Entries[0].Source != models.LedgerUndo {
+		t.Errorf("Unexpected undo entries %+v", undone.Entries)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 1 {
+		t.Errorf("Expected 1 card left, got %d", count)
+	}
+
+	// The scans, their session and the wishlist no longer count the copies
+	scans, err := service.GetSessionScans(userID, bulk.SessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session scans: %v", err)
+	}
+	if len(scans) != 2 || scans[0].Status != models.ScanStatusUndone || scans[1].Status != models.ScanStatusUndone {
+		t.Errorf("Expected both scans undone, got %+v", scans)
+	}
+	session, err := service.GetSession(userID, bulk.SessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if session.SuccessfulScans != 0 {
+		t.Errorf("Expected no successful scans left, got %d", session.SuccessfulScans)
+	}
+	if item, _ := db.GetWishlistItem(wanted.ID); item == nil || item.Acquired != 0 {
+		t.Errorf("Expected the wishlist tick-off given back, got %+v", item)
+	}
+	if _, err := service.Undo(userID, &models.UndoRequest{SessionID: bulk.SessionID}); !errors.Is(err, ErrCannotUndo) {
+		t.Errorf("Expected nothing left to undo, got %v", err)
+	}
+	if _, err := service.Undo(userID, &models.UndoRequest{EntryID: undone.Entries[0].ID}); !errors.Is(err, ErrCannotUndo) {
+		t.Errorf("Expected an undo not to be undoable, got %v", err)
+	}
+	if _, err := service.Undo("someone-else", &models.UndoRequest{SessionID: bulk.SessionID}); !errors.Is(err, ErrScanSessionNotFound) {
+		t.Errorf("Expected scan session not found error, got %v", err)
+	}
+
+	// The first copies added can't be taken back once only one is left
+	page, err = service.GetLedger(userID, &models.LedgerQuery{Source: models.LedgerManual})
+	if err != nil {
+		t.Fatalf("Failed to get ledger: %v", err)
+	}
+	added := page.Entries[len(page.Entries)-1]
+	if _, err := service.Undo(userID, &models.UndoRequest{EntryID: added.ID}); !errors.Is(err, database.ErrNotEnoughCopies) {
+		t.Errorf("Expected not enough copies error, got %v", err)
+	}
+	if _, err := service.Undo(userID, &models.UndoRequest{EntryID: page.Entries[0].ID}); err != nil {
+		t.Errorf("Failed to undo removal: %v", err)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 2 {
+		t.Errorf("Expected the removed copy back, got %d cards", count)
+	}
+
+	check, err := service.CheckLedger(userID)
+	if err != nil {
+		t.Fatalf("Failed to check ledger: %v", err)
+	}
+	if !check.Consistent || check.Entries != 7 {
+		t.Errorf("Expected consistent ledger of 7 entries, got %+v", check)
+	}
+
+	// Changes bypassing the ledger show up as discrepancies
+	if _, err := db.Exec(`UPDATE inventory SET quantity = 5 WHERE user_id = ?`, userID); err != nil {
+		t.Fatalf("Failed to update inventory: %v", err)
+	}
+	check, err = service.CheckLedger(userID)
+	if err != nil {
+		t.Fatalf("Failed to check ledger: %v", err)
+	}
+	if check.Consistent || len(check.Discrepancies) != 1 || check.Discrepancies[0].LedgerQuantity != 2 || check.Discrepancies[0].InventoryQuantity != 5 {
+		t.Errorf("Unexpected check %+v", check)
+	}
+
+	if _, err := db.Exec(`UPDATE inventory_ledger SET delta = 5`); err == nil {
+		t.Error("Expected the ledger to reject updates")
+	}
+}
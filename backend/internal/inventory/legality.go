@@ -0,0 +1,285 @@
+package inventory
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// formatRules are a format's deck construction rules
+type formatRules struct {
+	minDeck      int  // mainboard cards, plus commanders in commander formats
+	maxDeck      int  // 0 for no maximum
+	maxSideboard int  // -1 when the sideboard isn't checked
+	copies       int  // copies allowed per card name, except basic lands
+	commander    bool // led by commanders whose color identity the deck must match
+}
+
+var (
+	constructed = formatRules{minDeck: 60, maxSideboard: 15, copies: 4}
+	singleton   = formatRules{minDeck: 100, maxDeck: 100, maxSideboard: -1, copies: 1, commander: true}
+)
+
+// deckFormats are the formats decks can be validated against, named as in
+// Scryfall's legalities
+var deckFormats = map[string]formatRules{
+	"standard":        constructed,
+	"pioneer":         constructed,
+	"modern":          constructed,
+	"legacy":          constructed,
+	"vintage":         constructed,
+	"pauper":          constructed,
+	"penny":           constructed,
+	"historic":        constructed,
+	"explorer":        constructed,
+	"timeless":        constructed,
+	"alchemy":         constructed,
+	"commander":       singleton,
+	"duel":            singleton,
+	"paupercommander": singleton,
+	"brawl":           singleton,
+	"standardbrawl":   {minDeck: 60, maxDeck: 60, maxSideboard: -1, copies: 1, commander: true},
+}
+
+// copyLimitText matches rules text letting a deck exceed the copy limit,
+// e.g. "A deck can have up to seven cards named Seven Dwarves"
+var copyLimitText = regexp.MustCompile(`(?i)a deck can have (any number|up to (\w+)) cards named`)
+
+// numberWords are the spelled-out limits used by copyLimitText
+var numberWords = map[string]int{"two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10}
+
+// ValidateDeck checks one of the user's decks against a format's rules, by
+// default the format the deck was created for
+func (s *Service) ValidateDeck(userID string, deckID int64, format string) (*models.DeckValidation, error) {
+	deck, err := s.GetDeck(userID, deckID)
+	if err != nil {
+		return nil, err
+	}
+
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = deck.Format
+	}
+	if format == "" {
+		return nil, fmt.Errorf("%w: format is required", ErrInvalidDeck)
+	}
+	rules, ok := deckFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidDeck, format)
+	}
+
+	// Legality and rules text are the same for every printing of a card, so
+	// any printing stands in for lines that aren't pinned to one
+	cards := make(map[string]*models.Card)
+	var names []string
+	counts := make(map[string]int)
+	sections := make(map[string]int)
+	for _, dc := range deck.Cards {
+		sections[dc.Section] += dc.Quantity
+		if rules.commander && dc.Section == models.DeckSideboard {
+			continue
+		}
+		if _, ok := cards[dc.Name]; !ok {
+			names = append(names, dc.Name)
+			cards[dc.Name] = dc.Card
+		}
+		if cards[dc.Name] == nil || len(cards[dc.Name].Legalities) == 0 {
+			if card, err := s.anyPrinting(dc.Name); err != nil {
+				return nil, err
+			} else if card != nil {
+				cards[dc.Name] = card
+			}
+		}
+		counts[dc.Name] += dc.Quantity
+	}
+
+	v := &models.DeckValidation{DeckID: deck.ID, Format: format, Violations: []models.DeckViolation{}}
+	violate := func(rule, card, message string, args ...interface{}) {
+		v.Violations = append(v.Violations, models.DeckViolation{Rule: rule, Card: card, Message: fmt.Sprintf(message, args...)})
+	}
+
+	size := sections[models.DeckMainboard]
+	if rules.commander {
+		size += sections[models.DeckCommander]
+	}
+	if size < rules.minDeck {
+		violate(models.RuleDeckSize, "", "deck has %d cards, %s needs at least %d", size, format, rules.minDeck)
+	}
+	if rules.maxDeck > 0 && size > rules.maxDeck {
+		violate(models.RuleDeckSize, "", "deck has %d cards, %s allows at most %d", size, format, rules.maxDeck)
+	}
+	if rules.maxSideboard >= 0 && sections[models.DeckSideboard] > rules.maxSideboard {
+		violate(models.RuleSideboardSize, "", "sideboard has %d cards, %s allows at most %d", sections[models.DeckSideboard], format, rules.maxSideboard)
+	}
+
+	for _, name := range names {
+		card := cards[name]
+		legality := ""
+		if card != nil {
+			legality = card.Legalities[format]
+		}
+		switch legality {
+		case models.Banned:
+			violate(models.RuleBanned, name, "%s is banned in %s", name, format)
+		case models.NotLegal:
+			violate(models.RuleNotLegal, name, "%s is not legal in %s", name, format)
+		case "":
+			v.Warnings = append(v.Warnings, models.DeckViolation{Rule: models.RuleUnknown, Card: name,
+				Message: fmt.Sprintf("legality of %s in %s is unknown", name, format)})
+		}
+
+		limit := copyLimit(card, rules.copies)
+		if legality == models.Restricted {
+			limit = 1
+		}
+		if counts[name] > limit {
+			rule := models.RuleCopies
+			if legality == models.Restricted {
+				rule = models.RuleRestricted
+			}
+			violate(rule, name, "deck has %d copies of %s, %s allows %d", counts[name], name, format, limit)
+		}
+	}
+
+	if rules.commander {
+		s.validateCommanders(deck, format, cards, violate)
+	} else {
+		for _, dc := range deck.Cards {
+			if dc.Section == models.DeckCommander {
+				violate(models.RuleCommander, dc.Name, "%s decks don't have a commander", format)
+			}
+		}
+	}
+
+	v.Legal = len(v.Violations) == 0
+	return v, nil
+}
+
+// validateCommanders checks a commander deck's commanders and that every
+// card fits their color identity
+func (s *Service) validateCommanders(deck *models.Deck, format string, cards map[string]*models.Card, violate func(rule, card, message string, args ...interface{})) {
+	var commanders []*models.Card
+	identity := ""
+	for _, dc := range deck.Cards {
+		if dc.Section != models.DeckCommander {
+			continue
+		}
+		card := cards[dc.Name]
+		if card == nil {
+			continue
+		}
+		for i := 0; i < dc.Quantity; i++ {
+			commanders = append(commanders, card)
+		}
+		if !canBeCommander(card, format) {
+			violate(models.RuleCommander, dc.Name, "%s can't be a commander in %s", dc.Name, format)
+		}
+		identity += card.ColorIdentity
+	}
+
+	switch {
+	case len(commanders) == 0:
+		violate(models.RuleCommander, "", "%s decks need a commander", format)
+		return
+	case len(commanders) > 2:
+		violate(models.RuleCommander, "", "deck has %d commanders, at most 2 are allowed", len(commanders))
+	case len(commanders) == 2 && !canPartner(commanders[0], commanders[1]):
+		violate(models.RuleCommander, commanders[1].Name, "%s and %s can't be commanders together", commanders[0].Name, commanders[1].Name)
+	}
+
+	seen := make(map[string]bool)
+	for _, dc := range deck.Cards {
+		card := cards[dc.Name]
+		if dc.Section != models.DeckMainboard || card == nil || seen[dc.Name] {
+			continue
+		}
+		seen[dc.Name] = true
+		for _, color := range card.ColorIdentity {
+			if !strings.ContainsRune(identity, color) {
+				violate(models.RuleColorIdentity, dc.Name, "%s is outside the commander's color identity", dc.Name)
+				break
+			}
+		}
+	}
+}
+
+// anyPrinting returns a printing of the named card, preferring one with
+// legality data
+func (s *Service) anyPrinting(name string) (*models.Card, error) {
+	printings, err := s.db.GetCardsByName(name, "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range printings {
+		if len(printings[i].Legalities) > 0 {
+			return &printings[i], nil
+		}
+	}
+	if len(printings) > 0 {
+		return &printings[0], nil
+	}
+	return nil, nil
+}
+
+// copyLimit returns how many copies of a card a deck may hold, lifting the
+// format's limit for basic lands and cards whose rules text allows more
+func copyLimit(card *models.Card, limit int) int {
+	if card == nil {
+		return limit
+	}
+	if strings.Contains(card.TypeLine, "Basic") && strings.Contains(card.TypeLine, "Land") {
+		return math.MaxInt
+	}
+	m := copyLimitText.FindStringSubmatch(card.OracleText)
+	switch {
+	case m == nil:
+		return limit
+	case m[2] == "":
+		return math.MaxInt
+	default:
+		return max(limit, numberWords[strings.ToLower(m[2])])
+	}
+}
+
+// canBeCommander reports whether a card may lead a deck in a commander format
+func canBeCommander(card *models.Card, format string) bool {
+	if strings.Contains(card.OracleText, "can be your commander") {
+		return true
+	}
+	// Backgrounds lead alongside a commander that chooses one
+	if strings.Contains(card.TypeLine, "Background") {
+		return format != "paupercommander"
+	}
+	creature := strings.Contains(card.TypeLine, "Creature")
+	if format == "paupercommander" {
+		return creature
+	}
+	if !strings.Contains(card.TypeLine, "Legendary") {
+		return false
+	}
+	if format == "brawl" || format == "standardbrawl" {
+		return creature || strings.Contains(card.TypeLine, "Planeswalker")
+	}
+	return creature
+}
+
+// canPartner reports whether two cards may share the command zone
+func canPartner(a, b *models.Card) bool {
+	has := func(c *models.Card, text string) bool { return strings.Contains(c.OracleText, text) }
+	switch {
+	case has(a, "Partner") && has(b, "Partner"):
+		return true
+	case has(a, "Friends forever") && has(b, "Friends forever"):
+		return true
+	case has(a, "Choose a Background") && strings.Contains(b.TypeLine, "Background"),
+		has(b, "Choose a Background") && strings.Contains(a.TypeLine, "Background"):
+		return true
+	case has(a, "Doctor's companion") && strings.Contains(b.TypeLine, "Time Lord Doctor"),
+		has(b, "Doctor's companion") && strings.Contains(a.TypeLine, "Time Lord Doctor"):
+		return true
+	}
+	return false
+}
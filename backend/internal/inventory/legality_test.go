@@ -0,0 +1,98 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+func TestValidateDeck(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	allLegal := models.Legalities{"modern": models.Legal, "vintage": models.Legal, "commander": models.Legal}
+	cards := []models.Card{
+		{ID: "bolt-a25", ScryfallID: "bolt-a25", Name: "Lightning Bolt", SetCode: "A25", CollectorNumber: "141", TypeLine: "Instant",
+			ColorIdentity: "R", Legalities: allLegal},
+		{ID: "mountain", ScryfallID: "mountain", Name: "Mountain", SetCode: "M10", CollectorNumber: "242", TypeLine: "Basic Land — Mountain",
+			ColorIdentity: "R", Legalities: allLegal},
+		{ID: "krenko", ScryfallID: "krenko", Name: "Krenko, Mob Boss", SetCode: "M13", CollectorNumber: "139", TypeLine: "Legendary Creature — Goblin Warrior",
+			ColorIdentity: "R", Legalities: allLegal},
+		{ID: "lotus", ScryfallID: "lotus", Name: "Black Lotus", SetCode: "LEA", CollectorNumber: "232", TypeLine: "Artifact",
+			Legalities: models.Legalities{"modern": models.NotLegal, "vintage": models.Restricted, "commander": models.Banned}},
+		{ID: "brainstorm", ScryfallID: "brainstorm", Name: "Brainstorm", SetCode: "ICE", CollectorNumber: "61", TypeLine: "Instant",
+			ColorIdentity: "U", Legalities: allLegal},
+	}
+	for i := range cards {
+		cards[i].CreatedAt = time.Now()
+		if err := db.CreateCard(&cards[i]); err != nil {
+			t.Fatalf("Failed to create card: %v", err)
+		}
+	}
+
+	validate := func(format, decklist string) *models.DeckValidation {
+		t.Helper()
+		result, err := service.CreateDeck(userID, &models.DeckRequest{Name: format, Format: format, Decklist: decklist})
+		if err != nil {
+			t.Fatalf("Failed to create deck: %v", err)
+		}
+		if len(result.Errors) > 0 {
+			t.Fatalf("Unexpected decklist errors %+v", result.Errors)
+		}
+		v, err := service.ValidateDeck(userID, result.Deck.ID, "")
+		if err != nil {
+			t.Fatalf("Failed to validate deck: %v", err)
+		}
+		return v
+	}
+	rules := func(v *models.DeckValidation) map[string]string {
+		found := make(map[string]string)
+		for _, violation := range v.Violations {
+			found[violation.Rule] = violation.Card
+		}
+		return found
+	}
+
+	v := validate("modern", "4 Lightning Bolt\n56 Mountain\n\nSideboard\n15 Mountain")
+	if !v.Legal || len(v.Violations) != 0 || len(v.Warnings) != 0 {
+		t.Errorf("Expected legal modern deck, got %+v", v)
+	}
+
+	v = validate("modern", "4 Lightning Bolt\n5 Lightning Bolt (A25) 141\n50 Mountain\n1 Black Lotus\n\nSideboard\n16 Mountain")
+	found := rules(v)
+	if v.Legal || found[models.RuleCopies] != "Lightning Bolt" || found[models.RuleNotLegal] != "Black Lotus" || len(found) != 3 {
+		t.Errorf("Expected copies, not legal and sideboard violations, got %+v", v.Violations)
+	}
+	if _, ok := found[models.RuleSideboardSize]; !ok {
+		t.Errorf("Expected sideboard size violation, got %+v", v.Violations)
+	}
+
+	v = validate("vintage", "2 Black Lotus\n58 Mountain")
+	if found := rules(v); v.Legal || found[models.RuleRestricted] != "Black Lotus" {
+		t.Errorf("Expected restricted violation, got %+v", v.Violations)
+	}
+
+	v = validate("commander", "Commander\n1 Krenko, Mob Boss\n\nDeck\n2 Lightning Bolt\n1 Brainstorm\n1 Counterspell\n1 Black Lotus\n94 Mountain")
+	found = rules(v)
+	if v.Legal || found[models.RuleCopies] != "Lightning Bolt" || found[models.RuleColorIdentity] != "Brainstorm" ||
+		found[models.RuleBanned] != "Black Lotus" {
+		t.Errorf("Expected copies, color identity and banned violations, got %+v", v.Violations)
+	}
+	if _, ok := found[models.RuleDeckSize]; ok {
+		t.Errorf("Expected 99 cards plus commander to be 100, got %+v", v.Violations)
+	}
+	if len(v.Warnings) != 1 || v.Warnings[0].Card != "Counterspell" {
+		t.Errorf("Expected unknown legality warning for Counterspell, got %+v", v.Warnings)
+	}
+
+	v = validate("commander", "Commander\n1 Lightning Bolt\n\nDeck\n99 Mountain")
+	if found := rules(v); found[models.RuleCommander] != "Lightning Bolt" {
+		t.Errorf("Expected Lightning Bolt to be rejected as commander, got %+v", v.Violations)
+	}
+
+	if _, err := service.CreateDeck(userID, &models.DeckRequest{Name: "x", Format: "tiny", Decklist: "1 Mountain"}); !errors.Is(err, ErrInvalidDeck) {
+		t.Errorf("Expected invalid deck error for unknown format, got %v", err)
+	}
+}
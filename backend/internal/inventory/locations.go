@@ -0,0 +1,146 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+var (
+	// ErrLocationNotFound is returned when a location does not exist or belongs to another user
+	ErrLocationNotFound = errors.New("location not found")
+	// ErrInvalidLocation is returned for a location without a name or with an unknown kind
+	ErrInvalidLocation = errors.New("invalid location")
+	// ErrInvalidMove is returned for a move without copies or destination
+	ErrInvalidMove = errors.New("invalid move")
+)
+
+// locationKinds are the accepted location kinds
+var locationKinds = map[string]bool{
+	models.LocationBinder:  true,
+	models.LocationBox:     true,
+	models.LocationDeckBox: true,
+}
+
+// CreateLocation creates a binder, box or deck box, optionally inside another of the user's locations
+func (s *Service) CreateLocation(userID string, req *models.LocationRequest) (*models.Location, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidLocation)
+	}
+	kind := strings.ToLower(strings.TrimSpace(req.Kind))
+	if !locationKinds[kind] {
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidLocation, req.Kind)
+	}
+
+	if req.ParentID != nil {
+		if _, err := s.getLocation(userID, *req.ParentID); err != nil {
+			return nil, err
+		}
+	}
+
+	loc := &models.Location{
+		UserID:    userID,
+		ParentID:  req.ParentID,
+		Name:      name,
+		Kind:      kind,
+		CreatedAt: time.Now(),
+	}
+	if err := s.db.CreateLocation(loc); err != nil {
+		return nil, err
+	}
+	return loc, nil
+}
+
+// GetLocations retrieves a user's locations and the one their scans land in (0 for none)
+func (s *Service) GetLocations(userID string) ([]models.Location, int64, error) {
+	locations, err := s.db.GetUserLocations(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	current, err := s.db.GetCurrentLocation(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	return locations, current, nil
+}
+
+// GetLocationContents lists a location's nested locations and cards, including
+// the cards in nested locations if recursive is set
+func (s *Service) GetLocationContents(userID string, locationID int64, recursive bool) (*models.LocationContents, error) {
+	loc, err := s.getLocation(userID, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	children, err := s.db.GetChildLocations(locationID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.db.GetLocationContents(locationID, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LocationContents{
+		Location: loc,
+		Children: children,
+		Items:    items,
+	}, nil
+}
+
+// DeleteLocation deletes a location and its nested locations; their cards become unplaced
+func (s *Service) DeleteLocation(userID string, locationID int64) error {
+	if _, err := s.getLocation(userID, locationID); err != nil {
+		return err
+	}
+	return s.db.DeleteLocation(locationID)
+}
+
+// SetCurrentLocation sets the location the user's scans land in; nil clears it
+func (s *Service) SetCurrentLocation(userID string, locationID *int64) error {
+	if locationID != nil {
+		if _, err := s.getLocation(userID, *locationID); err != nil {
+			return err
+		}
+	}
+	return s.db.SetCurrentLocation(userID, locationID)
+}
+
+// MoveCards moves copies of an inventory entry between the user's locations
+func (s *Service) MoveCards(userID string, req *models.MoveRequest) error {
+	if req.Quantity <= 0 {
+		return fmt.Errorf("%w: quantity must be positive", ErrInvalidMove)
+	}
+	if req.FromLocationID == nil && req.ToLocationID == nil {
+		return fmt.Errorf("%w: from_location_id or to_location_id is required", ErrInvalidMove)
+	}
+	if req.Page < 0 || req.Slot < 0 {
+		return fmt.Errorf("%w: page and slot cannot be negative", ErrInvalidMove)
+	}
+
+	for _, id := range []*int64{req.FromLocationID, req.ToLocationID} {
+		if id != nil {
+			if _, err := s.getLocation(userID, *id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.db.MoveInventory(userID, req)
+}
+
+// getLocation retrieves one of the user's locations
+func (s *Service) getLocation(userID string, locationID int64) (*models.Location, error) {
+	loc, err := s.db.GetLocation(locationID)
+	if err != nil {
+		return nil, err
+	}
+	if loc == nil || loc.UserID != userID {
+		return nil, ErrLocationNotFound
+	}
+	return loc, nil
+}
@@ -0,0 +1,95 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+func TestLocations(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	box, err := service.CreateLocation(userID, &models.LocationRequest{Name: "Trade box", Kind: "box"})
+	if err != nil {
+		t.Fatalf("Failed to create box: %v", err)
+	}
+	binder, err := service.CreateLocation(userID, &models.LocationRequest{Name: "Blue binder", Kind: "binder", ParentID: &box.ID})
+	if err != nil {
+		t.Fatalf("Failed to create binder: %v", err)
+	}
+	if _, err := service.CreateLocation(userID, &models.LocationRequest{Name: "Shelf", Kind: "shelf"}); !errors.Is(err, ErrInvalidLocation) {
+		t.Errorf("Expected invalid location error, got %v", err)
+	}
+
+	// Scans land in the current location
+	if err := service.SetCurrentLocation(userID, &binder.ID); err != nil {
+		t.Fatalf("Failed to set current location: %v", err)
+	}
+	scans := []models.ScanRequest{{CardName: "Counterspell"}, {CardName: "Counterspell"}, {CardName: "Counterspell"}}
+	result, err := service.ProcessBulkScan(userID, &models.BulkScanRequest{Scans: scans})
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if result.Results[0].LocationID != binder.ID {
+		t.Errorf("Expected scan to land in the binder, got %+v", result.Results[0])
+	}
+
+	items, err := db.GetUserInventory(userID)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Expected one inventory entry, got %d (%v)", len(items), err)
+	}
+	item := items[0]
+
+	// Move two copies to the box, then more than are left in the binder
+	move := &models.MoveRequest{InventoryID: item.ID, FromLocationID: &binder.ID, ToLocationID: &box.ID, Quantity: 2, Page: 3, Slot: 5}
+	if err := service.MoveCards(userID, move); err != nil {
+		t.Fatalf("Failed to move cards: %v", err)
+	}
+	move.Quantity = 2
+	if err := service.MoveCards(userID, move); !errors.Is(err, database.ErrNotEnoughCopies) {
+		t.Errorf("Expected not enough copies error, got %v", err)
+	}
+
+	contents, err := service.GetLocationContents(userID, box.ID, false)
+	if err != nil {
+		t.Fatalf("Failed to get contents: %v", err)
+	}
+	if len(contents.Children) != 1 || len(contents.Items) != 1 || contents.Items[0].Quantity != 2 || contents.Items[0].Page != 3 {
+		t.Errorf("Expected box to hold the binder and 2 copies, got %+v", contents)
+	}
+	contents, err = service.GetLocationContents(userID, box.ID, true)
+	if err != nil {
+		t.Fatalf("Failed to get contents: %v", err)
+	}
+	if len(contents.Items) != 2 {
+		t.Errorf("Expected recursive listing to include the binder's copy, got %+v", contents.Items)
+	}
+
+	// Removing copies trims placements so none are placed twice
+	if _, err := db.RemoveFromInventory(userID, item.CardID, item.CopyAttributes, 2, manualChange); err != nil {
+		t.Fatalf("Failed to remove from inventory: %v", err)
+	}
+	items, _ = db.GetUserInventory(userID)
+	placed := 0
+	for _, p := range items[0].Locations {
+		placed += p.Quantity
+	}
+	if placed != 1 {
+		t.Errorf("Expected 1 placed copy after removal, got %+v", items[0].Locations)
+	}
+
+	// Deleting the box deletes the nested binder and unplaces its cards
+	if err := service.DeleteLocation(userID, box.ID); err != nil {
+		t.Fatalf("Failed to delete location: %v", err)
+	}
+	items, _ = db.GetUserInventory(userID)
+	if len(items) != 1 || len(items[0].Locations) != 0 {
+		t.Errorf("Expected unplaced copy to remain in inventory, got %+v", items)
+	}
+	if current, _ := db.GetCurrentLocation(userID); current != 0 {
+		t.Errorf("Expected current location to be cleared, got %d", current)
+	}
+}
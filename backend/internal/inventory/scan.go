@@ -0,0 +1,547 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+	"github.com/abzi/mtg_card_detector/internal/recognition"
+	"github.com/abzi/mtg_card_detector/internal/scanner"
+)
+
+const (
+	// AutoCommitConfidence is the confidence a scan's best candidate needs
+	// to be added to inventory without confirmation
+	AutoCommitConfidence = 0.9
+	// AmbiguityMargin is how close the runner-up candidate may score before
+	// the user has to pick the printing
+	AmbiguityMargin = 0.05
+)
+
+var (
+	// ErrScanNotFound is returned when a scan does not exist or belongs to another user
+	ErrScanNotFound = errors.New("scan not found")
+	// ErrScanNotPending is returned when confirming a scan that was already resolved
+	ErrScanNotPending = errors.New("scan is not awaiting confirmation")
+	// ErrNotCandidate is returned when confirming a printing the scan did not offer
+	ErrNotCandidate = errors.New("card is not a candidate for this scan")
+	// ErrBulkScanRolledBack is returned when a scan of an atomic bulk request
+	// fails, undoing the rest
+	ErrBulkScanRolledBack = errors.New("bulk scan rolled back")
+)
+
+// resolveFunc identifies a scan as candidate cards, best first
+type resolveFunc func() ([]models.CardCandidate, error)
+
+// ProcessSingleScan processes a single card scan and adds to inventory
+func (s *Service) ProcessSingleScan(userID string, req *models.ScanRequest) (*models.ScanResponse, error) {
+	if _, err := NormalizeAttributes(req.CopyAttributes); err != nil {
+		return nil, err
+	}
+	if req.ClientScanID == "" {
+		return s.processScan(userID, req, s.resolveRequest(req))
+	}
+
+	// A retried scan returns the first response instead of adding the card
+	// again, unless the first attempt failed
+	resolve := s.resolveAhead(req)
+	var result *models.ScanResponse
+	err := s.once(userID, scanKey(req.ClientScanID), scanIdentity(req), &result, func(tx *Service) error {
+		var err error
+		if result, err = tx.processScan(userID, req, resolve); err != nil {
+			return err
+		}
+		return scanFailure(result)
+	})
+	if err != nil && !errors.Is(err, errScanFailed) {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ProcessImageScan recognizes a card from a photo and adds the best match to
+// inventory as a copy with the given attributes, in the open scan session
+// with the given ID if it isn't 0
+func (s *Service) ProcessImageScan(userID string, img image.Image, artworkOnly bool, attrs models.CopyAttributes, sessionID int) (*models.RecognizeResponse, error) {
+	if _, err := NormalizeAttributes(attrs); err != nil {
+		return nil, err
+	}
+
+	var matches []models.CardMatch
+	req := &models.ScanRequest{CopyAttributes: attrs, SessionID: sessionID}
+	result, err := s.processScan(userID, req, func() ([]models.CardCandidate, error) {
+		var err error
+		matches, err = s.scanner.RecognizeImage(img, artworkOnly)
+		if err != nil {
+			return nil, err
+		}
+
+		candidates := make([]models.CardCandidate, len(matches))
+		for i, m := range matches {
+			candidates[i] = models.CardCandidate{
+				Card:       m.Card,
+				Confidence: 1 - float64(m.Distance)/recognition.HashBits,
+			}
+		}
+		return candidates, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.RecognizeResponse{ScanResponse: *result}
+	if len(matches) > 0 {
+		resp.Distance = matches[0].Distance
+		resp.Alternatives = matches[1:]
+	}
+	return resp, nil
+}
+
+// processScan runs a single scan in the open session the request names, or
+// else in its own session. The card is resolved first, then the scan, its
+// inventory change and the session counts are written in one transaction.
+func (s *Service) processScan(userID string, req *models.ScanRequest, resolve resolveFunc) (*models.ScanResponse, error) {
+	// Resolvers may fetch and cache cards, so they run outside the transaction
+	resolve = resolved(resolve())
+
+	var result models.ScanResponse
+	err := s.inTx(func(tx *Service) error {
+		sessionID, err := tx.startScans(userID, req.SessionID, models.ScanTypeSingle)
+		if err != nil {
+			return err
+		}
+
+		locationID, err := tx.db.GetCurrentLocation(userID)
+		if err != nil {
+			return err
+		}
+
+		result = tx.scanOne(userID, sessionID, locationID, req, resolve)
+		result.SessionID = sessionID
+
+		// Update session with the outcome
+		successful, failed := scanCounts(&result)
+		return tx.finishScans(sessionID, req.SessionID != 0, 1, successful, failed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ProcessBulkScan processes multiple card scans. Repeating the request's
+// Idempotency-Key returns the first response, and scans repeating a
+// client_scan_id return their first result without being counted again.
+func (s *Service) ProcessBulkScan(userID string, req *models.BulkScanRequest) (*models.BulkScanResponse, error) {
+	if _, err := NormalizeAttributes(req.Defaults); err != nil {
+		return nil, err
+	}
+	if req.IdempotencyKey == "" {
+		return s.processBulkScan(userID, req)
+	}
+
+	resolves := s.resolveScans(context.Background(), req.Scans, req.Defaults)
+	var result *models.BulkScanResponse
+	err := s.once(userID, "bulk:"+req.IdempotencyKey, req, &result, func(tx *Service) error {
+		var err error
+		result, err = tx.commitBulkScan(userID, req, resolves)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// processBulkScan processes multiple card scans in one session. The cards
+// are resolved first, together, then the scans, inventory changes and
+// session counts are written in one transaction in request order. Failed
+// scans are recorded as such, unless the request is atomic, in which case any
+// failure rolls back every scan.
+func (s *Service) processBulkScan(userID string, req *models.BulkScanRequest) (*models.BulkScanResponse, error) {
+	resolves := s.resolveScans(context.Background(), req.Scans, req.Defaults)
+
+	var result *models.BulkScanResponse
+	err := s.inTx(func(tx *Service) error {
+		var err error
+		result, err = tx.commitBulkScan(userID, req, resolves)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// resolveScans fills in the defaults of a bulk request's scans and resolves
+// them together. Resolvers may fetch and cache cards, so they run before the
+// transaction recording the scans.
+func (s *Service) resolveScans(ctx context.Context, scans []models.ScanRequest, defaults models.CopyAttributes) []resolveFunc {
+	resolves := make([]resolveFunc, len(scans))
+	var reqs []*models.ScanRequest
+	var positions []int
+	for i := range scans {
+		scanReq := &scans[i]
+		scanReq.CopyAttributes = withDefaults(scanReq.CopyAttributes, defaults)
+		if _, err := NormalizeAttributes(scanReq.CopyAttributes); err != nil {
+			// scanOne fails the scan without resolving it
+			resolves[i] = resolved(nil, err)
+			continue
+		}
+		reqs = append(reqs, scanReq)
+		positions = append(positions, i)
+	}
+
+	for j, resolution := range s.scanner.ResolveAll(ctx, reqs) {
+		if resolution.Err != nil {
+			resolves[positions[j]] = resolved(nil, resolution.Err)
+			continue
+		}
+		resolves[positions[j]] = resolved(cardCandidates(resolution.Candidates), nil)
+	}
+	return resolves
+}
+
+// commitBulkScan records a bulk request's resolved scans
+func (s *Service) commitBulkScan(userID string, req *models.BulkScanRequest, resolves []resolveFunc) (*models.BulkScanResponse, error) {
+	sessionID, err := s.startScans(userID, req.SessionID, models.ScanTypeBulk)
+	if err != nil {
+		return nil, err
+	}
+
+	locationID, err := s.db.GetCurrentLocation(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.ScanResponse, 0, len(req.Scans))
+	successful := 0
+	failed := 0
+	pending := 0
+
+	// Replayed scans were counted by the session they were first made in
+	var sessionScanned, sessionSuccessful, sessionFailed int
+
+	for i := range req.Scans {
+		result, scanned := s.scanOnce(userID, sessionID, locationID, &req.Scans[i], resolves[i])
+		ok, notOK := scanCounts(&result)
+		if notOK > 0 && req.Atomic {
+			return nil, fmt.Errorf("%w: scan %d failed: %s", ErrBulkScanRolledBack, i, result.Error)
+		}
+		if result.Status == models.ScanStatusPending {
+			pending++
+		}
+		successful += ok
+		failed += notOK
+		if scanned {
+			sessionScanned++
+			sessionSuccessful += ok
+			sessionFailed += notOK
+		}
+		results = append(results, result)
+	}
+
+	// Update scan session
+	if err := s.finishScans(sessionID, req.SessionID != 0, sessionScanned, sessionSuccessful, sessionFailed); err != nil {
+		return nil, err
+	}
+
+	return &models.BulkScanResponse{
+		SessionID:       sessionID,
+		TotalScanned:    len(req.Scans),
+		SuccessfulScans: successful,
+		FailedScans:     failed,
+		PendingScans:    pending,
+		Results:         results,
+	}, nil
+}
+
+// startScans returns the session scans are recorded in: the user's open
+// session with the given ID, or else a new session of scanType
+func (s *Service) startScans(userID string, sessionID int, scanType string) (int, error) {
+	if sessionID != 0 {
+		if _, err := s.getOpenSession(userID, sessionID); err != nil {
+			return 0, err
+		}
+		return sessionID, nil
+	}
+
+	session := &models.ScanSession{
+		UserID:    userID,
+		ScanType:  scanType,
+		StartedAt: time.Now(),
+	}
+	sessionID, err := s.db.CreateScanSession(session)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create scan session: %w", err)
+	}
+	return sessionID, nil
+}
+
+// finishScans counts scans against their session. Sessions started for the
+// scans are completed with them; explicit sessions stay open.
+func (s *Service) finishScans(sessionID int, explicit bool, scanned, successful, failed int) error {
+	if explicit {
+		return s.db.AddScanSessionCounts(sessionID, scanned, successful, failed)
+	}
+	return s.db.UpdateScanSession(sessionID, scanned, successful, failed)
+}
+
+// scanCounts returns how a scan's result counts towards its session's
+// successful and failed scans. Pending scans count as neither until confirmed.
+func scanCounts(result *models.ScanResponse) (successful, failed int) {
+	switch {
+	case result.Status == models.ScanStatusPending:
+		return 0, 0
+	case result.Success:
+		return 1, 0
+	default:
+		return 0, 1
+	}
+}
+
+// ConfirmScan commits a pending scan to inventory with the printing the user
+// picked. The scan, the copy and the session count are updated in one
+// transaction.
+func (s *Service) ConfirmScan(userID string, scanID int64, cardID string) (*models.ScanResponse, error) {
+	scan, err := s.db.GetScan(scanID)
+	if err != nil {
+		return nil, err
+	}
+	if scan == nil || scan.UserID != userID {
+		return nil, ErrScanNotFound
+	}
+	if scan.Status != models.ScanStatusPending {
+		return nil, ErrScanNotPending
+	}
+
+	offered := false
+	for _, c := range scan.Candidates {
+		if c.CardID == cardID {
+			offered = true
+			break
+		}
+	}
+	if !offered {
+		return nil, ErrNotCandidate
+	}
+
+	card, err := s.db.GetCardByID(cardID)
+	if err != nil {
+		return nil, err
+	}
+	if card == nil {
+		return nil, ErrNotCandidate
+	}
+
+	var attrs models.CopyAttributes
+	if scan.Request != nil {
+		attrs = scan.Request.CopyAttributes
+	}
+	if attrs, err = NormalizeAttributes(attrs); err != nil {
+		return nil, err
+	}
+
+	// Claim the scan first so concurrent confirmations only add the card once
+	var wishlist *models.WishlistItem
+	err = s.inTx(func(tx *Service) error {
+		claimed, err := tx.db.ResolvePendingScan(scanID, models.ScanStatusCommitted, cardID)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return ErrScanNotPending
+		}
+
+		if _, err := tx.db.AddToInventory(userID, card.ID, attrs, 1, scan.LocationID,
+			models.LedgerSource{Source: models.LedgerScan, SessionID: scan.SessionID, ScanID: scanID}); err != nil {
+			return fmt.Errorf("failed to add to inventory: %w", err)
+		}
+
+		if scan.SessionID != 0 {
+			if err := tx.db.IncrementScanSessionSuccess(scan.SessionID); err != nil {
+				return err
+			}
+		}
+
+		wishlist, err = tx.tickOffScan(userID, scanID, card, attrs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ScanResponse{
+		Success:    true,
+		ScanID:     scanID,
+		SessionID:  scan.SessionID,
+		Status:     models.ScanStatusCommitted,
+		Card:       card,
+		LocationID: scan.LocationID,
+		Wishlist:   wishlist,
+	}, nil
+}
+
+// resolveAhead resolves a scan before it is recorded, so resolvers that
+// fetch and cache cards run outside the transaction recording it
+func (s *Service) resolveAhead(req *models.ScanRequest) resolveFunc {
+	if _, err := NormalizeAttributes(req.CopyAttributes); err != nil {
+		// scanOne fails the scan without resolving it
+		return resolved(nil, err)
+	}
+	return resolved(s.resolveRequest(req)())
+}
+
+// resolved returns a resolveFunc for a scan resolved ahead of time
+func resolved(candidates []models.CardCandidate, err error) resolveFunc {
+	return func() ([]models.CardCandidate, error) {
+		return candidates, err
+	}
+}
+
+// resolveRequest resolves scan data through the scanner's resolver chain
+func (s *Service) resolveRequest(req *models.ScanRequest) resolveFunc {
+	return func() ([]models.CardCandidate, error) {
+		candidates, err := s.scanner.Resolve(context.Background(), req)
+		if err != nil {
+			return nil, err
+		}
+		return cardCandidates(candidates), nil
+	}
+}
+
+// cardCandidates converts the scanner's candidates for a scan response
+func cardCandidates(candidates []scanner.Candidate) []models.CardCandidate {
+	results := make([]models.CardCandidate, len(candidates))
+	for i, c := range candidates {
+		results[i] = models.CardCandidate{Card: c.Card, Confidence: c.Confidence}
+	}
+	return results
+}
+
+// scanOne resolves a scan, records it and commits unambiguous results to
+// inventory at the given location (0 for unplaced)
+func (s *Service) scanOne(userID string, sessionID int, locationID int64, req *models.ScanRequest, resolve resolveFunc) models.ScanResponse {
+	scan := &models.Scan{
+		UserID:     userID,
+		SessionID:  sessionID,
+		LocationID: locationID,
+		Request:    req,
+		CreatedAt:  time.Now(),
+	}
+
+	attrs, err := NormalizeAttributes(req.CopyAttributes)
+	if err != nil {
+		return s.recordFailure(scan, err.Error())
+	}
+
+	// Scan the card
+	candidates, err := resolve()
+	var sealed *scanner.SealedProductError
+	if errors.As(err, &sealed) {
+		// Sealed product is identified but not tracked in inventory
+		return models.ScanResponse{
+			Success: true,
+			Product: sealed.Product,
+		}
+	}
+	if err != nil {
+		return s.recordFailure(scan, err.Error())
+	}
+
+	if needsConfirmation(candidates) {
+		scan.Status = models.ScanStatusPending
+		for _, c := range candidates {
+			scan.Candidates = append(scan.Candidates, models.ScanCandidate{CardID: c.Card.ID, Confidence: c.Confidence})
+		}
+		scanID, err := s.db.CreateScan(scan)
+		if err != nil {
+			return models.ScanResponse{Success: false, Error: err.Error()}
+		}
+		return models.ScanResponse{
+			Success:    false,
+			ScanID:     scanID,
+			Status:     models.ScanStatusPending,
+			Candidates: candidates,
+			Error:      "multiple printings match, confirm which one was scanned",
+		}
+	}
+
+	card := candidates[0].Card
+
+	// Record the scan and add its copy to inventory together
+	var scanID int64
+	var wishlist *models.WishlistItem
+	err = s.inTx(func(tx *Service) error {
+		now := time.Now()
+		committed := *scan
+		committed.Status = models.ScanStatusCommitted
+		committed.CardID = card.ID
+		committed.ResolvedAt = &now
+		var err error
+		if scanID, err = tx.db.CreateScan(&committed); err != nil {
+			return fmt.Errorf("failed to record scan: %w", err)
+		}
+
+		if _, err := tx.db.AddToInventory(userID, card.ID, attrs, 1, locationID,
+			models.LedgerSource{Source: models.LedgerScan, SessionID: sessionID, ScanID: scanID}); err != nil {
+			return fmt.Errorf("failed to add to inventory: %w", err)
+		}
+
+		wishlist, err = tx.tickOffScan(userID, scanID, card, attrs)
+		return err
+	})
+	if err != nil {
+		return s.recordFailure(scan, err.Error())
+	}
+
+	return models.ScanResponse{
+		Success:    true,
+		ScanID:     scanID,
+		Status:     models.ScanStatusCommitted,
+		Card:       card,
+		LocationID: locationID,
+		Wishlist:   wishlist,
+	}
+}
+
+// tickOffScan counts a scan's copy towards the user's wishlist and records
+// the item it went to on the scan, so undoing the scan can give it back
+func (s *Service) tickOffScan(userID string, scanID int64, card *models.Card, attrs models.CopyAttributes) (*models.WishlistItem, error) {
+	item := s.tickOffWishlist(userID, card, attrs)
+	if item == nil {
+		return nil, nil
+	}
+	if err := s.db.SetScanWishlistItem(scanID, item.ID); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// recordFailure records a failed scan and returns its response
+func (s *Service) recordFailure(scan *models.Scan, message string) models.ScanResponse {
+	now := time.Now()
+	scan.Status = models.ScanStatusFailed
+	scan.Error = message
+	scan.ResolvedAt = &now
+	scanID, _ := s.db.CreateScan(scan)
+
+	return models.ScanResponse{
+		Success: false,
+		ScanID:  scanID,
+		Status:  models.ScanStatusFailed,
+		Error:   message,
+	}
+}
+
+// needsConfirmation reports whether the user has to pick among the candidates
+// rather than the best one being committed automatically
+func needsConfirmation(candidates []models.CardCandidate) bool {
+	if candidates[0].Confidence < AutoCommitConfidence {
+		return true
+	}
+	return len(candidates) > 1 && candidates[1].Confidence >= candidates[0].Confidence-AmbiguityMargin
+}
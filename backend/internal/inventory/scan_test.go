@@ -0,0 +1,310 @@
+package inventory
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/auth"
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/models"
+	"github.com/abzi/mtg_card_detector/internal/scanner"
+)
+
+func setupTestService(t testing.TB) (*Service, *database.DB, string) {
+	dbPath := "/tmp/test_inventory.db"
+	os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	cards := []models.Card{
+		{ID: "bolt-m10", ScryfallID: "bolt-m10", Name: "Lightning Bolt", SetCode: "M10", CollectorNumber: "146", TypeLine: "Instant", Rarity: "common", Colors: "R", CreatedAt: time.Now()},
+		{ID: "bolt-2xm", ScryfallID: "bolt-2xm", Name: "Lightning Bolt", SetCode: "2XM", CollectorNumber: "129", TypeLine: "Instant", Rarity: "uncommon", Colors: "R", CreatedAt: time.Now()},
+		{ID: "counterspell", ScryfallID: "counterspell", Name: "Counterspell", SetCode: "MH2", CollectorNumber: "267", TypeLine: "Instant", Rarity: "uncommon", Colors: "U", CreatedAt: time.Now()},
+	}
+	for i := range cards {
+		if err := db.CreateCard(&cards[i]); err != nil {
+			t.Fatalf("Failed to create card: %v", err)
+		}
+	}
+
+	scannerService, err := scanner.NewService(db)
+	if err != nil {
+		t.Fatalf("Failed to create scanner service: %v", err)
+	}
+	if err := scannerService.UseResolvers([]string{"local"}); err != nil {
+		t.Fatalf("Failed to configure resolvers: %v", err)
+	}
+
+	authResp, err := auth.NewService(db, "test-secret").GenerateAnonymousUser("test-device")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	return NewService(db, scannerService), db, authResp.UserID
+}
+
+func TestConfirmScan(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	// A unique printing is committed straight away
+	result, err := service.ProcessSingleScan(userID, &models.ScanRequest{CardName: "Counterspell"})
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if !result.Success || result.Status != models.ScanStatusCommitted {
+		t.Fatalf("Expected committed scan, got %+v", result)
+	}
+
+	// A name printed in several sets waits for the user to pick one
+	result, err = service.ProcessSingleScan(userID, &models.ScanRequest{CardName: "Lightning Bolt"})
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if result.Status != models.ScanStatusPending || len(result.Candidates) != 2 {
+		t.Fatalf("Expected pending scan with two candidates, got %+v", result)
+	}
+
+	if _, err := service.ConfirmScan(userID, result.ScanID, "counterspell"); !errors.Is(err, ErrNotCandidate) {
+		t.Errorf("Expected not a candidate error, got %v", err)
+	}
+	if _, err := service.ConfirmScan("someone-else", result.ScanID, "bolt-2xm"); !errors.Is(err, ErrScanNotFound) {
+		t.Errorf("Expected scan not found error, got %v", err)
+	}
+
+	// A confirmation that can't be counted in its session keeps nothing
+	if _, err := db.Exec(`CREATE TRIGGER no_session_counts BEFORE UPDATE ON scan_sessions
+		BEGIN SELECT RAISE(ABORT, 'sessions unavailable'); END`); err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+	if _, err := service.ConfirmScan(userID, result.ScanID, "bolt-2xm"); err == nil {
+		t.Error("Expected an error counting the confirmation")
+	}
+	if scan, _ := db.GetScan(result.ScanID); scan == nil || scan.Status != models.ScanStatusPending {
+		t.Errorf("Expected the scan to stay pending, got %+v", scan)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 1 {
+		t.Errorf("Expected nothing added by the failed confirmation, got %d copies", count)
+	}
+	if _, err := db.Exec(`DROP TRIGGER no_session_counts`); err != nil {
+		t.Fatalf("Failed to drop trigger: %v", err)
+	}
+
+	confirmed, err := service.ConfirmScan(userID, result.ScanID, "bolt-2xm")
+	if err != nil {
+		t.Fatalf("Failed to confirm scan: %v", err)
+	}
+	if confirmed.Card == nil || confirmed.Card.SetCode != "2XM" {
+		t.Errorf("Expected the 2XM printing, got %+v", confirmed)
+	}
+
+	if _, err := service.ConfirmScan(userID, result.ScanID, "bolt-2xm"); !errors.Is(err, ErrScanNotPending) {
+		t.Errorf("Expected scan not pending error, got %v", err)
+	}
+
+	items, err := db.GetUserInventory(userID)
+	if err != nil {
+		t.Fatalf("Failed to get inventory: %v", err)
+	}
+	if len(items) != 2 {
+		t.Errorf("Expected 2 inventory entries, got %d", len(items))
+	}
+}
+
+func TestScanCopyAttributes(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	scans := []models.ScanRequest{
+		{CardName: "Counterspell"},
+		{CardName: "Counterspell", CopyAttributes: models.CopyAttributes{Finish: "Foil", Condition: "lp", Language: "JA"}},
+		{CardName: "Counterspell", CopyAttributes: models.CopyAttributes{Condition: "mp"}},
+	}
+	result, err := service.ProcessBulkScan(userID, &models.BulkScanRequest{
+		Scans:    scans,
+		Defaults: models.CopyAttributes{Condition: "LP", Signed: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if result.SuccessfulScans != 3 {
+		t.Fatalf("Expected 3 successful scans, got %+v", result)
+	}
+
+	items, err := db.GetUserInventory(userID)
+	if err != nil {
+		t.Fatalf("Failed to get inventory: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("Expected copies with different attributes to be separate entries, got %d", len(items))
+	}
+
+	found := false
+	for _, item := range items {
+		if !item.Signed {
+			t.Errorf("Expected bulk default to mark every copy signed, got %+v", item.CopyAttributes)
+		}
+		if item.Finish == models.FinishFoil {
+			found = true
+			if item.Condition != models.ConditionLightlyPlayed || item.Language != "ja" {
+				t.Errorf("Expected normalized foil LP Japanese copy, got %+v", item.CopyAttributes)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected a foil entry")
+	}
+
+	// Removing only touches the entry with matching attributes
+	attrs := models.CopyAttributes{Finish: models.FinishFoil, Condition: "LP", Language: "ja", Signed: true}
+	if _, err := db.RemoveFromInventory(userID, "counterspell", attrs, 1, manualChange); err != nil {
+		t.Fatalf("Failed to remove from inventory: %v", err)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 2 {
+		t.Errorf("Expected 2 cards left, got %d", count)
+	}
+
+	_, err = service.ProcessSingleScan(userID, &models.ScanRequest{CardName: "Counterspell", CopyAttributes: models.CopyAttributes{Condition: "mint-ish"}})
+	if !errors.Is(err, ErrInvalidAttributes) {
+		t.Errorf("Expected invalid attributes error, got %v", err)
+	}
+}
+
+func TestAtomicBulkScan(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	// Any failure of an atomic request rolls back every scan and its session
+	_, err := service.ProcessBulkScan(userID, &models.BulkScanRequest{
+		Atomic: true,
+		Scans: []models.ScanRequest{
+			{CardName: "Counterspell", ClientScanID: "scan-1"},
+			{SetCode: "M10", CollectorNumber: "146"},
+			{CardName: "Black Lotus"},
+		},
+	})
+	if !errors.Is(err, ErrBulkScanRolledBack) {
+		t.Fatalf("Expected bulk scan rolled back error, got %v", err)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 0 {
+		t.Errorf("Expected nothing added, got %d copies", count)
+	}
+	if sessions, _ := service.GetSessions(userID, ""); len(sessions) != 0 {
+		t.Errorf("Expected no sessions, got %+v", sessions)
+	}
+	page, err := service.GetLedger(userID, &models.LedgerQuery{})
+	if err != nil {
+		t.Fatalf("Failed to get ledger: %v", err)
+	}
+	if len(page.Entries) != 0 {
+		t.Errorf("Expected no ledger entries, got %+v", page.Entries)
+	}
+
+	// The rolled back scan's client_scan_id is free to be scanned again
+	result, err := service.ProcessBulkScan(userID, &models.BulkScanRequest{
+		Atomic: true,
+		Scans: []models.ScanRequest{
+			{CardName: "Counterspell", ClientScanID: "scan-1"},
+			{SetCode: "M10", CollectorNumber: "146"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to bulk scan: %v", err)
+	}
+	if result.SuccessfulScans != 2 {
+		t.Errorf("Expected 2 successful scans, got %+v", result)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 2 {
+		t.Errorf("Expected 2 copies, got %d", count)
+	}
+
+	// Best effort requests keep the scans that succeed and count them all
+	session, err := service.StartSession(userID)
+	if err != nil {
+		t.Fatalf("Failed to start session: %v", err)
+	}
+	result, err = service.ProcessBulkScan(userID, &models.BulkScanRequest{
+		SessionID: session.ID,
+		Scans: []models.ScanRequest{
+			{CardName: "Counterspell"}, {CardName: "Black Lotus"},
+			{CardName: "Counterspell", CopyAttributes: models.CopyAttributes{Condition: "mint-ish"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to bulk scan: %v", err)
+	}
+	if result.SuccessfulScans != 1 || result.FailedScans != 2 {
+		t.Errorf("Expected 1 successful and 2 failed scans, got %+v", result)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 3 {
+		t.Errorf("Expected 3 copies, got %d", count)
+	}
+	got, err := service.GetSession(userID, session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if got.CardsScanned != 3 || got.SuccessfulScans != 1 || got.FailedScans != 2 {
+		t.Errorf("Unexpected session %+v", got)
+	}
+}
+
+func TestScanNotRecorded(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	// A copy whose scan can't be recorded isn't kept
+	if _, err := db.Exec(`CREATE TRIGGER no_committed_scans BEFORE INSERT ON scans WHEN NEW.status = 'committed'
+		BEGIN SELECT RAISE(ABORT, 'scans unavailable'); END`); err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+	result, err := service.ProcessSingleScan(userID, &models.ScanRequest{CardName: "Counterspell"})
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if result.Success || result.Status != models.ScanStatusFailed {
+		t.Errorf("Expected failed scan, got %+v", result)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 0 {
+		t.Errorf("Expected nothing added, got %d copies", count)
+	}
+	if _, err := db.Exec(`DROP TRIGGER no_committed_scans`); err != nil {
+		t.Fatalf("Failed to drop trigger: %v", err)
+	}
+
+	// Failing to count the scan against its session fails the request and
+	// keeps nothing, so a retry with the same key adds the card once
+	if _, err := db.Exec(`CREATE TRIGGER no_session_counts BEFORE UPDATE ON scan_sessions
+		BEGIN SELECT RAISE(ABORT, 'sessions unavailable'); END`); err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+	req := models.ScanRequest{CardName: "Counterspell", ClientScanID: "k1"}
+	if _, err := service.ProcessSingleScan(userID, &req); err == nil {
+		t.Error("Expected an error counting the scan")
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 0 {
+		t.Errorf("Expected nothing added by the failed request, got %d copies", count)
+	}
+	if _, err := db.Exec(`DROP TRIGGER no_session_counts`); err != nil {
+		t.Fatalf("Failed to drop trigger: %v", err)
+	}
+
+	retry := req
+	result, err = service.ProcessSingleScan(userID, &retry)
+	if err != nil {
+		t.Fatalf("Failed to retry scan: %v", err)
+	}
+	if !result.Success {
+		t.Errorf("Expected the retry to succeed, got %+v", result)
+	}
+	if count, _ := db.GetInventoryCount(userID); count != 1 {
+		t.Errorf("Expected 1 copy after the retry, got %d", count)
+	}
+}
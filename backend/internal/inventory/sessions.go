@@ -0,0 +1,111 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+var (
+	// ErrScanSessionNotFound is returned when a scan session does not exist or belongs to another user
+	ErrScanSessionNotFound = errors.New("scan session not found")
+	// ErrSessionCompleted is returned when scanning into or completing a session that is already completed
+	ErrSessionCompleted = errors.New("scan session is already completed")
+)
+
+// scanTypes are the scan session types sessions can be listed by
+var scanTypes = map[string]bool{
+	models.ScanTypeSingle:  true,
+	models.ScanTypeBulk:    true,
+	models.ScanTypeSession: true,
+}
+
+// StartSession opens a scan session that scans can be recorded in until it
+// is completed
+func (s *Service) StartSession(userID string) (*models.ScanSession, error) {
+	session := &models.ScanSession{
+		UserID:    userID,
+		ScanType:  models.ScanTypeSession,
+		StartedAt: time.Now(),
+	}
+	id, err := s.db.CreateScanSession(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scan session: %w", err)
+	}
+	session.ID = id
+	return session, nil
+}
+
+// GetSessions retrieves the user's scan sessions, newest first, optionally
+// only those of one scan type
+func (s *Service) GetSessions(userID, scanType string) ([]models.ScanSession, error) {
+	if scanType != "" && !scanTypes[scanType] {
+		return nil, fmt.Errorf("%w: unknown scan type %q", database.ErrInvalidQuery, scanType)
+	}
+	return s.db.GetUserScanSessions(userID, scanType)
+}
+
+// GetSession retrieves one of the user's scan sessions
+func (s *Service) GetSession(userID string, sessionID int) (*models.ScanSession, error) {
+	return s.getSession(userID, sessionID)
+}
+
+// CompleteSession closes one of the user's open scan sessions
+func (s *Service) CompleteSession(userID string, sessionID int) (*models.ScanSession, error) {
+	if _, err := s.getSession(userID, sessionID); err != nil {
+		return nil, err
+	}
+	completed, err := s.db.CompleteScanSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !completed {
+		return nil, ErrSessionCompleted
+	}
+	return s.getSession(userID, sessionID)
+}
+
+// GetSessionCards lists the copies a scan session added to the user's
+// inventory. Undone scans no longer count.
+func (s *Service) GetSessionCards(userID string, sessionID int) ([]models.SessionCard, error) {
+	if _, err := s.getSession(userID, sessionID); err != nil {
+		return nil, err
+	}
+	return s.db.GetSessionCards(sessionID)
+}
+
+// GetSessionScans lists the scans recorded in a scan session, including
+// failed and pending ones, in the order they were made
+func (s *Service) GetSessionScans(userID string, sessionID int) ([]models.Scan, error) {
+	if _, err := s.getSession(userID, sessionID); err != nil {
+		return nil, err
+	}
+	return s.db.GetSessionScans(sessionID)
+}
+
+// getSession retrieves a scan session, checking it belongs to the user
+func (s *Service) getSession(userID string, sessionID int) (*models.ScanSession, error) {
+	session, err := s.db.GetScanSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.UserID != userID {
+		return nil, ErrScanSessionNotFound
+	}
+	return session, nil
+}
+
+// getOpenSession retrieves a scan session scans can still be recorded in
+func (s *Service) getOpenSession(userID string, sessionID int) (*models.ScanSession, error) {
+	session, err := s.getSession(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.CompletedAt != nil {
+		return nil, ErrSessionCompleted
+	}
+	return session, nil
+}
@@ -0,0 +1,115 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+func TestScanSessionLifecycle(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	session, err := service.StartSession(userID)
+	if err != nil {
+		t.Fatalf("Failed to start session: %v", err)
+	}
+
+	// Single and bulk scans naming the session are recorded in it
+	result, err := service.ProcessSingleScan(userID, &models.ScanRequest{CardName: "Counterspell", SessionID: session.ID})
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if result.SessionID != session.ID {
+		t.Errorf("Expected scan in session %d, got %d", session.ID, result.SessionID)
+	}
+	bulk, err := service.ProcessBulkScan(userID, &models.BulkScanRequest{
+		SessionID: session.ID,
+		Scans: []models.ScanRequest{
+			{CardName: "Counterspell"}, {SetCode: "M10", CollectorNumber: "146"},
+			{CardName: "Lightning Bolt"}, {CardName: "Black Lotus"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to bulk scan: %v", err)
+	}
+	if bulk.SessionID != session.ID {
+		t.Errorf("Expected bulk scan in session %d, got %d", session.ID, bulk.SessionID)
+	}
+
+	got, err := service.GetSession(userID, session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if got.CardsScanned != 5 || got.SuccessfulScans != 3 || got.FailedScans != 1 || got.CompletedAt != nil {
+		t.Errorf("Unexpected open session %+v", got)
+	}
+
+	// Confirming the pending scan counts it, and undoing a scan takes it off
+	// the session's cards and successful scans
+	pending := bulk.Results[2]
+	if _, err := service.ConfirmScan(userID, pending.ScanID, "bolt-2xm"); err != nil {
+		t.Fatalf("Failed to confirm scan: %v", err)
+	}
+	page, err := service.GetLedger(userID, &models.LedgerQuery{SessionID: session.ID, CardID: "bolt-m10"})
+	if err != nil {
+		t.Fatalf("Failed to get ledger: %v", err)
+	}
+	if _, err := service.Undo(userID, &models.UndoRequest{EntryID: page.Entries[0].ID}); err != nil {
+		t.Fatalf("Failed to undo scan: %v", err)
+	}
+
+	cards, err := service.GetSessionCards(userID, session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get session cards: %v", err)
+	}
+	if len(cards) != 2 || cards[0].CardID != "counterspell" || cards[0].Quantity != 2 ||
+		cards[1].CardID != "bolt-2xm" || cards[1].Quantity != 1 || cards[1].Card.SetCode != "2XM" {
+		t.Errorf("Unexpected session cards %+v", cards)
+	}
+	scans, err := service.GetSessionScans(userID, session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get session scans: %v", err)
+	}
+	if len(scans) != 5 || scans[0].ID != result.ScanID || scans[2].Status != models.ScanStatusUndone ||
+		scans[3].Status != models.ScanStatusCommitted || scans[4].Status != models.ScanStatusFailed {
+		t.Errorf("Unexpected session scans %+v", scans)
+	}
+
+	completed, err := service.CompleteSession(userID, session.ID)
+	if err != nil {
+		t.Fatalf("Failed to complete session: %v", err)
+	}
+	if completed.CompletedAt == nil || completed.SuccessfulScans != 3 {
+		t.Errorf("Unexpected completed session %+v", completed)
+	}
+	if _, err := service.CompleteSession(userID, session.ID); !errors.Is(err, ErrSessionCompleted) {
+		t.Errorf("Expected session completed error, got %v", err)
+	}
+	if _, err := service.ProcessSingleScan(userID, &models.ScanRequest{CardName: "Counterspell", SessionID: session.ID}); !errors.Is(err, ErrSessionCompleted) {
+		t.Errorf("Expected scanning into a completed session to fail, got %v", err)
+	}
+	if _, err := service.GetSessionCards("someone-else", session.ID); !errors.Is(err, ErrScanSessionNotFound) {
+		t.Errorf("Expected scan session not found error, got %v", err)
+	}
+
+	// Scans without a session still get their own, completed at once
+	if _, err := service.ProcessSingleScan(userID, &models.ScanRequest{CardName: "Counterspell"}); err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	sessions, err := service.GetSessions(userID, "")
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].ScanType != models.ScanTypeSingle || sessions[0].CompletedAt == nil {
+		t.Errorf("Unexpected sessions %+v", sessions)
+	}
+	if sessions, _ := service.GetSessions(userID, models.ScanTypeSession); len(sessions) != 1 || sessions[0].ID != session.ID {
+		t.Errorf("Expected only the explicit session, got %+v", sessions)
+	}
+	if _, err := service.GetSessions(userID, "weekly"); !errors.Is(err, database.ErrInvalidQuery) {
+		t.Errorf("Expected invalid query error, got %v", err)
+	}
+}
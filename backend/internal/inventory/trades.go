@@ -0,0 +1,438 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+var (
+	// ErrTradeNotFound is returned when a trade does not exist or the user is not part of it
+	ErrTradeNotFound = errors.New("trade not found")
+	// ErrInvalidTrade is returned for a trade without copies or with copies not on a trade list
+	ErrInvalidTrade = errors.New("invalid trade")
+	// ErrNotTradePartners is returned when two users have not both agreed to trade with each other
+	ErrNotTradePartners = errors.New("users have not agreed to trade with each other")
+	// ErrPartnerNotFound is returned when adding a trade partner that does not exist
+	ErrPartnerNotFound = errors.New("trade partner not found")
+	// ErrTradeNotProposed is returned when resolving a trade that was already accepted, declined or cancelled
+	ErrTradeNotProposed = errors.New("trade is no longer proposed")
+)
+
+// AddTradePartner records the user's agreement to trade with a partner.
+// Matching and proposing trades needs both users to have added each other.
+func (s *Service) AddTradePartner(userID, partnerID string) error {
+	if partnerID == userID {
+		return fmt.Errorf("%w: cannot trade with yourself", ErrInvalidTrade)
+	}
+	partner, err := s.db.GetUserByID(partnerID)
+	if err != nil {
+		return err
+	}
+	if partner == nil {
+		return ErrPartnerNotFound
+	}
+	return s.db.AddTradePartner(userID, partnerID)
+}
+
+// RemoveTradePartner withdraws the user's agreement to trade with a partner
+func (s *Service) RemoveTradePartner(userID, partnerID string) error {
+	removed, err := s.db.RemoveTradePartner(userID, partnerID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrPartnerNotFound
+	}
+	return nil
+}
+
+// GetTradePartners retrieves the users the user has agreed to trade with
+func (s *Service) GetTradePartners(userID string) ([]models.TradePartner, error) {
+	return s.db.GetTradePartners(userID)
+}
+
+// checkTradePartners fails with ErrNotTradePartners unless both users agreed
+// to trade with each other
+func (s *Service) checkTradePartners(userID, partnerID string) error {
+	ok, err := s.db.AreTradePartners(userID, partnerID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotTradePartners
+	}
+	return nil
+}
+
+// priceBook looks up catalog prices, reading each card's prices once
+type priceBook struct {
+	s      *Service
+	prices map[string][]models.CardPrice
+}
+
+// unitPrice returns the price of a card's finish in a currency, or nil if
+// it has none
+func (b *priceBook) unitPrice(cardID, currency, finish string) (*float64, error) {
+	prices, ok := b.prices[cardID]
+	if !ok {
+		var err error
+		if prices, err = b.s.db.GetCardPrices(cardID); err != nil {
+			return nil, err
+		}
+		b.prices[cardID] = prices
+	}
+	for _, p := range prices {
+		if p.Currency == currency && p.Finish == finish {
+			return &p.Price, nil
+		}
+	}
+	return nil, nil
+}
+
+// FindTradeMatches intersects the user's wishlist with the partner's trade
+// list and the partner's wishlist with the user's trade list, valuing both
+// sides in currency. Offered copies go to wishlist items wanting their exact
+// printing first, and must meet the item's minimum condition and be priced
+// within its max price. The proposal is a balanced selection of the matches.
+func (s *Service) FindTradeMatches(userID, partnerID, currency string) (*models.TradeMatch, error) {
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkTradePartners(userID, partnerID); err != nil {
+		return nil, err
+	}
+
+	book := &priceBook{s: s, prices: make(map[string][]models.CardPrice)}
+	match := &models.TradeMatch{PartnerID: partnerID, Currency: currency}
+	if match.Receive, match.ReceiveValue, err = s.matchWants(userID, partnerID, currency, book); err != nil {
+		return nil, err
+	}
+	if match.Give, match.GiveValue, err = s.matchWants(partnerID, userID, currency, book); err != nil {
+		return nil, err
+	}
+	if len(match.Give) > 0 && len(match.Receive) > 0 {
+		match.Proposal = proposeTrade(partnerID, currency, match.Give, match.Receive)
+	}
+	return match, nil
+}
+
+// matchWants matches the wanting user's outstanding wishlist items against
+// the offering user's trade list, returning the matched copies and their
+// total value
+func (s *Service) matchWants(wantingID, offeringID, currency string, book *priceBook) ([]models.TradeMatchItem, float64, error) {
+	wants, err := s.db.GetUserWishlist(wantingID)
+	if err != nil {
+		return nil, 0, err
+	}
+	offers, err := s.db.GetUserTradeList(offeringID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Items wanting an exact printing are served first, then the oldest
+	sort.SliceStable(wants, func(i, j int) bool {
+		if (wants[i].CardID == "") != (wants[j].CardID == "") {
+			return wants[i].CardID != ""
+		}
+		return wants[i].ID < wants[j].ID
+	})
+
+	matches := []models.TradeMatchItem{}
+	var total float64
+	for _, want := range wants {
+		needed := want.Quantity - want.Acquired
+		for i := range offers {
+			offer := &offers[i]
+			if needed == 0 {
+				break
+			}
+			if offer.TradeQuantity == 0 || !wantsOffer(want, offer) {
+				continue
+			}
+			if want.MaxPrice != nil {
+				price, err := book.unitPrice(offer.CardID, want.Currency, offer.Finish)
+				if err != nil {
+					return nil, 0, err
+				}
+				if price == nil || *price > *want.MaxPrice {
+					continue
+				}
+			}
+
+			price, err := book.unitPrice(offer.CardID, currency, offer.Finish)
+			if err != nil {
+				return nil, 0, err
+			}
+			quantity := min(needed, offer.TradeQuantity)
+			item := models.TradeMatchItem{
+				TradeItem: models.TradeItem{
+					InventoryID:    offer.ID,
+					CardID:         offer.CardID,
+					Card:           offer.Card,
+					CopyAttributes: offer.CopyAttributes,
+					Quantity:       quantity,
+					UnitPrice:      price,
+				},
+				WishlistID: want.ID,
+			}
+			if price != nil {
+				item.Value = *price * float64(quantity)
+			}
+			matches = append(matches, item)
+			total += item.Value
+			offer.TradeQuantity -= quantity
+			needed -= quantity
+		}
+	}
+	return matches, total, nil
+}
+
+// wantsOffer reports whether an offered copy is the card a wishlist item
+// wants, in good enough condition
+func wantsOffer(want models.WishlistItem, offer *models.TradeListItem) bool {
+	if want.CardID != "" && want.CardID != offer.CardID {
+		return false
+	}
+	if want.CardID == "" && want.Name != offer.Card.Name {
+		return false
+	}
+	return want.MinCondition == "" || slices.Contains(satisfiedMinimums(offer.Condition), want.MinCondition)
+}
+
+// proposeTrade balances matched copies: the side worth less is taken in
+// full, and copies from the other side are added most valuable first as long
+// as each brings the two sides closer in value
+func proposeTrade(partnerID, currency string, give, receive []models.TradeMatchItem) *models.TradeProposal {
+	// tradeCopy is a single matched copy and its value
+	type tradeCopy struct {
+		inventoryID int
+		value       float64
+	}
+	copies := func(items []models.TradeMatchItem) []tradeCopy {
+		var out []tradeCopy
+		for _, item := range items {
+			for i := 0; i < item.Quantity; i++ {
+				out = append(out, tradeCopy{item.InventoryID, item.Value / float64(item.Quantity)})
+			}
+		}
+		return out
+	}
+	sum := func(cs []tradeCopy) float64 {
+		var total float64
+		for _, c := range cs {
+			total += c.value
+		}
+		return total
+	}
+	// requests merges copies of the same inventory entry, keeping their order
+	requests := func(cs []tradeCopy) []models.TradeItemRequest {
+		out := []models.TradeItemRequest{}
+		index := make(map[int]int)
+		for _, c := range cs {
+			if i, ok := index[c.inventoryID]; ok {
+				out[i].Quantity++
+				continue
+			}
+			index[c.inventoryID] = len(out)
+			out = append(out, models.TradeItemRequest{InventoryID: c.inventoryID, Quantity: 1})
+		}
+		return out
+	}
+
+	low, high := copies(give), copies(receive)
+	swapped := sum(low) > sum(high)
+	if swapped {
+		low, high = high, low
+	}
+	target := sum(low)
+	sort.SliceStable(high, func(i, j int) bool { return high[i].value > high[j].value })
+	var picked []tradeCopy
+	var total float64
+	for _, c := range high {
+		if math.Abs(total+c.value-target) < math.Abs(total-target) {
+			picked = append(picked, c)
+			total += c.value
+		}
+	}
+
+	proposal := &models.TradeProposal{TradeRequest: models.TradeRequest{PartnerID: partnerID, Currency: currency}}
+	if swapped {
+		low, picked = picked, low
+	}
+	proposal.Give, proposal.Receive = requests(low), requests(picked)
+	proposal.GiveValue, proposal.ReceiveValue = sum(low), sum(picked)
+	return proposal
+}
+
+// ProposeTrade records a trade of copies from the user's trade list for
+// copies from the partner's, valued at current prices
+func (s *Service) ProposeTrade(userID string, req *models.TradeRequest) (*models.Trade, error) {
+	currency, err := normalizeCurrency(req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if req.PartnerID == userID {
+		return nil, fmt.Errorf("%w: cannot trade with yourself", ErrInvalidTrade)
+	}
+	if err := s.checkTradePartners(userID, req.PartnerID); err != nil {
+		return nil, err
+	}
+	if len(req.Give) == 0 && len(req.Receive) == 0 {
+		return nil, fmt.Errorf("%w: no copies to trade", ErrInvalidTrade)
+	}
+
+	trade := &models.Trade{
+		ProposerID: userID,
+		PartnerID:  req.PartnerID,
+		Status:     models.TradeProposed,
+		Currency:   currency,
+		CreatedAt:  time.Now(),
+	}
+	book := &priceBook{s: s, prices: make(map[string][]models.CardPrice)}
+	if trade.Give, trade.GiveValue, err = s.tradeItems(userID, req.Give, currency, book); err != nil {
+		return nil, err
+	}
+	if trade.Receive, trade.ReceiveValue, err = s.tradeItems(req.PartnerID, req.Receive, currency, book); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.CreateTrade(trade); err != nil {
+		return nil, err
+	}
+	return trade, nil
+}
+
+// tradeItems resolves requested copies against the owner's trade list,
+// merging repeated entries, and returns them with their total value
+func (s *Service) tradeItems(ownerID string, reqs []models.TradeItemRequest, currency string, book *priceBook) ([]models.TradeItem, float64, error) {
+	offers, err := s.db.GetUserTradeList(ownerID)
+	if err != nil {
+		return nil, 0, err
+	}
+	offered := make(map[int]models.TradeListItem, len(offers))
+	for _, o := range offers {
+		offered[o.ID] = o
+	}
+
+	items := []models.TradeItem{}
+	index := make(map[int]int)
+	for _, r := range reqs {
+		if r.Quantity <= 0 {
+			return nil, 0, fmt.Errorf("%w: quantity must be positive", ErrInvalidQuantity)
+		}
+		if i, ok := index[r.InventoryID]; ok {
+			items[i].Quantity += r.Quantity
+			continue
+		}
+		offer, ok := offered[r.InventoryID]
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: inventory entry %d is not offered for trade", ErrInvalidTrade, r.InventoryID)
+		}
+		index[r.InventoryID] = len(items)
+		items = append(items, models.TradeItem{
+			InventoryID:    offer.ID,
+			CardID:         offer.CardID,
+			Card:           offer.Card,
+			CopyAttributes: offer.CopyAttributes,
+			Quantity:       r.Quantity,
+		})
+	}
+
+	var total float64
+	for i := range items {
+		item := &items[i]
+		if item.Quantity > offered[item.InventoryID].TradeQuantity {
+			return nil, 0, fmt.Errorf("%w: only %d copies of inventory entry %d are offered", ErrInvalidTrade,
+				offered[item.InventoryID].TradeQuantity, item.InventoryID)
+		}
+		if item.UnitPrice, err = book.unitPrice(item.CardID, currency, item.Finish); err != nil {
+			return nil, 0, err
+		}
+		if item.UnitPrice != nil {
+			total += *item.UnitPrice * float64(item.Quantity)
+		}
+	}
+	return items, total, nil
+}
+
+// GetTrades retrieves the trades the user proposed or was offered
+func (s *Service) GetTrades(userID string) ([]models.Trade, error) {
+	return s.db.GetUserTrades(userID)
+}
+
+// GetTrade retrieves a trade the user is part of
+func (s *Service) GetTrade(userID string, tradeID int64) (*models.Trade, error) {
+	trade, err := s.db.GetTrade(tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if trade == nil || (trade.ProposerID != userID && trade.PartnerID != userID) {
+		return nil, ErrTradeNotFound
+	}
+	return trade, nil
+}
+
+// AcceptTrade accepts a trade offered to the user, moving its copies between
+// the two inventories at once. Received copies count towards each user's
+// wishlist as scanned ones do.
+func (s *Service) AcceptTrade(userID string, tradeID int64) (*models.Trade, error) {
+	trade, err := s.GetTrade(userID, tradeID)
+	if err != nil {
+		return nil, err
+	}
+	if trade.PartnerID != userID {
+		return nil, fmt.Errorf("%w: only the partner it was offered to can accept it", ErrInvalidTrade)
+	}
+	if trade.Status != models.TradeProposed {
+		return nil, ErrTradeNotProposed
+	}
+
+	accepted, err := s.db.AcceptTrade(trade)
+	if err != nil {
+		return nil, err
+	}
+	if !accepted {
+		return nil, ErrTradeNotProposed
+	}
+
+	tickOff := func(receiverID string, items []models.TradeItem) {
+		for _, item := range items {
+			for i := 0; i < item.Quantity; i++ {
+				s.tickOffWishlist(receiverID, item.Card, item.CopyAttributes)
+			}
+		}
+	}
+	tickOff(trade.PartnerID, trade.Give)
+	tickOff(trade.ProposerID, trade.Receive)
+
+	return s.db.GetTrade(tradeID)
+}
+
+// DeclineTrade ends a proposed trade without exchanging cards: the partner
+// declines it, the proposer cancels it
+func (s *Service) DeclineTrade(userID string, tradeID int64) (*models.Trade, error) {
+	trade, err := s.GetTrade(userID, tradeID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := models.TradeDeclined
+	if trade.ProposerID == userID {
+		status = models.TradeCancelled
+	}
+	resolved, err := s.db.ResolveTrade(tradeID, status)
+	if err != nil {
+		return nil, err
+	}
+	if !resolved {
+		return nil, ErrTradeNotProposed
+	}
+	return s.db.GetTrade(tradeID)
+}
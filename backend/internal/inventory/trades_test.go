@@ -0,0 +1,153 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/abzi/mtg_card_detector/internal/auth"
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+func TestTradeMatching(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	other, err := auth.NewService(db, "test-secret").GenerateAnonymousUser("other-device")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	partnerID := other.UserID
+
+	for cardID, price := range map[string]float64{"bolt-m10": 1, "counterspell": 3} {
+		if err := db.SetCardPrices(cardID, []models.CardPrice{{Currency: models.CurrencyUSD, Finish: models.FinishNonfoil, Price: price}}); err != nil {
+			t.Fatalf("Failed to set prices: %v", err)
+		}
+	}
+
+	// Each user offers what the other wants
+	offer := func(userID, cardID string, quantity int) *models.InventoryItem {
+		item, err := service.AddCard(userID, cardID, &models.InventoryAddRequest{Quantity: quantity})
+		if err != nil {
+			t.Fatalf("Failed to add card: %v", err)
+		}
+		if _, err := service.SetTradeQuantity(userID, item.ID, &models.TradeListRequest{Quantity: quantity}); err != nil {
+			t.Fatalf("Failed to set trade quantity: %v", err)
+		}
+		return item
+	}
+	counterspells := offer(userID, "counterspell", 2)
+	bolts := offer(partnerID, "bolt-m10", 3)
+	if _, err := service.AddToWishlist(userID, &models.WishlistRequest{Name: "Lightning Bolt", Quantity: 2}); err != nil {
+		t.Fatalf("Failed to add to wishlist: %v", err)
+	}
+	if _, err := service.AddToWishlist(partnerID, &models.WishlistRequest{Name: "Counterspell", MinCondition: "NM"}); err != nil {
+		t.Fatalf("Failed to add to wishlist: %v", err)
+	}
+
+	// Matching needs both users to agree
+	if err := service.AddTradePartner(userID, partnerID); err != nil {
+		t.Fatalf("Failed to add trade partner: %v", err)
+	}
+	if _, err := service.FindTradeMatches(userID, partnerID, ""); !errors.Is(err, ErrNotTradePartners) {
+		t.Errorf("Expected not trade partners error, got %v", err)
+	}
+	if err := service.AddTradePartner(partnerID, userID); err != nil {
+		t.Fatalf("Failed to add trade partner: %v", err)
+	}
+
+	match, err := service.FindTradeMatches(userID, partnerID, "")
+	if err != nil {
+		t.Fatalf("Failed to find matches: %v", err)
+	}
+	if len(match.Receive) != 1 || match.Receive[0].InventoryID != bolts.ID || match.Receive[0].Quantity != 2 || match.ReceiveValue != 2 {
+		t.Errorf("Unexpected received copies %+v", match.Receive)
+	}
+	if len(match.Give) != 1 || match.Give[0].InventoryID != counterspells.ID || match.Give[0].Quantity != 1 || match.GiveValue != 3 {
+		t.Errorf("Unexpected given copies %+v", match.Give)
+	}
+	if match.Proposal == nil || match.Proposal.GiveValue != 3 || match.Proposal.ReceiveValue != 2 {
+		t.Fatalf("Unexpected proposal %+v", match.Proposal)
+	}
+
+	trade, err := service.ProposeTrade(userID, &match.Proposal.TradeRequest)
+	if err != nil {
+		t.Fatalf("Failed to propose trade: %v", err)
+	}
+	if _, err := service.AcceptTrade(userID, trade.ID); !errors.Is(err, ErrInvalidTrade) {
+		t.Errorf("Expected the proposer not to be able to accept, got %v", err)
+	}
+
+	accepted, err := service.AcceptTrade(partnerID, trade.ID)
+	if err != nil {
+		t.Fatalf("Failed to accept trade: %v", err)
+	}
+	if accepted.Status != models.TradeAccepted || accepted.ResolvedAt == nil {
+		t.Errorf("Unexpected accepted trade %+v", accepted)
+	}
+	for _, expected := range []struct {
+		userID, cardID string
+		quantity       int
+	}{
+		{userID, "counterspell", 1}, {userID, "bolt-m10", 2},
+		{partnerID, "counterspell", 1}, {partnerID, "bolt-m10", 1},
+	} {
+		items, err := db.GetUserInventory(expected.userID)
+		if err != nil {
+			t.Fatalf("Failed to get inventory: %v", err)
+		}
+		quantity := 0
+		for _, item := range items {
+			if item.CardID == expected.cardID {
+				quantity += item.Quantity
+			}
+		}
+		if quantity != expected.quantity {
+			t.Errorf("Expected %d %s, got %d", expected.quantity, expected.cardID, quantity)
+		}
+	}
+	wishlist, err := service.GetWishlist(userID)
+	if err != nil {
+		t.Fatalf("Failed to get wishlist: %v", err)
+	}
+	if !wishlist[0].Fulfilled {
+		t.Errorf("Expected received bolts to fulfill the wishlist, got %+v", wishlist[0])
+	}
+	if _, err := service.AcceptTrade(partnerID, trade.ID); !errors.Is(err, ErrTradeNotProposed) {
+		t.Errorf("Expected trade not proposed error, got %v", err)
+	}
+
+	// Copies gone from inventory fail the whole trade
+	trade, err = service.ProposeTrade(userID, &models.TradeRequest{
+		PartnerID: partnerID,
+		Give:      []models.TradeItemRequest{{InventoryID: counterspells.ID, Quantity: 1}},
+		Receive:   []models.TradeItemRequest{{InventoryID: bolts.ID, Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to propose trade: %v", err)
+	}
+	if _, err := service.RemoveCard(userID, "counterspell", models.CopyAttributes{}, 0); err != nil {
+		t.Fatalf("Failed to remove card: %v", err)
+	}
+	if _, err := service.AcceptTrade(partnerID, trade.ID); !errors.Is(err, database.ErrTradeUnavailable) {
+		t.Errorf("Expected trade unavailable error, got %v", err)
+	}
+	if count, _ := db.GetInventoryCount(partnerID); count != 2 {
+		t.Errorf("Expected partner's inventory to be unchanged, got %d cards", count)
+	}
+
+	declined, err := service.DeclineTrade(userID, trade.ID)
+	if err != nil {
+		t.Fatalf("Failed to cancel trade: %v", err)
+	}
+	if declined.Status != models.TradeCancelled {
+		t.Errorf("Expected cancelled trade, got %s", declined.Status)
+	}
+
+	if _, err := service.ProposeTrade(userID, &models.TradeRequest{
+		PartnerID: partnerID,
+		Receive:   []models.TradeItemRequest{{InventoryID: bolts.ID, Quantity: 5}},
+	}); !errors.Is(err, ErrInvalidTrade) {
+		t.Errorf("Expected invalid trade error for more copies than offered, got %v", err)
+	}
+}
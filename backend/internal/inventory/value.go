@@ -0,0 +1,81 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+const (
+	// DefaultHistoryDays is how far back value history goes by default
+	DefaultHistoryDays = 30
+	// DefaultMovers is the number of biggest movers listed by default
+	DefaultMovers = 10
+	// DefaultTopCards is the number of most valuable entries listed by default
+	DefaultTopCards = 10
+	// MaxTopCards is the most valuable entries that can be listed
+	MaxTopCards = 100
+)
+
+var (
+	// ErrInvalidCurrency is returned for a currency prices aren't tracked in
+	ErrInvalidCurrency = errors.New("invalid currency")
+	// ErrInvalidDateRange is returned for a history range ending before it starts
+	ErrInvalidDateRange = errors.New("invalid date range")
+)
+
+// GetInventoryValue totals the market value of the user's inventory in a
+// currency (USD by default) and lists its top most valuable entries
+func (s *Service) GetInventoryValue(userID, currency string, top int) (*models.InventoryValue, error) {
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	if top <= 0 {
+		top = DefaultTopCards
+	}
+	return s.db.GetInventoryValue(userID, currency, min(top, MaxTopCards))
+}
+
+// GetValueHistory retrieves the user's daily inventory value between two
+// dates, by default the last DefaultHistoryDays days, and the movers entries
+// whose value changed most over that range
+func (s *Service) GetValueHistory(userID, currency string, from, to *time.Time, movers int) (*models.ValueHistory, error) {
+	currency, err := normalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now().UTC()
+	if to != nil {
+		end = to.UTC()
+	}
+	start := end.AddDate(0, 0, -DefaultHistoryDays)
+	if from != nil {
+		start = from.UTC()
+	}
+	if start.After(end) {
+		return nil, fmt.Errorf("%w: from is after to", ErrInvalidDateRange)
+	}
+
+	if movers <= 0 {
+		movers = DefaultMovers
+	}
+	return s.db.GetValueHistory(userID, currency, start.Format(time.DateOnly), end.Format(time.DateOnly), min(movers, MaxTopCards))
+}
+
+// normalizeCurrency lowercases a currency, defaulting to USD
+func normalizeCurrency(currency string) (string, error) {
+	currency = strings.ToLower(currency)
+	switch currency {
+	case "":
+		return models.CurrencyUSD, nil
+	case models.CurrencyUSD, models.CurrencyEUR:
+		return currency, nil
+	}
+	return "", fmt.Errorf("%w: %q, use usd or eur", ErrInvalidCurrency, currency)
+}
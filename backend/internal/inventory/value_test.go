@@ -0,0 +1,175 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+func TestInventoryValue(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	prices := map[string][]models.CardPrice{
+		"bolt-m10": {
+			{Currency: models.CurrencyUSD, Finish: models.FinishNonfoil, Price: 1.25},
+			{Currency: models.CurrencyUSD, Finish: models.FinishFoil, Price: 8.5},
+		},
+		"counterspell": {
+			{Currency: models.CurrencyUSD, Finish: models.FinishNonfoil, Price: 0.75},
+			{Currency: models.CurrencyEUR, Finish: models.FinishNonfoil, Price: 0.5},
+		},
+	}
+	for cardID, p := range prices {
+		if err := db.SetCardPrices(cardID, p); err != nil {
+			t.Fatalf("Failed to set prices: %v", err)
+		}
+	}
+
+	adds := []struct {
+		cardID   string
+		finish   string
+		quantity int
+	}{
+		{"bolt-m10", models.FinishNonfoil, 4},
+		{"bolt-m10", models.FinishFoil, 1},
+		{"counterspell", models.FinishNonfoil, 2},
+		{"counterspell", models.FinishEtched, 1}, // no etched price
+		{"bolt-2xm", models.FinishNonfoil, 3},    // no prices at all
+	}
+	for _, a := range adds {
+		req := &models.InventoryAddRequest{Quantity: a.quantity, CopyAttributes: models.CopyAttributes{Finish: a.finish}}
+		if _, err := service.AddCard(userID, a.cardID, req); err != nil {
+			t.Fatalf("Failed to add card: %v", err)
+		}
+	}
+
+	value, err := service.GetInventoryValue(userID, "", 2)
+	if err != nil {
+		t.Fatalf("Failed to value inventory: %v", err)
+	}
+	if value.Currency != models.CurrencyUSD || value.Total != 15 {
+		t.Errorf("Expected $15.00, got %+v", value)
+	}
+	if value.PricedCards != 7 || value.UnpricedCards != 4 {
+		t.Errorf("Expected 7 priced and 4 unpriced cards, got %d and %d", value.PricedCards, value.UnpricedCards)
+	}
+	if value.PricesUpdated == nil {
+		t.Error("Expected price date")
+	}
+
+	// Each copy is valued at its own finish's price
+	if len(value.TopCards) != 2 {
+		t.Fatalf("Expected 2 top cards, got %d", len(value.TopCards))
+	}
+	if top := value.TopCards[0]; top.Finish != models.FinishFoil || top.UnitPrice != 8.5 || top.Value != 8.5 {
+		t.Errorf("Expected foil bolt first, got %+v", top)
+	}
+	if second := value.TopCards[1]; second.Finish != models.FinishNonfoil || second.Quantity != 4 || second.Value != 5 {
+		t.Errorf("Expected 4 nonfoil bolts second, got %+v", second)
+	}
+
+	value, err = service.GetInventoryValue(userID, "EUR", 0)
+	if err != nil || value.Total != 1 || value.PricedCards != 2 {
+		t.Errorf("Expected €1.00 over 2 cards, got %+v (%v)", value, err)
+	}
+
+	if _, err := service.GetInventoryValue(userID, "gbp", 0); !errors.Is(err, ErrInvalidCurrency) {
+		t.Errorf("Expected invalid currency error, got %v", err)
+	}
+
+	// Listing by value pages most valuable first, unpriced entries last
+	var values []string
+	q := &models.InventoryQuery{Sort: "value", Descending: true, Limit: 2}
+	for {
+		page, err := service.ListInventory(userID, q)
+		if err != nil {
+			t.Fatalf("Failed to list inventory: %v", err)
+		}
+		for _, item := range page.Items {
+			values = append(values, item.CardID+"/"+item.Finish)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if len(values) != 5 || values[0] != "bolt-m10/foil" || values[1] != "bolt-m10/nonfoil" || values[2] != "counterspell/nonfoil" {
+		t.Errorf("Unexpected value order %v", values)
+	}
+
+	if _, err := service.ListInventory(userID, &models.InventoryQuery{Sort: "value", Currency: "gbp"}); !errors.Is(err, database.ErrInvalidQuery) {
+		t.Errorf("Expected invalid query error, got %v", err)
+	}
+}
+
+func TestValueHistory(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	for cardID, quantity := range map[string]int{"bolt-m10": 4, "counterspell": 2, "bolt-2xm": 1} {
+		if _, err := service.AddCard(userID, cardID, &models.InventoryAddRequest{Quantity: quantity}); err != nil {
+			t.Fatalf("Failed to add card: %v", err)
+		}
+	}
+
+	snapshot := func(date string, prices map[string]float64) {
+		t.Helper()
+		for cardID, price := range prices {
+			p := []models.CardPrice{{Currency: models.CurrencyUSD, Finish: models.FinishNonfoil, Price: price}}
+			if err := db.SetCardPrices(cardID, p); err != nil {
+				t.Fatalf("Failed to set prices: %v", err)
+			}
+		}
+		if _, err := db.RecordValueSnapshot(date); err != nil {
+			t.Fatalf("Failed to record snapshot: %v", err)
+		}
+	}
+	snapshot("2025-01-01", map[string]float64{"bolt-m10": 1, "counterspell": 2, "bolt-2xm": 3})
+	snapshot("2025-01-02", map[string]float64{"bolt-m10": 1.5, "counterspell": 2, "bolt-2xm": 3})
+	snapshot("2025-01-03", map[string]float64{"bolt-m10": 2, "counterspell": 1, "bolt-2xm": 3})
+
+	// Snapshots of a date can be retaken
+	result, err := db.RecordValueSnapshot("2025-01-03")
+	if err != nil || result.Users != 1 || result.Prices != 3 {
+		t.Errorf("Expected one user and 3 prices, got %+v (%v)", result, err)
+	}
+
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)
+	history, err := service.GetValueHistory(userID, "usd", &from, &to, 0)
+	if err != nil {
+		t.Fatalf("Failed to get value history: %v", err)
+	}
+
+	var totals []float64
+	for _, p := range history.Points {
+		totals = append(totals, p.Total)
+	}
+	if len(totals) != 3 || totals[0] != 11 || totals[1] != 13 || totals[2] != 13 {
+		t.Errorf("Expected totals 11, 13, 13, got %v", totals)
+	}
+
+	// Bolts gained $4 and counterspells lost $2; the unchanged bolt isn't a mover
+	if len(history.Movers) != 2 {
+		t.Fatalf("Expected 2 movers, got %+v", history.Movers)
+	}
+	if m := history.Movers[0]; m.CardID != "bolt-m10" || m.Change != 4 || m.ChangePercent != 100 {
+		t.Errorf("Expected bolts up $4 (100%%) first, got %+v", m)
+	}
+	if m := history.Movers[1]; m.CardID != "counterspell" || m.Change != -2 || m.ChangePercent != -50 {
+		t.Errorf("Expected counterspells down $2 (-50%%) second, got %+v", m)
+	}
+
+	history, err = service.GetValueHistory(userID, "eur", &from, &to, 0)
+	if err != nil || len(history.Points) != 3 || history.Points[0].UnpricedCards != 7 || len(history.Movers) != 0 {
+		t.Errorf("Expected unpriced EUR history, got %+v (%v)", history, err)
+	}
+
+	if _, err := service.GetValueHistory(userID, "", &to, &from, 0); !errors.Is(err, ErrInvalidDateRange) {
+		t.Errorf("Expected invalid date range error, got %v", err)
+	}
+}
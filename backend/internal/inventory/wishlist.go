@@ -0,0 +1,217 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+	"github.com/abzi/mtg_card_detector/internal/scanner"
+)
+
+var (
+	// ErrWishlistItemNotFound is returned when a wishlist item does not exist or belongs to another user
+	ErrWishlistItemNotFound = errors.New("wishlist item not found")
+	// ErrInvalidWishlistItem is returned for a wishlist item without a card or with invalid limits
+	ErrInvalidWishlistItem = errors.New("invalid wishlist item")
+	// ErrNotOnTradeList is returned when an inventory entry is not offered for trade
+	ErrNotOnTradeList = errors.New("not on trade list")
+)
+
+// conditionOrder lists the canonical conditions from best to worst
+var conditionOrder = []string{
+	models.ConditionNearMint,
+	models.ConditionLightlyPlayed,
+	models.ConditionModeratelyPlayed,
+	models.ConditionHeavilyPlayed,
+	models.ConditionDamaged,
+}
+
+// satisfiedMinimums returns the minimum conditions a copy in the given
+// canonical condition meets: its own and every worse one
+func satisfiedMinimums(condition string) []string {
+	i := slices.Index(conditionOrder, condition)
+	if i < 0 {
+		return nil
+	}
+	return conditionOrder[i:]
+}
+
+// normalizeMinCondition canonicalizes a wishlist item's minimum condition,
+// leaving it empty for any condition
+func normalizeMinCondition(condition string) (string, error) {
+	condition = strings.ToUpper(strings.TrimSpace(condition))
+	if condition == "" {
+		return "", nil
+	}
+	canonical, ok := conditions[condition]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown condition %q", ErrInvalidWishlistItem, condition)
+	}
+	return canonical, nil
+}
+
+// AddToWishlist adds a wanted card to the user's wishlist. A card ID or set
+// and collector number pins the item to that printing; a name alone accepts
+// any printing of the card.
+func (s *Service) AddToWishlist(userID string, req *models.WishlistRequest) (*models.WishlistItem, error) {
+	quantity := req.Quantity
+	if quantity == 0 {
+		quantity = 1
+	}
+	if quantity < 0 {
+		return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidQuantity)
+	}
+	if req.MaxPrice != nil && *req.MaxPrice < 0 {
+		return nil, fmt.Errorf("%w: max price cannot be negative", ErrInvalidWishlistItem)
+	}
+	currency, err := normalizeCurrency(req.Currency)
+	if err != nil {
+		return nil, err
+	}
+	minCondition, err := normalizeMinCondition(req.MinCondition)
+	if err != nil {
+		return nil, err
+	}
+
+	item := &models.WishlistItem{
+		UserID:       userID,
+		Quantity:     quantity,
+		MaxPrice:     req.MaxPrice,
+		Currency:     currency,
+		MinCondition: minCondition,
+		CreatedAt:    time.Now(),
+	}
+
+	switch {
+	case req.CardID != "":
+		card, err := s.db.GetCardByID(req.CardID)
+		if err != nil {
+			return nil, err
+		}
+		if card == nil {
+			return nil, scanner.ErrCardNotFound
+		}
+		item.Name, item.CardID, item.Card = card.Name, card.ID, card
+	case strings.TrimSpace(req.Name) != "" || req.SetCode != "":
+		candidates, err := s.resolveRecord(csvRecord{
+			Name:            strings.TrimSpace(req.Name),
+			SetCode:         req.SetCode,
+			CollectorNumber: req.CollectorNumber,
+		})
+		if err != nil {
+			return nil, err
+		}
+		card := candidates[0].Card
+		item.Name = card.Name
+		if req.SetCode != "" {
+			item.CardID, item.Card = card.ID, card
+		}
+	default:
+		return nil, fmt.Errorf("%w: card_id, name or set_code is required", ErrInvalidWishlistItem)
+	}
+
+	if err := s.db.CreateWishlistItem(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// GetWishlist retrieves the user's wishlist, outstanding items first
+func (s *Service) GetWishlist(userID string) ([]models.WishlistItem, error) {
+	return s.db.GetUserWishlist(userID)
+}
+
+// UpdateWishlistItem changes the given fields of one of the user's wishlist
+// items. An empty minimum condition accepts any condition.
+func (s *Service) UpdateWishlistItem(userID string, id int64, req *models.WishlistUpdateRequest) (*models.WishlistItem, error) {
+	item, err := s.getWishlistItem(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Quantity != nil {
+		if *req.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidQuantity)
+		}
+		item.Quantity = *req.Quantity
+	}
+	if req.Acquired != nil {
+		if *req.Acquired < 0 {
+			return nil, fmt.Errorf("%w: acquired cannot be negative", ErrInvalidQuantity)
+		}
+		item.Acquired = *req.Acquired
+	}
+	if req.MaxPrice != nil {
+		if *req.MaxPrice < 0 {
+			return nil, fmt.Errorf("%w: max price cannot be negative", ErrInvalidWishlistItem)
+		}
+		item.MaxPrice = req.MaxPrice
+	}
+	if req.MinCondition != nil {
+		if item.MinCondition, err = normalizeMinCondition(*req.MinCondition); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.db.UpdateWishlistItem(item); err != nil {
+		return nil, err
+	}
+	item.Fulfilled = item.Acquired >= item.Quantity
+	return item, nil
+}
+
+// DeleteWishlistItem removes an item from the user's wishlist
+func (s *Service) DeleteWishlistItem(userID string, id int64) error {
+	if _, err := s.getWishlistItem(userID, id); err != nil {
+		return err
+	}
+	return s.db.DeleteWishlistItem(id)
+}
+
+// getWishlistItem retrieves a wishlist item, checking it belongs to the user
+func (s *Service) getWishlistItem(userID string, id int64) (*models.WishlistItem, error) {
+	item, err := s.db.GetWishlistItem(id)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.UserID != userID {
+		return nil, ErrWishlistItemNotFound
+	}
+	return item, nil
+}
+
+// tickOffWishlist counts a copy just added to inventory towards the user's
+// wishlist, returning the item it went to, if any. The wishlist is secondary
+// to the scan, so failures are not reported.
+func (s *Service) tickOffWishlist(userID string, card *models.Card, attrs models.CopyAttributes) *models.WishlistItem {
+	item, _ := s.db.TickOffWishlist(userID, card.ID, card.Name, satisfiedMinimums(attrs.Condition))
+	return item
+}
+
+// SetTradeQuantity offers copies of one of the user's inventory entries for trade
+func (s *Service) SetTradeQuantity(userID string, inventoryID int, req *models.TradeListRequest) (*models.TradeListItem, error) {
+	if req.Quantity <= 0 {
+		return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidQuantity)
+	}
+	return s.db.SetTradeQuantity(userID, inventoryID, req.Quantity)
+}
+
+// GetTradeList retrieves the inventory entries the user offers for trade
+func (s *Service) GetTradeList(userID string) ([]models.TradeListItem, error) {
+	return s.db.GetUserTradeList(userID)
+}
+
+// RemoveFromTradeList withdraws an inventory entry from the user's trade list
+func (s *Service) RemoveFromTradeList(userID string, inventoryID int) error {
+	removed, err := s.db.RemoveFromTradeList(userID, inventoryID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrNotOnTradeList
+	}
+	return nil
+}
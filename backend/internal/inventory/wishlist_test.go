@@ -0,0 +1,135 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+func TestWishlistTickOff(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	anyBolt, err := service.AddToWishlist(userID, &models.WishlistRequest{Name: "Lightning Bolt", Quantity: 2, MinCondition: "lp"})
+	if err != nil {
+		t.Fatalf("Failed to add to wishlist: %v", err)
+	}
+	if anyBolt.CardID != "" || anyBolt.MinCondition != models.ConditionLightlyPlayed || anyBolt.Currency != models.CurrencyUSD {
+		t.Errorf("Unexpected any-printing item %+v", anyBolt)
+	}
+	m10Bolt, err := service.AddToWishlist(userID, &models.WishlistRequest{SetCode: "m10", CollectorNumber: "146"})
+	if err != nil {
+		t.Fatalf("Failed to add to wishlist: %v", err)
+	}
+	if m10Bolt.CardID != "bolt-m10" || m10Bolt.Quantity != 1 {
+		t.Errorf("Unexpected pinned item %+v", m10Bolt)
+	}
+
+	// The scan ticks off the item wanting its exact printing first
+	result, err := service.ProcessSingleScan(userID, &models.ScanRequest{SetCode: "M10", CollectorNumber: "146"})
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if result.Wishlist == nil || result.Wishlist.ID != m10Bolt.ID || !result.Wishlist.Fulfilled {
+		t.Fatalf("Expected pinned item to be fulfilled, got %+v", result.Wishlist)
+	}
+
+	// Played copies don't meet the minimum condition
+	bulk, err := service.ProcessBulkScan(userID, &models.BulkScanRequest{
+		Scans: []models.ScanRequest{
+			{SetCode: "2XM", CollectorNumber: "129", CopyAttributes: models.CopyAttributes{Condition: "MP"}},
+			{SetCode: "M10", CollectorNumber: "146"},
+			{SetCode: "2XM", CollectorNumber: "129"},
+			{SetCode: "2XM", CollectorNumber: "129"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to bulk scan: %v", err)
+	}
+	if bulk.Results[0].Wishlist != nil {
+		t.Errorf("Expected MP copy not to tick off the wishlist, got %+v", bulk.Results[0].Wishlist)
+	}
+	if w := bulk.Results[1].Wishlist; w == nil || w.ID != anyBolt.ID || w.Acquired != 1 {
+		t.Errorf("Expected any-printing item to be ticked off, got %+v", w)
+	}
+	if w := bulk.Results[2].Wishlist; w == nil || !w.Fulfilled {
+		t.Errorf("Expected any-printing item to be fulfilled, got %+v", w)
+	}
+	if bulk.Results[3].Wishlist != nil {
+		t.Errorf("Expected fulfilled items not to be ticked off, got %+v", bulk.Results[3].Wishlist)
+	}
+
+	wishlist, err := service.GetWishlist(userID)
+	if err != nil {
+		t.Fatalf("Failed to get wishlist: %v", err)
+	}
+	if len(wishlist) != 2 || !wishlist[0].Fulfilled || !wishlist[1].Fulfilled {
+		t.Errorf("Unexpected wishlist %+v", wishlist)
+	}
+
+	quantity := 3
+	updated, err := service.UpdateWishlistItem(userID, anyBolt.ID, &models.WishlistUpdateRequest{Quantity: &quantity})
+	if err != nil {
+		t.Fatalf("Failed to update wishlist item: %v", err)
+	}
+	if updated.Fulfilled || updated.Acquired != 2 {
+		t.Errorf("Expected raised quantity to reopen the item, got %+v", updated)
+	}
+
+	if _, err := service.AddToWishlist(userID, &models.WishlistRequest{Name: "Counterspell", MinCondition: "mint-ish"}); !errors.Is(err, ErrInvalidWishlistItem) {
+		t.Errorf("Expected invalid wishlist item error, got %v", err)
+	}
+	if err := service.DeleteWishlistItem("someone-else", anyBolt.ID); !errors.Is(err, ErrWishlistItemNotFound) {
+		t.Errorf("Expected wishlist item not found error, got %v", err)
+	}
+	if err := service.DeleteWishlistItem(userID, anyBolt.ID); err != nil {
+		t.Errorf("Failed to delete wishlist item: %v", err)
+	}
+}
+
+func TestTradeList(t *testing.T) {
+	service, db, userID := setupTestService(t)
+	defer db.Close()
+
+	item, err := service.AddCard(userID, "counterspell", &models.InventoryAddRequest{Quantity: 3})
+	if err != nil {
+		t.Fatalf("Failed to add card: %v", err)
+	}
+
+	if _, err := service.SetTradeQuantity(userID, item.ID, &models.TradeListRequest{Quantity: 4}); !errors.Is(err, database.ErrNotEnoughCopies) {
+		t.Errorf("Expected not enough copies error, got %v", err)
+	}
+	if _, err := service.SetTradeQuantity("someone-else", item.ID, &models.TradeListRequest{Quantity: 1}); !errors.Is(err, database.ErrNotInInventory) {
+		t.Errorf("Expected not in inventory error, got %v", err)
+	}
+
+	offered, err := service.SetTradeQuantity(userID, item.ID, &models.TradeListRequest{Quantity: 2})
+	if err != nil {
+		t.Fatalf("Failed to set trade quantity: %v", err)
+	}
+	if offered.TradeQuantity != 2 || offered.Quantity != 3 || offered.Card.Name != "Counterspell" {
+		t.Errorf("Unexpected trade list item %+v", offered)
+	}
+
+	// Copies leaving inventory cap the offer
+	if _, err := service.RemoveCard(userID, "counterspell", models.CopyAttributes{}, 2); err != nil {
+		t.Fatalf("Failed to remove card: %v", err)
+	}
+	tradeList, err := service.GetTradeList(userID)
+	if err != nil {
+		t.Fatalf("Failed to get trade list: %v", err)
+	}
+	if len(tradeList) != 1 || tradeList[0].TradeQuantity != 1 {
+		t.Errorf("Expected one copy offered, got %+v", tradeList)
+	}
+
+	// Removing the last copy drops the entry from the trade list
+	if _, err := service.RemoveCard(userID, "counterspell", models.CopyAttributes{}, 0); err != nil {
+		t.Fatalf("Failed to remove card: %v", err)
+	}
+	if err := service.RemoveFromTradeList(userID, item.ID); !errors.Is(err, ErrNotOnTradeList) {
+		t.Errorf("Expected not on trade list error, got %v", err)
+	}
+}
@@ -12,27 +12,620 @@ type User struct {
 
 // Card represents a Magic: The Gathering card
 type Card struct {
-	ID              string    `json:"id"`
-	ScryfallID      string    `json:"scryfall_id,omitempty"`
-	Name            string    `json:"name"`
-	SetCode         string    `json:"set_code"`
-	CollectorNumber string    `json:"collector_number"`
-	ImageURI        string    `json:"image_uri,omitempty"`
-	OracleText      string    `json:"oracle_text,omitempty"`
-	TypeLine        string    `json:"type_line,omitempty"`
-	ManaCost        string    `json:"mana_cost,omitempty"`
-	Rarity          string    `json:"rarity,omitempty"`
-	CreatedAt       time.Time `json:"created_at"`
-}
-
-// InventoryItem represents a card in a user's inventory
+	ID              string     `json:"id"`
+	ScryfallID      string     `json:"scryfall_id,omitempty"`
+	Name            string     `json:"name"`
+	SetCode         string     `json:"set_code"`
+	CollectorNumber string     `json:"collector_number"`
+	ImageURI        string     `json:"image_uri,omitempty"`
+	OracleText      string     `json:"oracle_text,omitempty"`
+	TypeLine        string     `json:"type_line,omitempty"`
+	ManaCost        string     `json:"mana_cost,omitempty"`
+	Rarity          string     `json:"rarity,omitempty"`
+	ReleasedAt      string     `json:"released_at,omitempty"` // YYYY-MM-DD
+	Colors          string     `json:"colors"`                // WUBRG letters, empty for colorless
+	ColorIdentity   string     `json:"color_identity"`        // WUBRG letters
+	CMC             float64    `json:"cmc"`
+	Legalities      Legalities `json:"legalities,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	// Prices is only loaded by the card details endpoint and catalog imports;
+	// nil means unknown rather than unpriced
+	Prices []CardPrice `json:"prices,omitempty"`
+}
+
+// Legalities maps format names ("modern", "commander", ...) to a card's
+// legality in them
+type Legalities map[string]string
+
+// Card legalities, as reported by Scryfall
+const (
+	Legal      = "legal"
+	NotLegal   = "not_legal"
+	Restricted = "restricted"
+	Banned     = "banned"
+)
+
+// Price currencies
+const (
+	CurrencyUSD = "usd"
+	CurrencyEUR = "eur"
+)
+
+// CardPrice is a printing's latest market price in one currency and finish
+type CardPrice struct {
+	Currency  string    `json:"currency"`
+	Finish    string    `json:"finish"`
+	Price     float64   `json:"price"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// InventoryValue is the market value of a user's inventory in one currency.
+// Copies are valued at the price of their finish; copies without one are
+// counted as unpriced.
+type InventoryValue struct {
+	Currency      string       `json:"currency"`
+	Total         float64      `json:"total"`
+	PricedCards   int          `json:"priced_cards"`
+	UnpricedCards int          `json:"unpriced_cards"`
+	PricesUpdated *time.Time   `json:"prices_updated,omitempty"`
+	TopCards      []ValuedItem `json:"top_cards"`
+}
+
+// ValuePoint is a user's inventory value on one day
+type ValuePoint struct {
+	Date          string  `json:"date"` // YYYY-MM-DD
+	Total         float64 `json:"total"`
+	PricedCards   int     `json:"priced_cards"`
+	UnpricedCards int     `json:"unpriced_cards"`
+}
+
+// ValueMover is an inventory entry whose price changed between two snapshots
+type ValueMover struct {
+	InventoryItem
+	FromPrice     float64 `json:"from_price"`
+	ToPrice       float64 `json:"to_price"`
+	Change        float64 `json:"change"`         // value change of all copies
+	ChangePercent float64 `json:"change_percent"` // unit price change
+}
+
+// ValueHistory is a user's daily inventory value between two dates, with the
+// entries whose value changed most between the first and last snapshot
+type ValueHistory struct {
+	Currency string       `json:"currency"`
+	From     string       `json:"from"`
+	To       string       `json:"to"`
+	Points   []ValuePoint `json:"points"`
+	Movers   []ValueMover `json:"movers"`
+}
+
+// SnapshotResult summarizes a daily value snapshot
+type SnapshotResult struct {
+	Date   string `json:"date"`
+	Users  int    `json:"users"`
+	Prices int    `json:"prices"`
+}
+
+// ValuedItem is an inventory entry with the market value of its copies
+type ValuedItem struct {
+	InventoryItem
+	UnitPrice float64 `json:"unit_price"`
+	Value     float64 `json:"value"`
+}
+
+// InventoryItem represents copies of a card in a user's inventory. Copies of
+// the same printing with different attributes are separate items.
 type InventoryItem struct {
-	ID       int       `json:"id"`
-	UserID   string    `json:"user_id"`
-	CardID   string    `json:"card_id"`
-	Quantity int       `json:"quantity"`
-	AddedAt  time.Time `json:"added_at"`
-	Card     *Card     `json:"card,omitempty"`
+	ID       int    `json:"id"`
+	UserID   string `json:"user_id"`
+	CardID   string `json:"card_id"`
+	Quantity int    `json:"quantity"`
+	CopyAttributes
+	AddedAt   time.Time   `json:"added_at"`
+	Card      *Card       `json:"card,omitempty"`
+	Locations []Placement `json:"locations,omitempty"` // copies not listed here are unplaced
+}
+
+// Location kinds
+const (
+	LocationBinder  = "binder"
+	LocationBox     = "box"
+	LocationDeckBox = "deck_box"
+)
+
+// Location represents a binder, box or deck box a user stores cards in
+type Location struct {
+	ID        int64     `json:"id"`
+	UserID    string    `json:"user_id"`
+	ParentID  *int64    `json:"parent_id,omitempty"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LocationRequest creates a location, optionally inside another one
+type LocationRequest struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	ParentID *int64 `json:"parent_id,omitempty"`
+}
+
+// Placement is a number of copies of an inventory entry stored at a location,
+// optionally at a binder page and slot
+type Placement struct {
+	LocationID int64 `json:"location_id"`
+	Quantity   int   `json:"quantity"`
+	Page       int   `json:"page,omitempty"`
+	Slot       int   `json:"slot,omitempty"`
+}
+
+// LocationItem is an inventory entry placed at a location
+type LocationItem struct {
+	Placement
+	Item *InventoryItem `json:"item"`
+}
+
+// LocationContents lists a location's nested locations and the cards stored in it
+type LocationContents struct {
+	Location *Location      `json:"location"`
+	Children []Location     `json:"children"`
+	Items    []LocationItem `json:"items"`
+}
+
+// MoveRequest moves copies of an inventory entry between locations. A nil
+// location means the entry's unplaced copies.
+type MoveRequest struct {
+	InventoryID    int    `json:"inventory_id"`
+	FromLocationID *int64 `json:"from_location_id,omitempty"`
+	ToLocationID   *int64 `json:"to_location_id,omitempty"`
+	Quantity       int    `json:"quantity"`
+	Page           int    `json:"page,omitempty"`
+	Slot           int    `json:"slot,omitempty"`
+}
+
+// CurrentLocationRequest sets where a user's scans land; nil clears it
+type CurrentLocationRequest struct {
+	LocationID *int64 `json:"location_id"`
+}
+
+// InventoryQuery filters, sorts and pages a user's inventory. Empty filters match everything.
+type InventoryQuery struct {
+	Name        string     // substring of the card name
+	SetCode     string     // exact set code
+	Rarity      string     // exact rarity
+	TypeLine    string     // substring of the type line
+	Colors      string     // WUBRG letters the card's colors must all include, or "C" for colorless
+	AddedAfter  *time.Time // inclusive
+	AddedBefore *time.Time // exclusive
+	LocationID  int64      // entries with copies stored at the location
+	Sort        string     // "name", "set", "quantity", "value" or "added_at" (default)
+	Currency    string     // currency of the "value" sort, USD by default
+	Descending  bool
+	Limit       int
+	Cursor      string // NextCursor of the previous page
+}
+
+// InventoryPage is a page of a user's inventory, with totals over every
+// entry matching the query
+type InventoryPage struct {
+	Items        []InventoryItem `json:"inventory"`
+	Count        int             `json:"count"`
+	TotalEntries int             `json:"total_entries"`
+	TotalCards   int             `json:"total_cards"`
+	NextCursor   string          `json:"next_cursor,omitempty"`
+}
+
+// InventoryStats summarizes a user's inventory
+type InventoryStats struct {
+	TotalCards      int          `json:"total_cards"`
+	UniqueCards     int          `json:"unique_cards"` // distinct printings
+	UniqueNames     int          `json:"unique_names"`
+	LastUpdated     *time.Time   `json:"last_updated,omitempty"`
+	BySet           []StatBucket `json:"by_set"`
+	ByRarity        []StatBucket `json:"by_rarity"`
+	ByColorIdentity []StatBucket `json:"by_color_identity"` // "C" for colorless
+	ByType          []StatBucket `json:"by_type"`           // cards count toward each of their types
+	ByManaValue     []StatBucket `json:"by_mana_value"`     // nonland cards, "7+" for 7 and above
+}
+
+// StatBucket counts the cards in one group of an inventory breakdown
+type StatBucket struct {
+	Key         string `json:"key"`
+	Cards       int    `json:"cards"`
+	UniqueCards int    `json:"unique_cards"`
+}
+
+// Deck sections
+const (
+	DeckMainboard = "mainboard"
+	DeckSideboard = "sideboard"
+	DeckCommander = "commander"
+)
+
+// Deck is a user's decklist
+type Deck struct {
+	ID        int64      `json:"id"`
+	UserID    string     `json:"user_id"`
+	Name      string     `json:"name"`
+	Format    string     `json:"format,omitempty"`
+	CardCount int        `json:"card_count"`
+	Cards     []DeckCard `json:"cards,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// DeckCard is a line of a decklist. Lines naming a set are pinned to that
+// printing by CardID; others accept any printing of the card.
+type DeckCard struct {
+	Section  string `json:"section"`
+	Name     string `json:"name"`
+	CardID   string `json:"card_id,omitempty"`
+	Card     *Card  `json:"card,omitempty"`
+	Quantity int    `json:"quantity"`
+}
+
+// DeckRequest creates a deck from a plain-text decklist, structured card
+// lines, or both
+type DeckRequest struct {
+	Name     string            `json:"name"`
+	Format   string            `json:"format,omitempty"`
+	Decklist string            `json:"decklist,omitempty"`
+	Cards    []DeckCardRequest `json:"cards,omitempty"`
+}
+
+// DeckCardRequest is a decklist line to resolve against the catalog
+type DeckCardRequest struct {
+	Section         string `json:"section,omitempty"` // mainboard by default
+	Name            string `json:"name"`
+	SetCode         string `json:"set_code,omitempty"`
+	CollectorNumber string `json:"collector_number,omitempty"`
+	Quantity        int    `json:"quantity"`
+}
+
+// DeckLineError reports a decklist line that couldn't be parsed or resolved
+type DeckLineError struct {
+	Line  int    `json:"line"`
+	Text  string `json:"text"`
+	Error string `json:"error"`
+}
+
+// DeckImportResponse is a created deck and the lines left out of it
+type DeckImportResponse struct {
+	Deck   *Deck           `json:"deck"`
+	Errors []DeckLineError `json:"errors,omitempty"`
+}
+
+// DeckReport compares a deck against its owner's inventory
+type DeckReport struct {
+	DeckID            int64            `json:"deck_id"`
+	Name              string           `json:"name"`
+	Complete          bool             `json:"complete"`
+	Owned             int              `json:"owned"`
+	DifferentPrinting int              `json:"different_printing"`
+	Missing           int              `json:"missing"`
+	Cards             []DeckCardReport `json:"cards"`
+}
+
+// DeckCardReport says how many copies of a deck line the owner holds. Owned
+// copies match the line; DifferentPrinting copies are other printings of a
+// line pinned to one printing. Each held copy counts toward one line only.
+type DeckCardReport struct {
+	DeckCard
+	Owned             int `json:"owned"`
+	DifferentPrinting int `json:"different_printing"`
+	Missing           int `json:"missing"`
+}
+
+// Deck validation rules
+const (
+	RuleDeckSize      = "deck_size"
+	RuleSideboardSize = "sideboard_size"
+	RuleCopies        = "copies"
+	RuleBanned        = "banned"
+	RuleRestricted    = "restricted"
+	RuleNotLegal      = "not_legal"
+	RuleCommander     = "commander"
+	RuleColorIdentity = "color_identity"
+	RuleUnknown       = "unknown_legality"
+)
+
+// DeckViolation is a format rule a deck breaks, with the offending card
+// unless the rule concerns the whole deck
+type DeckViolation struct {
+	Rule    string `json:"rule"`
+	Card    string `json:"card,omitempty"`
+	Message string `json:"message"`
+}
+
+// DeckValidation is the result of checking a deck against a format's rules.
+// Warnings don't make a deck illegal; they flag cards whose legality is
+// unknown because the catalog has no legality data for them.
+type DeckValidation struct {
+	DeckID     int64           `json:"deck_id"`
+	Format     string          `json:"format"`
+	Legal      bool            `json:"legal"`
+	Violations []DeckViolation `json:"violations"`
+	Warnings   []DeckViolation `json:"warnings,omitempty"`
+}
+
+// WishlistItem is a card a user wants. Items naming a printing by CardID
+// want that printing; others want any printing of the card.
+type WishlistItem struct {
+	ID           int64     `json:"id"`
+	UserID       string    `json:"user_id"`
+	Name         string    `json:"name"`
+	CardID       string    `json:"card_id,omitempty"`
+	Card         *Card     `json:"card,omitempty"`
+	Quantity     int       `json:"quantity"`
+	Acquired     int       `json:"acquired"`
+	Fulfilled    bool      `json:"fulfilled"`
+	MaxPrice     *float64  `json:"max_price,omitempty"`
+	Currency     string    `json:"currency"`
+	MinCondition string    `json:"min_condition,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// WishlistRequest adds a wanted card by card ID, by set and collector
+// number, or by name for any printing
+type WishlistRequest struct {
+	CardID          string   `json:"card_id,omitempty"`
+	Name            string   `json:"name,omitempty"`
+	SetCode         string   `json:"set_code,omitempty"`
+	CollectorNumber string   `json:"collector_number,omitempty"`
+	Quantity        int      `json:"quantity"`
+	MaxPrice        *float64 `json:"max_price,omitempty"`
+	Currency        string   `json:"currency,omitempty"`
+	MinCondition    string   `json:"min_condition,omitempty"`
+}
+
+// WishlistUpdateRequest changes a wishlist item; omitted fields are kept
+type WishlistUpdateRequest struct {
+	Quantity     *int     `json:"quantity,omitempty"`
+	Acquired     *int     `json:"acquired,omitempty"`
+	MaxPrice     *float64 `json:"max_price,omitempty"`
+	MinCondition *string  `json:"min_condition,omitempty"`
+}
+
+// TradeListItem is an inventory entry offered for trade
+type TradeListItem struct {
+	InventoryItem
+	TradeQuantity int `json:"trade_quantity"`
+}
+
+// TradeListRequest sets how many copies of an inventory entry are offered
+type TradeListRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+// TradePartner is a user someone has agreed to trade with. Trades can only
+// be matched and proposed between mutual partners.
+type TradePartner struct {
+	UserID    string    `json:"user_id"`
+	Mutual    bool      `json:"mutual"` // the partner has agreed too
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Trade statuses
+const (
+	TradeProposed  = "proposed"
+	TradeAccepted  = "accepted"
+	TradeDeclined  = "declined"
+	TradeCancelled = "cancelled"
+)
+
+// TradeItem is copies of an inventory entry changing hands in a trade
+type TradeItem struct {
+	InventoryID int    `json:"inventory_id"`
+	CardID      string `json:"card_id"`
+	Card        *Card  `json:"card,omitempty"`
+	CopyAttributes
+	Quantity  int      `json:"quantity"`
+	UnitPrice *float64 `json:"unit_price"` // nil when the card has no price for its finish
+}
+
+// Trade is a proposed exchange of copies between two users. Give and
+// Receive are from the proposer's side.
+type Trade struct {
+	ID           int64       `json:"id"`
+	ProposerID   string      `json:"proposer_id"`
+	PartnerID    string      `json:"partner_id"`
+	Status       string      `json:"status"`
+	Currency     string      `json:"currency"`
+	Give         []TradeItem `json:"give"`
+	Receive      []TradeItem `json:"receive"`
+	GiveValue    float64     `json:"give_value"`
+	ReceiveValue float64     `json:"receive_value"`
+	CreatedAt    time.Time   `json:"created_at"`
+	ResolvedAt   *time.Time  `json:"resolved_at,omitempty"`
+}
+
+// TradeItemRequest names copies of a trade list entry
+type TradeItemRequest struct {
+	InventoryID int `json:"inventory_id"`
+	Quantity    int `json:"quantity"`
+}
+
+// TradeRequest proposes a trade with a partner: the proposer's copies to
+// give and the partner's to receive, all from their trade lists
+type TradeRequest struct {
+	PartnerID string             `json:"partner_id"`
+	Currency  string             `json:"currency,omitempty"`
+	Give      []TradeItemRequest `json:"give"`
+	Receive   []TradeItemRequest `json:"receive"`
+}
+
+// TradeMatchItem is copies one user offers that match an item on the other's wishlist
+type TradeMatchItem struct {
+	TradeItem
+	WishlistID int64   `json:"wishlist_id"`
+	Value      float64 `json:"value"`
+}
+
+// TradeMatch intersects each user's wishlist with the other's trade list.
+// Give and Receive are from the requesting user's side.
+type TradeMatch struct {
+	PartnerID    string           `json:"partner_id"`
+	Currency     string           `json:"currency"`
+	Give         []TradeMatchItem `json:"give"`
+	Receive      []TradeMatchItem `json:"receive"`
+	GiveValue    float64          `json:"give_value"`
+	ReceiveValue float64          `json:"receive_value"`
+	Proposal     *TradeProposal   `json:"proposal,omitempty"`
+}
+
+// TradeProposal is a balanced selection of matched copies, ready to be
+// proposed as is
+type TradeProposal struct {
+	TradeRequest
+	GiveValue    float64 `json:"give_value"`
+	ReceiveValue float64 `json:"receive_value"`
+}
+
+// InventoryAddRequest adds copies of a card to inventory without scanning
+type InventoryAddRequest struct {
+	Quantity int `json:"quantity,omitempty"` // defaults to 1
+	CopyAttributes
+	LocationID *int64 `json:"location_id,omitempty"`
+}
+
+// InventoryUpdateRequest sets an inventory entry's quantity or adjusts it by
+// a delta; exactly one of the two is given
+type InventoryUpdateRequest struct {
+	Quantity *int `json:"quantity,omitempty"`
+	Delta    *int `json:"delta,omitempty"`
+}
+
+// Inventory ledger sources
+const (
+	LedgerScan    = "scan"
+	LedgerImport  = "import"
+	LedgerManual  = "manual"
+	LedgerTrade   = "trade"
+	LedgerUndo    = "undo"
+	LedgerInitial = "initial" // quantities held before the ledger existed
+)
+
+// LedgerSource says what caused an inventory change
+type LedgerSource struct {
+	Source    string `json:"source"`
+	SessionID int    `json:"session_id,omitempty"` // scan session of a scan
+	ScanID    int64  `json:"scan_id,omitempty"`    // scan that added the copy
+	TradeID   int64  `json:"trade_id,omitempty"`
+	RevertsID int64  `json:"reverts_id,omitempty"` // entry an undo reverses
+}
+
+// LedgerEntry is one change to the quantity of a user's copies
+type LedgerEntry struct {
+	ID     int64  `json:"id"`
+	UserID string `json:"user_id"`
+	CardID string `json:"card_id"`
+	Card   *Card  `json:"card,omitempty"`
+	CopyAttributes
+	Delta int `json:"delta"`
+	LedgerSource
+	RevertedBy int64     `json:"reverted_by,omitempty"` // undo entry that reversed this one
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// LedgerQuery filters and pages a user's ledger, newest entries first
+type LedgerQuery struct {
+	Source    string
+	SessionID int
+	CardID    string
+	Limit     int
+	Cursor    string
+}
+
+// LedgerPage is one page of ledger entries
+type LedgerPage struct {
+	Entries    []LedgerEntry `json:"entries"`
+	Count      int           `json:"count"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// UndoRequest reverses a single ledger entry or every change a scan session
+// made; exactly one of the two is given
+type UndoRequest struct {
+	EntryID   int64 `json:"entry_id,omitempty"`
+	SessionID int   `json:"session_id,omitempty"`
+}
+
+// UndoResponse lists the ledger entries recording the reversal
+type UndoResponse struct {
+	Entries []LedgerEntry `json:"entries"`
+	Count   int           `json:"count"`
+}
+
+// LedgerDiscrepancy is copies whose inventory quantity differs from the
+// quantity rebuilt from the ledger
+type LedgerDiscrepancy struct {
+	CardID string `json:"card_id"`
+	CopyAttributes
+	LedgerQuantity    int `json:"ledger_quantity"`
+	InventoryQuantity int `json:"inventory_quantity"`
+}
+
+// LedgerCheck compares a user's inventory with quantities rebuilt from the ledger
+type LedgerCheck struct {
+	Consistent    bool                `json:"consistent"`
+	Entries       int                 `json:"entries"`
+	Discrepancies []LedgerDiscrepancy `json:"discrepancies"`
+}
+
+// Import row statuses
+const (
+	ImportMatched   = "matched"
+	ImportAmbiguous = "ambiguous"
+	ImportFailed    = "failed"
+)
+
+// ImportRow reports how one CSV line of an inventory import resolved. Only
+// matched rows are added to inventory.
+type ImportRow struct {
+	Line       int             `json:"line"`
+	Status     string          `json:"status"`
+	Quantity   int             `json:"quantity"`
+	Name       string          `json:"name,omitempty"`
+	Card       *Card           `json:"card,omitempty"`
+	Candidates []CardCandidate `json:"candidates,omitempty"`
+	CopyAttributes
+	Error string `json:"error,omitempty"`
+}
+
+// ImportReport summarizes an inventory CSV import
+type ImportReport struct {
+	Format     string      `json:"format"`
+	DryRun     bool        `json:"dry_run"`
+	Matched    int         `json:"matched"`
+	Ambiguous  int         `json:"ambiguous"`
+	Failed     int         `json:"failed"`
+	CardsAdded int         `json:"cards_added"`
+	Rows       []ImportRow `json:"rows"`
+}
+
+// Card finishes
+const (
+	FinishNonfoil = "nonfoil"
+	FinishFoil    = "foil"
+	FinishEtched  = "etched"
+)
+
+// Card conditions, best to worst
+const (
+	ConditionNearMint         = "NM"
+	ConditionLightlyPlayed    = "LP"
+	ConditionModeratelyPlayed = "MP"
+	ConditionHeavilyPlayed    = "HP"
+	ConditionDamaged          = "DMG"
+)
+
+// CopyAttributes describe a physical copy of a printing. Empty finish,
+// condition and language default to nonfoil, NM and English.
+type CopyAttributes struct {
+	Finish    string `json:"finish,omitempty"`
+	Condition string `json:"condition,omitempty"`
+	Language  string `json:"language,omitempty"` // Scryfall language code, e.g. "en", "ja"
+	Signed    bool   `json:"signed,omitempty"`
+	Altered   bool   `json:"altered,omitempty"`
+	Misprint  bool   `json:"misprint,omitempty"`
 }
 
 // ScanSession represents a scanning session
@@ -47,24 +640,123 @@ type ScanSession struct {
 	CompletedAt     *time.Time `json:"completed_at,omitempty"`
 }
 
+// Scan session types. Single and bulk sessions are opened and completed by
+// one request; explicit sessions stay open for scans until completed.
+const (
+	ScanTypeSingle  = "single"
+	ScanTypeBulk    = "bulk"
+	ScanTypeSession = "session"
+)
+
+// SessionCard is copies of a card a scan session added to inventory, net of
+// undone scans
+type SessionCard struct {
+	CardID string `json:"card_id"`
+	Card   *Card  `json:"card"`
+	CopyAttributes
+	Quantity int `json:"quantity"`
+}
+
 // ScanRequest represents a card scan request
 type ScanRequest struct {
 	CardName        string `json:"card_name,omitempty"`
 	SetCode         string `json:"set_code,omitempty"`
 	CollectorNumber string `json:"collector_number,omitempty"`
 	Barcode         string `json:"barcode,omitempty"`
+	Image           []byte `json:"image,omitempty"`          // base64-encoded JPEG/PNG photo
+	TypeLine        string `json:"type_line,omitempty"`      // OCR hint for fuzzy name matching
+	SessionID       int    `json:"session_id,omitempty"`     // open scan session to record the scan in
+	ClientScanID    string `json:"client_scan_id,omitempty"` // idempotency key; repeats return the first response
+	CopyAttributes
 }
 
-// BulkScanRequest represents multiple card scans
+// BulkScanRequest represents multiple card scans. Defaults apply to every
+// scan that doesn't set the attribute itself.
 type BulkScanRequest struct {
-	Scans []ScanRequest `json:"scans"`
+	Scans          []ScanRequest  `json:"scans"`
+	Defaults       CopyAttributes `json:"defaults,omitempty"`
+	SessionID      int            `json:"session_id,omitempty"` // open scan session to record the scans in
+	Atomic         bool           `json:"atomic,omitempty"`     // roll back every scan if any fails
+	IdempotencyKey string         `json:"-"`                    // from the Idempotency-Key header
 }
 
-// ScanResponse represents the result of a scan
+// Scan statuses
+const (
+	ScanStatusCommitted = "committed"
+	ScanStatusPending   = "pending"
+	ScanStatusFailed    = "failed"
+	ScanStatusUndone    = "undone" // committed, then taken back by an undo
+)
+
+// ScanResponse represents the result of a scan. Ambiguous scans are not
+// committed: they have status "pending" and list candidate printings to
+// confirm with POST /api/v1/cards/scan/{scan_id}/confirm.
 type ScanResponse struct {
-	Success bool   `json:"success"`
-	Card    *Card  `json:"card,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Success    bool            `json:"success"`
+	ScanID     int64           `json:"scan_id,omitempty"`
+	SessionID  int             `json:"session_id,omitempty"`
+	Status     string          `json:"status,omitempty"`
+	Card       *Card           `json:"card,omitempty"`
+	LocationID int64           `json:"location_id,omitempty"`
+	Product    *SealedProduct  `json:"product,omitempty"`
+	Candidates []CardCandidate `json:"candidates,omitempty"`
+	Wishlist   *WishlistItem   `json:"wishlist,omitempty"` // item the scanned card ticked off
+	Error      string          `json:"error,omitempty"`
+}
+
+// Scan represents an individual scan and its outcome
+type Scan struct {
+	ID         int64           `json:"id"`
+	UserID     string          `json:"user_id"`
+	SessionID  int             `json:"session_id,omitempty"`
+	Status     string          `json:"status"`
+	CardID     string          `json:"card_id,omitempty"`
+	LocationID int64           `json:"location_id,omitempty"`
+	Request    *ScanRequest    `json:"request,omitempty"`
+	Candidates []ScanCandidate `json:"candidates,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ResolvedAt *time.Time      `json:"resolved_at,omitempty"`
+}
+
+// ScanCandidate is a candidate printing recorded with a pending scan
+type ScanCandidate struct {
+	CardID     string  `json:"card_id"`
+	Confidence float64 `json:"confidence"`
+}
+
+// ConfirmScanRequest picks the printing for a pending scan
+type ConfirmScanRequest struct {
+	CardID string `json:"card_id"`
+}
+
+// SealedProduct represents sealed product identified by a barcode scan.
+// Sealed product is reported back to the client but not added to inventory.
+type SealedProduct struct {
+	Barcode string `json:"barcode"`
+	Name    string `json:"name"`
+}
+
+// Barcode represents a mapping from a barcode or platform identifier to a card or sealed product
+type Barcode struct {
+	Code        string    `json:"barcode"`
+	Kind        string    `json:"kind"`
+	CardID      string    `json:"card_id,omitempty"`
+	ProductName string    `json:"product_name,omitempty"`
+	AddedBy     string    `json:"added_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	Card        *Card     `json:"card,omitempty"`
+}
+
+// BarcodeRequest teaches the server a new barcode mapping. The target is
+// either a card (by ID or set and collector number) or a sealed product name.
+type BarcodeRequest struct {
+	Barcode         string `json:"barcode"`
+	Kind            string `json:"kind,omitempty"`
+	CardID          string `json:"card_id,omitempty"`
+	SetCode         string `json:"set_code,omitempty"`
+	CollectorNumber string `json:"collector_number,omitempty"`
+	ProductName     string `json:"product_name,omitempty"`
 }
 
 // BulkScanResponse represents results of bulk scanning
@@ -73,9 +765,92 @@ type BulkScanResponse struct {
 	TotalScanned    int            `json:"total_scanned"`
 	SuccessfulScans int            `json:"successful_scans"`
 	FailedScans     int            `json:"failed_scans"`
+	PendingScans    int            `json:"pending_scans"`
 	Results         []ScanResponse `json:"results"`
 }
 
+// Scan job statuses
+const (
+	ScanJobQueued    = "queued"
+	ScanJobRunning   = "running"
+	ScanJobCompleted = "completed"
+	ScanJobFailed    = "failed"
+)
+
+// ScanJob is a bulk scan processed in the background. Results holds the
+// outcome of each scan processed so far; CompletedAt is set once the job has
+// completed or failed.
+type ScanJob struct {
+	ID              int64            `json:"id"`
+	UserID          string           `json:"user_id"`
+	SessionID       int              `json:"session_id"`
+	Status          string           `json:"status"`
+	Total           int              `json:"total"`
+	Processed       int              `json:"processed"`
+	SuccessfulScans int              `json:"successful_scans"`
+	FailedScans     int              `json:"failed_scans"`
+	PendingScans    int              `json:"pending_scans"`
+	Error           string           `json:"error,omitempty"`
+	Request         *BulkScanRequest `json:"-"`
+	Results         []ScanJobResult  `json:"results,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+	StartedAt       *time.Time       `json:"started_at,omitempty"`
+	CompletedAt     *time.Time       `json:"completed_at,omitempty"`
+}
+
+// ScanJobResult is the outcome of the scan at a position of a job's request
+type ScanJobResult struct {
+	Position int `json:"position"`
+	ScanResponse
+}
+
+// IdempotencyKey is a client-supplied key and the response to the request
+// first made with it. Response is nil until that request stores it, in the
+// same transaction as the key is claimed.
+type IdempotencyKey struct {
+	UserID      string
+	Key         string
+	Fingerprint string
+	Response    []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// CardCandidate represents a card that may match a scan, with a confidence from 0 to 1
+type CardCandidate struct {
+	Card       *Card   `json:"card"`
+	Confidence float64 `json:"confidence"`
+}
+
+// CardImageHash represents the perceptual hashes of a card's artwork
+type CardImageHash struct {
+	CardID    string    `json:"card_id"`
+	PHash     uint64    `json:"phash"`
+	DHash     uint64    `json:"dhash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CardMatch represents a candidate card from image recognition
+type CardMatch struct {
+	Card     *Card `json:"card"`
+	Distance int   `json:"distance"`
+}
+
+// RecognizeResponse represents the result of an image recognition scan
+type RecognizeResponse struct {
+	ScanResponse
+	Distance     int         `json:"distance,omitempty"`
+	Alternatives []CardMatch `json:"alternatives,omitempty"`
+}
+
+// CatalogImportResult summarizes a Scryfall bulk data import
+type CatalogImportResult struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Skipped   int `json:"skipped"`
+}
+
 // AuthResponse represents authentication response
 type AuthResponse struct {
 	UserID string `json:"user_id"`
@@ -0,0 +1,179 @@
+package recognition
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// Artwork region of a card photo cropped to the card borders, expressed as
+// fractions of the card width and height
+const (
+	ArtworkLeft   = 0.08
+	ArtworkTop    = 0.11
+	ArtworkRight  = 0.92
+	ArtworkBottom = 0.55
+)
+
+// HashBits is the number of bits in each hash, and so the largest possible distance
+const HashBits = 64
+
+const (
+	phashSize   = 32
+	phashLowDim = 8
+)
+
+// CropArtwork returns the artwork region of a full card image
+func CropArtwork(img image.Image) image.Image {
+	b := img.Bounds()
+	rect := image.Rect(
+		b.Min.X+int(float64(b.Dx())*ArtworkLeft),
+		b.Min.Y+int(float64(b.Dy())*ArtworkTop),
+		b.Min.X+int(float64(b.Dx())*ArtworkRight),
+		b.Min.Y+int(float64(b.Dy())*ArtworkBottom),
+	)
+
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+	return &croppedImage{Image: img, rect: rect}
+}
+
+type croppedImage struct {
+	image.Image
+	rect image.Rectangle
+}
+
+func (c *croppedImage) Bounds() image.Rectangle {
+	return c.rect
+}
+
+// DHash computes a 64-bit difference hash of an image
+func DHash(img image.Image) uint64 {
+	pixels := grayscale(img, 9, 8)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if pixels[y*9+x] < pixels[y*9+x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// PHash computes a 64-bit DCT-based perceptual hash of an image
+func PHash(img image.Image) uint64 {
+	pixels := grayscale(img, phashSize, phashSize)
+	coeffs := dct2D(pixels, phashSize)
+
+	low := make([]float64, 0, phashLowDim*phashLowDim)
+	for y := 0; y < phashLowDim; y++ {
+		for x := 0; x < phashLowDim; x++ {
+			low = append(low, coeffs[y*phashSize+x])
+		}
+	}
+
+	sorted := append([]float64(nil), low...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for _, c := range low {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
+
+// Distance returns the Hamming distance between two hashes
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// grayscale downsamples an image to width x height luminance values by
+// averaging every source pixel into its destination cell
+func grayscale(img image.Image, width, height int) []float64 {
+	b := img.Bounds()
+	sums := make([]float64, width*height)
+	counts := make([]int, width*height)
+
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return sums
+	}
+
+	cell := func(x, y int) int {
+		cx := (x - b.Min.X) * width / b.Dx()
+		cy := (y - b.Min.Y) * height / b.Dy()
+		return cy*width + cx
+	}
+
+	// JPEG photos decode to YCbCr, so read the luma plane directly rather
+	// than going through the much slower generic color conversion
+	if ycc, ok := img.(*image.YCbCr); ok {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				i := cell(x, y)
+				sums[i] += float64(ycc.Y[ycc.YOffset(x, y)])
+				counts[i]++
+			}
+		}
+	} else {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, bl, _ := img.At(x, y).RGBA()
+				lum := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)) / 257
+				i := cell(x, y)
+				sums[i] += lum
+				counts[i]++
+			}
+		}
+	}
+
+	for i := range sums {
+		if counts[i] > 0 {
+			sums[i] /= float64(counts[i])
+		}
+	}
+	return sums
+}
+
+// dct2D computes the two-dimensional DCT-II of an n x n matrix
+func dct2D(pixels []float64, n int) []float64 {
+	cosines := make([]float64, n*n)
+	for k := 0; k < n; k++ {
+		for i := 0; i < n; i++ {
+			cosines[k*n+i] = math.Cos(math.Pi / float64(n) * (float64(i) + 0.5) * float64(k))
+		}
+	}
+
+	rows := make([]float64, n*n)
+	for y := 0; y < n; y++ {
+		for k := 0; k < n; k++ {
+			var sum float64
+			for x := 0; x < n; x++ {
+				sum += pixels[y*n+x] * cosines[k*n+x]
+			}
+			rows[y*n+k] = sum
+		}
+	}
+
+	out := make([]float64, n*n)
+	for x := 0; x < n; x++ {
+		for k := 0; k < n; k++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				sum += rows[y*n+x] * cosines[k*n+y]
+			}
+			out[k*n+x] = sum
+		}
+	}
+	return out
+}
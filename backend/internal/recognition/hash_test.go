@@ -0,0 +1,82 @@
+package recognition
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// testCard draws a synthetic card whose pattern depends only on the relative
+// position within the image, so it survives resizing
+func testCard(width, height int, seed float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			u := float64(x) / float64(width)
+			w := float64(y) / float64(height)
+			v := 127 + 40*math.Sin(u*(9+seed)+seed)*math.Cos(w*(7+2*seed)-seed) +
+				40*math.Sin((u+w)*(13+seed)) + 40*math.Cos(u*w*(17+3*seed))
+			img.Set(x, y, color.RGBA{R: uint8(v), G: uint8(v / 2), B: uint8(255 - v), A: 255})
+		}
+	}
+	return img
+}
+
+func brighten(src *image.RGBA, amount uint8) *image.RGBA {
+	dst := image.NewRGBA(src.Bounds())
+	for i, v := range src.Pix {
+		switch {
+		case i%4 == 3:
+			dst.Pix[i] = v
+		case int(v)+int(amount) > 255:
+			dst.Pix[i] = 255
+		default:
+			dst.Pix[i] = v + amount
+		}
+	}
+	return dst
+}
+
+func TestHashIdenticalImages(t *testing.T) {
+	img := testCard(488, 680, 0)
+
+	if d := Distance(PHash(img), PHash(img)); d != 0 {
+		t.Errorf("Expected pHash distance 0 for identical images, got %d", d)
+	}
+	if d := Distance(DHash(img), DHash(img)); d != 0 {
+		t.Errorf("Expected dHash distance 0 for identical images, got %d", d)
+	}
+}
+
+func TestHashToleratesResizeAndBrightness(t *testing.T) {
+	original := CropArtwork(testCard(488, 680, 0))
+	resized := CropArtwork(testCard(244, 340, 0))
+	brighter := CropArtwork(brighten(testCard(488, 680, 0), 20))
+
+	if d := Distance(PHash(original), PHash(resized)); d > 10 {
+		t.Errorf("Expected small pHash distance for resized image, got %d", d)
+	}
+	if d := Distance(PHash(original), PHash(brighter)); d > 10 {
+		t.Errorf("Expected small pHash distance for brightened image, got %d", d)
+	}
+}
+
+func TestHashDistinguishesDifferentImages(t *testing.T) {
+	a := CropArtwork(testCard(488, 680, 0))
+	b := CropArtwork(testCard(488, 680, 5))
+
+	if d := Distance(PHash(a), PHash(b)); d <= MaxDistance {
+		t.Errorf("Expected pHash distance above %d for different images, got %d", MaxDistance, d)
+	}
+}
+
+func TestCropArtwork(t *testing.T) {
+	img := testCard(1000, 1000, 0)
+	art := CropArtwork(img)
+
+	expected := image.Rect(80, 110, 920, 550)
+	if art.Bounds() != expected {
+		t.Errorf("Expected artwork bounds %v, got %v", expected, art.Bounds())
+	}
+}
@@ -0,0 +1,170 @@
+package recognition
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+const (
+	// MaxDistance is the largest pHash distance still considered a match
+	MaxDistance = 22
+	// MaxAlternatives is the number of ranked alternatives returned with a match
+	MaxAlternatives = 5
+)
+
+// Match is a card from the hash index ranked by its distance to a photo
+type Match struct {
+	CardID   string
+	Distance int
+}
+
+type entry struct {
+	cardID string
+	phash  uint64
+	dhash  uint64
+}
+
+// Index matches card photos against the precomputed artwork hashes of known printings
+type Index struct {
+	db         *database.DB
+	httpClient *http.Client
+	mu         sync.RWMutex
+	entries    []entry
+	loaded     bool
+}
+
+// NewIndex creates a new image hash index
+func NewIndex(db *database.DB) *Index {
+	return &Index{
+		db: db,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Match returns the closest indexed printings to a card photo, best first
+func (idx *Index) Match(img image.Image, artworkOnly bool) ([]Match, error) {
+	if err := idx.load(); err != nil {
+		return nil, err
+	}
+
+	if !artworkOnly {
+		img = CropArtwork(img)
+	}
+	phash := PHash(img)
+	dhash := DHash(img)
+
+	idx.mu.RLock()
+	matches := make([]Match, 0, MaxAlternatives+1)
+	dhashDistances := make(map[string]int)
+	for _, e := range idx.entries {
+		distance := Distance(phash, e.phash)
+		if distance > MaxDistance {
+			continue
+		}
+		matches = append(matches, Match{CardID: e.cardID, Distance: distance})
+		dhashDistances[e.cardID] = Distance(dhash, e.dhash)
+	}
+	idx.mu.RUnlock()
+
+	// Rank by pHash distance, falling back to dHash to break ties
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return dhashDistances[matches[i].CardID] < dhashDistances[matches[j].CardID]
+	})
+
+	if len(matches) > MaxAlternatives+1 {
+		matches = matches[:MaxAlternatives+1]
+	}
+	return matches, nil
+}
+
+// Add hashes a full card image and stores it in the index
+func (idx *Index) Add(cardID string, img image.Image) error {
+	art := CropArtwork(img)
+	hash := &models.CardImageHash{
+		CardID: cardID,
+		PHash:  PHash(art),
+		DHash:  DHash(art),
+	}
+	if err := idx.db.UpsertCardImageHash(hash); err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.loaded {
+		for i := range idx.entries {
+			if idx.entries[i].cardID == cardID {
+				idx.entries[i].phash = hash.PHash
+				idx.entries[i].dhash = hash.DHash
+				return nil
+			}
+		}
+		idx.entries = append(idx.entries, entry{cardID: cardID, phash: hash.PHash, dhash: hash.DHash})
+	}
+	return nil
+}
+
+// AddFromURL downloads a card's image and stores its hashes in the index
+func (idx *Index) AddFromURL(card *models.Card) error {
+	if card.ImageURI == "" {
+		return fmt.Errorf("card %s has no image", card.ID)
+	}
+
+	resp, err := idx.httpClient.Get(card.ImageURI)
+	if err != nil {
+		return fmt.Errorf("failed to download card image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download card image: status %d", resp.StatusCode)
+	}
+
+	img, _, err := image.Decode(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to decode card image: %w", err)
+	}
+
+	return idx.Add(card.ID, img)
+}
+
+// load reads the hash index from the database on first use
+func (idx *Index) load() error {
+	idx.mu.RLock()
+	loaded := idx.loaded
+	idx.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	hashes, err := idx.db.GetAllCardImageHashes()
+	if err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.loaded {
+		return nil
+	}
+	idx.entries = make([]entry, 0, len(hashes))
+	for _, h := range hashes {
+		idx.entries = append(idx.entries, entry{cardID: h.CardID, phash: h.PHash, dhash: h.DHash})
+	}
+	idx.loaded = true
+	return nil
+}
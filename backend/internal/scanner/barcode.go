@@ -0,0 +1,279 @@
+package scanner
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+var (
+	// ErrUnknownBarcode is returned when a barcode has no known mapping
+	ErrUnknownBarcode = errors.New("unknown barcode")
+	// ErrBarcodeExists is returned when teaching a barcode that already maps elsewhere
+	ErrBarcodeExists = errors.New("barcode is already mapped")
+	// ErrInvalidBarcode is returned for malformed barcode mappings
+	ErrInvalidBarcode = errors.New("invalid barcode")
+)
+
+// Barcode kinds
+const (
+	BarcodeUPC   = "upc"
+	BarcodeEAN   = "ean"
+	BarcodeArena = "arena"
+	BarcodeMTGO  = "mtgo"
+)
+
+// SealedProductError is returned when a barcode identifies sealed product rather than a card
+type SealedProductError struct {
+	Product *models.SealedProduct
+}
+
+func (e *SealedProductError) Error() string {
+	return fmt.Sprintf("barcode %s identifies sealed product %q", e.Product.Barcode, e.Product.Name)
+}
+
+// BarcodeResolver resolves scans by their barcode mapping
+type BarcodeResolver struct {
+	db *database.DB
+}
+
+// NewBarcodeResolver creates a barcode resolver
+func NewBarcodeResolver(db *database.DB) *BarcodeResolver {
+	return &BarcodeResolver{db: db}
+}
+
+// Name returns the resolver name
+func (r *BarcodeResolver) Name() string {
+	return "barcode"
+}
+
+// Resolve looks up the scan's barcode
+func (r *BarcodeResolver) Resolve(ctx context.Context, req *models.ScanRequest) ([]Candidate, error) {
+	code := normalizeBarcode(req.Barcode)
+	if code == "" {
+		return nil, nil
+	}
+
+	barcode, err := r.db.GetBarcode(code)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if barcode == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownBarcode, code)
+	}
+
+	if barcode.CardID == "" {
+		return nil, &SealedProductError{Product: &models.SealedProduct{
+			Barcode: barcode.Code,
+			Name:    barcode.ProductName,
+		}}
+	}
+
+	card, err := r.db.GetCardByID(barcode.CardID)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if card == nil {
+		return nil, ErrCardNotFound
+	}
+
+	return []Candidate{{Card: card, Confidence: 1, Source: r.Name()}}, nil
+}
+
+// LearnBarcode records a new barcode mapping taught by a user
+func (s *Service) LearnBarcode(userID string, req *models.BarcodeRequest) (*models.Barcode, error) {
+	barcode, err := s.buildBarcode(req)
+	if err != nil {
+		return nil, err
+	}
+	barcode.AddedBy = userID
+
+	existing, err := s.db.GetBarcode(barcode.Code)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if existing != nil {
+		if existing.CardID == barcode.CardID && existing.ProductName == barcode.ProductName {
+			existing.Card = barcode.Card
+			return existing, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrBarcodeExists, barcode.Code)
+	}
+
+	if err := s.db.CreateBarcode(barcode); err != nil {
+		return nil, err
+	}
+	return barcode, nil
+}
+
+// ImportBarcodes loads barcode mappings from CSV with the header
+// barcode,kind,set_code,collector_number,product_name. Rows with a set code
+// and collector number map to that card; other rows map to sealed product.
+func (s *Service) ImportBarcodes(r io.Reader) (*models.CatalogImportResult, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read barcode header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["barcode"]; !ok {
+		return nil, fmt.Errorf("barcode CSV is missing the barcode column")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	result := &models.CatalogImportResult{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read barcode CSV line %d: %w", line, err)
+		}
+
+		barcode, err := s.buildBarcode(&models.BarcodeRequest{
+			Barcode:         field(record, "barcode"),
+			Kind:            field(record, "kind"),
+			SetCode:         field(record, "set_code"),
+			CollectorNumber: field(record, "collector_number"),
+			ProductName:     field(record, "product_name"),
+		})
+		if err != nil {
+			result.Skipped++
+			continue
+		}
+
+		inserted, err := s.db.UpsertBarcode(barcode)
+		if err != nil {
+			return nil, err
+		}
+		if inserted {
+			result.Inserted++
+		} else {
+			result.Updated++
+		}
+	}
+
+	return result, nil
+}
+
+// buildBarcode validates a barcode request and resolves its target card
+func (s *Service) buildBarcode(req *models.BarcodeRequest) (*models.Barcode, error) {
+	code := normalizeBarcode(req.Barcode)
+	if code == "" {
+		return nil, fmt.Errorf("%w: barcode is required", ErrInvalidBarcode)
+	}
+
+	kind := strings.ToLower(strings.TrimSpace(req.Kind))
+	if kind == "" {
+		kind = inferBarcodeKind(code)
+	}
+	if err := validateBarcode(code, kind); err != nil {
+		return nil, err
+	}
+
+	barcode := &models.Barcode{
+		Code:        code,
+		Kind:        kind,
+		ProductName: strings.TrimSpace(req.ProductName),
+		CreatedAt:   time.Now(),
+	}
+
+	var card *models.Card
+	var err error
+	switch {
+	case req.CardID != "":
+		card, err = s.db.GetCardByID(req.CardID)
+	case req.SetCode != "" && req.CollectorNumber != "":
+		card, err = s.db.GetCardBySetAndNumber(strings.ToUpper(req.SetCode), req.CollectorNumber)
+	case barcode.ProductName != "":
+		return barcode, nil
+	default:
+		return nil, fmt.Errorf("%w: a card or product name is required", ErrInvalidBarcode)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if card == nil {
+		return nil, ErrCardNotFound
+	}
+
+	barcode.CardID = card.ID
+	barcode.ProductName = ""
+	barcode.Card = card
+	return barcode, nil
+}
+
+// normalizeBarcode strips whitespace and separators scanners sometimes include
+func normalizeBarcode(code string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+
+// inferBarcodeKind guesses the kind of a bare barcode from its length
+func inferBarcodeKind(code string) string {
+	if len(code) == 13 {
+		return BarcodeEAN
+	}
+	return BarcodeUPC
+}
+
+// validateBarcode checks a barcode is well formed for its kind
+func validateBarcode(code, kind string) error {
+	switch kind {
+	case BarcodeUPC:
+		if len(code) != 12 {
+			return fmt.Errorf("%w: UPC barcode must have 12 digits", ErrInvalidBarcode)
+		}
+	case BarcodeEAN:
+		if len(code) != 13 {
+			return fmt.Errorf("%w: EAN barcode must have 13 digits", ErrInvalidBarcode)
+		}
+	case BarcodeArena, BarcodeMTGO:
+		// Platform identifiers are opaque alphanumeric codes
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown barcode kind %q", ErrInvalidBarcode, kind)
+	}
+
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("%w: barcode must be numeric", ErrInvalidBarcode)
+		}
+	}
+	if !validCheckDigit(code) {
+		return fmt.Errorf("%w: barcode check digit is invalid", ErrInvalidBarcode)
+	}
+	return nil
+}
+
+// validCheckDigit verifies the GS1 check digit used by UPC-A and EAN-13
+func validCheckDigit(code string) bool {
+	sum := 0
+	for i := len(code) - 2; i >= 0; i-- {
+		digit := int(code[i] - '0')
+		if (len(code)-2-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return (10-sum%10)%10 == int(code[len(code)-1]-'0')
+}
@@ -0,0 +1,92 @@
+package scanner
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/abzi/mtg_card_detector/internal/auth"
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+func TestValidateBarcode(t *testing.T) {
+	tests := []struct {
+		code  string
+		kind  string
+		valid bool
+	}{
+		{"036000291452", BarcodeUPC, true},
+		{"036000291453", BarcodeUPC, false},
+		{"4006381333931", BarcodeEAN, true},
+		{"4006381333931", BarcodeUPC, false},
+		{"03600029145X", BarcodeUPC, false},
+		{"A1B2C3D4E5", BarcodeArena, true},
+		{"036000291452", "isbn", false},
+	}
+
+	for _, tt := range tests {
+		err := validateBarcode(tt.code, tt.kind)
+		if (err == nil) != tt.valid {
+			t.Errorf("validateBarcode(%s, %s): expected valid=%v, got %v", tt.code, tt.kind, tt.valid, err)
+		}
+	}
+}
+
+func TestBarcodeScans(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := newTestService(t, db)
+	if _, err := service.ImportBulkData(strings.NewReader(testBulkData)); err != nil {
+		t.Fatalf("Failed to import bulk data: %v", err)
+	}
+
+	authResp, err := auth.NewService(db, "test-secret").GenerateAnonymousUser("test-device")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Unknown barcodes fail with a clear error
+	_, err = service.ScanCard(&models.ScanRequest{Barcode: "036000291452"})
+	if !errors.Is(err, ErrUnknownBarcode) {
+		t.Errorf("Expected unknown barcode error, got %v", err)
+	}
+
+	// Teach a card mapping, then scan it
+	barcode, err := service.LearnBarcode(authResp.UserID, &models.BarcodeRequest{
+		Barcode:         "0360-0029-1452",
+		SetCode:         "m10",
+		CollectorNumber: "146",
+	})
+	if err != nil {
+		t.Fatalf("Failed to learn barcode: %v", err)
+	}
+	if barcode.Kind != BarcodeUPC || barcode.Card == nil {
+		t.Errorf("Expected UPC mapping to a card, got %+v", barcode)
+	}
+
+	card, err := service.ScanCard(&models.ScanRequest{Barcode: "036000291452"})
+	if err != nil {
+		t.Fatalf("Failed to scan barcode: %v", err)
+	}
+	if card.Name != "Lightning Bolt" {
+		t.Errorf("Expected Lightning Bolt, got %s", card.Name)
+	}
+
+	// Remapping to a different target is rejected
+	_, err = service.LearnBarcode(authResp.UserID, &models.BarcodeRequest{Barcode: "036000291452", ProductName: "Booster Box"})
+	if !errors.Is(err, ErrBarcodeExists) {
+		t.Errorf("Expected barcode exists error, got %v", err)
+	}
+
+	// Sealed product barcodes identify the product instead of a card
+	if _, err := service.ImportBarcodes(strings.NewReader("barcode,kind,product_name\n4006381333931,ean,Modern Horizons 2 Draft Booster\n123,ean,Bad Row\n")); err != nil {
+		t.Fatalf("Failed to import barcodes: %v", err)
+	}
+
+	_, err = service.ScanCard(&models.ScanRequest{Barcode: "4006381333931"})
+	var sealed *SealedProductError
+	if !errors.As(err, &sealed) || sealed.Product.Name != "Modern Horizons 2 Draft Booster" {
+		t.Errorf("Expected sealed product error, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+	"github.com/abzi/mtg_card_detector/internal/scryfall"
+)
+
+// bulkBatchSize is the number of printings upserted per database transaction
+const bulkBatchSize = 500
+
+// ImportBulkData streams a Scryfall bulk data file ("default_cards" or
+// "all_cards") into the local catalog, upserting printings by Scryfall ID.
+// The file is decoded one card at a time so it never has to fit in memory.
+func (s *Service) ImportBulkData(r io.Reader) (*models.CatalogImportResult, error) {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bulk data: %w", err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("invalid bulk data: expected a JSON array of cards")
+	}
+
+	result := &models.CatalogImportResult{}
+	batch := make([]models.Card, 0, bulkBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		batchResult, err := s.db.UpsertCardsByScryfallID(batch)
+		if err != nil {
+			return err
+		}
+		result.Inserted += batchResult.Inserted
+		result.Updated += batchResult.Updated
+		result.Unchanged += batchResult.Unchanged
+		batch = batch[:0]
+		return nil
+	}
+
+	for n := 1; dec.More(); n++ {
+		var sc scryfall.Card
+		if err := dec.Decode(&sc); err != nil {
+			return nil, fmt.Errorf("failed to decode card %d: %w", n, err)
+		}
+
+		// Digital-only printings can never be scanned from a physical card.
+		// all_cards has an object per language of each printing, while the
+		// catalog holds a printing once and scans record the copy's language.
+		if sc.ID == "" || sc.Name == "" || sc.SetCode == "" || sc.CollectorNumber == "" || sc.Digital || sc.Lang != "en" {
+			result.Skipped++
+			continue
+		}
+
+		batch = append(batch, *s.convertScryfallCard(&sc))
+		if len(batch) == bulkBatchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("invalid bulk data: %w", err)
+	}
+
+	// Updated names do not change the catalog size, so force a rebuild
+	s.fuzzy.Invalidate()
+
+	return result, nil
+}
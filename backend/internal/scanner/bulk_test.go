@@ -0,0 +1,174 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+func setupTestDB(t testing.TB) *database.DB {
+	dbPath := "/tmp/test_scanner.db"
+	os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+
+	if err := db.RunMigrations("../../migrations"); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	return db
+}
+
+func newTestService(t testing.TB, db *database.DB) *Service {
+	service, err := NewService(db)
+	if err != nil {
+		t.Fatalf("Failed to create scanner service: %v", err)
+	}
+	return service
+}
+
+const testBulkData = `[
+  {"id": "e3285e6b-3e79-4d7c-bf96-d920f973b80d", "name": "Lightning Bolt", "set": "m10", "collector_number": "146", "lang": "en",
+   "type_line": "Instant", "mana_cost": "{R}", "rarity": "common", "oracle_text": "Lightning Bolt deals 3 damage to any target.",
+   "colors": ["R"], "color_identity": ["R"], "cmc": 1,
+   "legalities": {"modern": "legal", "standard": "not_legal", "vintage": "legal"},
+   "prices": {"usd": "1.25", "usd_foil": "8.50", "usd_etched": null, "eur": "0.90", "eur_foil": null, "tix": "0.03"},
+   "image_uris": {"normal": "https://cards.scryfall.io/normal/front/bolt.jpg"}},
+  {"id": "a1c1d6b4-0e1c-4f7b-9a66-1c5f0c1b6a7e", "name": "Counterspell", "set": "mh2", "collector_number": "267", "lang": "en",
+   "type_line": "Instant", "mana_cost": "{U}{U}", "rarity": "uncommon"},
+  {"id": "0b0b7c8a-3d2f-4a0e-8f5e-9d1b2c3d4e5f", "name": "Lightning Bolt", "set": "pana", "collector_number": "1", "lang": "en",
+   "type_line": "Instant", "mana_cost": "{R}", "rarity": "common", "digital": true},
+  {"id": "", "name": "Broken Entry", "set": "xxx", "collector_number": "1"}
+]`
+
+func TestImportBulkData(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := newTestService(t, db)
+
+	result, err := service.ImportBulkData(strings.NewReader(testBulkData))
+	if err != nil {
+		t.Fatalf("Failed to import bulk data: %v", err)
+	}
+
+	expected := models.CatalogImportResult{Inserted: 2, Skipped: 2}
+	if *result != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *result)
+	}
+
+	card, err := db.GetCardBySetAndNumber("M10", "146")
+	if err != nil {
+		t.Fatalf("Failed to get card: %v", err)
+	}
+	if card == nil || card.Name != "Lightning Bolt" {
+		t.Fatalf("Expected imported Lightning Bolt, got %+v", card)
+	}
+	if card.ImageURI != "https://cards.scryfall.io/normal/front/bolt.jpg" {
+		t.Errorf("Expected normal image URI, got %s", card.ImageURI)
+	}
+	if card.Colors != "R" || card.ColorIdentity != "R" || card.CMC != 1 {
+		t.Errorf("Expected red mana value 1 card, got colors %q, identity %q, cmc %v", card.Colors, card.ColorIdentity, card.CMC)
+	}
+
+	if card.Legalities["modern"] != models.Legal || card.Legalities["standard"] != models.NotLegal {
+		t.Errorf("Expected modern legal, standard not legal, got %v", card.Legalities)
+	}
+
+	prices, err := db.GetCardPrices(card.ID)
+	if err != nil {
+		t.Fatalf("Failed to get prices: %v", err)
+	}
+	expectedPrices := map[string]float64{"eur/nonfoil": 0.9, "usd/foil": 8.5, "usd/nonfoil": 1.25}
+	if len(prices) != len(expectedPrices) {
+		t.Errorf("Expected %d prices, got %+v", len(expectedPrices), prices)
+	}
+	for _, p := range prices {
+		if expectedPrices[p.Currency+"/"+p.Finish] != p.Price || p.UpdatedAt.IsZero() {
+			t.Errorf("Unexpected price %+v", p)
+		}
+	}
+
+	// Re-importing with one changed printing updates it in place, and
+	// refreshes prices of unchanged printings
+	changed := strings.Replace(testBulkData, `"rarity": "uncommon"`, `"rarity": "common"`, 1)
+	changed = strings.Replace(changed, `"usd": "1.25"`, `"usd": "1.50"`, 1)
+	result, err = service.ImportBulkData(strings.NewReader(changed))
+	if err != nil {
+		t.Fatalf("Failed to re-import bulk data: %v", err)
+	}
+
+	expected = models.CatalogImportResult{Updated: 1, Unchanged: 1, Skipped: 2}
+	if *result != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *result)
+	}
+
+	updated, err := db.GetCardBySetAndNumber("MH2", "267")
+	if err != nil {
+		t.Fatalf("Failed to get card: %v", err)
+	}
+	if updated.Rarity != "common" {
+		t.Errorf("Expected rarity to be updated to common, got %s", updated.Rarity)
+	}
+
+	prices, err = db.GetCardPrices(card.ID)
+	if err != nil {
+		t.Fatalf("Failed to get prices: %v", err)
+	}
+	for _, p := range prices {
+		if p.Currency == models.CurrencyUSD && p.Finish == models.FinishNonfoil && p.Price != 1.5 {
+			t.Errorf("Expected refreshed USD price 1.50, got %v", p.Price)
+		}
+	}
+}
+
+// testAllCardsData has one printing in several languages, as all_cards does
+const testAllCardsData = `[
+  {"id": "e3285e6b-3e79-4d7c-bf96-d920f973b80d", "name": "Lightning Bolt", "set": "m10", "collector_number": "146", "lang": "en",
+   "type_line": "Instant", "rarity": "common"},
+  {"id": "5c9e6f4d-2b8a-4f1e-9d3c-7a6b5c4d3e2f", "name": "Lightning Bolt", "set": "m10", "collector_number": "146", "lang": "ja",
+   "type_line": "Instant", "rarity": "common"},
+  {"id": "8f7e6d5c-4b3a-4291-8e7d-6c5b4a3f2e1d", "name": "Lightning Bolt", "set": "m10", "collector_number": "146", "lang": "de",
+   "type_line": "Instant", "rarity": "common"}
+]`
+
+func TestImportBulkDataLanguages(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := newTestService(t, db)
+	result, err := service.ImportBulkData(strings.NewReader(testAllCardsData))
+	if err != nil {
+		t.Fatalf("Failed to import bulk data: %v", err)
+	}
+	expected := models.CatalogImportResult{Inserted: 1, Skipped: 2}
+	if *result != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *result)
+	}
+
+	// With the printing stored once, an exact name scan is certain of it
+	candidates, err := NewLocalResolver(db).Resolve(context.Background(), &models.ScanRequest{CardName: "Lightning Bolt"})
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].Confidence != 1 || candidates[0].Card.ScryfallID != "e3285e6b-3e79-4d7c-bf96-d920f973b80d" {
+		t.Errorf("Expected the English printing alone, got %+v", candidates)
+	}
+}
+
+func TestImportBulkDataRejectsNonArray(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := newTestService(t, db)
+	if _, err := service.ImportBulkData(strings.NewReader(`{"object": "card"}`)); err == nil {
+		t.Error("Expected error for non-array bulk data")
+	}
+}
@@ -0,0 +1,179 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/fuzzy"
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+const (
+	// MinFuzzyScore is the lowest fuzzy match score accepted as a scan result
+	MinFuzzyScore = 0.75
+	// maxFuzzyCandidates is the number of ranked candidates a fuzzy scan returns
+	maxFuzzyCandidates = 10
+	// fuzzyRecheckInterval is how often the name index is checked against the
+	// catalog for cards stored by another process, such as the catalog command
+	fuzzyRecheckInterval = time.Minute
+)
+
+// FuzzyResolver matches noisy OCR card names against the local catalog
+// without network access
+type FuzzyResolver struct {
+	db      *database.DB
+	mu      sync.RWMutex
+	index   *fuzzy.Index
+	checked time.Time // when the index was last checked against the catalog
+}
+
+// NewFuzzyResolver creates a fuzzy name resolver
+func NewFuzzyResolver(db *database.DB) *FuzzyResolver {
+	return &FuzzyResolver{db: db}
+}
+
+// Name returns the resolver name
+func (r *FuzzyResolver) Name() string {
+	return "fuzzy"
+}
+
+// Resolve ranks catalog printings by name similarity to the scanned name,
+// using the type line, set and collector number as tie-breaking hints
+func (r *FuzzyResolver) Resolve(ctx context.Context, req *models.ScanRequest) ([]Candidate, error) {
+	if req.CardName == "" {
+		return nil, nil
+	}
+
+	matches, err := r.Search(req.CardName, fuzzy.Hints{
+		TypeLine:        req.TypeLine,
+		SetCode:         req.SetCode,
+		CollectorNumber: req.CollectorNumber,
+	}, maxFuzzyCandidates)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]Candidate, 0, len(matches))
+	for _, m := range matches {
+		if m.Score < MinFuzzyScore {
+			break
+		}
+		card, err := r.db.GetCardByID(m.CardID)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		if card != nil {
+			candidates = append(candidates, Candidate{Card: card, Confidence: m.Score, Source: r.Name()})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, ErrCardNotFound
+	}
+	return candidates, nil
+}
+
+// Search returns up to limit catalog printings matching a name, best first
+func (r *FuzzyResolver) Search(name string, hints fuzzy.Hints, limit int) ([]fuzzy.Match, error) {
+	if err := r.refresh(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.index.Search(name, hints, limit), nil
+}
+
+// Add indexes a card just stored in the catalog, saving a rebuild
+func (r *FuzzyResolver) Add(card *models.Card) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.index != nil {
+		r.index.Add(cardEntry(card))
+	}
+}
+
+// Invalidate discards the name index so it is rebuilt on next use
+func (r *FuzzyResolver) Invalidate() {
+	r.mu.Lock()
+	r.index = nil
+	r.mu.Unlock()
+}
+
+// MatchName returns catalog printings ranked by how well their name matches
+// a noisy OCR name, entirely offline
+func (s *Service) MatchName(name string, hints fuzzy.Hints, limit int) ([]models.CardCandidate, error) {
+	matches, err := s.fuzzy.Search(name, hints, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]models.CardCandidate, 0, len(matches))
+	for _, m := range matches {
+		card, err := s.db.GetCardByID(m.CardID)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		if card != nil {
+			candidates = append(candidates, models.CardCandidate{Card: card, Confidence: m.Score})
+		}
+	}
+	return candidates, nil
+}
+
+// refresh builds the name index if there is none. Cards stored by this
+// process are added to the index as they are, so only every
+// fuzzyRecheckInterval is it checked against the catalog size, and rebuilt
+// if another process has changed the catalog.
+func (r *FuzzyResolver) refresh() error {
+	r.mu.RLock()
+	fresh := r.index != nil && time.Since(r.checked) < fuzzyRecheckInterval
+	r.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.index != nil && time.Since(r.checked) < fuzzyRecheckInterval {
+		return nil
+	}
+
+	if r.index != nil {
+		count, err := r.db.GetCardCount()
+		if err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+		if r.index.Len() == count {
+			r.checked = time.Now()
+			return nil
+		}
+	}
+
+	cards, err := r.db.GetCardNameIndex()
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	entries := make([]fuzzy.Entry, len(cards))
+	for i := range cards {
+		entries[i] = cardEntry(&cards[i])
+	}
+	r.index = fuzzy.NewIndex(entries)
+	r.checked = time.Now()
+	return nil
+}
+
+// cardEntry is a card's entry in the name index
+func cardEntry(card *models.Card) fuzzy.Entry {
+	return fuzzy.Entry{
+		CardID:          card.ID,
+		Name:            card.Name,
+		SetCode:         card.SetCode,
+		CollectorNumber: card.CollectorNumber,
+		TypeLine:        card.TypeLine,
+	}
+}
@@ -0,0 +1,48 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"image"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+// RecognizeImage matches a card photo against the artwork hash index and
+// returns the candidate printings ranked by distance, best first
+func (s *Service) RecognizeImage(img image.Image, artworkOnly bool) ([]models.CardMatch, error) {
+	matches, err := s.images.Match(img, artworkOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match image: %w", err)
+	}
+
+	if len(matches) == 0 {
+		return nil, ErrCardNotFound
+	}
+
+	results := make([]models.CardMatch, 0, len(matches))
+	for _, m := range matches {
+		card, err := s.db.GetCardByID(m.CardID)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		if card == nil {
+			continue
+		}
+		results = append(results, models.CardMatch{Card: card, Distance: m.Distance})
+	}
+
+	if len(results) == 0 {
+		return nil, ErrCardNotFound
+	}
+
+	return results, nil
+}
+
+// IndexCardImage downloads a card's image and adds its artwork hashes to the index
+func (s *Service) IndexCardImage(card *models.Card) error {
+	if err := s.scryfall.Wait(context.Background()); err != nil {
+		return err
+	}
+	return s.images.AddFromURL(card)
+}
@@ -0,0 +1,251 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/abzi/mtg_card_detector/internal/models"
+)
+
+var (
+	// ErrInsufficientData is returned when no enabled resolver can use the scan data
+	ErrInsufficientData = errors.New("insufficient scan data")
+	// ErrCardNotFound is returned when a resolver could use the scan data but found no card
+	ErrCardNotFound = errors.New("card not found")
+)
+
+// DefaultResolvers is the resolver order used when none is configured
+var DefaultResolvers = []string{"barcode", "local", "fuzzy", "image", "scryfall"}
+
+// DefaultResolveWorkers is how many scans ResolveAll resolves at a time
+const DefaultResolveWorkers = 8
+
+// Candidate is a card a resolver believes matches a scan
+type Candidate struct {
+	Card       *models.Card
+	Confidence float64 // 0 to 1
+	Source     string
+}
+
+// CardResolver resolves scan data to candidate cards. Resolvers return no
+// candidates and a nil error when the request has nothing they can use, and
+// ErrCardNotFound when they tried but found no match. Candidates must be
+// stored in the cards table so they can be added to inventory.
+type CardResolver interface {
+	Name() string
+	Resolve(ctx context.Context, req *models.ScanRequest) ([]Candidate, error)
+}
+
+// BatchResolver is a CardResolver that resolves many scans together more
+// cheaply than one at a time
+type BatchResolver interface {
+	CardResolver
+	// ResolveBatch resolves each scan as Resolve would, in order
+	ResolveBatch(ctx context.Context, reqs []*models.ScanRequest) []Resolution
+}
+
+// Resolution is the outcome of resolving one of many scans
+type Resolution struct {
+	Candidates []Candidate
+	Err        error
+}
+
+// Chain tries each resolver in order and returns the candidates of the first one that finds any
+type Chain struct {
+	resolvers []CardResolver
+}
+
+// NewChain creates a resolver chain
+func NewChain(resolvers ...CardResolver) *Chain {
+	return &Chain{resolvers: resolvers}
+}
+
+// Name returns the resolver name
+func (c *Chain) Name() string {
+	names := make([]string, len(c.resolvers))
+	for i, r := range c.resolvers {
+		names[i] = r.Name()
+	}
+	return "chain(" + strings.Join(names, ",") + ")"
+}
+
+// Resolve runs the chain. Errors from individual resolvers do not stop the
+// chain; if no resolver finds a candidate the first real error is returned.
+func (c *Chain) Resolve(ctx context.Context, req *models.ScanRequest) ([]Candidate, error) {
+	var run chainRun
+	for _, r := range c.resolvers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		candidates, err := r.Resolve(ctx, req)
+		if run.record(r, candidates, err) {
+			break
+		}
+	}
+	return run.result()
+}
+
+// ResolveAll runs the chain for many scans, on up to workers goroutines at a
+// time, returning their resolutions in order. Batch resolvers are instead
+// given every scan still unresolved when their turn comes, all at once.
+func (c *Chain) ResolveAll(ctx context.Context, reqs []*models.ScanRequest, workers int) []Resolution {
+	runs := make([]chainRun, len(reqs))
+
+	for start := 0; start < len(c.resolvers); {
+		if batch, ok := c.resolvers[start].(BatchResolver); ok {
+			var unresolved []int
+			var batchReqs []*models.ScanRequest
+			for i := range runs {
+				if runs[i].candidates == nil {
+					unresolved = append(unresolved, i)
+					batchReqs = append(batchReqs, reqs[i])
+				}
+			}
+			if len(unresolved) > 0 && ctx.Err() == nil {
+				for j, resolution := range batch.ResolveBatch(ctx, batchReqs) {
+					runs[unresolved[j]].record(batch, resolution.Candidates, resolution.Err)
+				}
+			}
+			start++
+			continue
+		}
+
+		// Scans go through the resolvers up to the next batch resolver on their own
+		end := start + 1
+		for end < len(c.resolvers) {
+			if _, ok := c.resolvers[end].(BatchResolver); ok {
+				break
+			}
+			end++
+		}
+		resolvers := c.resolvers[start:end]
+		parallel(len(reqs), workers, func(i int) {
+			for _, r := range resolvers {
+				if runs[i].candidates != nil || ctx.Err() != nil {
+					return
+				}
+				candidates, err := r.Resolve(ctx, reqs[i])
+				runs[i].record(r, candidates, err)
+			}
+		})
+		start = end
+	}
+
+	resolutions := make([]Resolution, len(reqs))
+	for i := range runs {
+		if runs[i].candidates == nil && ctx.Err() != nil {
+			resolutions[i].Err = ctx.Err()
+			continue
+		}
+		resolutions[i].Candidates, resolutions[i].Err = runs[i].result()
+	}
+	return resolutions
+}
+
+// chainRun tracks one scan's way through a chain
+type chainRun struct {
+	candidates []Candidate
+	firstErr   error
+	attempted  bool
+}
+
+// record takes a resolver's outcome, reporting whether it found candidates
+func (run *chainRun) record(r CardResolver, candidates []Candidate, err error) bool {
+	if err != nil {
+		run.attempted = true
+		if !errors.Is(err, ErrCardNotFound) && run.firstErr == nil {
+			run.firstErr = fmt.Errorf("%s: %w", r.Name(), err)
+		}
+		return false
+	}
+	if len(candidates) == 0 {
+		return false
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+	run.candidates = candidates
+	return true
+}
+
+// result is the candidates found, or else why there are none
+func (run *chainRun) result() ([]Candidate, error) {
+	switch {
+	case run.candidates != nil:
+		return run.candidates, nil
+	case run.firstErr != nil:
+		return nil, run.firstErr
+	case run.attempted:
+		return nil, ErrCardNotFound
+	}
+	return nil, ErrInsufficientData
+}
+
+// parallel calls fn with each index below n, on up to workers goroutines
+func parallel(n, workers int, fn func(i int)) {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(max(workers, 1), n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// RegisterResolver makes a resolver available to UseResolvers under its name
+func (s *Service) RegisterResolver(r CardResolver) {
+	s.registry[r.Name()] = r
+}
+
+// UseResolvers sets which registered resolvers ScanCard runs, in order
+func (s *Service) UseResolvers(names []string) error {
+	resolvers := make([]CardResolver, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		r, ok := s.registry[name]
+		if !ok {
+			return fmt.Errorf("unknown card resolver %q", name)
+		}
+		resolvers = append(resolvers, r)
+	}
+
+	if len(resolvers) == 0 {
+		return fmt.Errorf("at least one card resolver must be enabled")
+	}
+
+	s.resolver = NewChain(resolvers...)
+	return nil
+}
+
+// Resolve returns the candidates for a scan from the configured resolver chain, best first
+func (s *Service) Resolve(ctx context.Context, req *models.ScanRequest) ([]Candidate, error) {
+	return s.resolver.Resolve(ctx, req)
+}
+
+// ResolveAll resolves many scans through the configured resolver chain,
+// returning their resolutions in order
+func (s *Service) ResolveAll(ctx context.Context, reqs []*models.ScanRequest) []Resolution {
+	return s.resolver.ResolveAll(ctx, reqs, s.workers)
+}
+
+// SetResolveWorkers sets how many scans ResolveAll resolves at a time
+func (s *Service) SetResolveWorkers(n int) {
+	s.workers = n
+}
@@ -0,0 +1,302 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abzi/mtg_card_detector/internal/fuzzy"
+	"github.com/abzi/mtg_card_detector/internal/models"
+	"github.com/abzi/mtg_card_detector/internal/scryfall"
+)
+
+type fakeResolver struct {
+	name       string
+	candidates []Candidate
+	err        error
+	calls      int
+}
+
+func (r *fakeResolver) Name() string {
+	return r.name
+}
+
+func (r *fakeResolver) Resolve(ctx context.Context, req *models.ScanRequest) ([]Candidate, error) {
+	r.calls++
+	return r.candidates, r.err
+}
+
+func TestChainReturnsFirstResolverWithCandidates(t *testing.T) {
+	skip := &fakeResolver{name: "skip"}
+	miss := &fakeResolver{name: "miss", err: ErrCardNotFound}
+	hit := &fakeResolver{name: "hit", candidates: []Candidate{
+		{Card: &models.Card{Name: "Shock"}, Confidence: 0.4},
+		{Card: &models.Card{Name: "Lightning Bolt"}, Confidence: 0.9},
+	}}
+	after := &fakeResolver{name: "after", candidates: []Candidate{{Card: &models.Card{Name: "Opt"}, Confidence: 1}}}
+
+	candidates, err := NewChain(skip, miss, hit, after).Resolve(context.Background(), &models.ScanRequest{})
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+
+	if len(candidates) != 2 || candidates[0].Card.Name != "Lightning Bolt" {
+		t.Errorf("Expected hit's candidates ranked by confidence, got %+v", candidates)
+	}
+	if after.calls != 0 {
+		t.Error("Expected resolvers after the first hit not to run")
+	}
+}
+
+func TestChainErrors(t *testing.T) {
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name      string
+		resolvers []CardResolver
+		expected  error
+	}{
+		{"no applicable resolver", []CardResolver{&fakeResolver{name: "a"}}, ErrInsufficientData},
+		{"not found", []CardResolver{&fakeResolver{name: "a"}, &fakeResolver{name: "b", err: ErrCardNotFound}}, ErrCardNotFound},
+		{"real error wins", []CardResolver{&fakeResolver{name: "a", err: ErrCardNotFound}, &fakeResolver{name: "b", err: boom}}, boom},
+	}
+
+	for _, tt := range tests {
+		_, err := NewChain(tt.resolvers...).Resolve(context.Background(), &models.ScanRequest{})
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestUseResolvers(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := newTestService(t, db)
+	custom := &fakeResolver{name: "custom", candidates: []Candidate{{Card: &models.Card{Name: "Opt"}, Confidence: 1}}}
+	service.RegisterResolver(custom)
+
+	if err := service.UseResolvers([]string{"local", "missing"}); err == nil {
+		t.Error("Expected error for unknown resolver")
+	}
+
+	if err := service.UseResolvers([]string{"local", " custom "}); err != nil {
+		t.Fatalf("Failed to configure resolvers: %v", err)
+	}
+
+	card, err := service.ScanCard(&models.ScanRequest{CardName: "Opt"})
+	if err != nil {
+		t.Fatalf("Failed to scan card: %v", err)
+	}
+	if card.Name != "Opt" || custom.calls != 1 {
+		t.Errorf("Expected custom resolver to answer after local miss, got %+v", card)
+	}
+}
+
+// fakeScryfall stands in for the Scryfall API, knowing every printing whose
+// collector number doesn't start with "x". Each request takes latency, and
+// collection requests are counted.
+func fakeScryfall(t testing.TB, latency time.Duration, collections *int32) *scryfall.Client {
+	card := func(set, number string) scryfall.Card {
+		return scryfall.Card{ID: "sf-" + set + "-" + number, Name: "Card " + number, SetCode: set,
+			CollectorNumber: number, TypeLine: "Instant", Rarity: "common"}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(latency)
+		if r.URL.Path == "/cards/collection" {
+			atomic.AddInt32(collections, 1)
+			var body struct {
+				Identifiers []scryfall.Identifier `json:"identifiers"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			var result scryfall.CollectionResult
+			for _, id := range body.Identifiers {
+				if strings.HasPrefix(id.CollectorNumber, "x") {
+					result.NotFound = append(result.NotFound, id)
+				} else {
+					result.Data = append(result.Data, card(id.Set, id.CollectorNumber))
+				}
+			}
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/cards/"), "/")
+		if len(parts) != 2 || strings.HasPrefix(parts[1], "x") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"object": "error", "code": "not_found", "status": 404, "details": "No card found"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(card(parts[0], parts[1]))
+	}))
+	t.Cleanup(server.Close)
+	return scryfall.NewClient(scryfall.Options{BaseURL: server.URL, Rate: 10000, Burst: 100})
+}
+
+// setupBulkResolve returns a service resolving locally, then on a fake
+// Scryfall, with count local printings in set LOC
+func setupBulkResolve(t testing.TB, count int, latency time.Duration, collections *int32) *Service {
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+
+	for i := 0; i < count; i++ {
+		card := &models.Card{ID: fmt.Sprintf("loc-%d", i), ScryfallID: fmt.Sprintf("loc-%d", i), Name: fmt.Sprintf("Local %d", i),
+			SetCode: "LOC", CollectorNumber: fmt.Sprint(i), TypeLine: "Instant", Rarity: "common", CreatedAt: time.Now()}
+		if err := db.CreateCard(card); err != nil {
+			t.Fatalf("Failed to create card: %v", err)
+		}
+	}
+
+	service := newTestService(t, db)
+	service.UseScryfall(fakeScryfall(t, latency, collections))
+	if err := service.UseResolvers([]string{"local", "scryfall"}); err != nil {
+		t.Fatalf("Failed to configure resolvers: %v", err)
+	}
+	return service
+}
+
+func TestResolveAll(t *testing.T) {
+	var collections int32
+	service := setupBulkResolve(t, 3, 0, &collections)
+
+	reqs := []*models.ScanRequest{
+		{SetCode: "LOC", CollectorNumber: "0"},
+		{SetCode: "NEW", CollectorNumber: "1"},
+		{SetCode: "NEW", CollectorNumber: "x9"},
+		{SetCode: "LOC", CollectorNumber: "2"},
+		{SetCode: "new", CollectorNumber: "1"},
+		{},
+	}
+	for i := 0; i < 80; i++ {
+		reqs = append(reqs, &models.ScanRequest{SetCode: "BIG", CollectorNumber: fmt.Sprint(i)})
+	}
+
+	resolutions := service.ResolveAll(context.Background(), reqs)
+	if len(resolutions) != len(reqs) {
+		t.Fatalf("Expected %d resolutions, got %d", len(reqs), len(resolutions))
+	}
+
+	// Results keep the order of the scans, and misses are fetched from
+	// Scryfall 75 at a time, once each
+	if resolutions[0].Err != nil || resolutions[0].Candidates[0].Card.ID != "loc-0" || resolutions[0].Candidates[0].Source != "local" {
+		t.Errorf("Expected local hit, got %+v", resolutions[0])
+	}
+	if resolutions[3].Err != nil || resolutions[3].Candidates[0].Card.ID != "loc-2" {
+		t.Errorf("Expected local hit, got %+v", resolutions[3])
+	}
+	fetched := resolutions[1]
+	if fetched.Err != nil || fetched.Candidates[0].Card.ScryfallID != "sf-new-1" || fetched.Candidates[0].Source != "scryfall" {
+		t.Errorf("Expected Scryfall hit, got %+v", fetched)
+	}
+	if resolutions[4].Err != nil || resolutions[4].Candidates[0].Card.ID != fetched.Candidates[0].Card.ID {
+		t.Errorf("Expected the same stored card for a repeated scan, got %+v", resolutions[4])
+	}
+	if !errors.Is(resolutions[2].Err, ErrCardNotFound) {
+		t.Errorf("Expected card not found, got %+v", resolutions[2])
+	}
+	if !errors.Is(resolutions[5].Err, ErrInsufficientData) {
+		t.Errorf("Expected insufficient data, got %+v", resolutions[5])
+	}
+	for i, resolution := range resolutions[6:] {
+		if resolution.Err != nil || resolution.Candidates[0].Card.CollectorNumber != fmt.Sprint(i) {
+			t.Errorf("Expected BIG %d, got %+v", i, resolution)
+		}
+	}
+	if collections != 2 {
+		t.Errorf("Expected 82 misses in 2 collection requests, got %d", collections)
+	}
+
+	// Fetched printings are stored, so they resolve locally next time
+	candidates, err := service.Resolve(context.Background(), reqs[1])
+	if err != nil || candidates[0].Source != "local" {
+		t.Errorf("Expected stored printing to resolve locally, got %+v, %v", candidates, err)
+	}
+}
+
+// BenchmarkResolveAll resolves bulk scans of 100 printings, 30 of them missing
+// from the local catalog, against a Scryfall answering in 5ms
+func BenchmarkResolveAll(b *testing.B) {
+	var collections int32
+	service := setupBulkResolve(b, 70, 5*time.Millisecond, &collections)
+
+	// Each iteration scans printings Scryfall hasn't been asked for yet
+	scans := func(n int) []*models.ScanRequest {
+		reqs := make([]*models.ScanRequest, 0, 100)
+		for i := 0; i < 100; i++ {
+			if i%10 < 7 {
+				reqs = append(reqs, &models.ScanRequest{SetCode: "LOC", CollectorNumber: fmt.Sprint(i * 7 / 10)})
+			} else {
+				reqs = append(reqs, &models.ScanRequest{SetCode: "NEW", CollectorNumber: fmt.Sprintf("%d-%d", n, i)})
+			}
+		}
+		return reqs
+	}
+
+	n := 0
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			n++
+			for _, req := range scans(n) {
+				if _, err := service.Resolve(context.Background(), req); err != nil {
+					b.Fatalf("Failed to resolve: %v", err)
+				}
+			}
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			n++
+			for _, resolution := range service.ResolveAll(context.Background(), scans(n)) {
+				if resolution.Err != nil {
+					b.Fatalf("Failed to resolve: %v", resolution.Err)
+				}
+			}
+		}
+	})
+}
+
+func TestFuzzyIndexKeptCurrent(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	service := newTestService(t, db)
+	bolt := &models.Card{ID: "bolt", ScryfallID: "bolt", Name: "Lightning Bolt", SetCode: "M10", CollectorNumber: "146", CreatedAt: time.Now()}
+	if err := db.CreateCard(bolt); err != nil {
+		t.Fatalf("Failed to create card: %v", err)
+	}
+	if matches, _ := service.fuzzy.Search("Lightnmg Bolt", fuzzy.Hints{}, 5); len(matches) != 1 {
+		t.Fatalf("Expected Lightning Bolt, got %+v", matches)
+	}
+	index := service.fuzzy.index
+
+	// Cards fetched during scans are added without rebuilding the index
+	helix := &models.Card{ID: "helix", ScryfallID: "helix", Name: "Lightning Helix", SetCode: "RAV", CollectorNumber: "213", CreatedAt: time.Now()}
+	if _, err := service.storeCard(helix); err != nil {
+		t.Fatalf("Failed to store card: %v", err)
+	}
+	if matches, _ := service.fuzzy.Search("Lightning Helx", fuzzy.Hints{}, 5); len(matches) == 0 || matches[0].CardID != "helix" {
+		t.Errorf("Expected the stored card, got %+v", matches)
+	}
+	if service.fuzzy.index != index {
+		t.Error("Expected the index not to be rebuilt")
+	}
+
+	// Cards another process stores are picked up at the next recheck
+	vial := &models.Card{ID: "vial", ScryfallID: "vial", Name: "Aether Vial", SetCode: "DST", CollectorNumber: "91", CreatedAt: time.Now()}
+	if err := db.CreateCard(vial); err != nil {
+		t.Fatalf("Failed to create card: %v", err)
+	}
+	service.fuzzy.checked = time.Time{}
+	if matches, _ := service.fuzzy.Search("Aether Vial", fuzzy.Hints{}, 5); len(matches) == 0 || matches[0].CardID != "vial" {
+		t.Errorf("Expected the rebuilt index to find the new card, got %+v", matches)
+	}
+}
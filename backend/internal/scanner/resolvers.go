@@ -0,0 +1,195 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/abzi/mtg_card_detector/internal/database"
+	"github.com/abzi/mtg_card_detector/internal/models"
+	"github.com/abzi/mtg_card_detector/internal/recognition"
+	"github.com/abzi/mtg_card_detector/internal/scryfall"
+)
+
+// LocalResolver looks cards up in the local catalog by set and collector number or exact name
+type LocalResolver struct {
+	db *database.DB
+}
+
+// NewLocalResolver creates a local catalog resolver
+func NewLocalResolver(db *database.DB) *LocalResolver {
+	return &LocalResolver{db: db}
+}
+
+// Name returns the resolver name
+func (r *LocalResolver) Name() string {
+	return "local"
+}
+
+// Resolve looks the scan up in the cards table. Name-only scans return every
+// local printing of the name, sharing the confidence between them.
+func (r *LocalResolver) Resolve(ctx context.Context, req *models.ScanRequest) ([]Candidate, error) {
+	var cards []models.Card
+
+	if req.SetCode != "" && req.CollectorNumber != "" {
+		card, err := r.db.GetCardBySetAndNumber(req.SetCode, req.CollectorNumber)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		if card != nil {
+			cards = append(cards, *card)
+		}
+	} else if req.CardName != "" {
+		var err error
+		cards, err = r.db.GetCardsByName(req.CardName, req.SetCode)
+		if err != nil {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+	} else {
+		return nil, nil
+	}
+
+	if len(cards) == 0 {
+		return nil, ErrCardNotFound
+	}
+
+	candidates := make([]Candidate, len(cards))
+	for i := range cards {
+		candidates[i] = Candidate{Card: &cards[i], Confidence: 1 / float64(len(cards)), Source: r.Name()}
+	}
+	return candidates, nil
+}
+
+// ScryfallResolver looks cards up on the Scryfall API and caches them in the local catalog
+type ScryfallResolver struct {
+	service *Service
+}
+
+// Name returns the resolver name
+func (r *ScryfallResolver) Name() string {
+	return "scryfall"
+}
+
+// Resolve fetches the scan from Scryfall by set and collector number, or every
+// printing of the best fuzzy name match, sharing the confidence between them
+func (r *ScryfallResolver) Resolve(ctx context.Context, req *models.ScanRequest) ([]Candidate, error) {
+	var cards []*models.Card
+
+	if req.SetCode != "" && req.CollectorNumber != "" {
+		card, err := r.service.fetchFromScryfallBySetNumber(ctx, req.SetCode, req.CollectorNumber)
+		if err != nil {
+			return nil, err
+		}
+		cards = []*models.Card{card}
+	} else if req.CardName != "" {
+		var err error
+		cards, err = r.service.fetchPrintingsFromScryfall(ctx, req.CardName, req.SetCode)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, nil
+	}
+
+	return r.store(cards)
+}
+
+// ResolveBatch resolves scans as Resolve does, except that scans by set and
+// collector number are fetched together through Scryfall's collection
+// endpoint. Name scans need every printing of the name, so are still fetched
+// one at a time.
+func (r *ScryfallResolver) ResolveBatch(ctx context.Context, reqs []*models.ScanRequest) []Resolution {
+	resolutions := make([]Resolution, len(reqs))
+
+	var identifiers []scryfall.Identifier
+	var batched []int
+	requested := make(map[string]bool)
+	for i, req := range reqs {
+		if req.SetCode == "" || req.CollectorNumber == "" {
+			resolutions[i].Candidates, resolutions[i].Err = r.Resolve(ctx, req)
+			continue
+		}
+		batched = append(batched, i)
+		if key := setNumberKey(req.SetCode, req.CollectorNumber); !requested[key] {
+			requested[key] = true
+			identifiers = append(identifiers, scryfall.Identifier{Set: strings.ToLower(req.SetCode), CollectorNumber: req.CollectorNumber})
+		}
+	}
+	if len(batched) == 0 {
+		return resolutions
+	}
+
+	cards, err := r.service.fetchCollectionFromScryfall(ctx, identifiers)
+	stored := make(map[string]Resolution)
+	for _, i := range batched {
+		if err != nil {
+			resolutions[i].Err = err
+			continue
+		}
+		key := setNumberKey(reqs[i].SetCode, reqs[i].CollectorNumber)
+		resolution, ok := stored[key]
+		if !ok {
+			if card := cards[key]; card != nil {
+				resolution.Candidates, resolution.Err = r.store([]*models.Card{card})
+			} else {
+				resolution.Err = ErrCardNotFound
+			}
+			stored[key] = resolution
+		}
+		resolutions[i] = resolution
+	}
+	return resolutions
+}
+
+// store caches cards fetched from Scryfall, returning them as candidates
+// sharing the confidence between them
+func (r *ScryfallResolver) store(cards []*models.Card) ([]Candidate, error) {
+	candidates := make([]Candidate, len(cards))
+	for i, card := range cards {
+		stored, err := r.service.storeCard(card)
+		if err != nil {
+			return nil, err
+		}
+		candidates[i] = Candidate{Card: stored, Confidence: 1 / float64(len(cards)), Source: r.Name()}
+	}
+	return candidates, nil
+}
+
+// ImageResolver matches an attached card photo against the artwork hash index
+type ImageResolver struct {
+	service *Service
+}
+
+// Name returns the resolver name
+func (r *ImageResolver) Name() string {
+	return "image"
+}
+
+// Resolve decodes the scan's image and ranks indexed printings by hash distance
+func (r *ImageResolver) Resolve(ctx context.Context, req *models.ScanRequest) ([]Candidate, error) {
+	if len(req.Image) == 0 {
+		return nil, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(req.Image))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+
+	matches, err := r.service.RecognizeImage(img, false)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]Candidate, len(matches))
+	for i, m := range matches {
+		candidates[i] = Candidate{
+			Card:       m.Card,
+			Confidence: 1 - float64(m.Distance)/recognition.HashBits,
+			Source:     r.Name(),
+		}
+	}
+	return candidates, nil
+}
@@ -1,156 +1,179 @@
 package scanner
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/abzi/mtg_card_detector/internal/database"
 	"github.com/abzi/mtg_card_detector/internal/models"
+	"github.com/abzi/mtg_card_detector/internal/recognition"
+	"github.com/abzi/mtg_card_detector/internal/scryfall"
 	"github.com/google/uuid"
 )
 
-const (
-	ScryfallAPIBase = "https://api.scryfall.com"
-	RateLimit       = time.Millisecond * 100 // Scryfall rate limit: 10 requests per second
-)
-
-type ScryfallCard struct {
-	ID              string                 `json:"id"`
-	Name            string                 `json:"name"`
-	SetCode         string                 `json:"set"`
-	CollectorNumber string                 `json:"collector_number"`
-	ImageURIs       map[string]string      `json:"image_uris,omitempty"`
-	CardFaces       []map[string]interface{} `json:"card_faces,omitempty"`
-	OracleText      string                 `json:"oracle_text,omitempty"`
-	TypeLine        string                 `json:"type_line"`
-	ManaCost        string                 `json:"mana_cost,omitempty"`
-	Rarity          string                 `json:"rarity"`
+// scryfallPriceFields maps Scryfall's price fields to a currency and finish.
+// MTGO tix are ignored since digital cards aren't tracked.
+var scryfallPriceFields = []struct {
+	field, currency, finish string
+}{
+	{"usd", models.CurrencyUSD, models.FinishNonfoil},
+	{"usd_foil", models.CurrencyUSD, models.FinishFoil},
+	{"usd_etched", models.CurrencyUSD, models.FinishEtched},
+	{"eur", models.CurrencyEUR, models.FinishNonfoil},
+	{"eur_foil", models.CurrencyEUR, models.FinishFoil},
+	{"eur_etched", models.CurrencyEUR, models.FinishEtched},
 }
 
 type Service struct {
-	db         *database.DB
-	httpClient *http.Client
-	lastCall   time.Time
+	db       *database.DB
+	scryfall *scryfall.Client
+	images   *recognition.Index
+	fuzzy    *FuzzyResolver
+	registry map[string]CardResolver
+	resolver *Chain
+	workers  int
 }
 
-// NewService creates a new scanner service
-func NewService(db *database.DB) *Service {
-	return &Service{
-		db: db,
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		lastCall: time.Time{},
+// NewService creates a new scanner service running the DefaultResolvers
+func NewService(db *database.DB) (*Service, error) {
+	s := &Service{
+		db:       db,
+		scryfall: scryfall.NewClient(scryfall.Options{}),
+		images:   recognition.NewIndex(db),
+		fuzzy:    NewFuzzyResolver(db),
+		registry: make(map[string]CardResolver),
+		workers:  DefaultResolveWorkers,
 	}
-}
 
-// ScanCard identifies a card from scan data
-func (s *Service) ScanCard(req *models.ScanRequest) (*models.Card, error) {
-	// Try to find card in local database first
-	var card *models.Card
-	var err error
-
-	if req.SetCode != "" && req.CollectorNumber != "" {
-		card, err = s.db.GetCardBySetAndNumber(req.SetCode, req.CollectorNumber)
-		if err != nil {
-			return nil, fmt.Errorf("database error: %w", err)
-		}
-		if card != nil {
-			return card, nil
-		}
+	s.RegisterResolver(NewBarcodeResolver(db))
+	s.RegisterResolver(NewLocalResolver(db))
+	s.RegisterResolver(s.fuzzy)
+	s.RegisterResolver(&ScryfallResolver{service: s})
+	s.RegisterResolver(&ImageResolver{service: s})
+	if err := s.UseResolvers(DefaultResolvers); err != nil {
+		return nil, err
 	}
 
-	// If not found locally, query Scryfall API
-	if req.SetCode != "" && req.CollectorNumber != "" {
-		card, err = s.fetchFromScryfallBySetNumber(req.SetCode, req.CollectorNumber)
-	} else if req.CardName != "" {
-		card, err = s.fetchFromScryfallByName(req.CardName, req.SetCode)
-	} else {
-		return nil, fmt.Errorf("insufficient scan data")
-	}
+	return s, nil
+}
 
+// UseScryfall replaces the Scryfall API client, such as one with another
+// base URL or rate limit
+func (s *Service) UseScryfall(client *scryfall.Client) {
+	s.scryfall = client
+}
+
+// ScanCard identifies a card from scan data using the configured resolver chain
+func (s *Service) ScanCard(req *models.ScanRequest) (*models.Card, error) {
+	candidates, err := s.Resolve(context.Background(), req)
 	if err != nil {
 		return nil, err
 	}
+	return candidates[0].Card, nil
+}
 
-	// Store the card in local database
-	if card != nil {
-		if err := s.db.CreateCard(card); err != nil {
-			// Ignore duplicate errors, card might have been added by another request
-			if !strings.Contains(err.Error(), "UNIQUE constraint failed") {
-				return nil, fmt.Errorf("failed to store card: %w", err)
+// storeCard caches a card fetched from Scryfall in the local catalog and its
+// fuzzy name index, and returns the stored copy
+func (s *Service) storeCard(card *models.Card) (*models.Card, error) {
+	if err := s.db.CreateCard(card); err != nil {
+		// Ignore duplicate errors, card might have been added by another request
+		if !strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return nil, fmt.Errorf("failed to store card: %w", err)
+		}
+		existing, err := s.db.GetCardByScryfallID(card.ScryfallID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load stored card: %w", err)
+		}
+		if existing != nil {
+			if err := s.db.SetCardPrices(existing.ID, card.Prices); err != nil {
+				return nil, err
 			}
+			return existing, nil
 		}
+		return card, nil
 	}
-
+	s.fuzzy.Add(card)
 	return card, nil
 }
 
 // fetchFromScryfallBySetNumber fetches card data from Scryfall by set and collector number
-func (s *Service) fetchFromScryfallBySetNumber(setCode, collectorNumber string) (*models.Card, error) {
-	s.rateLimit()
-
-	url := fmt.Sprintf("%s/cards/%s/%s", ScryfallAPIBase,
-		url.PathEscape(strings.ToLower(setCode)),
-		url.PathEscape(collectorNumber))
-
-	scryfallCard, err := s.makeRequest(url)
+func (s *Service) fetchFromScryfallBySetNumber(ctx context.Context, setCode, collectorNumber string) (*models.Card, error) {
+	scryfallCard, err := s.scryfall.CardBySetNumber(ctx, setCode, collectorNumber)
 	if err != nil {
-		return nil, err
+		return nil, scryfallError(err)
 	}
 
 	return s.convertScryfallCard(scryfallCard), nil
 }
 
-// fetchFromScryfallByName fetches card data from Scryfall by name
-func (s *Service) fetchFromScryfallByName(name, setCode string) (*models.Card, error) {
-	s.rateLimit()
+// fetchPrintingsFromScryfall fetches every printing of the card best matching
+// a name, optionally restricted to a set, newest first
+func (s *Service) fetchPrintingsFromScryfall(ctx context.Context, name, setCode string) ([]*models.Card, error) {
+	named, err := s.scryfall.CardNamed(ctx, name, setCode)
+	if err != nil {
+		return nil, scryfallError(err)
+	}
 
-	searchURL := fmt.Sprintf("%s/cards/named?fuzzy=%s", ScryfallAPIBase, url.QueryEscape(name))
-	if setCode != "" {
-		searchURL += fmt.Sprintf("&set=%s", url.QueryEscape(setCode))
+	if named.PrintsSearchURI == "" {
+		return []*models.Card{s.convertScryfallCard(named)}, nil
 	}
 
-	scryfallCard, err := s.makeRequest(searchURL)
+	prints, err := s.scryfall.Search(ctx, named.PrintsSearchURI)
 	if err != nil {
-		return nil, err
+		return nil, scryfallError(err)
 	}
 
-	return s.convertScryfallCard(scryfallCard), nil
+	cards := make([]*models.Card, 0, len(prints.Data))
+	for i := range prints.Data {
+		sc := &prints.Data[i]
+		if sc.Digital || (setCode != "" && !strings.EqualFold(sc.SetCode, setCode)) {
+			continue
+		}
+		cards = append(cards, s.convertScryfallCard(sc))
+	}
+
+	if len(cards) == 0 {
+		return []*models.Card{s.convertScryfallCard(named)}, nil
+	}
+	return cards, nil
 }
 
-// makeRequest makes HTTP request to Scryfall API
-func (s *Service) makeRequest(url string) (*ScryfallCard, error) {
-	resp, err := s.httpClient.Get(url)
+// fetchCollectionFromScryfall fetches printings by set and collector number
+// in as few requests as Scryfall allows, keyed by setNumberKey. Printings
+// Scryfall doesn't know are left out.
+func (s *Service) fetchCollectionFromScryfall(ctx context.Context, identifiers []scryfall.Identifier) (map[string]*models.Card, error) {
+	collection, err := s.scryfall.Collection(ctx, identifiers)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
+		return nil, scryfallError(err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("card not found")
+	cards := make(map[string]*models.Card, len(collection.Data))
+	for i := range collection.Data {
+		sc := &collection.Data[i]
+		cards[setNumberKey(sc.SetCode, sc.CollectorNumber)] = s.convertScryfallCard(sc)
 	}
+	return cards, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("scryfall API error: %d - %s", resp.StatusCode, string(body))
-	}
+// setNumberKey identifies a printing by set and collector number, ignoring case
+func setNumberKey(setCode, collectorNumber string) string {
+	return strings.ToLower(setCode) + "/" + strings.ToLower(collectorNumber)
+}
 
-	var scryfallCard ScryfallCard
-	if err := json.NewDecoder(resp.Body).Decode(&scryfallCard); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+// scryfallError reports cards Scryfall doesn't know as ErrCardNotFound
+func scryfallError(err error) error {
+	if errors.Is(err, scryfall.ErrNotFound) {
+		return ErrCardNotFound
 	}
-
-	return &scryfallCard, nil
+	return err
 }
 
 // convertScryfallCard converts Scryfall API response to internal Card model
-func (s *Service) convertScryfallCard(sc *ScryfallCard) *models.Card {
+func (s *Service) convertScryfallCard(sc *scryfall.Card) *models.Card {
 	card := &models.Card{
 		ID:              uuid.New().String(),
 		ScryfallID:      sc.ID,
@@ -161,9 +184,28 @@ func (s *Service) convertScryfallCard(sc *ScryfallCard) *models.Card {
 		TypeLine:        sc.TypeLine,
 		ManaCost:        sc.ManaCost,
 		Rarity:          sc.Rarity,
+		ReleasedAt:      sc.ReleasedAt,
+		ColorIdentity:   colorString(sc.ColorIdentity),
+		CMC:             sc.CMC,
+		Legalities:      sc.Legalities,
 		CreatedAt:       time.Now(),
 	}
 
+	// Multi-faced cards only list colors on their faces
+	colors := sc.Colors
+	if colors == nil {
+		for _, face := range sc.CardFaces {
+			faceColors, _ := face["colors"].([]interface{})
+			for _, c := range faceColors {
+				if c, ok := c.(string); ok {
+					colors = append(colors, c)
+				}
+			}
+		}
+	}
+	card.Colors = colorString(colors)
+	card.Prices = convertScryfallPrices(sc.Prices, card.CreatedAt)
+
 	// Get image URI
 	if sc.ImageURIs != nil {
 		if normal, ok := sc.ImageURIs["normal"]; ok {
@@ -183,13 +225,38 @@ func (s *Service) convertScryfallCard(sc *ScryfallCard) *models.Card {
 	return card
 }
 
-// rateLimit ensures we don't exceed Scryfall's rate limit
-func (s *Service) rateLimit() {
-	if !s.lastCall.IsZero() {
-		elapsed := time.Since(s.lastCall)
-		if elapsed < RateLimit {
-			time.Sleep(RateLimit - elapsed)
+// convertScryfallPrices converts a Scryfall prices object, whose values are
+// decimal strings or null when there is no price for that finish. It returns
+// nil when the payload had no prices object at all.
+func convertScryfallPrices(prices map[string]*string, updatedAt time.Time) []models.CardPrice {
+	if prices == nil {
+		return nil
+	}
+	result := []models.CardPrice{}
+	for _, f := range scryfallPriceFields {
+		v := prices[f.field]
+		if v == nil {
+			continue
+		}
+		price, err := strconv.ParseFloat(*v, 64)
+		if err != nil || price <= 0 {
+			continue
+		}
+		result = append(result, models.CardPrice{Currency: f.currency, Finish: f.finish, Price: price, UpdatedAt: updatedAt})
+	}
+	return result
+}
+
+// colorString encodes Scryfall colors as their WUBRG letters in WUBRG order
+func colorString(colors []string) string {
+	var b strings.Builder
+	for _, c := range "WUBRG" {
+		for _, color := range colors {
+			if strings.EqualFold(color, string(c)) {
+				b.WriteRune(c)
+				break
+			}
 		}
 	}
-	s.lastCall = time.Now()
+	return b.String()
 }
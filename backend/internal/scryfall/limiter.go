@@ -0,0 +1,76 @@
+package scryfall
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket shared by every caller of a client. Tokens refill
+// at a steady rate up to a burst; each request takes one, waiting its turn
+// when none are left. It is safe for concurrent use.
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration // time to refill one token
+	burst    int
+	tokens   float64
+	last     time.Time
+}
+
+// NewLimiter creates a limiter allowing rate requests per second with bursts
+// of up to burst requests. The bucket starts full.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		interval: time.Duration(float64(time.Second) / rate),
+		burst:    burst,
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or ctx is done. A caller that gives
+// up returns its token to the bucket.
+func (l *Limiter) Wait(ctx context.Context) error {
+	delay := l.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token, possibly one that hasn't refilled yet, and returns
+// how long to wait until it has. Later callers queue behind earlier ones.
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+	l.tokens = min(l.tokens, float64(l.burst))
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens * float64(l.interval))
+}
+
+// cancel gives back a reserved token that won't be used
+func (l *Limiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = min(l.tokens+1, float64(l.burst))
+}
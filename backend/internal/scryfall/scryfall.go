@@ -0,0 +1,376 @@
+// Package scryfall is a client for the Scryfall API. Every request of a client
+// goes through one shared rate limiter, and requests Scryfall turns away with
+// 429 Too Many Requests or a server error are retried with exponential
+// backoff, honoring Retry-After.
+package scryfall
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultBaseURL is the Scryfall API
+	DefaultBaseURL = "https://api.scryfall.com"
+	// DefaultRate is the request rate Scryfall asks clients to stay under, per second
+	DefaultRate = 10
+	// DefaultMaxRetries is how many times a turned away request is retried
+	DefaultMaxRetries = 3
+	// DefaultBackoff is the wait before the first retry, doubling for each one after
+	DefaultBackoff = 500 * time.Millisecond
+	// DefaultMaxBackoff caps the wait between retries
+	DefaultMaxBackoff = 10 * time.Second
+	// MaxCollectionSize is the most identifiers Scryfall takes per collection request
+	MaxCollectionSize = 75
+)
+
+// ErrNotFound is returned when Scryfall has no such card
+var ErrNotFound = errors.New("not found on scryfall")
+
+// Card is a card object returned by the Scryfall API
+type Card struct {
+	ID              string                   `json:"id"`
+	Name            string                   `json:"name"`
+	SetCode         string                   `json:"set"`
+	CollectorNumber string                   `json:"collector_number"`
+	Lang            string                   `json:"lang"`
+	ImageURIs       map[string]string        `json:"image_uris,omitempty"`
+	CardFaces       []map[string]interface{} `json:"card_faces,omitempty"`
+	OracleText      string                   `json:"oracle_text,omitempty"`
+	TypeLine        string                   `json:"type_line"`
+	ManaCost        string                   `json:"mana_cost,omitempty"`
+	Rarity          string                   `json:"rarity"`
+	Digital         bool                     `json:"digital"`
+	ReleasedAt      string                   `json:"released_at,omitempty"`
+	Colors          []string                 `json:"colors,omitempty"`
+	ColorIdentity   []string                 `json:"color_identity,omitempty"`
+	CMC             float64                  `json:"cmc"`
+	PrintsSearchURI string                   `json:"prints_search_uri,omitempty"`
+	Prices          map[string]*string       `json:"prices,omitempty"`
+	Legalities      map[string]string        `json:"legalities,omitempty"`
+}
+
+// List is a page of cards returned by Scryfall search endpoints
+type List struct {
+	Data     []Card `json:"data"`
+	HasMore  bool   `json:"has_more"`
+	NextPage string `json:"next_page"`
+}
+
+// Identifier names a card to fetch with Collection: by Scryfall ID, by exact
+// name optionally in a set, or by set and collector number
+type Identifier struct {
+	ID              string `json:"id,omitempty"`
+	Name            string `json:"name,omitempty"`
+	Set             string `json:"set,omitempty"`
+	CollectorNumber string `json:"collector_number,omitempty"`
+}
+
+// CollectionResult is the cards found for a collection request, in the order
+// of their identifiers, and the identifiers that matched none
+type CollectionResult struct {
+	Data     []Card       `json:"data"`
+	NotFound []Identifier `json:"not_found"`
+}
+
+// Error is an error response from the Scryfall API
+type Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Details string `json:"details"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("scryfall API error: %d - %s", e.Status, e.Details)
+}
+
+// Options configures a client. Zero values take the defaults.
+type Options struct {
+	BaseURL    string
+	Rate       float64 // requests per second
+	Burst      int
+	MaxRetries int // negative for none
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	HTTPClient *http.Client
+}
+
+// Client makes rate limited requests to the Scryfall API. It is safe for
+// concurrent use; share one client so all requests count against one limit.
+type Client struct {
+	baseURL    string
+	http       *http.Client
+	limiter    *Limiter
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// NewClient creates a client with the given options
+func NewClient(opts Options) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(opts.BaseURL, "/"),
+		http:       opts.HTTPClient,
+		maxRetries: opts.MaxRetries,
+		backoff:    opts.Backoff,
+		maxBackoff: opts.MaxBackoff,
+	}
+	if c.baseURL == "" {
+		c.baseURL = DefaultBaseURL
+	}
+	if c.http == nil {
+		c.http = &http.Client{Timeout: 10 * time.Second}
+	}
+	if c.maxRetries == 0 {
+		c.maxRetries = DefaultMaxRetries
+	}
+	if c.backoff == 0 {
+		c.backoff = DefaultBackoff
+	}
+	if c.maxBackoff == 0 {
+		c.maxBackoff = DefaultMaxBackoff
+	}
+	rate := opts.Rate
+	if rate <= 0 {
+		rate = DefaultRate
+	}
+	c.limiter = NewLimiter(rate, opts.Burst)
+	return c
+}
+
+// Wait takes a turn from the client's rate limit, for requests to Scryfall
+// made outside the client such as image downloads
+func (c *Client) Wait(ctx context.Context) error {
+	return c.limiter.Wait(ctx)
+}
+
+// CardBySetNumber fetches a printing by set code and collector number
+func (c *Client) CardBySetNumber(ctx context.Context, setCode, collectorNumber string) (*Card, error) {
+	var card Card
+	path := fmt.Sprintf("/cards/%s/%s", url.PathEscape(strings.ToLower(setCode)), url.PathEscape(collectorNumber))
+	if err := c.Get(ctx, path, &card); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// CardNamed fetches the card best matching a fuzzy name, optionally in a set
+func (c *Client) CardNamed(ctx context.Context, name, setCode string) (*Card, error) {
+	query := url.Values{"fuzzy": {name}}
+	if setCode != "" {
+		query.Set("set", setCode)
+	}
+	var card Card
+	if err := c.Get(ctx, "/cards/named?"+query.Encode(), &card); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// Search fetches the search results from a search URI Scryfall returned, such
+// as a card's PrintsSearchURI, following next_page until the last page
+func (c *Client) Search(ctx context.Context, searchURI string) (*List, error) {
+	result := &List{}
+	for next := searchURI; next != ""; {
+		var page List
+		if err := c.Get(ctx, next, &page); err != nil {
+			return nil, err
+		}
+		result.Data = append(result.Data, page.Data...)
+
+		next = ""
+		if page.HasMore {
+			next = page.NextPage
+		}
+	}
+	return result, nil
+}
+
+// Collection fetches the cards matching a list of identifiers, in requests
+// of up to MaxCollectionSize identifiers each
+func (c *Client) Collection(ctx context.Context, identifiers []Identifier) (*CollectionResult, error) {
+	result := &CollectionResult{}
+	for start := 0; start < len(identifiers); start += MaxCollectionSize {
+		end := min(start+MaxCollectionSize, len(identifiers))
+		body := struct {
+			Identifiers []Identifier `json:"identifiers"`
+		}{identifiers[start:end]}
+
+		var page CollectionResult
+		if err := c.post(ctx, "/cards/collection", body, &page); err != nil {
+			return nil, err
+		}
+		result.Data = append(result.Data, page.Data...)
+		result.NotFound = append(result.NotFound, page.NotFound...)
+	}
+	return result, nil
+}
+
+// Get requests a path under the base URL, or an absolute URL, and decodes
+// the JSON response into v. A 404 returns ErrNotFound and other error
+// responses an *Error.
+func (c *Client) Get(ctx context.Context, path string, v interface{}) error {
+	target := c.url(path)
+	resp, err := c.do(ctx, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	})
+	if err != nil {
+		return err
+	}
+	return decode(resp, v)
+}
+
+// post sends body as JSON to a path under the base URL and decodes the JSON
+// response into v, failing as Get does
+func (c *Client) post(ctx context.Context, path string, body, v interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	target := c.url(path)
+	resp, err := c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	return decode(resp, v)
+}
+
+// url resolves a path under the base URL, leaving absolute URLs as they are
+func (c *Client) url(path string) string {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return c.baseURL + path
+}
+
+// decode decodes a JSON response into v, closing its body
+func decode(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// do sends a request built by newRequest, waiting for the rate limit before
+// each attempt and retrying rate limited and failed attempts. It returns the
+// response of the first successful attempt.
+func (c *Client) do(ctx context.Context, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		req, err := newRequest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", "mtg-card-detector/1.0")
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if attempt >= c.maxRetries {
+				return nil, fmt.Errorf("failed to make request: %w", err)
+			}
+			if err := sleep(ctx, c.retryDelay(attempt, nil)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+
+		apiErr := readError(resp)
+		if apiErr.Status == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		if !retryable(apiErr.Status) || attempt >= c.maxRetries {
+			return nil, apiErr
+		}
+		if err := sleep(ctx, c.retryDelay(attempt, resp)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryable reports whether a response status is worth retrying
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// retryDelay is how long to wait before retrying: what the response's
+// Retry-After asks for, or else an exponential backoff
+func (c *Client) retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return d
+		}
+	}
+	delay := c.backoff << attempt
+	if delay <= 0 || delay > c.maxBackoff {
+		delay = c.maxBackoff
+	}
+	return delay
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// readError reads an error response, closing its body
+func readError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	apiErr := &Error{}
+	if json.Unmarshal(body, apiErr) != nil || apiErr.Details == "" {
+		apiErr.Details = string(body)
+	}
+	apiErr.Status = resp.StatusCode
+	return apiErr
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,218 @@
+package scryfall
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client for a stand-in Scryfall server with short
+// backoffs and no rate limit to speak of
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewClient(Options{BaseURL: server.URL, Rate: 1000, Burst: 100, Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"object": "error", "code": "rate_limited", "status": 429, "details": "slow down"}`))
+		default:
+			if r.URL.Path != "/cards/m10/146" {
+				t.Errorf("Unexpected path %s", r.URL.Path)
+			}
+			w.Write([]byte(`{"id": "abc", "name": "Lightning Bolt", "set": "m10", "collector_number": "146"}`))
+		}
+	})
+
+	start := time.Now()
+	card, err := client.CardBySetNumber(context.Background(), "M10", "146")
+	if err != nil {
+		t.Fatalf("Failed to fetch card: %v", err)
+	}
+	if card.Name != "Lightning Bolt" || calls != 3 {
+		t.Errorf("Expected the card after 3 calls, got %+v after %d", card, calls)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected Retry-After to be honored, retried after %v", elapsed)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	var calls int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch r.URL.Path {
+		case "/cards/named":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"object": "error", "code": "not_found", "status": 404, "details": "No cards found"}`))
+		case "/cards/bad/1":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"object": "error", "code": "bad_request", "status": 400, "details": "Invalid set"}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	})
+
+	if _, err := client.CardNamed(context.Background(), "Lightning Blot", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+
+	var apiErr *Error
+	if _, err := client.CardBySetNumber(context.Background(), "bad", "1"); !errors.As(err, &apiErr) || apiErr.Details != "Invalid set" {
+		t.Errorf("Expected bad request error, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected client errors not to be retried, got %d calls", calls)
+	}
+
+	// Server errors are retried until the retries run out
+	calls = 0
+	if _, err := client.CardBySetNumber(context.Background(), "m10", "146"); !errors.As(err, &apiErr) || apiErr.Status != http.StatusBadGateway {
+		t.Errorf("Expected bad gateway error, got %v", err)
+	}
+	if calls != DefaultMaxRetries+1 {
+		t.Errorf("Expected %d calls, got %d", DefaultMaxRetries+1, calls)
+	}
+}
+
+func TestClientCollection(t *testing.T) {
+	var calls int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Method != http.MethodPost || r.URL.Path != "/cards/collection" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var body struct {
+			Identifiers []Identifier `json:"identifiers"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if len(body.Identifiers) > MaxCollectionSize {
+			t.Errorf("Expected at most %d identifiers, got %d", MaxCollectionSize, len(body.Identifiers))
+		}
+
+		// Every tenth card is unknown
+		var result CollectionResult
+		for _, id := range body.Identifiers {
+			if id.CollectorNumber[len(id.CollectorNumber)-1] == '0' {
+				result.NotFound = append(result.NotFound, id)
+				continue
+			}
+			result.Data = append(result.Data, Card{Name: "Card " + id.CollectorNumber, SetCode: id.Set, CollectorNumber: id.CollectorNumber})
+		}
+		json.NewEncoder(w).Encode(result)
+	})
+
+	identifiers := make([]Identifier, 100)
+	for i := range identifiers {
+		identifiers[i] = Identifier{Set: "m10", CollectorNumber: fmt.Sprint(i + 1)}
+	}
+	result, err := client.Collection(context.Background(), identifiers)
+	if err != nil {
+		t.Fatalf("Failed to fetch collection: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 requests, got %d", calls)
+	}
+	if len(result.Data) != 90 || len(result.NotFound) != 10 {
+		t.Fatalf("Expected 90 cards and 10 not found, got %d and %d", len(result.Data), len(result.NotFound))
+	}
+	if result.Data[0].CollectorNumber != "1" || result.Data[89].CollectorNumber != "99" || result.NotFound[9].CollectorNumber != "100" {
+		t.Errorf("Expected results in identifier order, got %+v", result)
+	}
+}
+
+func TestClientSearch(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Three pages of two printings each
+		page := 1
+		fmt.Sscan(r.URL.Query().Get("page"), &page)
+		list := List{Data: []Card{
+			{Name: "Plains", CollectorNumber: fmt.Sprint(page*2 - 1)},
+			{Name: "Plains", CollectorNumber: fmt.Sprint(page * 2)},
+		}}
+		if page < 3 {
+			list.HasMore = true
+			list.NextPage = fmt.Sprintf("%s/cards/search?q=plains&page=%d", server.URL, page+1)
+		}
+		json.NewEncoder(w).Encode(list)
+	}))
+	t.Cleanup(server.Close)
+	client := NewClient(Options{BaseURL: server.URL, Rate: 1000, Burst: 100})
+
+	list, err := client.Search(context.Background(), server.URL+"/cards/search?q=plains")
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(list.Data) != 6 || list.Data[5].CollectorNumber != "6" {
+		t.Errorf("Expected the printings of every page, got %+v", list.Data)
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.CardNamed(ctx, "Lightning Bolt", ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the backoff to stop with the context, took %v", elapsed)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	// After the burst, concurrent callers share the rate between them
+	limiter := NewLimiter(100, 2)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := limiter.Wait(context.Background()); err != nil {
+				t.Errorf("Failed to wait: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected 10 requests past the burst to take 100ms, took %v", elapsed)
+	}
+
+	// A caller that gives up doesn't hold up the next one
+	limiter = NewLimiter(10, 1)
+	limiter.Wait(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancelled wait, got %v", err)
+	}
+	start = time.Now()
+	limiter.Wait(context.Background())
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("Expected the cancelled token back, waited %v", elapsed)
+	}
+}
@@ -0,0 +1,9 @@
+-- Perceptual hash index of card artwork for image recognition
+
+CREATE TABLE IF NOT EXISTS card_image_hashes (
+    card_id TEXT PRIMARY KEY,
+    phash INTEGER NOT NULL,
+    dhash INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (card_id) REFERENCES cards(id) ON DELETE CASCADE
+);
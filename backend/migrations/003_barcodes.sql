@@ -0,0 +1,15 @@
+-- Barcode mappings for card and sealed product scans
+
+CREATE TABLE IF NOT EXISTS barcodes (
+    code TEXT PRIMARY KEY,
+    kind TEXT NOT NULL, -- 'upc', 'ean', 'arena' or 'mtgo'
+    card_id TEXT, -- set when the barcode identifies a single card
+    product_name TEXT, -- set when the barcode identifies sealed product
+    added_by TEXT, -- user who taught the mapping, NULL for imports
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (card_id) REFERENCES cards(id) ON DELETE CASCADE,
+    FOREIGN KEY (added_by) REFERENCES users(id) ON DELETE SET NULL,
+    CHECK (card_id IS NOT NULL OR product_name IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_barcodes_card_id ON barcodes(card_id);
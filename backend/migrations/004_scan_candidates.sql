@@ -0,0 +1,23 @@
+-- Printing disambiguation: release dates and individually tracked scans
+
+ALTER TABLE cards ADD COLUMN released_at TEXT;
+
+-- Scans table - every scan and its outcome; ambiguous scans wait here for confirmation
+CREATE TABLE IF NOT EXISTS scans (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    session_id INTEGER,
+    status TEXT NOT NULL, -- 'committed', 'pending' or 'failed'
+    card_id TEXT, -- the committed printing
+    request TEXT, -- JSON scan request
+    candidates TEXT, -- JSON array of candidate card IDs and confidences
+    error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    resolved_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (session_id) REFERENCES scan_sessions(id) ON DELETE SET NULL,
+    FOREIGN KEY (card_id) REFERENCES cards(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_scans_user_status ON scans(user_id, status);
+CREATE INDEX IF NOT EXISTS idx_scans_session_id ON scans(session_id);
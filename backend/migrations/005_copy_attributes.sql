@@ -0,0 +1,29 @@
+-- Per-copy attributes: copies of a printing differing in finish, condition,
+-- language or flags are tracked as separate inventory entries.
+-- SQLite can't change a UNIQUE constraint in place, so the table is rebuilt.
+
+CREATE TABLE inventory_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    card_id TEXT NOT NULL,
+    quantity INTEGER DEFAULT 1,
+    finish TEXT NOT NULL DEFAULT 'nonfoil', -- 'nonfoil', 'foil' or 'etched'
+    condition TEXT NOT NULL DEFAULT 'NM', -- 'NM', 'LP', 'MP', 'HP' or 'DMG'
+    language TEXT NOT NULL DEFAULT 'en',
+    signed INTEGER NOT NULL DEFAULT 0,
+    altered INTEGER NOT NULL DEFAULT 0,
+    misprint INTEGER NOT NULL DEFAULT 0,
+    added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (card_id) REFERENCES cards(id) ON DELETE CASCADE,
+    UNIQUE(user_id, card_id, finish, condition, language, signed, altered, misprint)
+);
+
+INSERT INTO inventory_new (id, user_id, card_id, quantity, added_at)
+SELECT id, user_id, card_id, quantity, added_at FROM inventory;
+
+DROP TABLE inventory;
+ALTER TABLE inventory_new RENAME TO inventory;
+
+CREATE INDEX IF NOT EXISTS idx_inventory_user_id ON inventory(user_id);
+CREATE INDEX IF NOT EXISTS idx_inventory_card_id ON inventory(card_id);
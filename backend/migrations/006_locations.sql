@@ -0,0 +1,38 @@
+-- Storage locations: binders, boxes and deck boxes, optionally nested, and how
+-- many copies of each inventory entry are stored in them. Copies not placed
+-- anywhere are the entry's quantity minus its placed quantities.
+
+CREATE TABLE IF NOT EXISTS locations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    parent_id INTEGER, -- enclosing location, e.g. the box a deck box sits in
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL, -- 'binder', 'box' or 'deck_box'
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (parent_id) REFERENCES locations(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_locations_user_id ON locations(user_id);
+CREATE INDEX IF NOT EXISTS idx_locations_parent_id ON locations(parent_id);
+
+-- Inventory placements - page and slot are 0 when not tracked
+CREATE TABLE IF NOT EXISTS inventory_locations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    inventory_id INTEGER NOT NULL,
+    location_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,
+    page INTEGER NOT NULL DEFAULT 0,
+    slot INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (inventory_id) REFERENCES inventory(id) ON DELETE CASCADE,
+    FOREIGN KEY (location_id) REFERENCES locations(id) ON DELETE CASCADE,
+    UNIQUE(inventory_id, location_id, page, slot)
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_locations_location_id ON inventory_locations(location_id);
+
+-- Where a user's scans currently land
+ALTER TABLE users ADD COLUMN current_location_id INTEGER REFERENCES locations(id) ON DELETE SET NULL;
+
+-- Where a scan lands once committed
+ALTER TABLE scans ADD COLUMN location_id INTEGER REFERENCES locations(id) ON DELETE SET NULL;
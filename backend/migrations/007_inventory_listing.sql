@@ -0,0 +1,9 @@
+-- Card colors and mana value for inventory filters, and indexes for paging
+-- through large inventories in each sort order
+
+ALTER TABLE cards ADD COLUMN colors TEXT; -- WUBRG letters, e.g. 'UR'; empty for colorless
+ALTER TABLE cards ADD COLUMN color_identity TEXT; -- WUBRG letters
+ALTER TABLE cards ADD COLUMN cmc REAL;
+
+CREATE INDEX IF NOT EXISTS idx_inventory_user_added_at ON inventory(user_id, added_at, id);
+CREATE INDEX IF NOT EXISTS idx_inventory_user_quantity ON inventory(user_id, quantity, id);
@@ -0,0 +1,21 @@
+-- When each user's inventory last changed, maintained by triggers so every
+-- insert, quantity change and removal is covered
+
+ALTER TABLE users ADD COLUMN inventory_updated_at DATETIME;
+
+UPDATE users SET inventory_updated_at = (SELECT MAX(added_at) FROM inventory WHERE inventory.user_id = users.id);
+
+CREATE TRIGGER IF NOT EXISTS inventory_touch_insert AFTER INSERT ON inventory
+BEGIN
+    UPDATE users SET inventory_updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = NEW.user_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS inventory_touch_update AFTER UPDATE ON inventory
+BEGIN
+    UPDATE users SET inventory_updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = NEW.user_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS inventory_touch_delete AFTER DELETE ON inventory
+BEGIN
+    UPDATE users SET inventory_updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE id = OLD.user_id;
+END;
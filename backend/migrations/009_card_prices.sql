@@ -0,0 +1,12 @@
+-- Latest market price of each printing per currency and finish, as reported
+-- by Scryfall. A missing row means Scryfall has no price for that finish.
+
+CREATE TABLE IF NOT EXISTS card_prices (
+    card_id TEXT NOT NULL,
+    currency TEXT NOT NULL, -- 'usd' or 'eur'
+    finish TEXT NOT NULL,   -- 'nonfoil', 'foil' or 'etched'
+    price REAL NOT NULL,
+    updated_at DATETIME NOT NULL,
+    FOREIGN KEY (card_id) REFERENCES cards(id) ON DELETE CASCADE,
+    PRIMARY KEY (card_id, currency, finish)
+);
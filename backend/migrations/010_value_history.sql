@@ -0,0 +1,23 @@
+-- Daily snapshots of card prices and inventory values, recorded by the
+-- catalog snapshot-values command. Dates are YYYY-MM-DD in UTC.
+
+CREATE TABLE IF NOT EXISTS card_price_history (
+    card_id TEXT NOT NULL,
+    currency TEXT NOT NULL,
+    finish TEXT NOT NULL,
+    date TEXT NOT NULL,
+    price REAL NOT NULL,
+    FOREIGN KEY (card_id) REFERENCES cards(id) ON DELETE CASCADE,
+    PRIMARY KEY (card_id, currency, finish, date)
+);
+
+CREATE TABLE IF NOT EXISTS inventory_value_history (
+    user_id TEXT NOT NULL,
+    currency TEXT NOT NULL,
+    date TEXT NOT NULL,
+    total REAL NOT NULL,
+    priced_cards INTEGER NOT NULL,
+    unpriced_cards INTEGER NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, currency, date)
+);
@@ -0,0 +1,25 @@
+-- Decklists, compared against the owner's inventory
+
+CREATE TABLE IF NOT EXISTS decks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_decks_user_id ON decks(user_id);
+
+-- A card_id pins the line to one printing; without one any printing will do
+CREATE TABLE IF NOT EXISTS deck_cards (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    deck_id INTEGER NOT NULL,
+    section TEXT NOT NULL, -- 'mainboard', 'sideboard' or 'commander'
+    name TEXT NOT NULL,
+    card_id TEXT,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    FOREIGN KEY (deck_id) REFERENCES decks(id) ON DELETE CASCADE,
+    FOREIGN KEY (card_id) REFERENCES cards(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_deck_cards_deck_id ON deck_cards(deck_id);
@@ -0,0 +1,5 @@
+-- Format legalities from Scryfall, and the format a deck is built for
+
+ALTER TABLE cards ADD COLUMN legalities TEXT; -- JSON object, e.g. {"modern": "legal", "legacy": "banned"}
+
+ALTER TABLE decks ADD COLUMN format TEXT;
@@ -0,0 +1,31 @@
+-- Cards users want, ticked off as scans add them, and inventory copies they
+-- offer for trade
+
+CREATE TABLE IF NOT EXISTS wishlist (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    card_id TEXT, -- NULL for any printing of the card
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    acquired INTEGER NOT NULL DEFAULT 0,
+    max_price REAL,
+    currency TEXT NOT NULL DEFAULT 'usd',
+    min_condition TEXT, -- NULL for any condition
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (card_id) REFERENCES cards(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_wishlist_user_name ON wishlist(user_id, name);
+
+CREATE TABLE IF NOT EXISTS trade_list (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    inventory_id INTEGER NOT NULL UNIQUE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (inventory_id) REFERENCES inventory(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_trade_list_user_id ON trade_list(user_id);
@@ -0,0 +1,48 @@
+-- Users agreeing to trade with each other, and the trades they propose. A
+-- pair can be matched once each has added the other as a partner.
+
+CREATE TABLE IF NOT EXISTS trade_partners (
+    user_id TEXT NOT NULL,
+    partner_id TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, partner_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (partner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS trades (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    proposer_id TEXT NOT NULL,
+    partner_id TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'proposed', -- 'proposed', 'accepted', 'declined' or 'cancelled'
+    currency TEXT NOT NULL DEFAULT 'usd',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    resolved_at DATETIME,
+    FOREIGN KEY (proposer_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (partner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_trades_proposer_id ON trades(proposer_id);
+CREATE INDEX IF NOT EXISTS idx_trades_partner_id ON trades(partner_id);
+
+-- Copies changing hands. The card and copy attributes are recorded so the
+-- trade reads the same after the inventory entry is gone.
+CREATE TABLE IF NOT EXISTS trade_items (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    trade_id INTEGER NOT NULL,
+    from_user_id TEXT NOT NULL,
+    inventory_id INTEGER NOT NULL,
+    card_id TEXT NOT NULL,
+    finish TEXT NOT NULL,
+    condition TEXT NOT NULL,
+    language TEXT NOT NULL,
+    signed INTEGER NOT NULL DEFAULT 0,
+    altered INTEGER NOT NULL DEFAULT 0,
+    misprint INTEGER NOT NULL DEFAULT 0,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price REAL, -- in the trade's currency when proposed, NULL if unknown
+    FOREIGN KEY (trade_id) REFERENCES trades(id) ON DELETE CASCADE,
+    FOREIGN KEY (card_id) REFERENCES cards(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_trade_items_trade_id ON trade_items(trade_id);
@@ -0,0 +1,36 @@
+-- Append-only ledger of inventory changes. Summing a user's deltas per card
+-- and copy attributes rebuilds their inventory quantities.
+
+CREATE TABLE IF NOT EXISTS inventory_ledger (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    card_id TEXT NOT NULL,
+    finish TEXT NOT NULL,
+    condition TEXT NOT NULL,
+    language TEXT NOT NULL,
+    signed INTEGER NOT NULL DEFAULT 0,
+    altered INTEGER NOT NULL DEFAULT 0,
+    misprint INTEGER NOT NULL DEFAULT 0,
+    delta INTEGER NOT NULL CHECK (delta <> 0),
+    source TEXT NOT NULL, -- 'scan', 'import', 'manual', 'trade', 'undo' or 'initial'
+    session_id INTEGER, -- scan session of a scan
+    trade_id INTEGER, -- trade that moved the copies
+    reverts_id INTEGER UNIQUE, -- entry an undo reverses
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (reverts_id) REFERENCES inventory_ledger(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_ledger_user_id ON inventory_ledger(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_inventory_ledger_session_id ON inventory_ledger(session_id);
+
+CREATE TRIGGER IF NOT EXISTS inventory_ledger_append_only BEFORE UPDATE ON inventory_ledger
+BEGIN
+    SELECT RAISE(ABORT, 'inventory ledger is append-only');
+END;
+
+-- Quantities held before the ledger existed
+INSERT INTO inventory_ledger (user_id, card_id, finish, condition, language, signed, altered, misprint, delta, source, created_at)
+SELECT user_id, card_id, finish, condition, language, signed, altered, misprint, quantity, 'initial', added_at
+FROM inventory
+WHERE quantity > 0;
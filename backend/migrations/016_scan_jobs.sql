@@ -0,0 +1,31 @@
+-- Background bulk scan jobs. The queue lives here so jobs interrupted by a
+-- restart resume where they left off.
+
+CREATE TABLE IF NOT EXISTS scan_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    session_id INTEGER, -- scan session the job's scans are recorded in
+    status TEXT NOT NULL, -- 'queued', 'running', 'completed' or 'failed'
+    request TEXT, -- JSON bulk scan request, cleared once the job is done
+    total INTEGER NOT NULL,
+    processed INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    started_at DATETIME,
+    completed_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (session_id) REFERENCES scan_sessions(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_scan_jobs_status ON scan_jobs(status, id);
+
+-- The result of each of a job's scans, by its position in the request
+CREATE TABLE IF NOT EXISTS scan_job_results (
+    job_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    status TEXT, -- scan status, NULL for sealed product and errors
+    success INTEGER NOT NULL,
+    result TEXT NOT NULL, -- JSON scan response
+    PRIMARY KEY (job_id, position),
+    FOREIGN KEY (job_id) REFERENCES scan_jobs(id) ON DELETE CASCADE
+);
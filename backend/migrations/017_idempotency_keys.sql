@@ -0,0 +1,15 @@
+-- Client-supplied idempotency keys and the response first returned for them,
+-- so retried scan submissions don't add cards twice
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id TEXT NOT NULL,
+    key TEXT NOT NULL, -- namespaced by what it deduplicates, e.g. 'scan:<client_scan_id>'
+    fingerprint TEXT NOT NULL, -- hash of the request the key was first used with
+    response TEXT, -- JSON response, NULL while the first request is in progress
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    PRIMARY KEY (user_id, key),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
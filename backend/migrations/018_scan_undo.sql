@@ -0,0 +1,8 @@
+-- Links a scan's ledger entry to its scan and the scan to the wishlist item
+-- its copy ticked off, so undoing the entry takes both back too. Undone scans
+-- get status 'undone'.
+
+-- No foreign key: deleting a scan would have to update the append-only ledger
+ALTER TABLE inventory_ledger ADD COLUMN scan_id INTEGER; -- scan that added the copy
+
+ALTER TABLE scans ADD COLUMN wishlist_id INTEGER REFERENCES wishlist(id) ON DELETE SET NULL; -- wishlist item the copy ticked off